@@ -0,0 +1,126 @@
+package relish
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"sort"
+)
+
+// Canonicalize rewrites a valid encoding into canonical form, the form an
+// Encoder produces with SetCanonical(true): map entries in ascending order
+// of their encoded key bytes, a single NaN bit pattern, negative zero
+// written as positive zero, and every length prefix in its shortest form.
+// Two encodings of the same value canonicalize to identical bytes.
+//
+// Invalid input is rejected with the first error Validate reports. Maps
+// whose keys only become equal once canonicalized (such as two NaNs with
+// different payloads) are rejected with ErrDuplicateMapKey.
+func Canonicalize(data []byte) ([]byte, error) {
+	if err := firstError(Validate(data)); err != nil {
+		return nil, err
+	}
+	t, c, _, err := splitValue(data)
+	if err != nil {
+		return nil, err
+	}
+	cc, err := canonicalContent(t, c)
+	if err != nil {
+		return nil, err
+	}
+	return appendValue(make([]byte, 0, len(data)), t, cc), nil
+}
+
+// canonicalContent returns the canonical form of content c of a value of
+// type t. c must already be valid.
+func canonicalContent(t byte, c []byte) ([]byte, error) {
+	switch TypeID(t) {
+	case TypeF32:
+		out := make([]byte, 4)
+		f := canonicalF32(math.Float32frombits(binary.LittleEndian.Uint32(c)))
+		binary.LittleEndian.PutUint32(out, math.Float32bits(f))
+		return out, nil
+	case TypeF64:
+		out := make([]byte, 8)
+		f := canonicalF64(math.Float64frombits(binary.LittleEndian.Uint64(c)))
+		binary.LittleEndian.PutUint64(out, math.Float64bits(f))
+		return out, nil
+	case TypeArray:
+		et := c[0]
+		out := []byte{et}
+		for rest := c[1:]; len(rest) > 0; {
+			ec, r, err := splitElem(et, rest)
+			if err != nil {
+				return nil, err
+			}
+			rest = r
+			cc, err := canonicalContent(et, ec)
+			if err != nil {
+				return nil, err
+			}
+			out = appendElem(out, et, cc)
+		}
+		return out, nil
+	case TypeMap:
+		return canonicalMap(c)
+	case TypeStruct:
+		var out []byte
+		for rest := c; len(rest) > 0; {
+			id := rest[0]
+			ft, fc, r, err := splitValue(rest[1:])
+			if err != nil {
+				return nil, err
+			}
+			rest = r
+			cc, err := canonicalContent(ft, fc)
+			if err != nil {
+				return nil, err
+			}
+			out = appendValue(append(out, id), ft, cc)
+		}
+		return out, nil
+	case TypeEnum:
+		vt, vc, _, err := splitValue(c[1:])
+		if err != nil {
+			return nil, err
+		}
+		cc, err := canonicalContent(vt, vc)
+		if err != nil {
+			return nil, err
+		}
+		return appendValue([]byte{c[0]}, vt, cc), nil
+	default:
+		return c, nil
+	}
+}
+
+func canonicalMap(c []byte) ([]byte, error) {
+	kt, vt := c[0], c[1]
+	type pair struct{ k, v []byte }
+	var pairs []pair
+	for rest := c[2:]; len(rest) > 0; {
+		kc, vc, r, err := splitEntry(kt, vt, rest)
+		if err != nil {
+			return nil, err
+		}
+		rest = r
+		ck, err := canonicalContent(kt, kc)
+		if err != nil {
+			return nil, err
+		}
+		cv, err := canonicalContent(vt, vc)
+		if err != nil {
+			return nil, err
+		}
+		pairs = append(pairs, pair{appendElem(nil, kt, ck), appendElem(nil, vt, cv)})
+	}
+	sort.Slice(pairs, func(i, j int) bool { return bytes.Compare(pairs[i].k, pairs[j].k) < 0 })
+	out := []byte{kt, vt}
+	for i, p := range pairs {
+		if i > 0 && bytes.Equal(p.k, pairs[i-1].k) {
+			return nil, &Error{Kind: ErrDuplicateMapKey, Detail: "keys are equal in canonical form"}
+		}
+		out = append(append(out, p.k...), p.v...)
+	}
+	return out, nil
+}
@@ -0,0 +1,76 @@
+package relish
+
+import (
+	"bytes"
+	"math"
+	"testing"
+)
+
+func TestEncoder_Canonical(t *testing.T) {
+	m := map[string]uint8{"bb": 2, "a": 1, "c": 3}
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	enc.SetCanonical(true)
+	if err := enc.Encode(m); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	// Keys sort by their encoded bytes, length prefix included.
+	want := []byte{0x10, 0x18, 0x0E, 0x02, 0x02, 'a', 0x01, 0x02, 'c', 0x03, 0x04, 'b', 'b', 0x02}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got %x want %x", buf.Bytes(), want)
+	}
+
+	buf.Reset()
+	if err := enc.Encode([]float64{math.Copysign(0, -1), math.Float64frombits(0x7FF0000000000001)}); err != nil {
+		t.Fatalf("encode: %v", err)
+	}
+	want = []byte{0x0F, 0x22, 0x0D,
+		0, 0, 0, 0, 0, 0, 0, 0,
+		0, 0, 0, 0, 0, 0, 0xF8, 0x7F,
+	}
+	if !bytes.Equal(buf.Bytes(), want) {
+		t.Fatalf("got %x want %x", buf.Bytes(), want)
+	}
+
+	// Distinct NaN keys collide once canonicalized.
+	nans := map[float32]bool{float32(math.NaN()): true, math.Float32frombits(0x7FC00001): false}
+	if err := enc.Encode(nans); err == nil || err.(*Error).Kind != ErrDuplicateMapKey {
+		t.Fatalf("expected ErrDuplicateMapKey, got %v", err)
+	}
+}
+
+func TestCanonicalize(t *testing.T) {
+	// struct{0: map<u8,f32>{2: -0.0, 1: NaN}} with a long-form outer length.
+	in := []byte{0x11, 0x1F, 0x00, 0x00, 0x00, 0x00,
+		0x10, 0x18, 0x02, 0x0C,
+		0x02, 0x00, 0x00, 0x00, 0x80,
+		0x01, 0x01, 0x00, 0xC0, 0x7F,
+	}
+	want := []byte{0x11, 0x1E, 0x00,
+		0x10, 0x18, 0x02, 0x0C,
+		0x01, 0x00, 0x00, 0xC0, 0x7F,
+		0x02, 0x00, 0x00, 0x00, 0x00,
+	}
+	got, err := Canonicalize(in)
+	if err != nil {
+		t.Fatalf("Canonicalize: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Fatalf("got %x want %x", got, want)
+	}
+	again, err := Canonicalize(got)
+	if err != nil || !bytes.Equal(again, got) {
+		t.Fatalf("not idempotent: %x, %v", again, err)
+	}
+
+	dup := []byte{0x10, 0x14, 0x0C, 0x00,
+		0x01, 0x00, 0xC0, 0x7F,
+		0x02, 0x00, 0xC0, 0x7F,
+	}
+	if _, err := Canonicalize(dup); err == nil || err.(*Error).Kind != ErrDuplicateMapKey {
+		t.Fatalf("expected ErrDuplicateMapKey, got %v", err)
+	}
+	if _, err := Canonicalize([]byte{0x0E, 0x02, 0xFF}); err == nil || err.(*Error).Kind != ErrInvalidUTF8 {
+		t.Fatalf("expected ErrInvalidUTF8, got %v", err)
+	}
+}
@@ -0,0 +1,67 @@
+// Command go2rust generates Rust types for the relish crate from Go
+// types with relish tags.
+//
+// Usage:
+//
+//	go2rust [-dir dir] [-o file] [Type...]
+//
+// go2rust reads the Go package in dir, the current directory by default,
+// and writes Rust definitions of the named types, and of every struct
+// they use, to the -o file or standard output. Without type names it
+// translates every struct type that has a relish-tagged field. See
+// package github.com/dadrian/relish/rust for the type mapping.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/dadrian/relish"
+	"github.com/dadrian/relish/gosrc"
+	"github.com/dadrian/relish/rust"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "read the Go package in `dir`")
+	out := flag.String("o", "", "write output to `file` instead of standard output")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: go2rust [-dir dir] [-o file] [Type...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if err := run(*dir, *out, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "go2rust:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, out string, names []string) error {
+	pkg, err := gosrc.ParseDir(dir)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		names = pkg.TaggedTypes()
+		if len(names) == 0 {
+			return fmt.Errorf("no relish-tagged struct types in package %s", pkg.Name)
+		}
+	}
+	var schemas []relish.Schema
+	for _, n := range names {
+		s, err := pkg.Schema(n)
+		if err != nil {
+			return err
+		}
+		schemas = append(schemas, s)
+	}
+	src, err := rust.Generate(schemas...)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(out, src, 0o666)
+}
@@ -0,0 +1,109 @@
+// Command proto2go generates Go types with relish tags from Protocol
+// Buffers message definitions.
+//
+// Usage:
+//
+//	proto2go [-pkg name] [-o file] [-report file] file.proto...
+//
+// The files are converted together, so a file's imports should be listed
+// with it. proto2go writes Go declarations of every message to the -o file
+// or standard output, and lists the constructs that have no Relish
+// equivalent, such as services and options, on standard error or in the
+// -report file. See package github.com/dadrian/relish/protoimport for how
+// messages are converted.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/dadrian/relish/idl"
+	"github.com/dadrian/relish/protoimport"
+)
+
+func main() {
+	pkg := flag.String("pkg", "", "Go package `name` (default: the output directory's name, or \"schema\")")
+	out := flag.String("o", "", "write output to `file` instead of standard output")
+	report := flag.String("report", "", "write the conversion report to `file` instead of standard error")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: proto2go [-pkg name] [-o file] [-report file] file.proto...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Args(), *pkg, *out, *report); err != nil {
+		var list idl.ErrorList
+		if errors.As(err, &list) {
+			for _, e := range list {
+				fmt.Fprintln(os.Stderr, e)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, "proto2go:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(files []string, pkg, out, report string) error {
+	var (
+		parsed []*protoimport.File
+		errs   idl.ErrorList
+	)
+	for _, name := range files {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		f, err := protoimport.Parse(name, src)
+		if err != nil {
+			errs = append(errs, err.(idl.ErrorList)...)
+		}
+		parsed = append(parsed, f)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	res, err := protoimport.Convert(parsed...)
+	if err != nil {
+		return err
+	}
+	if len(res.Schema.Decls) == 0 {
+		return fmt.Errorf("no messages in %s", res.Schema.Name)
+	}
+	if pkg == "" {
+		pkg = "schema"
+		if out != "" {
+			if abs, err := filepath.Abs(out); err == nil {
+				pkg = filepath.Base(filepath.Dir(abs))
+			}
+		}
+	}
+	src, err := res.GenerateGo(pkg)
+	if err != nil {
+		return err
+	}
+	var w io.Writer = os.Stderr
+	if report != "" {
+		rf, err := os.Create(report)
+		if err != nil {
+			return err
+		}
+		defer rf.Close()
+		w = rf
+	}
+	for _, n := range res.Notes {
+		fmt.Fprintln(w, n)
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(out, src, 0o666)
+}
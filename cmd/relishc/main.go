@@ -0,0 +1,88 @@
+// Command relishc compiles Relish schema files to Go.
+//
+// Usage:
+//
+//	relishc [-pkg name] [-o file] schema.relish...
+//
+// The files are read as one schema, so types declared in one may be used
+// in another. relishc checks the schema and writes Go declarations of its
+// types, with relish struct tags, to the -o file or standard output. See
+// package github.com/dadrian/relish/idl for the schema language.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dadrian/relish/idl"
+)
+
+func main() {
+	pkg := flag.String("pkg", "", "Go package `name` (default: the output directory's name, or \"schema\")")
+	out := flag.String("o", "", "write output to `file` instead of standard output")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: relishc [-pkg name] [-o file] schema.relish...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Args(), *pkg, *out); err != nil {
+		var list idl.ErrorList
+		if errors.As(err, &list) {
+			for _, e := range list {
+				fmt.Fprintln(os.Stderr, e)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, "relishc:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(files []string, pkg, out string) error {
+	schema := &idl.File{Name: filepath.Base(files[0])}
+	if len(files) > 1 {
+		schema.Name = fmt.Sprintf("%s and %d more files", schema.Name, len(files)-1)
+	}
+	var errs idl.ErrorList
+	for _, name := range files {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		f, err := idl.Parse(name, src)
+		if err != nil {
+			errs = append(errs, err.(idl.ErrorList)...)
+		}
+		schema.Decls = append(schema.Decls, f.Decls...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	if err := idl.Check(schema); err != nil {
+		return err
+	}
+	if pkg == "" {
+		pkg = "schema"
+		if out != "" {
+			if abs, err := filepath.Abs(out); err == nil {
+				pkg = filepath.Base(filepath.Dir(abs))
+			}
+		}
+	}
+	src, err := idl.GenerateGo(schema, pkg)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(out, src, 0o666)
+}
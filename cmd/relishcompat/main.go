@@ -0,0 +1,99 @@
+// Command relishcompat checks that a new version of a Relish type can
+// exchange data with the old one.
+//
+// Usage:
+//
+//	relishcompat [-type name] old new
+//
+// Each of old and new is one of:
+//
+//   - a directory, read as a Go package; -type names a struct type in it
+//   - a .relish schema file; -type names a type it declares
+//   - a file holding a schema written by relish.MarshalSchema
+//
+// relishcompat prints every difference, marking breaking ones, and exits
+// with status 1 if any is breaking. See relish.CheckCompatible for which
+// changes break compatibility.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dadrian/relish"
+	"github.com/dadrian/relish/gosrc"
+	"github.com/dadrian/relish/idl"
+)
+
+func main() {
+	name := flag.String("type", "", "compare the type called `name` in both versions")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: relishcompat [-type name] old new\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() != 2 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	old, err := load(flag.Arg(0), *name)
+	if err == nil {
+		var new relish.Schema
+		if new, err = load(flag.Arg(1), *name); err == nil {
+			err = report(old, new)
+		}
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "relishcompat:", err)
+		os.Exit(1)
+	}
+}
+
+func report(old, new relish.Schema) error {
+	changes, err := relish.CheckCompatible(old, new)
+	for _, c := range changes {
+		fmt.Println(c)
+	}
+	var e *relish.Error
+	if errors.As(err, &e) && e.Kind == relish.ErrIncompatible {
+		os.Exit(1)
+	}
+	return err
+}
+
+// load reads the schema of the type called name from path.
+func load(path, name string) (relish.Schema, error) {
+	if fi, err := os.Stat(path); err != nil {
+		return nil, err
+	} else if fi.IsDir() {
+		if name == "" {
+			return nil, fmt.Errorf("%s is a Go package; -type is required", path)
+		}
+		p, err := gosrc.ParseDir(path)
+		if err != nil {
+			return nil, err
+		}
+		return p.Schema(name)
+	}
+	src, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	if filepath.Ext(path) != ".relish" {
+		return relish.UnmarshalSchema(src)
+	}
+	if name == "" {
+		return nil, fmt.Errorf("%s is a schema file; -type is required", path)
+	}
+	f, err := idl.Parse(path, src)
+	if err != nil {
+		return nil, err
+	}
+	if err := idl.Check(f); err != nil {
+		return nil, err
+	}
+	return f.Schema(name)
+}
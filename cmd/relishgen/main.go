@@ -0,0 +1,64 @@
+// Command relishgen generates reflection-free Relish codecs for Go struct
+// types.
+//
+// Usage:
+//
+//	relishgen [-dir dir] [-o file] [Type...]
+//
+// relishgen reads the Go package in dir, the current directory by
+// default, and writes MarshalRelish, RelishSize and UnmarshalRelish
+// methods for the named types, and for every struct type of the package
+// they use, to the -o file, relish_codec.go in dir by default. Without
+// type names it covers every struct type that has a relish-tagged field.
+// The methods encode exactly as reflection does, and relish.Marshal and
+// relish.Unmarshal use them automatically. It is meant to be run by
+// go generate:
+//
+//	//go:generate relishgen
+//
+// See package github.com/dadrian/relish/codegen for details.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dadrian/relish/codegen"
+)
+
+func main() {
+	dir := flag.String("dir", ".", "read the Go package in `dir`")
+	out := flag.String("o", "", "write output to `file` (default: relish_codec.go in dir)")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: relishgen [-dir dir] [-o file] [Type...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if err := run(*dir, *out, flag.Args()); err != nil {
+		fmt.Fprintln(os.Stderr, "relishgen:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, out string, names []string) error {
+	if out == "" {
+		out = filepath.Join(dir, "relish_codec.go")
+	}
+	pkg, err := codegen.Load(dir, out)
+	if err != nil {
+		return err
+	}
+	if len(names) == 0 {
+		names = codegen.TaggedTypes(pkg)
+		if len(names) == 0 {
+			return fmt.Errorf("no relish-tagged struct types in package %s", pkg.Name())
+		}
+	}
+	src, err := codegen.Generate(pkg, names...)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(out, src, 0o666)
+}
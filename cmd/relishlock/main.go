@@ -0,0 +1,93 @@
+// Command relishlock maintains a lockfile of the field IDs used by the
+// Relish types of a Go package, so that a retired ID is never reused.
+//
+// Usage:
+//
+//	relishlock [-lock file] [-w] [dir]
+//
+// relishlock reads the Go package in dir, the current directory by
+// default, and compares its relish-tagged struct types with the lockfile,
+// relish.lock in dir by default. It reports every field that changes the
+// Relish type of an ID or reuses a retired one, and exits with status 1
+// if there are any. Otherwise, with -w it writes the updated lockfile,
+// creating it if need be; without -w it fails if the lockfile is out of
+// date, which suits a presubmit check.
+//
+// To retire an ID explicitly, keep a blank field for it:
+//
+//	_ struct{} `relish:"3,reserved"`
+//
+// See package github.com/dadrian/relish/lockfile for the file format.
+package main
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/dadrian/relish/lockfile"
+)
+
+func main() {
+	lock := flag.String("lock", "", "lockfile `path` (default: relish.lock in dir)")
+	write := flag.Bool("w", false, "write the updated lockfile")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: relishlock [-lock file] [-w] [dir]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	if *lock == "" {
+		*lock = filepath.Join(dir, "relish.lock")
+	}
+	if err := run(dir, *lock, *write); err != nil {
+		fmt.Fprintln(os.Stderr, "relishlock:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, lock string, write bool) error {
+	types, err := lockfile.Load(dir)
+	if err != nil {
+		return err
+	}
+	old := &lockfile.File{}
+	src, err := os.ReadFile(lock)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && write:
+	case errors.Is(err, fs.ErrNotExist):
+		return fmt.Errorf("%s does not exist; run relishlock -w to create it", lock)
+	case err != nil:
+		return err
+	default:
+		if old, err = lockfile.Parse(lock, src); err != nil {
+			return err
+		}
+	}
+	updated, conflicts := lockfile.Update(old, types)
+	if len(conflicts) > 0 {
+		for _, c := range conflicts {
+			fmt.Fprintln(os.Stderr, c)
+		}
+		return fmt.Errorf("%d field IDs conflict with %s", len(conflicts), lock)
+	}
+	out := updated.Format()
+	if write {
+		return os.WriteFile(lock, out, 0o666)
+	}
+	if !bytes.Equal(out, src) {
+		return fmt.Errorf("%s is out of date; run relishlock -w", lock)
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// unifiedDiff returns the changes from old to new as a unified diff with
+// three lines of context, or nil if they are equal.
+func unifiedDiff(name string, old, new []byte) []byte {
+	if bytes.Equal(old, new) {
+		return nil
+	}
+	edits := diffLines(splitLines(old), splitLines(new))
+
+	const context = 3
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "--- %s.orig\n+++ %s\n", name, name)
+	for k := 0; k < len(edits); {
+		if edits[k].op == ' ' {
+			k++
+			continue
+		}
+		// A hunk runs from context lines before the first change to
+		// context lines after the last change that is not separated from
+		// the next by more than 2*context unchanged lines.
+		start := max(k-context, 0)
+		end := k
+		for end < len(edits) {
+			if edits[end].op != ' ' {
+				end++
+				continue
+			}
+			run := end
+			for run < len(edits) && edits[run].op == ' ' {
+				run++
+			}
+			if run == len(edits) || run-end > 2*context {
+				end = min(end+context, len(edits))
+				break
+			}
+			end = run
+		}
+		var na, nb int
+		for _, e := range edits[start:end] {
+			if e.op != '+' {
+				na++
+			}
+			if e.op != '-' {
+				nb++
+			}
+		}
+		fmt.Fprintf(&out, "@@ -%s +%s @@\n", hunkRange(edits[start].i, na), hunkRange(edits[start].j, nb))
+		for _, e := range edits[start:end] {
+			out.WriteByte(e.op)
+			out.WriteString(e.line)
+			out.WriteByte('\n')
+		}
+		k = end
+	}
+	return out.Bytes()
+}
+
+// edit is one line of a diff: ' ' keeps a line, '-' deletes it from the
+// old text and '+' inserts it from the new one. i and j count the old and
+// new lines before it.
+type edit struct {
+	op   byte
+	line string
+	i, j int
+}
+
+// diffLines returns a shortest edit script from a to b, found with
+// Myers's O(ND) algorithm. It keeps the furthest-reaching paths of each
+// of the D steps, so its memory grows with the square of the number of
+// changed lines rather than with the product of the lengths.
+func diffLines(a, b []string) []edit {
+	n, m := len(a), len(b)
+	off := n + m + 1
+	// v[off+k] is the furthest x reached on diagonal k = x - y.
+	v := make([]int, 2*off+1)
+	var trace [][]int // trace[d][k+d] is v[off+k] after step d
+	for d := 0; d <= n+m; d++ {
+		done := false
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[off+k-1] < v[off+k+1] {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x, y = x+1, y+1
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				done = true
+			}
+		}
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+		if done {
+			break
+		}
+	}
+
+	// Walk back from the end, collecting edits in reverse. Each step
+	// after the first is a move down or right followed by a run of
+	// equal lines.
+	var edits []edit
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1] // prev[k+d-1] is the x reached on diagonal k
+		k := x - y
+		down := k == -d || k != d && prev[k-1+d-1] < prev[k+1+d-1]
+		pk := k - 1
+		if down {
+			pk = k + 1
+		}
+		px := prev[pk+d-1]
+		py := px - pk
+		mx, my := px+1, py
+		if down {
+			mx, my = px, py+1
+		}
+		for x > mx && y > my {
+			x, y = x-1, y-1
+			edits = append(edits, edit{' ', a[x], x, y})
+		}
+		if down {
+			edits = append(edits, edit{'+', b[py], px, py})
+		} else {
+			edits = append(edits, edit{'-', a[px], px, py})
+		}
+		x, y = px, py
+	}
+	for x > 0 && y > 0 {
+		x, y = x-1, y-1
+		edits = append(edits, edit{' ', a[x], x, y})
+	}
+	for l, r := 0, len(edits)-1; l < r; l, r = l+1, r-1 {
+		edits[l], edits[r] = edits[r], edits[l]
+	}
+	return edits
+}
+
+func hunkRange(start, n int) string {
+	if n == 0 {
+		return fmt.Sprintf("%d,0", start)
+	}
+	if n == 1 {
+		return fmt.Sprint(start + 1)
+	}
+	return fmt.Sprintf("%d,%d", start+1, n)
+}
+
+func splitLines(b []byte) []string {
+	s := strings.TrimSuffix(string(b), "\n")
+	if s == "" {
+		return nil
+	}
+	return strings.Split(s, "\n")
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"math/rand"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestUnifiedDiff(t *testing.T) {
+	old := "a\nb\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\n"
+	new := "a\nB\nc\nd\ne\nf\ng\nh\ni\nj\nk\nl\nm\nn\n"
+	const want = `--- x.go.orig
++++ x.go
+@@ -1,5 +1,5 @@
+ a
+-b
++B
+ c
+ d
+ e
+@@ -11,3 +11,4 @@
+ k
+ l
+ m
++n
+`
+	if got := string(unifiedDiff("x.go", []byte(old), []byte(new))); got != want {
+		t.Errorf("unifiedDiff =\n%s\nwant\n%s", got, want)
+	}
+	if got := unifiedDiff("x.go", []byte(old), []byte(old)); got != nil {
+		t.Errorf("unifiedDiff of equal files = %q", got)
+	}
+	const wantEmpty = "--- x.go.orig\n+++ x.go\n@@ -0,0 +1,2 @@\n+a\n+b\n"
+	if got := string(unifiedDiff("x.go", nil, []byte("a\nb\n"))); got != wantEmpty {
+		t.Errorf("unifiedDiff from empty =\n%s\nwant\n%s", got, wantEmpty)
+	}
+}
+
+func TestDiffLines_Shortest(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	lines := func() []string {
+		s := make([]string, r.Intn(12))
+		for i := range s {
+			s[i] = string(rune('a' + r.Intn(3)))
+		}
+		return s
+	}
+	for n := 0; n < 500; n++ {
+		a, b := lines(), lines()
+		edits := diffLines(a, b)
+		var gotA, gotB []string
+		changes := 0
+		for _, e := range edits {
+			if e.op != '+' {
+				gotA = append(gotA, e.line)
+			}
+			if e.op != '-' {
+				gotB = append(gotB, e.line)
+			}
+			if e.op != ' ' {
+				changes++
+			}
+		}
+		if strings.Join(gotA, "") != strings.Join(a, "") || strings.Join(gotB, "") != strings.Join(b, "") {
+			t.Fatalf("diffLines(%q, %q) = %v does not turn one into the other", a, b, edits)
+		}
+		if want := len(a) + len(b) - 2*lcsLen(a, b); changes != want {
+			t.Fatalf("diffLines(%q, %q) makes %d changes, want %d", a, b, changes, want)
+		}
+	}
+}
+
+func lcsLen(a, b []string) int {
+	l := make([][]int, len(a)+1)
+	for i := range l {
+		l[i] = make([]int, len(b)+1)
+	}
+	for i := len(a) - 1; i >= 0; i-- {
+		for j := len(b) - 1; j >= 0; j-- {
+			if a[i] == b[j] {
+				l[i][j] = l[i+1][j+1] + 1
+			} else {
+				l[i][j] = max(l[i+1][j], l[i][j+1])
+			}
+		}
+	}
+	return l[0][0]
+}
+
+func TestUnifiedDiff_Large(t *testing.T) {
+	// A quadratic table for this would need 10^10 cells.
+	var old strings.Builder
+	for i := 0; i < 100000; i++ {
+		old.WriteString(strconv.Itoa(i) + "\n")
+	}
+	new := strings.Replace(old.String(), "\n50000\n", "\n50000 // changed\n", 1)
+	got := string(unifiedDiff("x.go", []byte(old.String()), []byte(new)))
+	if !strings.Contains(got, "@@ -49998,7 +49998,7 @@\n") || !strings.Contains(got, "-50000\n+50000 // changed\n") {
+		t.Errorf("unifiedDiff =\n%s", got)
+	}
+}
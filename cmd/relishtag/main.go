@@ -0,0 +1,103 @@
+// Command relishtag adds relish tags to the struct types of a Go package.
+//
+// Usage:
+//
+//	relishtag [-d] [-lock file] [-type name,...] [dir]
+//
+// relishtag rewrites the Go files of the package in dir, the current
+// directory by default, giving every exported field without a relish tag
+// one, and tagging pointer fields optional. Existing tags and comments
+// are kept. If the package has a lockfile, relish.lock in dir by default,
+// IDs it records are not given to new fields. With -d relishtag prints
+// the changes as a diff instead of writing them.
+//
+// See package github.com/dadrian/relish/tagger for the rules, and run
+// relishlock -w afterwards to record the new IDs.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dadrian/relish/gosrc"
+	"github.com/dadrian/relish/lockfile"
+	"github.com/dadrian/relish/tagger"
+)
+
+func main() {
+	diff := flag.Bool("d", false, "print a diff of the changes instead of writing them")
+	lock := flag.String("lock", "", "lockfile `path` (default: relish.lock in dir, if it exists)")
+	types := flag.String("type", "", "tag only the struct types in the comma-separated `list`")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: relishtag [-d] [-lock file] [-type name,...] [dir]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() > 1 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	dir := "."
+	if flag.NArg() == 1 {
+		dir = flag.Arg(0)
+	}
+	var opts tagger.Options
+	if *types != "" {
+		opts.Types = strings.Split(*types, ",")
+	}
+	if err := run(dir, *lock, *diff, opts); err != nil {
+		fmt.Fprintln(os.Stderr, "relishtag:", err)
+		os.Exit(1)
+	}
+}
+
+func run(dir, lock string, diff bool, opts tagger.Options) error {
+	explicit := lock != ""
+	if !explicit {
+		lock = filepath.Join(dir, "relish.lock")
+	}
+	src, err := os.ReadFile(lock)
+	switch {
+	case errors.Is(err, fs.ErrNotExist) && !explicit:
+	case err != nil:
+		return err
+	default:
+		if opts.Lock, err = lockfile.Parse(lock, src); err != nil {
+			return err
+		}
+	}
+	p, err := gosrc.ParseDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, f := range p.Files {
+		name := p.Fset.File(f.Pos()).Name()
+		out, warnings, err := tagger.Tag(p.Fset, f, opts)
+		for _, w := range warnings {
+			fmt.Fprintln(os.Stderr, w)
+		}
+		if err != nil {
+			return err
+		}
+		if out == nil {
+			continue
+		}
+		if !diff {
+			if err := os.WriteFile(name, out, 0o666); err != nil {
+				return err
+			}
+			continue
+		}
+		old, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		os.Stdout.Write(unifiedDiff(name, old, out))
+	}
+	return nil
+}
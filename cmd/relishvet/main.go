@@ -0,0 +1,96 @@
+// Command relishvet reports mistakes in relish struct tags.
+//
+// Usage:
+//
+//	relishvet [dir...]
+//
+// relishvet checks the Go package in each dir, the current directory by
+// default. A dir ending in /... stands for every package below it. It
+// prints one line per problem and exits with status 1 if it found any.
+// See package github.com/dadrian/relish/vet for the checks.
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/dadrian/relish/vet"
+)
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: relishvet [dir...]\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	args := flag.Args()
+	if len(args) == 0 {
+		args = []string{"."}
+	}
+	dirs, err := expand(args)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "relishvet:", err)
+		os.Exit(1)
+	}
+	status := 0
+	for _, dir := range dirs {
+		diags, err := vet.Dir(dir)
+		if err != nil {
+			fmt.Fprintln(os.Stderr, "relishvet:", err)
+			status = 1
+			continue
+		}
+		for _, d := range diags {
+			fmt.Println(d)
+			status = 1
+		}
+	}
+	os.Exit(status)
+}
+
+// expand replaces each dir/... in args with the directories below dir
+// that hold Go files, skipping testdata and hidden directories.
+func expand(args []string) ([]string, error) {
+	var dirs []string
+	for _, arg := range args {
+		root, ok := strings.CutSuffix(arg, "/...")
+		if !ok {
+			dirs = append(dirs, arg)
+			continue
+		}
+		err := filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if !d.IsDir() {
+				return nil
+			}
+			if name := d.Name(); path != root && (name == "testdata" || name == "vendor" || strings.HasPrefix(name, ".") || strings.HasPrefix(name, "_")) {
+				return filepath.SkipDir
+			}
+			if hasGo(path) {
+				dirs = append(dirs, path)
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return dirs, nil
+}
+
+// hasGo reports whether dir holds Go files other than tests.
+func hasGo(dir string) bool {
+	names, _ := filepath.Glob(filepath.Join(dir, "*.go"))
+	for _, n := range names {
+		if !strings.HasSuffix(n, "_test.go") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,93 @@
+// Command rust2go generates Go types with relish tags from Rust structs
+// and enums that derive Relish.
+//
+// Usage:
+//
+//	rust2go [-pkg name] [-o file] file.rs...
+//
+// The files are read as one schema, so types declared in one may be used
+// in another. rust2go writes Go declarations of every Relish-derived type
+// to the -o file or standard output. See package
+// github.com/dadrian/relish/rust for how Rust types are read.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/dadrian/relish/idl"
+	"github.com/dadrian/relish/rust"
+)
+
+func main() {
+	pkg := flag.String("pkg", "", "Go package `name` (default: the output directory's name, or \"schema\")")
+	out := flag.String("o", "", "write output to `file` instead of standard output")
+	flag.Usage = func() {
+		fmt.Fprintf(os.Stderr, "usage: rust2go [-pkg name] [-o file] file.rs...\n")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(flag.Args(), *pkg, *out); err != nil {
+		var list idl.ErrorList
+		if errors.As(err, &list) {
+			for _, e := range list {
+				fmt.Fprintln(os.Stderr, e)
+			}
+		} else {
+			fmt.Fprintln(os.Stderr, "rust2go:", err)
+		}
+		os.Exit(1)
+	}
+}
+
+func run(files []string, pkg, out string) error {
+	schema := &idl.File{Name: filepath.Base(files[0])}
+	if len(files) > 1 {
+		schema.Name = fmt.Sprintf("%s and %d more files", schema.Name, len(files)-1)
+	}
+	var errs idl.ErrorList
+	for _, name := range files {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return err
+		}
+		f, err := rust.Parse(name, src)
+		if err != nil {
+			errs = append(errs, err.(idl.ErrorList)...)
+		}
+		schema.Decls = append(schema.Decls, f.Decls...)
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	if len(schema.Decls) == 0 {
+		return fmt.Errorf("no types deriving Relish in %s", schema.Name)
+	}
+	if err := idl.Check(schema); err != nil {
+		return err
+	}
+	if pkg == "" {
+		pkg = "schema"
+		if out != "" {
+			if abs, err := filepath.Abs(out); err == nil {
+				pkg = filepath.Base(filepath.Dir(abs))
+			}
+		}
+	}
+	src, err := idl.GenerateGo(schema, pkg)
+	if err != nil {
+		return err
+	}
+	if out == "" {
+		_, err = os.Stdout.Write(src)
+		return err
+	}
+	return os.WriteFile(out, src, 0o666)
+}
@@ -0,0 +1,385 @@
+package relish
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	intr "github.com/dadrian/relish/internal"
+)
+
+// Marshaler is implemented by types that encode themselves without
+// reflection, such as those generated by cmd/relishgen. Marshal and the
+// Encoder call these methods for any struct whose pointer type has them.
+type Marshaler interface {
+	// MarshalRelish appends the value's TLV to a.
+	MarshalRelish(a *Appender) error
+	// RelishSize returns the number of bytes MarshalRelish appends.
+	RelishSize() int
+}
+
+// Unmarshaler is implemented by types that decode themselves without
+// reflection. Unmarshal and the Decoder call UnmarshalRelish for any
+// struct whose pointer type has it, unless a field mask is set.
+type Unmarshaler interface {
+	// UnmarshalRelish decodes the value with type t and content c.
+	UnmarshalRelish(t TypeID, c []byte) error
+}
+
+var marshalerType = reflect.TypeOf((*Marshaler)(nil)).Elem()
+
+// reflectOnly makes the Encoder and Decoder ignore Marshaler and
+// Unmarshaler, so that tests can compare them with the reflection path.
+var reflectOnly bool
+
+// marshalerOf returns the Marshaler for struct value rv, if its pointer
+// type implements Marshaler. Values that are not addressable are copied.
+func marshalerOf(rv reflect.Value) (Marshaler, bool) {
+	if reflectOnly || rv.Kind() != reflect.Struct || !reflect.PointerTo(rv.Type()).Implements(marshalerType) {
+		return nil, false
+	}
+	if rv.CanAddr() && rv.Addr().CanInterface() {
+		return rv.Addr().Interface().(Marshaler), true
+	}
+	p := reflect.New(rv.Type())
+	p.Elem().Set(rv)
+	return p.Interface().(Marshaler), true
+}
+
+// unmarshalerOf returns the Unmarshaler for struct value dst, if its
+// pointer type implements Unmarshaler.
+func unmarshalerOf(dst reflect.Value) (Unmarshaler, bool) {
+	if reflectOnly || dst.Kind() != reflect.Struct || !dst.CanAddr() || !dst.Addr().CanInterface() {
+		return nil, false
+	}
+	u, ok := dst.Addr().Interface().(Unmarshaler)
+	return u, ok
+}
+
+// An Appender appends Relish encodings to Buf. Code generated by
+// cmd/relishgen writes through it, and the Encoder hands one to each
+// Marshaler.
+//
+// Values are written as a TLV: Type or Start appends the type ID, Begin
+// reserves the length of a varsize value and End fills it in once the
+// content has been appended. Array elements and map keys and values omit
+// the type ID; a Marshaler writing one is told so by Elem.
+type Appender struct {
+	Buf []byte
+	// Canonical selects canonical encoding, as Encoder.SetCanonical does.
+	Canonical bool
+
+	elem   TypeID
+	inElem bool
+}
+
+// Type appends the type ID of a TLV.
+func (a *Appender) Type(t TypeID) { a.Buf = append(a.Buf, byte(t)) }
+
+// Elem makes the next value written with Start or Encode an element of
+// type et.
+func (a *Appender) Elem(et TypeID) { a.elem, a.inElem = et, true }
+
+// Start begins a value of type t: it appends t, or after Elem checks that
+// t is the element type and appends nothing.
+func (a *Appender) Start(t TypeID) error {
+	if !a.inElem {
+		a.Type(t)
+		return nil
+	}
+	a.inElem = false
+	if t != a.elem {
+		return &Error{Kind: ErrTypeMismatch, Detail: "element encoded as " + t.String() + ", want " + a.elem.String()}
+	}
+	return nil
+}
+
+// Begin reserves space for the length of a varsize value and returns the
+// position to pass to End.
+func (a *Appender) Begin() int {
+	a.Buf = append(a.Buf, 0)
+	return len(a.Buf) - 1
+}
+
+// End writes the length of the content appended since Begin returned
+// mark, moving the content up if the length needs the long form.
+func (a *Appender) End(mark int) error {
+	n := len(a.Buf) - mark - 1
+	sz := intr.SizeOfLen(n)
+	if sz < 0 {
+		return &Error{Kind: ErrLengthOverflow, Detail: "length out of range"}
+	}
+	if sz > 1 {
+		a.Buf = append(a.Buf, make([]byte, sz-1)...)
+		copy(a.Buf[mark+sz:], a.Buf[mark+1:mark+1+n])
+	}
+	intr.EncodeLen(a.Buf[mark:], n)
+	return nil
+}
+
+// The following append the content of fixed-size values.
+
+func (a *Appender) Bool(v bool) {
+	if v {
+		a.Buf = append(a.Buf, 0xFF)
+	} else {
+		a.Buf = append(a.Buf, 0x00)
+	}
+}
+func (a *Appender) U8(v uint8)   { a.Buf = append(a.Buf, v) }
+func (a *Appender) U16(v uint16) { a.Buf = binary.LittleEndian.AppendUint16(a.Buf, v) }
+func (a *Appender) U32(v uint32) { a.Buf = binary.LittleEndian.AppendUint32(a.Buf, v) }
+func (a *Appender) U64(v uint64) { a.Buf = binary.LittleEndian.AppendUint64(a.Buf, v) }
+func (a *Appender) U128(v U128)  { a.Buf = append(a.Buf, v[:]...) }
+func (a *Appender) I8(v int8)    { a.Buf = append(a.Buf, byte(v)) }
+func (a *Appender) I16(v int16)  { a.U16(uint16(v)) }
+func (a *Appender) I32(v int32)  { a.U32(uint32(v)) }
+func (a *Appender) I64(v int64)  { a.U64(uint64(v)) }
+func (a *Appender) I128(v I128)  { a.Buf = append(a.Buf, v[:]...) }
+
+func (a *Appender) F32(v float32) {
+	if a.Canonical {
+		v = canonicalF32(v)
+	}
+	a.U32(math.Float32bits(v))
+}
+
+func (a *Appender) F64(v float64) {
+	if a.Canonical {
+		v = canonicalF64(v)
+	}
+	a.U64(math.Float64bits(v))
+}
+
+// Timestamp appends t as whole seconds since the Unix epoch.
+func (a *Appender) Timestamp(t time.Time) error {
+	sec := t.Unix()
+	if sec < 0 {
+		return &Error{Kind: ErrTypeMismatch, Detail: "timestamp before Unix epoch"}
+	}
+	a.U64(uint64(sec))
+	return nil
+}
+
+// String appends the length and bytes of s, which must be valid UTF-8.
+func (a *Appender) String(s string) error {
+	if !utf8.ValidString(s) {
+		return &Error{Kind: ErrInvalidUTF8, Detail: "invalid utf-8 in string"}
+	}
+	a.Buf = appendLen(a.Buf, len(s))
+	a.Buf = append(a.Buf, s...)
+	return nil
+}
+
+// SortPairs puts the map pairs appended since position start, whose keys
+// have type kt and values type vt, in canonical order if Canonical is set.
+func (a *Appender) SortPairs(start int, kt, vt TypeID) error {
+	if !a.Canonical {
+		return nil
+	}
+	type pair struct{ k, kv []byte }
+	var pairs []pair
+	for p := a.Buf[start:]; len(p) > 0; {
+		_, r, err := measureElem(byte(kt), p)
+		if err != nil {
+			return err
+		}
+		_, next, err := measureElem(byte(vt), r)
+		if err != nil {
+			return err
+		}
+		// Keys sort by their encoded bytes, length prefix included.
+		pairs = append(pairs, pair{p[:len(p)-len(r)], p[:len(p)-len(next)]})
+		p = next
+	}
+	sort.SliceStable(pairs, func(i, j int) bool { return bytes.Compare(pairs[i].k, pairs[j].k) < 0 })
+	sorted := make([]byte, 0, len(a.Buf)-start)
+	for i, p := range pairs {
+		if i > 0 && bytes.Equal(p.k, pairs[i-1].k) {
+			return &Error{Kind: ErrDuplicateMapKey, Detail: "keys are equal in canonical form"}
+		}
+		sorted = append(sorted, p.kv...)
+	}
+	copy(a.Buf[start:], sorted)
+	return nil
+}
+
+// Encode appends v using reflection, for values whose type has no
+// generated methods.
+func (a *Appender) Encode(v any) error {
+	var buf bytes.Buffer
+	if err := (&Encoder{w: &buf, canonical: a.Canonical}).Encode(v); err != nil {
+		return err
+	}
+	b := buf.Bytes()
+	if err := a.Start(TypeID(b[0])); err != nil {
+		return err
+	}
+	a.Buf = append(a.Buf, b[1:]...)
+	return nil
+}
+
+// LenSize returns the size of the length prefix for n bytes of content.
+func LenSize(n int) int { return intr.SizeOfLen(n) }
+
+// SizeOf returns the size of the TLV for v, found by encoding it with
+// reflection, or 0 if v cannot be encoded.
+func SizeOf(v any) int {
+	b, err := Marshal(v)
+	if err != nil {
+		return 0
+	}
+	return len(b)
+}
+
+// The following helpers take apart encoded values for generated
+// UnmarshalRelish methods. They report errors as the Decoder does.
+
+// SplitValue splits the TLV at the start of b into its type ID, its
+// content and whatever follows it.
+func SplitValue(b []byte) (TypeID, []byte, []byte, error) {
+	t, c, rest, err := splitValue(b)
+	return TypeID(t), c, rest, err
+}
+
+// SplitElem splits an array element of type t from the start of b.
+// Elements of a zero-size type such as null take no bytes, so b holding
+// any is an error.
+func SplitElem(t TypeID, b []byte) ([]byte, []byte, error) { return splitElem(byte(t), b) }
+
+// SplitEntry splits a map entry with key type kt and value type vt from
+// the start of b into its key and value content and whatever follows it.
+func SplitEntry(kt, vt TypeID, b []byte) ([]byte, []byte, []byte, error) {
+	return splitEntry(byte(kt), byte(vt), b)
+}
+
+// CheckType reports an error unless a value of type t decodes into a Go
+// value whose Relish type is want. goType names the Go type in the error.
+func CheckType(t, want TypeID, goType string) error {
+	if t == want || structLike(byte(t)) && structLike(byte(want)) {
+		return nil
+	}
+	return &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("cannot decode %v into %s", t, goType)}
+}
+
+// CheckElemType is CheckType for array elements and map keys and values.
+func CheckElemType(et, want TypeID, goType string) error {
+	if et == want || structLike(byte(et)) && structLike(byte(want)) {
+		return nil
+	}
+	return &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("cannot decode %v elements into %s", et, goType)}
+}
+
+// NextField splits the first field from struct content p. prev is the ID
+// of the field before it, or -1, since IDs must increase.
+func NextField(p []byte, prev int) (id byte, t TypeID, c, rest []byte, err error) {
+	id = p[0]
+	if id&0x80 != 0 {
+		return 0, 0, nil, nil, &Error{Kind: ErrInvalidFieldID, Detail: "top bit set"}
+	}
+	if int(id) <= prev {
+		return 0, 0, nil, nil, &Error{Kind: ErrFieldOrder, Detail: "field ids not strictly increasing"}
+	}
+	t, c, rest, err = SplitValue(p[1:])
+	return id, t, c, rest, err
+}
+
+// SplitVariant splits enum content c into its variant ID and the type and
+// content of the variant's value.
+func SplitVariant(c []byte) (byte, TypeID, []byte, error) {
+	if len(c) < 1 {
+		return 0, 0, nil, &Error{Kind: ErrTypeMismatch, Detail: "enum content too short"}
+	}
+	t, vc, rest, err := SplitValue(c[1:])
+	if err != nil {
+		return 0, 0, nil, err
+	}
+	if len(rest) != 0 {
+		return 0, 0, nil, &Error{Kind: ErrEnumLengthMismatch, Detail: "variant did not consume full length"}
+	}
+	return c[0], t, vc, nil
+}
+
+// SplitArray splits array content c into its element type and elements.
+func SplitArray(c []byte) (TypeID, []byte, error) {
+	if len(c) == 0 {
+		return 0, nil, &Error{Kind: ErrUnexpectedEOF, Detail: "array missing element type"}
+	}
+	return TypeID(c[0]), c[1:], nil
+}
+
+// CountElems returns the number of elements of type et in elems.
+func CountElems(et TypeID, elems []byte) (int, error) {
+	n := 0
+	for p := elems; len(p) > 0; n++ {
+		_, rest, err := splitElem(byte(et), p)
+		if err != nil {
+			return 0, err
+		}
+		p = rest
+	}
+	return n, nil
+}
+
+// SplitMap splits map content c into its key and value types and pairs.
+func SplitMap(c []byte) (TypeID, TypeID, []byte, error) {
+	if len(c) < 2 {
+		return 0, 0, nil, &Error{Kind: ErrUnexpectedEOF, Detail: "map missing key or value type"}
+	}
+	return TypeID(c[0]), TypeID(c[1]), c[2:], nil
+}
+
+// The following decode the content of fixed-size values and strings,
+// which SplitValue, SplitElem and SplitEntry return at the right length.
+
+func DecodeBool(c []byte) (bool, error) {
+	switch c[0] {
+	case 0x00:
+		return false, nil
+	case 0xFF:
+		return true, nil
+	}
+	return false, &Error{Kind: ErrInvalidValue, Detail: "invalid bool value"}
+}
+func DecodeU16(c []byte) uint16  { return binary.LittleEndian.Uint16(c) }
+func DecodeU32(c []byte) uint32  { return binary.LittleEndian.Uint32(c) }
+func DecodeU64(c []byte) uint64  { return binary.LittleEndian.Uint64(c) }
+func DecodeF32(c []byte) float32 { return math.Float32frombits(binary.LittleEndian.Uint32(c)) }
+func DecodeF64(c []byte) float64 { return math.Float64frombits(binary.LittleEndian.Uint64(c)) }
+
+func DecodeString(c []byte) (string, error) {
+	if !utf8.Valid(c) {
+		return "", &Error{Kind: ErrInvalidUTF8, Detail: "invalid utf-8 in string"}
+	}
+	return string(c), nil
+}
+
+func DecodeTimestamp(c []byte) (time.Time, error) {
+	sec := binary.LittleEndian.Uint64(c)
+	if sec > math.MaxInt64 {
+		return time.Time{}, &Error{Kind: ErrInvalidValue, Detail: "timestamp out of range"}
+	}
+	return time.Unix(int64(sec), 0).UTC(), nil
+}
+
+// DecodeValue decodes the value with type t and content c into v, a
+// non-nil pointer, using reflection.
+func DecodeValue(v any, t TypeID, c []byte) error {
+	return decodeValue(reflect.ValueOf(v).Elem(), byte(t), c, nil)
+}
+
+// InField, InVariant, InIndex and InKey prefix the path of an error from
+// a struct field, enum variant, array element or map value, as the
+// Decoder does. InKey takes the key's type and element content, and the
+// pair's index.
+func InField(err error, id byte) error   { return prefixPath(err, pathField("", id)) }
+func InVariant(err error, id byte) error { return prefixPath(err, pathVariant("", id)) }
+func InIndex(err error, i int) error     { return prefixPath(err, pathIndex("", i)) }
+func InKey(err error, kt TypeID, key []byte, i int) error {
+	return prefixPath(err, pathKey("", byte(kt), key, i))
+}
@@ -0,0 +1,177 @@
+package relish_test
+
+import (
+	"bytes"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dadrian/relish"
+	"github.com/dadrian/relish/internal/gentest"
+)
+
+// encodeBoth encodes v with its generated codec and with reflection.
+func encodeBoth(t *testing.T, v any, canonical bool) (gen, refl []byte) {
+	t.Helper()
+	encode := func() []byte {
+		var buf bytes.Buffer
+		enc := relish.NewEncoder(&buf)
+		enc.SetCanonical(canonical)
+		if err := enc.Encode(v); err != nil {
+			t.Fatalf("encode %T: %v", v, err)
+		}
+		return buf.Bytes()
+	}
+	gen = encode()
+	relish.SetReflectOnly(true)
+	defer relish.SetReflectOnly(false)
+	return gen, encode()
+}
+
+// decodeBoth decodes data into a new T with its generated codec and with
+// reflection.
+func decodeBoth[T any](data []byte) (gen, refl T, genErr, reflErr error) {
+	genErr = relish.Unmarshal(data, &gen)
+	relish.SetReflectOnly(true)
+	defer relish.SetReflectOnly(false)
+	reflErr = relish.Unmarshal(data, &refl)
+	return
+}
+
+func ptr[T any](v T) *T { return &v }
+
+// epoch is the earliest time a Relish timestamp holds; the zero
+// time.Time is before it.
+var epoch = time.Unix(0, 0).UTC()
+
+func sampleOrders() []*gentest.Order {
+	full := &gentest.Order{
+		ID:     7,
+		Note:   ptr("rush"),
+		Lines:  []gentest.Line{{SKU: "a", Qty: 1}, {SKU: "b", Qty: -2}},
+		Counts: map[string]uint16{"x": 1, "yy": 2, "z": 3},
+		Labels: gentest.Labels{"env": 9, "a": 1},
+		Big:    relish.U128{1, 2, 3, 15: 0xFF},
+		Neg:    relish.I128{0: 0x80, 15: 1},
+		At:     time.Unix(1700000000, 0).UTC(),
+		Parent: &gentest.Order{ID: 1, At: epoch, Shape: gentest.Shape{Empty: &relish.Null{}}},
+		Shape:  gentest.Shape{Circle: ptr(1.5)},
+		Blob:   bytes.Repeat([]byte{0xAB}, 200),
+		Grid:   [2][3]int8{{1, 2, 3}, {-4, -5, -6}},
+		Ratio:  0.25,
+		Scale:  -2,
+		Flags:  []bool{true, false, true},
+		Shapes: map[int64]*gentest.Shape{
+			-3: {Square: &gentest.Line{SKU: "sq"}},
+			4:  {Circle: ptr(2.0)},
+		},
+		Tags:   []string{"t1", "t2"},
+		Any:    "dyn",
+		Nested: map[uint8][]gentest.Line{2: {{SKU: "n"}}, 1: nil},
+		Ptr:    &gentest.Line{SKU: "p", Qty: 5},
+		Count:  ptr(uint64(42)),
+		Sum:    -9,
+		Opt:    gentest.Line{SKU: "never written"},
+	}
+	full.Inline.X = -300
+	two := &gentest.Order{
+		At:    epoch,
+		Shape: gentest.Shape{Circle: ptr(1.0), Square: &gentest.Line{}},
+		Lines: []gentest.Line{},
+	}
+	return []*gentest.Order{{At: epoch}, full, two}
+}
+
+func TestGenerated_Encode(t *testing.T) {
+	for i, o := range sampleOrders() {
+		gen, refl := encodeBoth(t, o, true)
+		if !bytes.Equal(gen, refl) {
+			t.Errorf("order %d: generated %x\nreflection %x", i, gen, refl)
+		}
+		if n := o.RelishSize(); n != len(gen) {
+			t.Errorf("order %d: RelishSize = %d, encoded %d bytes", i, n, len(gen))
+		}
+		// With no map of more than one entry the encoding is deterministic
+		// without canonical mode too.
+		one := *o
+		one.Counts, one.Labels, one.Shapes, one.Nested = nil, nil, nil, nil
+		gen, refl = encodeBoth(t, &one, false)
+		if !bytes.Equal(gen, refl) {
+			t.Errorf("order %d, non-canonical: generated %x\nreflection %x", i, gen, refl)
+		}
+		b, err := relish.Marshal(&one)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, gen) {
+			t.Errorf("order %d: Marshal = %x, Encoder wrote %x", i, b, gen)
+		}
+	}
+	for _, s := range []gentest.Shape{{}, {Empty: &relish.Null{}}, {Square: &gentest.Line{SKU: "s"}}} {
+		gen, refl := encodeBoth(t, s, true)
+		if !bytes.Equal(gen, refl) {
+			t.Errorf("%+v: generated %x, reflection %x", s, gen, refl)
+		}
+	}
+}
+
+func TestGenerated_Decode(t *testing.T) {
+	for i, o := range sampleOrders() {
+		o.Any = nil // the Decoder cannot fill an interface
+		relish.SetReflectOnly(true)
+		data, err := relish.Marshal(o)
+		relish.SetReflectOnly(false)
+		if err != nil {
+			t.Fatal(err)
+		}
+		gen, refl, genErr, reflErr := decodeBoth[gentest.Order](data)
+		if genErr != nil || reflErr != nil {
+			t.Fatalf("order %d: decode errors %v, %v", i, genErr, reflErr)
+		}
+		if !reflect.DeepEqual(gen, refl) {
+			t.Errorf("order %d: generated %+v\nreflection %+v", i, gen, refl)
+		}
+
+		// Corrupt each content byte in turn: both paths must fail, or
+		// succeed, alike. A corrupt outer header would only make the
+		// Decoder read a different amount.
+		for j := 1 + relish.LenSize(len(data)-1); j < len(data); j++ {
+			bad := bytes.Clone(data)
+			bad[j] ^= 0x5A
+			gen, refl, genErr, reflErr := decodeBoth[gentest.Order](bad)
+			if fmt.Sprint(genErr) != fmt.Sprint(reflErr) {
+				t.Errorf("order %d, byte %d: generated error %v, reflection error %v", i, j, genErr, reflErr)
+				continue
+			}
+			if genErr == nil && !reflect.DeepEqual(gen, refl) {
+				t.Errorf("order %d, byte %d: generated %+v\nreflection %+v", i, j, gen, refl)
+			}
+		}
+		for j := range data {
+			_, _, genErr, reflErr := decodeBoth[gentest.Order](data[:j])
+			if fmt.Sprint(genErr) != fmt.Sprint(reflErr) {
+				t.Errorf("order %d, truncated to %d: generated error %v, reflection error %v", i, j, genErr, reflErr)
+			}
+		}
+	}
+}
+
+func TestSplitHelpers_ZeroSize(t *testing.T) {
+	// Null elements take no bytes, so a byte after them is an error
+	// rather than an endless run of elements.
+	if n, err := relish.CountElems(relish.TypeNull, []byte{0x01}); err == nil {
+		t.Errorf("CountElems(null, 01) = %d, nil", n)
+	}
+	if _, _, err := relish.SplitElem(relish.TypeNull, []byte{0x01}); err == nil {
+		t.Error("SplitElem(null, 01) succeeded")
+	}
+	// A null key is fine when the value takes bytes.
+	kc, vc, rest, err := relish.SplitEntry(relish.TypeNull, relish.TypeU8, []byte{0x07, 0x08})
+	if err != nil || len(kc) != 0 || !bytes.Equal(vc, []byte{0x07}) || !bytes.Equal(rest, []byte{0x08}) {
+		t.Errorf("SplitEntry(null, u8) = %x, %x, %x, %v", kc, vc, rest, err)
+	}
+	if _, _, _, err := relish.SplitEntry(relish.TypeNull, relish.TypeNull, []byte{0x01}); err == nil {
+		t.Error("SplitEntry(null, null, 01) succeeded")
+	}
+}
@@ -0,0 +1,941 @@
+// Package codegen generates reflection-free Relish codecs for Go struct
+// types. For each struct it declares MarshalRelish, RelishSize and
+// UnmarshalRelish methods, which write and read the wire format directly
+// through relish.Appender and the relish decoding helpers. The methods
+// produce the same bytes as the reflection-based Encoder, and Marshal,
+// Unmarshal, the Encoder and the Decoder call them automatically.
+//
+// Values of types the generator cannot handle statically, such as
+// interfaces, int and types from other packages without generated
+// methods, are encoded and decoded through reflection.
+package codegen
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dadrian/relish/gosrc"
+	intr "github.com/dadrian/relish/internal"
+)
+
+// relishPath is the import path of package relish.
+const relishPath = "github.com/dadrian/relish"
+
+// Load parses and type-checks the package in dir, leaving out tests and
+// the file named skip, which is usually the output of an earlier run.
+func Load(dir, skip string) (*types.Package, error) {
+	names, err := filepath.Glob(filepath.Join(dir, "*.go"))
+	if err != nil {
+		return nil, err
+	}
+	var files []string
+	for _, n := range names {
+		if !strings.HasSuffix(n, "_test.go") && (skip == "" || filepath.Base(n) != filepath.Base(skip)) {
+			files = append(files, n)
+		}
+	}
+	if len(files) == 0 {
+		return nil, fmt.Errorf("codegen: no Go files in %s", dir)
+	}
+	p, err := gosrc.ParseFiles(files...)
+	if err != nil {
+		return nil, err
+	}
+	return Check(p.Fset, p.Files)
+}
+
+// Check type-checks files as one package, importing dependencies from
+// source.
+func Check(fset *token.FileSet, files []*ast.File) (*types.Package, error) {
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	return conf.Check(files[0].Name.Name, fset, files, nil)
+}
+
+// TaggedTypes returns the names of the struct types in pkg that have at
+// least one field with a relish tag, in alphabetical order.
+func TaggedTypes(pkg *types.Package) []string {
+	var names []string
+	for _, name := range pkg.Scope().Names() {
+		tn, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok || tn.IsAlias() {
+			continue
+		}
+		if st, ok := tn.Type().Underlying().(*types.Struct); ok && len(taggedFields(st)) > 0 {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// Generate returns the source of a Go file for pkg declaring the codec
+// methods of the named struct types, and of the struct types in pkg they
+// refer to. Types that already declare any of the methods are left alone.
+func Generate(pkg *types.Package, names ...string) ([]byte, error) {
+	g := &generator{
+		pkg:     pkg,
+		imports: map[string]string{relishPath: "relish"},
+		gen:     make(map[*types.TypeName]bool),
+	}
+	for _, name := range names {
+		tn, ok := pkg.Scope().Lookup(name).(*types.TypeName)
+		if !ok {
+			return nil, fmt.Errorf("codegen: package %s declares no type %s", pkg.Name(), name)
+		}
+		named, ok := tn.Type().(*types.Named)
+		if !ok || tn.IsAlias() {
+			return nil, fmt.Errorf("codegen: %s is an alias", name)
+		}
+		if _, ok := named.Underlying().(*types.Struct); !ok {
+			return nil, fmt.Errorf("codegen: %s is not a struct type", name)
+		}
+		if named.TypeParams().Len() > 0 {
+			return nil, fmt.Errorf("codegen: %s is generic", name)
+		}
+		g.add(named)
+	}
+	for i := 0; i < len(g.queue); i++ {
+		st := g.queue[i].Underlying().(*types.Struct)
+		for j := 0; j < st.NumFields(); j++ {
+			g.walk(st.Field(j).Type())
+		}
+	}
+
+	var body bytes.Buffer
+	for _, named := range g.queue {
+		if err := g.structType(&body, named); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	fmt.Fprintf(&out, "// Code generated by relishgen. DO NOT EDIT.\n\npackage %s\n\nimport (\n", pkg.Name())
+	paths := make([]string, 0, len(g.imports))
+	byName := make(map[string]string)
+	for path, name := range g.imports {
+		if prev, ok := byName[name]; ok {
+			return nil, fmt.Errorf("codegen: packages %s and %s are both named %s", prev, path, name)
+		}
+		byName[name] = path
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		fmt.Fprintf(&out, "\t%q\n", path)
+	}
+	out.WriteString(")\n")
+	out.Write(body.Bytes())
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("codegen: formatting generated code: %v", err)
+	}
+	return src, nil
+}
+
+type generator struct {
+	pkg     *types.Package
+	imports map[string]string // import path to package name
+	gen     map[*types.TypeName]bool
+	queue   []*types.Named // types to generate, in order
+	tmp     int
+}
+
+// add queues named for generation unless it already has codec methods.
+func (g *generator) add(named *types.Named) {
+	tn := named.Obj()
+	if g.gen[tn] || declaresCodec(named) {
+		return
+	}
+	g.gen[tn] = true
+	g.queue = append(g.queue, named)
+}
+
+// walk queues the struct types of pkg that t refers to.
+func (g *generator) walk(t types.Type) {
+	switch t := types.Unalias(t).(type) {
+	case *types.Pointer:
+		g.walk(t.Elem())
+	case *types.Slice:
+		g.walk(t.Elem())
+	case *types.Array:
+		g.walk(t.Elem())
+	case *types.Map:
+		g.walk(t.Key())
+		g.walk(t.Elem())
+	case *types.Named:
+		if t.Obj().Pkg() != g.pkg || t.TypeArgs().Len() > 0 || g.gen[t.Obj()] {
+			return
+		}
+		if _, ok := t.Underlying().(*types.Struct); ok {
+			g.add(t)
+		} else {
+			g.walk(t.Underlying())
+		}
+	}
+}
+
+// declaresCodec reports whether named or its pointer type has any of the
+// codec methods.
+func declaresCodec(named *types.Named) bool {
+	ms := types.NewMethodSet(types.NewPointer(named))
+	for _, m := range []string{"MarshalRelish", "UnmarshalRelish", "RelishSize"} {
+		if ms.Lookup(named.Obj().Pkg(), m) != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// hasCodec reports whether values of t are encoded and decoded by calling
+// their codec methods.
+func (g *generator) hasCodec(t types.Type) bool {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok {
+		return false
+	}
+	if _, ok := named.Underlying().(*types.Struct); !ok {
+		return false
+	}
+	if g.gen[named.Obj()] {
+		return true
+	}
+	ms := types.NewMethodSet(types.NewPointer(named))
+	for _, m := range []string{"MarshalRelish", "UnmarshalRelish", "RelishSize"} {
+		if ms.Lookup(named.Obj().Pkg(), m) == nil {
+			return false
+		}
+	}
+	return true
+}
+
+// field is a relish-tagged struct field.
+type field struct {
+	name                string
+	id                  int
+	optional, omitempty bool
+	typ                 types.Type
+	exported            bool
+}
+
+func taggedFields(st *types.Struct) []field {
+	var fields []field
+	for i := 0; i < st.NumFields(); i++ {
+		f := st.Field(i)
+		id, optional, omitempty, ok := intr.ParseRelishTag(reflect.StructField{Tag: reflect.StructTag(st.Tag(i))})
+		if ok {
+			fields = append(fields, field{f.Name(), id, optional, omitempty, f.Type(), f.Exported()})
+		}
+	}
+	sort.SliceStable(fields, func(i, j int) bool { return fields[i].id < fields[j].id })
+	return fields
+}
+
+// isEnum reports whether every tagged field of st is optional, which
+// makes the Encoder write its values as enums when one field is set.
+func isEnum(st *types.Struct) bool {
+	fields := taggedFields(st)
+	for _, f := range fields {
+		if !f.optional {
+			return false
+		}
+	}
+	return len(fields) > 0
+}
+
+// elem returns the element type of pointer type t.
+func elem(t types.Type) types.Type { return t.Underlying().(*types.Pointer).Elem() }
+
+func isPointer(t types.Type) bool {
+	_, ok := t.Underlying().(*types.Pointer)
+	return ok
+}
+
+// special returns the name of a relish type Go type t stands for that
+// the Encoder recognizes by identity rather than kind, or "".
+func special(t types.Type) string {
+	named, ok := types.Unalias(t).(*types.Named)
+	if !ok || named.Obj().Pkg() == nil {
+		return ""
+	}
+	switch path, name := named.Obj().Pkg().Path(), named.Obj().Name(); {
+	case path == "time" && name == "Time":
+		return "Timestamp"
+	case path == relishPath && (name == "U128" || name == "I128" || name == "Null"):
+		return name
+	}
+	return ""
+}
+
+// basics maps the Go basic kinds that have a relish type to the name of
+// that type's Appender method.
+var basics = map[types.BasicKind]string{
+	types.Bool:    "Bool",
+	types.Uint8:   "U8",
+	types.Uint16:  "U16",
+	types.Uint32:  "U32",
+	types.Uint64:  "U64",
+	types.Int8:    "I8",
+	types.Int16:   "I16",
+	types.Int32:   "I32",
+	types.Int64:   "I64",
+	types.Float32: "F32",
+	types.Float64: "F64",
+	types.String:  "String",
+}
+
+// sizes holds the content size of fixed-size relish types by Appender
+// method name.
+var sizes = map[string]int{
+	"Bool": 1, "U8": 1, "U16": 2, "U32": 4, "U64": 8, "U128": 16,
+	"I8": 1, "I16": 2, "I32": 4, "I64": 8, "I128": 16,
+	"F32": 4, "F64": 8, "Timestamp": 8, "Null": 0,
+}
+
+// scalar returns the Appender method name for t if it is a relish
+// primitive.
+func scalar(t types.Type) (string, bool) {
+	if s := special(t); s != "" {
+		return s, true
+	}
+	if b, ok := t.Underlying().(*types.Basic); ok {
+		s, ok := basics[b.Kind()]
+		return s, ok
+	}
+	return "", false
+}
+
+// fixedSize returns the content size of t if it encodes to a fixed-size
+// relish type.
+func fixedSize(t types.Type) (int, bool) {
+	s, ok := scalar(t)
+	if !ok || s == "String" {
+		return 0, false
+	}
+	return sizes[s], true
+}
+
+// typeID returns the relish type constant for values of t, as the
+// Encoder's typeIDOf does, or false if t has none.
+func typeID(t types.Type) (string, bool) {
+	for isPointer(t) {
+		t = t.Underlying().(*types.Pointer).Elem()
+	}
+	if s, ok := scalar(t); ok {
+		if s == "Timestamp" {
+			s = "timestamp"
+		}
+		return "relish.Type" + strings.ToUpper(s[:1]) + s[1:], true
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Slice, *types.Array:
+		return "relish.TypeArray", true
+	case *types.Map:
+		return "relish.TypeMap", true
+	case *types.Struct:
+		if isEnum(u) {
+			return "relish.TypeEnum", true
+		}
+		return "relish.TypeStruct", true
+	}
+	return "", false
+}
+
+// name returns a fresh temporary variable name.
+func (g *generator) name(prefix string) string {
+	g.tmp++
+	return fmt.Sprintf("%s%d", prefix, g.tmp)
+}
+
+// typeString returns t as written in the generated file, recording the
+// imports it needs.
+func (g *generator) typeString(t types.Type) string {
+	return types.TypeString(t, func(p *types.Package) string {
+		if p == g.pkg {
+			return ""
+		}
+		g.imports[p.Path()] = p.Name()
+		return p.Name()
+	})
+}
+
+// goName returns t as reflect.Type.String would write it.
+func goName(t types.Type) string {
+	switch u := types.Unalias(t).(type) {
+	case *types.Named:
+		name := u.Obj().Name()
+		if p := u.Obj().Pkg(); p != nil {
+			name = p.Name() + "." + name
+		}
+		return name
+	case *types.Basic:
+		// byte and rune are aliases, which reflect does not see.
+		return types.Typ[u.Kind()].Name()
+	case *types.Pointer:
+		return "*" + goName(u.Elem())
+	case *types.Slice:
+		return "[]" + goName(u.Elem())
+	case *types.Array:
+		return fmt.Sprintf("[%d]%s", u.Len(), goName(u.Elem()))
+	case *types.Map:
+		return "map[" + goName(u.Key()) + "]" + goName(u.Elem())
+	case *types.Interface:
+		if u.Empty() {
+			return "interface {}"
+		}
+	case *types.Struct:
+		if u.NumFields() == 0 {
+			return "struct {}"
+		}
+		var b strings.Builder
+		b.WriteString("struct {")
+		for i := range u.NumFields() {
+			if i > 0 {
+				b.WriteString(";")
+			}
+			f := u.Field(i)
+			b.WriteString(" ")
+			if !f.Embedded() {
+				b.WriteString(f.Name() + " ")
+			}
+			b.WriteString(goName(f.Type()))
+			if tag := u.Tag(i); tag != "" {
+				b.WriteString(" " + strconv.Quote(tag))
+			}
+		}
+		b.WriteString(" }")
+		return b.String()
+	}
+	return types.TypeString(t, func(p *types.Package) string { return p.Name() })
+}
+
+// convert returns expr converted to the unnamed type u if t is named.
+func convert(expr string, t types.Type, u string) string {
+	if _, ok := types.Unalias(t).(*types.Basic); ok {
+		return expr
+	}
+	return u + "(" + expr + ")"
+}
+
+func (g *generator) structType(b *bytes.Buffer, named *types.Named) error {
+	name := named.Obj().Name()
+	st := named.Underlying().(*types.Struct)
+	fields := taggedFields(st)
+	for i, f := range fields {
+		if !f.exported {
+			return fmt.Errorf("codegen: %s.%s: tagged field is unexported", name, f.name)
+		}
+		if i > 0 && fields[i-1].id == f.id {
+			return fmt.Errorf("codegen: %s.%s: field id %d already used by %s", name, f.name, f.id, fields[i-1].name)
+		}
+	}
+	enum := isEnum(st)
+	var present []field // fields that may be written as the enum variant
+	if enum {
+		for _, f := range fields {
+			if isPointer(f.typ) {
+				present = append(present, f)
+			}
+		}
+	}
+
+	// MarshalRelish
+	fmt.Fprintf(b, "\n// MarshalRelish appends the Relish encoding of v to a.\nfunc (v *%s) MarshalRelish(a *relish.Appender) error {\n", name)
+	if len(present) > 0 {
+		b.WriteString("n := 0\n")
+		for _, f := range present {
+			fmt.Fprintf(b, "if v.%s != nil {\nn++\n}\n", f.name)
+		}
+		b.WriteString("if n == 1 {\nif err := a.Start(relish.TypeEnum); err != nil {\nreturn err\n}\nm := a.Begin()\nswitch {\n")
+		for _, f := range present {
+			fmt.Fprintf(b, "case v.%s != nil:\na.Buf = append(a.Buf, %d)\n", f.name, f.id)
+			g.encode(b, "(*v."+f.name+")", elem(f.typ), false)
+		}
+		b.WriteString("}\nreturn a.End(m)\n}\n")
+	}
+	b.WriteString("if err := a.Start(relish.TypeStruct); err != nil {\nreturn err\n}\nm := a.Begin()\n")
+	for _, f := range fields {
+		cond := g.writeCond(f)
+		if cond != "" {
+			fmt.Fprintf(b, "if %s {\n", cond)
+		}
+		fmt.Fprintf(b, "a.Buf = append(a.Buf, %d)\n", f.id)
+		g.encode(b, "v."+f.name, f.typ, false)
+		if cond != "" {
+			b.WriteString("}\n")
+		}
+	}
+	b.WriteString("return a.End(m)\n}\n")
+
+	// RelishSize
+	fmt.Fprintf(b, "\n// RelishSize returns the length of the Relish encoding of v.\nfunc (v *%s) RelishSize() int {\nn := 0\n", name)
+	if len(present) > 0 {
+		b.WriteString("k := 0\n")
+		for _, f := range present {
+			fmt.Fprintf(b, "if v.%s != nil {\nk++\n}\n", f.name)
+		}
+		b.WriteString("if k == 1 {\nswitch {\n")
+		for _, f := range present {
+			fmt.Fprintf(b, "case v.%s != nil:\nn = 1\n", f.name)
+			g.size(b, "n", "(*v."+f.name+")", elem(f.typ), false)
+		}
+		b.WriteString("}\nreturn 1 + relish.LenSize(n) + n\n}\n")
+	}
+	for _, f := range fields {
+		cond := g.writeCond(f)
+		if cond != "" {
+			fmt.Fprintf(b, "if %s {\n", cond)
+		}
+		b.WriteString("n++\n")
+		g.size(b, "n", "v."+f.name, f.typ, false)
+		if cond != "" {
+			b.WriteString("}\n")
+		}
+	}
+	b.WriteString("return 1 + relish.LenSize(n) + n\n}\n")
+
+	// UnmarshalRelish
+	want, _ := typeID(named)
+	fmt.Fprintf(b, "\n// UnmarshalRelish decodes the Relish value with type t and content c\n// into v.\nfunc (v *%s) UnmarshalRelish(t relish.TypeID, c []byte) error {\n", name)
+	fmt.Fprintf(b, "if err := relish.CheckType(t, %s, %q); err != nil {\nreturn err\n}\n", want, goName(named))
+	var variants bytes.Buffer
+	used := false
+	for _, f := range fields {
+		fmt.Fprintf(&variants, "case %d:\n", f.id)
+		if !isPointer(f.typ) {
+			variants.WriteString("return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: \"enum field must be pointer\"}\n")
+			continue
+		}
+		used = true
+		g.decode(&variants, "v."+f.name, f.typ, "vt", "vc", func(err string) string {
+			return "relish.InVariant(" + err + ", id)"
+		})
+	}
+	vt, vc := "vt", "vc"
+	if !used {
+		vt, vc = "_", "_"
+	}
+	fmt.Fprintf(b, "if t == relish.TypeEnum {\nid, %s, %s, err := relish.SplitVariant(c)\nif err != nil {\nreturn err\n}\nswitch id {\n", vt, vc)
+	b.Write(variants.Bytes())
+	b.WriteString("default:\nreturn &relish.Error{Kind: relish.ErrTypeMismatch, Detail: \"unknown enum variant\"}\n}\n")
+	if used {
+		b.WriteString("return nil\n")
+	}
+	b.WriteString("}\n")
+	ft, fc := "ft", "fc"
+	if len(fields) == 0 {
+		ft, fc = "_", "_"
+	}
+	fmt.Fprintf(b, "prev := -1\nfor p := c; len(p) > 0; {\nid, %s, %s, rest, err := relish.NextField(p, prev)\nif err != nil {\nreturn err\n}\np, prev = rest, int(id)\n", ft, fc)
+	if len(fields) > 0 {
+		b.WriteString("switch id {\n")
+		for _, f := range fields {
+			fmt.Fprintf(b, "case %d:\n", f.id)
+			g.decode(b, "v."+f.name, f.typ, "ft", "fc", func(err string) string {
+				return "relish.InField(" + err + ", id)"
+			})
+		}
+		b.WriteString("}\n")
+	}
+	b.WriteString("}\nreturn nil\n}\n")
+	return nil
+}
+
+// writeCond returns the condition under which the Encoder writes f in a
+// struct, or "" if it always does.
+func (g *generator) writeCond(f field) string {
+	expr := "v." + f.name
+	if f.optional && isPointer(f.typ) {
+		return expr + " != nil"
+	}
+	if f.omitempty {
+		return g.nonZero(expr, f.typ)
+	}
+	return ""
+}
+
+// nonZero returns a condition that holds when expr, of type t, is not the
+// zero value, as the Encoder judges omitempty fields.
+func (g *generator) nonZero(expr string, t types.Type) string {
+	switch u := t.Underlying().(type) {
+	case *types.Pointer, *types.Slice, *types.Map, *types.Interface, *types.Chan, *types.Signature:
+		return expr + " != nil"
+	case *types.Basic:
+		switch {
+		case u.Info()&types.IsBoolean != 0:
+			return expr
+		case u.Info()&types.IsString != 0:
+			return expr + ` != ""`
+		case u.Kind() == types.UnsafePointer:
+			return expr + " != nil"
+		}
+		return expr + " != 0"
+	}
+	if types.Comparable(t) && !holdsInterface(t) {
+		return expr + " != (" + g.typeString(t) + "{})"
+	}
+	g.imports["reflect"] = "reflect"
+	return "!reflect.DeepEqual(" + expr + ", " + g.typeString(t) + "{})"
+}
+
+// holdsInterface reports whether comparing values of t may compare
+// interfaces, which panics if they hold values that cannot be compared.
+func holdsInterface(t types.Type) bool {
+	switch u := t.Underlying().(type) {
+	case *types.Interface:
+		return true
+	case *types.Array:
+		return holdsInterface(u.Elem())
+	case *types.Struct:
+		for i := 0; i < u.NumFields(); i++ {
+			if holdsInterface(u.Field(i).Type()) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// encode writes statements that append expr, an addressable value of type
+// t, to a: as a TLV, or as an element if elem is set.
+func (g *generator) encode(b *bytes.Buffer, expr string, t types.Type, elem bool) {
+	if s, ok := scalar(t); ok {
+		g.encodeScalar(b, expr, t, s, elem)
+		return
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Pointer:
+		e := u.Elem()
+		if isPointer(e) {
+			break
+		}
+		if special(e) == "Null" {
+			g.encode(b, "", e, elem)
+			return
+		}
+		if g.hasCodec(e) {
+			p := g.name("p")
+			fmt.Fprintf(b, "%s := %s\nif %s == nil {\n%s = new(%s)\n}\n", p, expr, p, p, g.typeString(e))
+			g.encode(b, "(*"+p+")", e, elem)
+			return
+		}
+		x := g.name("x")
+		fmt.Fprintf(b, "var %s %s\nif %s != nil {\n%s = *%s\n}\n", x, g.typeString(e), expr, x, expr)
+		g.encode(b, x, e, elem)
+		return
+	case *types.Slice, *types.Array:
+		e := u.(interface{ Elem() types.Type }).Elem()
+		et, ok := typeID(e)
+		if !ok {
+			break
+		}
+		if !elem {
+			b.WriteString("a.Type(relish.TypeArray)\n")
+		}
+		m := g.name("m")
+		fmt.Fprintf(b, "%s := a.Begin()\na.Buf = append(a.Buf, byte(%s))\n", m, et)
+		if _, isSlice := u.(*types.Slice); isSlice && types.Identical(e, types.Typ[types.Uint8]) {
+			fmt.Fprintf(b, "a.Buf = append(a.Buf, %s...)\n", expr)
+		} else {
+			i := g.name("i")
+			fmt.Fprintf(b, "for %s := range %s {\n", i, expr)
+			g.encode(b, expr+"["+i+"]", e, true)
+			b.WriteString("}\n")
+		}
+		fmt.Fprintf(b, "if err := a.End(%s); err != nil {\nreturn err\n}\n", m)
+		return
+	case *types.Map:
+		kt, ok1 := typeID(u.Key())
+		vt, ok2 := typeID(u.Elem())
+		if !ok1 || !ok2 {
+			break
+		}
+		if !elem {
+			b.WriteString("a.Type(relish.TypeMap)\n")
+		}
+		m, s, k, v := g.name("m"), g.name("s"), g.name("k"), g.name("v")
+		fmt.Fprintf(b, "%s := a.Begin()\na.Buf = append(a.Buf, byte(%s), byte(%s))\n%s := len(a.Buf)\n", m, kt, vt, s)
+		fmt.Fprintf(b, "for %s, %s := range %s {\n", k, v, expr)
+		g.encode(b, k, u.Key(), true)
+		g.encode(b, v, u.Elem(), true)
+		fmt.Fprintf(b, "}\nif err := a.SortPairs(%s, %s, %s); err != nil {\nreturn err\n}\n", s, kt, vt)
+		fmt.Fprintf(b, "if err := a.End(%s); err != nil {\nreturn err\n}\n", m)
+		return
+	case *types.Struct:
+		if g.hasCodec(t) {
+			if elem {
+				et, _ := typeID(t)
+				fmt.Fprintf(b, "a.Elem(%s)\n", et)
+			}
+			fmt.Fprintf(b, "if err := %s.MarshalRelish(a); err != nil {\nreturn err\n}\n", expr)
+			return
+		}
+	}
+	if elem {
+		et, _ := typeID(t)
+		fmt.Fprintf(b, "a.Elem(%s)\n", et)
+	}
+	fmt.Fprintf(b, "if err := a.Encode(%s); err != nil {\nreturn err\n}\n", expr)
+}
+
+func (g *generator) encodeScalar(b *bytes.Buffer, expr string, t types.Type, s string, elem bool) {
+	if !elem {
+		et, _ := typeID(t)
+		fmt.Fprintf(b, "a.Type(%s)\n", et)
+	}
+	switch s {
+	case "Null":
+	case "Timestamp":
+		fmt.Fprintf(b, "if err := a.Timestamp(%s); err != nil {\nreturn err\n}\n", expr)
+	case "String":
+		fmt.Fprintf(b, "if err := a.String(%s); err != nil {\nreturn err\n}\n", convert(expr, t, "string"))
+	case "U128", "I128":
+		fmt.Fprintf(b, "a.%s(%s)\n", s, expr)
+	default:
+		fmt.Fprintf(b, "a.%s(%s)\n", s, convert(expr, t, t.Underlying().String()))
+	}
+}
+
+// size writes statements that add the size of expr, of type t, to the
+// variable n: its TLV, or its element layout if elem is set.
+func (g *generator) size(b *bytes.Buffer, n, expr string, t types.Type, elem bool) {
+	hdr := "1 + "
+	if elem {
+		hdr = ""
+	}
+	if sz, ok := fixedSize(t); ok {
+		if !elem {
+			sz++
+		}
+		fmt.Fprintf(b, "%s += %d\n", n, sz)
+		return
+	}
+	if s, _ := scalar(t); s == "String" {
+		fmt.Fprintf(b, "%s += %srelish.LenSize(len(%s)) + len(%s)\n", n, hdr, expr, expr)
+		return
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Pointer:
+		e := u.Elem()
+		if isPointer(e) {
+			break
+		}
+		if _, ok := fixedSize(e); ok {
+			g.size(b, n, "", e, elem)
+			return
+		}
+		if g.hasCodec(e) {
+			p := g.name("p")
+			fmt.Fprintf(b, "%s := %s\nif %s == nil {\n%s = new(%s)\n}\n", p, expr, p, p, g.typeString(e))
+			g.size(b, n, "(*"+p+")", e, elem)
+			return
+		}
+		x := g.name("x")
+		fmt.Fprintf(b, "var %s %s\nif %s != nil {\n%s = *%s\n}\n", x, g.typeString(e), expr, x, expr)
+		g.size(b, n, x, e, elem)
+		return
+	case *types.Slice, *types.Array:
+		e := u.(interface{ Elem() types.Type }).Elem()
+		if _, ok := typeID(e); !ok {
+			break
+		}
+		c := g.name("c")
+		if sz, ok := fixedSize(e); ok {
+			fmt.Fprintf(b, "%s := 1 + len(%s)*%d\n", c, expr, sz)
+		} else {
+			i := g.name("i")
+			fmt.Fprintf(b, "%s := 1\nfor %s := range %s {\n", c, i, expr)
+			g.size(b, c, expr+"["+i+"]", e, true)
+			b.WriteString("}\n")
+		}
+		fmt.Fprintf(b, "%s += %srelish.LenSize(%s) + %s\n", n, hdr, c, c)
+		return
+	case *types.Map:
+		_, ok1 := typeID(u.Key())
+		_, ok2 := typeID(u.Elem())
+		if !ok1 || !ok2 {
+			break
+		}
+		c := g.name("c")
+		ks, kfixed := fixedSize(u.Key())
+		vs, vfixed := fixedSize(u.Elem())
+		if kfixed && vfixed {
+			fmt.Fprintf(b, "%s := 2 + len(%s)*%d\n", c, expr, ks+vs)
+		} else {
+			k, v := "_", "_"
+			if !kfixed {
+				k = g.name("k")
+			}
+			if !vfixed {
+				v = g.name("v")
+			}
+			fmt.Fprintf(b, "%s := 2\nfor %s, %s := range %s {\n", c, k, v, expr)
+			if kfixed {
+				fmt.Fprintf(b, "%s += %d\n", c, ks)
+			} else {
+				g.size(b, c, k, u.Key(), true)
+			}
+			if vfixed {
+				fmt.Fprintf(b, "%s += %d\n", c, vs)
+			} else {
+				g.size(b, c, v, u.Elem(), true)
+			}
+			b.WriteString("}\n")
+		}
+		fmt.Fprintf(b, "%s += %srelish.LenSize(%s) + %s\n", n, hdr, c, c)
+		return
+	case *types.Struct:
+		if g.hasCodec(t) {
+			fmt.Fprintf(b, "%s += %s.RelishSize()", n, expr)
+			if elem {
+				b.WriteString(" - 1")
+			}
+			b.WriteString("\n")
+			return
+		}
+	}
+	fmt.Fprintf(b, "%s += relish.SizeOf(%s)", n, expr)
+	if elem {
+		b.WriteString(" - 1")
+	}
+	b.WriteString("\n")
+}
+
+// decode writes statements that decode the value with type tv and
+// content cv, both variable names, into dst, an addressable expression of
+// type t. Errors are returned through wrap, which adds their path.
+func (g *generator) decode(b *bytes.Buffer, dst string, t types.Type, tv, cv string, wrap func(string) string) {
+	ret := func(err string) { fmt.Fprintf(b, "return %s\n", wrap(err)) }
+	check := func(want string) {
+		fmt.Fprintf(b, "if err := relish.CheckType(%s, %s, %q); err != nil {\n", tv, want, goName(t))
+		ret("err")
+		b.WriteString("}\n")
+	}
+	if s, ok := scalar(t); ok {
+		want, _ := typeID(t)
+		check(want)
+		switch s {
+		case "Null":
+		case "U128", "I128":
+			fmt.Fprintf(b, "%s = relish.%s(%s)\n", dst, s, cv)
+		case "Bool", "String", "Timestamp":
+			x := g.name("x")
+			fmt.Fprintf(b, "%s, err := relish.Decode%s(%s)\nif err != nil {\n", x, s, cv)
+			ret("err")
+			u := strings.ToLower(s)
+			if s == "Timestamp" {
+				u = ""
+			}
+			fmt.Fprintf(b, "}\n%s = %s\n", dst, g.convertTo(x, t, u))
+		case "U8":
+			fmt.Fprintf(b, "%s = %s\n", dst, g.convertTo(cv+"[0]", t, "uint8"))
+		case "I8":
+			fmt.Fprintf(b, "%s = %s\n", dst, g.convertTo("int8("+cv+"[0])", t, "int8"))
+		case "U16", "U32", "U64", "F32", "F64":
+			fmt.Fprintf(b, "%s = %s\n", dst, g.convertTo("relish.Decode"+s+"("+cv+")", t, t.Underlying().String()))
+		case "I16", "I32", "I64":
+			u := "U" + s[1:]
+			fmt.Fprintf(b, "%s = %s\n", dst, g.convertTo(t.Underlying().String()+"(relish.Decode"+u+"("+cv+"))", t, t.Underlying().String()))
+		}
+		return
+	}
+	switch u := t.Underlying().(type) {
+	case *types.Pointer:
+		e := u.Elem()
+		if isPointer(e) {
+			break
+		}
+		fmt.Fprintf(b, "if %s == nil {\n%s = new(%s)\n}\n", dst, dst, g.typeString(e))
+		g.decode(b, "(*"+dst+")", e, tv, cv, wrap)
+		return
+	case *types.Slice, *types.Array:
+		e := u.(interface{ Elem() types.Type }).Elem()
+		want, ok := typeID(e)
+		if !ok {
+			break
+		}
+		check("relish.TypeArray")
+		et, el, n := g.name("et"), g.name("el"), g.name("n")
+		fmt.Fprintf(b, "%s, %s, err := relish.SplitArray(%s)\nif err != nil {\n", et, el, cv)
+		ret("err")
+		fmt.Fprintf(b, "}\nif err := relish.CheckElemType(%s, %s, %q); err != nil {\n", et, want, goName(e))
+		ret("err")
+		fmt.Fprintf(b, "}\n%s, err := relish.CountElems(%s, %s)\nif err != nil {\n", n, et, el)
+		ret("err")
+		b.WriteString("}\n")
+		if arr, ok := u.(*types.Array); ok {
+			g.imports["fmt"] = "fmt"
+			fmt.Fprintf(b, "if %s != %d {\n", n, arr.Len())
+			ret(fmt.Sprintf("&relish.Error{Kind: relish.ErrTypeMismatch, Detail: fmt.Sprintf(\"array has %%d elements, %s holds %d\", %s)}", goName(t), arr.Len(), n))
+			b.WriteString("}\n")
+		} else {
+			fmt.Fprintf(b, "%s = make(%s, %s)\n", dst, g.typeString(t), n)
+			if types.Identical(e, types.Typ[types.Uint8]) {
+				fmt.Fprintf(b, "copy(%s, %s)\n", dst, el)
+				return
+			}
+		}
+		i, ec := g.name("i"), g.name("ec")
+		fmt.Fprintf(b, "for %s := 0; %s < %s; %s++ {\nvar %s []byte\n%s, %s, _ = relish.SplitElem(%s, %s)\n", i, i, n, i, ec, ec, el, et, el)
+		g.decode(b, dst+"["+i+"]", e, et, ec, func(err string) string {
+			return wrap("relish.InIndex(" + err + ", " + i + ")")
+		})
+		b.WriteString("}\n")
+		return
+	case *types.Map:
+		kwant, ok1 := typeID(u.Key())
+		vwant, ok2 := typeID(u.Elem())
+		if !ok1 || !ok2 {
+			break
+		}
+		check("relish.TypeMap")
+		kt, vt, pr := g.name("kt"), g.name("vt"), g.name("pr")
+		fmt.Fprintf(b, "%s, %s, %s, err := relish.SplitMap(%s)\nif err != nil {\n", kt, vt, pr, cv)
+		ret("err")
+		fmt.Fprintf(b, "}\nif err := relish.CheckElemType(%s, %s, %q); err != nil {\n", kt, kwant, goName(u.Key()))
+		ret("err")
+		fmt.Fprintf(b, "}\nif err := relish.CheckElemType(%s, %s, %q); err != nil {\n", vt, vwant, goName(u.Elem()))
+		ret("err")
+		out, i, kc, vc, next, k, v := g.name("out"), g.name("i"), g.name("kc"), g.name("vc"), g.name("next"), g.name("k"), g.name("v")
+		fmt.Fprintf(b, "}\n%s := make(%s)\nfor %s := 0; len(%s) > 0; %s++ {\n", out, g.typeString(t), i, pr, i)
+		fmt.Fprintf(b, "%s, %s, %s, err := relish.SplitEntry(%s, %s, %s)\nif err != nil {\n", kc, vc, next, kt, vt, pr)
+		ret("err")
+		fmt.Fprintf(b, "}\nvar %s %s\n", k, g.typeString(u.Key()))
+		g.decode(b, k, u.Key(), kt, kc, wrap)
+		fmt.Fprintf(b, "if _, dup := %s[%s]; dup {\n", out, k)
+		ret(fmt.Sprintf("relish.InKey(&relish.Error{Kind: relish.ErrDuplicateMapKey, Detail: \"duplicate map key\"}, %s, %s, %s)", kt, kc, i))
+		fmt.Fprintf(b, "}\nvar %s %s\n", v, g.typeString(u.Elem()))
+		g.decode(b, v, u.Elem(), vt, vc, func(err string) string {
+			return wrap("relish.InKey(" + err + ", " + kt + ", " + kc + ", " + i + ")")
+		})
+		fmt.Fprintf(b, "%s[%s] = %s\n%s = %s\n}\n%s = %s\n", out, k, v, pr, next, dst, out)
+		return
+	case *types.Struct:
+		if g.hasCodec(t) {
+			fmt.Fprintf(b, "if err := %s.UnmarshalRelish(%s, %s); err != nil {\n", dst, tv, cv)
+			ret("err")
+			b.WriteString("}\n")
+			return
+		}
+	}
+	fmt.Fprintf(b, "if err := relish.DecodeValue(&%s, %s, %s); err != nil {\n", dst, tv, cv)
+	ret("err")
+	b.WriteString("}\n")
+}
+
+// convertTo returns expr, of unnamed type u, converted to t if t is named.
+// An empty u means expr already has type t.
+func (g *generator) convertTo(expr string, t types.Type, u string) string {
+	if _, ok := types.Unalias(t).(*types.Basic); ok || u == "" {
+		return expr
+	}
+	return g.typeString(t) + "(" + expr + ")"
+}
@@ -0,0 +1,65 @@
+package codegen
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestGenerate_Golden(t *testing.T) {
+	dir := filepath.Join("..", "internal", "gentest")
+	pkg, err := Load(dir, "relish_codec.go")
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := TaggedTypes(pkg)
+	if want := []string{"Line", "Order", "Shape"}; !reflect.DeepEqual(names, want) {
+		t.Errorf("TaggedTypes = %v, want %v", names, want)
+	}
+	got, err := Generate(pkg, names...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want, err := os.ReadFile(filepath.Join(dir, "relish_codec.go"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("generated code differs from %s; run go generate there", dir)
+	}
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	for _, tc := range []struct{ src, want string }{
+		{"type T struct {\n\tx int `relish:\"0\"`\n}", "codegen: T.x: tagged field is unexported"},
+		{"type T struct {\n\tA int `relish:\"1\"`\n\tB int `relish:\"1\"`\n}", "codegen: T.B: field id 1 already used by A"},
+		{"type T int", "codegen: T is not a struct type"},
+		{"type T struct{}", ""},
+	} {
+		fset := token.NewFileSet()
+		f, err := parser.ParseFile(fset, "t.go", "package p\n"+tc.src, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkg, err := Check(fset, []*ast.File{f})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = Generate(pkg, "T")
+		if got := errString(err); got != tc.want {
+			t.Errorf("Generate(%q) = %q, want %q", tc.src, got, tc.want)
+		}
+	}
+}
+
+func errString(err error) string {
+	if err == nil {
+		return ""
+	}
+	return err.Error()
+}
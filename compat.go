@@ -0,0 +1,197 @@
+package relish
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// SchemaChange is a difference between two versions of a schema.
+type SchemaChange struct {
+	// Path locates the changed type as Error.Path locates values, with
+	// [*] and {*} standing for every array element and map value.
+	Path string
+	// Breaking reports whether data written with one version can fail
+	// to decode, or decode differently, with the other.
+	Breaking bool
+	Detail   string
+}
+
+func (c SchemaChange) String() string {
+	s := c.Detail
+	if c.Path != "" {
+		s = c.Path + ": " + s
+	}
+	if c.Breaking {
+		s = "breaking: " + s
+	}
+	return s
+}
+
+// CheckCompatible compares two versions of a type and reports how they
+// differ on the wire, so that a change can be checked before it is
+// deployed. Each of old and new is a Schema, a reflect.Type, or a value
+// of the Go type to derive the schema of with SchemaOf.
+//
+// Readers and writers of either version may meet data of the other, so
+// a change is breaking if it fails in either direction. Changing the type
+// of a field, array element, map key or map value is breaking, as are
+// removing a required field or an enum variant, adding a required field,
+// and making a field optional or required. Adding or removing an optional
+// field, adding an enum variant and renaming a field are reported but
+// not breaking. Values of a new variant do fail to decode in old readers,
+// but only once writers use it.
+//
+// The changes are returned in the order the schemas were walked. If any
+// is breaking, the error is an *Error of kind ErrIncompatible.
+func CheckCompatible(old, new any) ([]SchemaChange, error) {
+	from, err := compatSchema(old)
+	if err != nil {
+		return nil, err
+	}
+	to, err := compatSchema(new)
+	if err != nil {
+		return nil, err
+	}
+	c := &compatChecker{seen: make(map[[2]Schema]bool)}
+	c.compare("", from, to)
+	var breaking []SchemaChange
+	for _, ch := range c.changes {
+		if ch.Breaking {
+			breaking = append(breaking, ch)
+		}
+	}
+	switch len(breaking) {
+	case 0:
+		return c.changes, nil
+	case 1:
+		return c.changes, &Error{Kind: ErrIncompatible, Path: breaking[0].Path, Detail: breaking[0].Detail}
+	}
+	return c.changes, &Error{Kind: ErrIncompatible, Path: breaking[0].Path,
+		Detail: fmt.Sprintf("%s (and %d more breaking changes)", breaking[0].Detail, len(breaking)-1)}
+}
+
+func compatSchema(v any) (Schema, error) {
+	switch v := v.(type) {
+	case nil:
+		return nil, &Error{Kind: ErrInvalidValue, Detail: "CheckCompatible of nil"}
+	case Schema:
+		return v, nil
+	case reflect.Type:
+		return SchemaOf(v)
+	}
+	return SchemaOf(reflect.TypeOf(v))
+}
+
+type compatChecker struct {
+	changes []SchemaChange
+	seen    map[[2]Schema]bool // struct and enum pairs already compared
+}
+
+func (c *compatChecker) add(path string, breaking bool, format string, args ...any) {
+	c.changes = append(c.changes, SchemaChange{Path: path, Breaking: breaking, Detail: fmt.Sprintf(format, args...)})
+}
+
+func (c *compatChecker) compare(path string, old, new Schema) {
+	switch o := old.(type) {
+	case PrimitiveDesc:
+		if n, ok := new.(PrimitiveDesc); ok && n.Type == o.Type {
+			return
+		}
+	case *ArrayDesc:
+		if n, ok := new.(*ArrayDesc); ok {
+			c.compare(path+"[*]", o.Elem, n.Elem)
+			return
+		}
+	case *MapDesc:
+		if n, ok := new.(*MapDesc); ok {
+			keys := &compatChecker{seen: c.seen}
+			keys.compare(path, o.Key, n.Key)
+			if len(keys.changes) > 0 {
+				c.add(path, true, "map key type changed from %v to %v", o.Key, n.Key)
+			}
+			c.compare(path+"{*}", o.Value, n.Value)
+			return
+		}
+	case *StructDesc:
+		if n, ok := new.(*StructDesc); ok {
+			if !c.visit(o, n) {
+				c.fields(path, o.Fields, n.Fields)
+			}
+			return
+		}
+	case *EnumDesc:
+		if n, ok := new.(*EnumDesc); ok {
+			if !c.visit(o, n) {
+				c.variants(path, o.Variants, n.Variants)
+			}
+			return
+		}
+	}
+	c.add(path, true, "type changed from %v to %v", old, new)
+}
+
+// visit reports whether old and new have been compared already, and
+// marks them compared, so that recursive schemas terminate.
+func (c *compatChecker) visit(old, new Schema) bool {
+	k := [2]Schema{old, new}
+	if c.seen[k] {
+		return true
+	}
+	c.seen[k] = true
+	return false
+}
+
+func (c *compatChecker) fields(path string, old, new []FieldDesc) {
+	for _, o := range old {
+		p := pathField(path, o.ID)
+		n, ok := findField(new, o.ID)
+		switch {
+		case !ok && o.Optional:
+			c.add(p, false, "optional field %s removed; its ID must not be reused", o.Name)
+			continue
+		case !ok:
+			c.add(p, true, "required field %s removed", o.Name)
+			continue
+		}
+		if o.Name != n.Name {
+			c.add(p, false, "field %s renamed to %s", o.Name, n.Name)
+		}
+		switch {
+		case o.Optional && !n.Optional:
+			c.add(p, true, "field %s became required; old data may lack it", n.Name)
+		case !o.Optional && n.Optional:
+			c.add(p, true, "field %s became optional; old readers require it", n.Name)
+		}
+		c.compare(p, o.Type, n.Type)
+	}
+	for _, n := range new {
+		if _, ok := findField(old, n.ID); ok {
+			continue
+		}
+		if n.Optional {
+			c.add(pathField(path, n.ID), false, "optional field %s added", n.Name)
+		} else {
+			c.add(pathField(path, n.ID), true, "required field %s added; old data lacks it", n.Name)
+		}
+	}
+}
+
+func (c *compatChecker) variants(path string, old, new []FieldDesc) {
+	for _, o := range old {
+		p := pathVariant(path, o.ID)
+		n, ok := findField(new, o.ID)
+		if !ok {
+			c.add(p, true, "variant %s removed", o.Name)
+			continue
+		}
+		if o.Name != n.Name {
+			c.add(p, false, "variant %s renamed to %s", o.Name, n.Name)
+		}
+		c.compare(p, o.Type, n.Type)
+	}
+	for _, n := range new {
+		if _, ok := findField(old, n.ID); !ok {
+			c.add(pathVariant(path, n.ID), false, "variant %s added; old readers reject values that use it", n.Name)
+		}
+	}
+}
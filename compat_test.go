@@ -0,0 +1,94 @@
+package relish
+
+import (
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type compatV1 struct {
+	ID     uint32            `relish:"0"`
+	Note   *string           `relish:"1,optional"`
+	Lines  []compatLineV1    `relish:"2"`
+	Counts map[string]uint16 `relish:"3"`
+	Old    *uint8            `relish:"4,optional"`
+	Gone   string            `relish:"5"`
+	Kind   compatKindV1      `relish:"6"`
+	Self   *compatV1         `relish:"7,optional"`
+}
+
+type compatLineV1 struct {
+	SKU string `relish:"0"`
+	Qty int32  `relish:"1"`
+}
+
+type compatKindV1 struct {
+	A *uint8  `relish:"0,optional"`
+	B *string `relish:"1,optional"`
+}
+
+type compatV2 struct {
+	ID     uint32            `relish:"0"`
+	Note   string            `relish:"1"`
+	Lines  []compatLineV2    `relish:"2"`
+	Counts map[uint32]uint16 `relish:"3"`
+	Kind   compatKindV2      `relish:"6"`
+	Self   *compatV2         `relish:"7,optional"`
+	New    *bool             `relish:"8,optional"`
+	Must   bool              `relish:"9"`
+}
+
+type compatLineV2 struct {
+	Code string `relish:"0"`
+	Qty  int64  `relish:"1"`
+}
+
+type compatKindV2 struct {
+	A *uint8 `relish:"0,optional"`
+	C *bool  `relish:"2,optional"`
+}
+
+func TestCheckCompatible(t *testing.T) {
+	changes, err := CheckCompatible(compatV1{}, reflect.TypeOf(compatV2{}))
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		"breaking: .1: field Note became required; old data may lack it",
+		".2[*].0: field SKU renamed to Code",
+		"breaking: .2[*].1: type changed from i32 to i64",
+		"breaking: .3: map key type changed from string to u32",
+		".4: optional field Old removed; its ID must not be reused",
+		"breaking: .5: required field Gone removed",
+		"breaking: .6<1>: variant B removed",
+		".6<2>: variant C added; old readers reject values that use it",
+		".8: optional field New added",
+		"breaking: .9: required field Must added; old data lacks it",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("CheckCompatible =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	var e *Error
+	if !errors.As(err, &e) || e.Kind != ErrIncompatible || e.Path != ".1" {
+		t.Errorf("err = %v, want ErrIncompatible at .1", err)
+	}
+}
+
+func TestCheckCompatible_Safe(t *testing.T) {
+	old := &StructDesc{Name: "T", Fields: []FieldDesc{
+		{ID: 0, Name: "a", Type: &ArrayDesc{Elem: PrimitiveDesc{Type: TypeU8}}},
+	}}
+	new := &StructDesc{Name: "T", Fields: []FieldDesc{
+		{ID: 0, Name: "a", Type: &ArrayDesc{Elem: PrimitiveDesc{Type: TypeU8}}},
+		{ID: 1, Name: "b", Type: &MapDesc{Key: PrimitiveDesc{Type: TypeString}, Value: old}, Optional: true},
+	}}
+	changes, err := CheckCompatible(old, new)
+	if err != nil || len(changes) != 1 || changes[0].String() != ".1: optional field b added" {
+		t.Errorf("CheckCompatible = %v, %v", changes, err)
+	}
+	if changes, err := CheckCompatible(new, new); err != nil || len(changes) != 0 {
+		t.Errorf("CheckCompatible(new, new) = %v, %v", changes, err)
+	}
+}
@@ -2,8 +2,13 @@ package relish
 
 import (
 	"bytes"
+	"encoding/binary"
+	"fmt"
 	"io"
+	"math"
 	"reflect"
+	"time"
+	"unicode/utf8"
 
 	intr "github.com/dadrian/relish/internal"
 )
@@ -12,76 +17,387 @@ import (
 type Decoder struct {
 	r      io.Reader
 	offset int64
+	mask   [][]pathSeg
 }
 
 // NewDecoder creates a new streaming decoder.
 func NewDecoder(r io.Reader) *Decoder { return &Decoder{r: r} }
 
-// Decode reads a TLV into v. This is a stub for now.
+// SetFieldMask restricts later calls to Decode to the values selected by
+// paths, such as "1", "3.2" and "4[*].0". Paths use the syntax of Query
+// and may name the Go fields of the decode target; array elements and
+// map values are selected with [*] and {*}. Struct fields and enum
+// variants outside the mask are skipped after checking only their
+// framing, and their Go fields are left untouched. Calling SetFieldMask
+// with no paths removes the mask.
+func (d *Decoder) SetFieldMask(paths ...string) error {
+	var mask [][]pathSeg
+	for _, p := range paths {
+		segs, err := parsePath(p)
+		if err != nil {
+			return err
+		}
+		for _, s := range segs {
+			if s.kind == segField && s.wild || (s.kind == segIndex || s.kind == segKey) && !s.wild {
+				return &Error{Kind: ErrSyntax, Detail: fmt.Sprintf("path %q: %s cannot be used in a field mask", p, s)}
+			}
+		}
+		mask = append(mask, segs)
+	}
+	d.mask = mask
+	return nil
+}
+
+// Decode reads the next TLV into v, which must be a non-nil pointer.
 func (d *Decoder) Decode(v any) error {
 	rv := reflect.ValueOf(v)
 	if rv.Kind() != reflect.Pointer || rv.IsNil() {
 		return &Error{Kind: ErrTypeMismatch, Detail: "Decode target must be non-nil pointer"}
 	}
-	rv = rv.Elem()
-	switch rv.Kind() {
-	case reflect.Struct:
-		// Peek type for struct vs enum
-		t, err := intr.ReadType(d.r)
-		if err != nil {
+	m, err := buildMask(d.mask, rv.Type().Elem())
+	if err != nil {
+		return err
+	}
+	t, n, err := d.readHeader()
+	if err != nil {
+		return err
+	}
+	// Check the type before reading the content, skipping content that
+	// cannot be decoded into v. Structs are left to decodeValue, as an
+	// Unmarshaler may take any type.
+	rt := rv.Type().Elem()
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	if want, err := typeIDOf(rt); err == nil && rt.Kind() != reflect.Struct && t != want {
+		if err := d.skipContent(n); err != nil {
 			return err
 		}
-		switch t {
-		case 0x11:
-			return d.decodeStructInto(rv)
-		case 0x12:
-			return d.decodeEnumInto(rv)
+		return &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("cannot decode %v into %v", TypeID(t), rt)}
+	}
+	c, err := d.readContent(n)
+	if err != nil {
+		return err
+	}
+	return decodeValue(rv.Elem(), t, c, m)
+}
+
+// SkipValue skips the next TLV, reading past its content without
+// holding it in memory or checking more than its header.
+func (d *Decoder) SkipValue() error {
+	_, n, err := d.readHeader()
+	if err != nil {
+		return err
+	}
+	return d.skipContent(n)
+}
+
+// readHeader reads the type ID and length of the next TLV from the
+// underlying reader.
+func (d *Decoder) readHeader() (byte, int, error) {
+	t, err := intr.ReadType(d.r)
+	if err != nil {
+		if intr.IsInvalidType(err) {
+			return 0, 0, &Error{Offset: d.offset, Kind: ErrInvalidTypeID, Detail: err.Error()}
+		}
+		return 0, 0, err
+	}
+	d.offset++
+	n, ok := intr.FixedSize(t)
+	if !ok {
+		if !intr.IsVarSize(t) {
+			return 0, 0, &Error{Offset: d.offset - 1, Kind: ErrInvalidTypeID, Detail: fmt.Sprintf("unknown type id 0x%02x", t)}
+		}
+		var used int
+		if n, used, err = intr.ReadLen(d.r); err != nil {
+			return 0, 0, unexpectedEOF(err)
+		}
+		d.offset += int64(used)
+	}
+	return t, n, nil
+}
+
+// readContent reads n bytes of content. The buffer grows only as bytes
+// arrive, so a corrupt length cannot force a large allocation.
+func (d *Decoder) readContent(n int) ([]byte, error) {
+	var b bytes.Buffer
+	read, err := io.CopyN(&b, d.r, int64(n))
+	d.offset += read
+	if err != nil {
+		return nil, unexpectedEOF(err)
+	}
+	return b.Bytes(), nil
+}
+
+// skipContent reads past n bytes of content.
+func (d *Decoder) skipContent(n int) error {
+	skipped, err := io.CopyN(io.Discard, d.r, int64(n))
+	d.offset += skipped
+	return unexpectedEOF(err)
+}
+
+// unexpectedEOF turns io.EOF, met partway through a value, into
+// io.ErrUnexpectedEOF.
+func unexpectedEOF(err error) error {
+	if err == io.EOF {
+		return io.ErrUnexpectedEOF
+	}
+	return err
+}
+
+// fieldMask selects the parts of a value to decode. A nil mask selects
+// the whole value.
+type fieldMask struct {
+	// fields holds the selected struct fields and enum variants, or is nil
+	// if the mask does not select by field.
+	fields map[byte]*fieldMask
+	// elems applies to every array element and map value.
+	elems *fieldMask
+}
+
+// buildMask builds the mask for paths, resolving field names against rt.
+func buildMask(paths [][]pathSeg, rt reflect.Type) (*fieldMask, error) {
+	if len(paths) == 0 {
+		return nil, nil
+	}
+	m := &fieldMask{}
+	for _, p := range paths {
+		segs := append([]pathSeg(nil), p...)
+		if err := resolveNames(segs, rt); err != nil {
+			return nil, err
+		}
+		// A trailing wildcard selects every element, i.e. the whole value.
+		for len(segs) > 0 && segs[len(segs)-1].wild {
+			segs = segs[:len(segs)-1]
+		}
+		if len(segs) == 0 {
+			return nil, nil
+		}
+		m.add(segs)
+	}
+	return m, nil
+}
+
+func (m *fieldMask) add(segs []pathSeg) {
+	s, rest := segs[0], segs[1:]
+	if s.wild {
+		if m.elems == nil {
+			m.elems = &fieldMask{}
+		}
+		m.elems.add(rest)
+		return
+	}
+	if m.fields == nil {
+		m.fields = make(map[byte]*fieldMask)
+	}
+	sub, ok := m.fields[s.id]
+	switch {
+	case ok && sub == nil:
+		// Already selected whole.
+	case len(rest) == 0:
+		m.fields[s.id] = nil
+	default:
+		if sub == nil {
+			sub = &fieldMask{}
+			m.fields[s.id] = sub
+		}
+		sub.add(rest)
+	}
+}
+
+// skip reports whether field or variant id is outside the mask, and
+// returns the mask for it otherwise.
+func (m *fieldMask) skip(id byte) (*fieldMask, bool) {
+	if m == nil || m.fields == nil {
+		return nil, false
+	}
+	sub, ok := m.fields[id]
+	return sub, !ok
+}
+
+func (m *fieldMask) elem() *fieldMask {
+	if m == nil {
+		return nil
+	}
+	return m.elems
+}
+
+// decodeValue decodes the value with type t and content c into dst.
+func decodeValue(dst reflect.Value, t byte, c []byte, m *fieldMask) error {
+	if dst.Kind() == reflect.Pointer {
+		if dst.IsNil() {
+			dst.Set(reflect.New(dst.Type().Elem()))
+		}
+		return decodeValue(dst.Elem(), t, c, m)
+	}
+	if m == nil {
+		if u, ok := unmarshalerOf(dst); ok {
+			return u.UnmarshalRelish(TypeID(t), c)
+		}
+	}
+	want, err := typeIDOf(dst.Type())
+	if err != nil {
+		return err
+	}
+	if t != want && !(structLike(t) && structLike(want)) {
+		return &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("cannot decode %v into %v", TypeID(t), dst.Type())}
+	}
+	le := binary.LittleEndian
+	switch dst.Type() {
+	case u128Type:
+		dst.Set(reflect.ValueOf(U128(c)))
+		return nil
+	case i128Type:
+		dst.Set(reflect.ValueOf(I128(c)))
+		return nil
+	case nullType:
+		return nil
+	case timeType:
+		sec := le.Uint64(c)
+		if sec > math.MaxInt64 {
+			return &Error{Kind: ErrInvalidValue, Detail: "timestamp out of range"}
+		}
+		dst.Set(reflect.ValueOf(time.Unix(int64(sec), 0).UTC()))
+		return nil
+	}
+	switch dst.Kind() {
+	case reflect.Bool:
+		switch c[0] {
+		case 0x00:
+			dst.SetBool(false)
+		case 0xFF:
+			dst.SetBool(true)
 		default:
-			return &Error{Kind: ErrTypeMismatch, Detail: "expected struct/enum TLV"}
+			return &Error{Kind: ErrInvalidValue, Detail: "invalid bool value"}
 		}
+	case reflect.Uint8:
+		dst.SetUint(uint64(c[0]))
+	case reflect.Uint16:
+		dst.SetUint(uint64(le.Uint16(c)))
+	case reflect.Uint32:
+		dst.SetUint(uint64(le.Uint32(c)))
+	case reflect.Uint64:
+		dst.SetUint(le.Uint64(c))
+	case reflect.Int8:
+		dst.SetInt(int64(int8(c[0])))
+	case reflect.Int16:
+		dst.SetInt(int64(int16(le.Uint16(c))))
+	case reflect.Int32:
+		dst.SetInt(int64(int32(le.Uint32(c))))
+	case reflect.Int64:
+		dst.SetInt(int64(le.Uint64(c)))
+	case reflect.Float32:
+		dst.SetFloat(float64(math.Float32frombits(le.Uint32(c))))
+	case reflect.Float64:
+		dst.SetFloat(math.Float64frombits(le.Uint64(c)))
 	case reflect.String:
-		s, err := intr.ReadStringTLV(d.r)
+		if !utf8.Valid(c) {
+			return &Error{Kind: ErrInvalidUTF8, Detail: "invalid utf-8 in string"}
+		}
+		dst.SetString(string(c))
+	case reflect.Slice, reflect.Array:
+		return decodeArrayInto(dst, c, m.elem())
+	case reflect.Map:
+		return decodeMapInto(dst, c, m.elem())
+	case reflect.Struct:
+		if TypeID(t) == TypeEnum {
+			return decodeEnumInto(dst, c, m)
+		}
+		return decodeStructInto(dst, c, m)
+	}
+	return nil
+}
+
+func decodeArrayInto(dst reflect.Value, c []byte, m *fieldMask) error {
+	if len(c) == 0 {
+		return &Error{Kind: ErrUnexpectedEOF, Detail: "array missing element type"}
+	}
+	et, elems := c[0], c[1:]
+	if err := checkElemType(et, dst.Type().Elem()); err != nil {
+		return err
+	}
+	n := 0
+	for p := elems; len(p) > 0; n++ {
+		_, rest, err := splitElem(et, p)
 		if err != nil {
 			return err
 		}
-		rv.SetString(s)
-		return nil
-	case reflect.Bool:
-		b, err := intr.ReadBoolTLV(d.r)
+		p = rest
+	}
+	if dst.Kind() == reflect.Array {
+		if n != dst.Len() {
+			return &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("array has %d elements, %v holds %d", n, dst.Type(), dst.Len())}
+		}
+	} else {
+		dst.Set(reflect.MakeSlice(dst.Type(), n, n))
+	}
+	for i := 0; i < n; i++ {
+		ec, rest, _ := splitElem(et, elems)
+		if err := decodeValue(dst.Index(i), et, ec, m); err != nil {
+			return prefixPath(err, pathIndex("", i))
+		}
+		elems = rest
+	}
+	return nil
+}
+
+func decodeMapInto(dst reflect.Value, c []byte, m *fieldMask) error {
+	if len(c) < 2 {
+		return &Error{Kind: ErrUnexpectedEOF, Detail: "map missing key or value type"}
+	}
+	kt, vt := c[0], c[1]
+	rt := dst.Type()
+	if err := checkElemType(kt, rt.Key()); err != nil {
+		return err
+	}
+	if err := checkElemType(vt, rt.Elem()); err != nil {
+		return err
+	}
+	out := reflect.MakeMap(rt)
+	for i, p := 0, c[2:]; len(p) > 0; i++ {
+		kc, vc, next, err := splitEntry(kt, vt, p)
 		if err != nil {
 			return err
 		}
-		rv.SetBool(b)
-		return nil
-	case reflect.Uint32:
-		u, err := intr.ReadU32TLV(d.r)
-		if err != nil {
+		k := reflect.New(rt.Key()).Elem()
+		if err := decodeValue(k, kt, kc, nil); err != nil {
 			return err
 		}
-		rv.SetUint(uint64(u))
-		return nil
-	default:
-		return ErrNotImplemented
+		if out.MapIndex(k).IsValid() {
+			return &Error{Kind: ErrDuplicateMapKey, Path: pathKey("", kt, kc, i), Detail: "duplicate map key"}
+		}
+		v := reflect.New(rt.Elem()).Elem()
+		if err := decodeValue(v, vt, vc, m); err != nil {
+			return prefixPath(err, pathKey("", kt, kc, i))
+		}
+		out.SetMapIndex(k, v)
+		p = next
 	}
+	dst.Set(out)
+	return nil
 }
 
-// SkipValue efficiently skips a single TLV value. Stub for now.
-func (d *Decoder) SkipValue() error { return ErrNotImplemented }
-
-func (d *Decoder) decodeStructInto(dst reflect.Value) error {
-	// We already consumed type byte in Decode; next is length
-	n, _, err := intr.ReadLen(d.r)
+// checkElemType reports an error unless array elements or map keys or
+// values of type et can be decoded into Go type rt.
+func checkElemType(et byte, rt reflect.Type) error {
+	want, err := typeIDOf(rt)
 	if err != nil {
 		return err
 	}
-	if n == 0 {
+	if et == want || structLike(et) && structLike(want) {
 		return nil
 	}
-	buf := make([]byte, n)
-	if err := intr.ReadFull(d.r, buf); err != nil {
-		return err
-	}
-	br := bytes.NewReader(buf)
+	return &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("cannot decode %v elements into %v", TypeID(et), rt)}
+}
+
+// structLike reports whether t is a struct or an enum. Go structs decode
+// from either, as encodeStruct may produce either.
+func structLike(t byte) bool { return TypeID(t) == TypeStruct || TypeID(t) == TypeEnum }
+
+// decodeStructInto decodes struct content c into dst. Fields without a
+// matching Go field, and fields outside m, are skipped after checking
+// their framing.
+func decodeStructInto(dst reflect.Value, c []byte, m *fieldMask) error {
 	// Build field id -> index map
 	rt := dst.Type()
 	idToIndex := make(map[int]int)
@@ -91,12 +407,8 @@ func (d *Decoder) decodeStructInto(dst reflect.Value) error {
 		}
 	}
 	var prev = -1
-	for br.Len() > 0 {
-		// Field ID
-		b, err := br.ReadByte()
-		if err != nil {
-			return err
-		}
+	for p := c; len(p) > 0; {
+		b := p[0]
 		if b&0x80 != 0 {
 			return &Error{Kind: ErrInvalidFieldID, Detail: "top bit set"}
 		}
@@ -105,47 +417,43 @@ func (d *Decoder) decodeStructInto(dst reflect.Value) error {
 			return &Error{Kind: ErrFieldOrder, Detail: "field ids not strictly increasing"}
 		}
 		prev = id
-		// Read full TLV for this field
-		tlv, err := readTLVBytes(br)
+		ft, fc, next, err := splitValue(p[1:])
 		if err != nil {
 			return err
 		}
+		p = next
+		sub, skip := m.skip(b)
+		if skip {
+			continue
+		}
 		idx, ok := idToIndex[id]
 		if !ok {
 			// unknown field: ignore
 			continue
 		}
-		f := dst.Field(idx)
-		// Handle pointer optional fields
-		if f.Kind() == reflect.Pointer {
-			if f.IsNil() {
-				f.Set(reflect.New(f.Type().Elem()))
-			}
-			f = f.Elem()
-		}
-		// Decode into field from TLV bytes
-		if err := NewDecoder(bytes.NewReader(tlv)).Decode(f.Addr().Interface()); err != nil {
-			return err
+		if err := decodeValue(dst.Field(idx), ft, fc, sub); err != nil {
+			return prefixPath(err, pathField("", b))
 		}
 	}
 	return nil
 }
 
-func (d *Decoder) decodeEnumInto(dst reflect.Value) error {
-	// Type already consumed by caller
-	n, _, err := intr.ReadLen(d.r)
+func decodeEnumInto(dst reflect.Value, c []byte, m *fieldMask) error {
+	if len(c) < 1 {
+		return &Error{Kind: ErrTypeMismatch, Detail: "enum content too short"}
+	}
+	vid := c[0]
+	vt, vc, rest, err := splitValue(c[1:])
 	if err != nil {
 		return err
 	}
-	if n < 1 {
-		return &Error{Kind: ErrTypeMismatch, Detail: "enum content too short"}
+	if len(rest) != 0 {
+		return &Error{Kind: ErrEnumLengthMismatch, Detail: "variant did not consume full length"}
 	}
-	buf := make([]byte, n)
-	if err := intr.ReadFull(d.r, buf); err != nil {
-		return err
+	sub, skip := m.skip(vid)
+	if skip {
+		return nil
 	}
-	vid := buf[0]
-	payload := buf[1:]
 	rt := dst.Type()
 	var idx = -1
 	for i := 0; i < rt.NumField(); i++ {
@@ -157,59 +465,13 @@ func (d *Decoder) decodeEnumInto(dst reflect.Value) error {
 	if idx < 0 {
 		return &Error{Kind: ErrTypeMismatch, Detail: "unknown enum variant"}
 	}
-	// Decode variant value; must consume entire payload
-	br := bytes.NewReader(payload)
 	f := dst.Field(idx)
 	if f.Kind() != reflect.Pointer {
 		// enum fields must be pointers in these tests
 		return &Error{Kind: ErrTypeMismatch, Detail: "enum field must be pointer"}
 	}
-	if f.IsNil() {
-		f.Set(reflect.New(f.Type().Elem()))
-	}
-	if err := NewDecoder(br).Decode(f.Interface()); err != nil {
-		return err
-	}
-	if br.Len() != 0 {
-		return &Error{Kind: ErrEnumLengthMismatch, Detail: "variant did not consume full length"}
+	if err := decodeValue(f, vt, vc, sub); err != nil {
+		return prefixPath(err, pathVariant("", vid))
 	}
 	return nil
 }
-
-// readTLVBytes reads a complete TLV (type + [len] + content) and returns its bytes.
-func readTLVBytes(r io.Reader) ([]byte, error) {
-	t, err := intr.ReadType(r)
-	if err != nil {
-		return nil, err
-	}
-	if n, ok := intr.FixedSize(t); ok {
-		if n == 0 {
-			return []byte{t}, nil
-		}
-		out := make([]byte, 1+n)
-		out[0] = t
-		if err := intr.ReadFull(r, out[1:]); err != nil {
-			return nil, err
-		}
-		return out, nil
-	}
-	// varsize
-	n, used, err := intr.ReadLen(r)
-	if err != nil {
-		return nil, err
-	}
-	hdr := make([]byte, 1+used)
-	hdr[0] = t
-	// Re-encode the length
-	var tmp [4]byte
-	_ = intr.EncodeLen(tmp[:], n)
-	copy(hdr[1:], tmp[:used])
-	out := make([]byte, len(hdr)+n)
-	copy(out, hdr)
-	if n > 0 {
-		if err := intr.ReadFull(r, out[len(hdr):]); err != nil {
-			return nil, err
-		}
-	}
-	return out, nil
-}
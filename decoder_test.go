@@ -0,0 +1,202 @@
+package relish
+
+import (
+	"bytes"
+	"io"
+	"reflect"
+	"runtime"
+	"testing"
+	"time"
+)
+
+func TestDecode_AllTypes(t *testing.T) {
+	type Variant struct {
+		N *int16  `relish:"0,optional"`
+		S *string `relish:"1,optional"`
+	}
+	type All struct {
+		B    bool              `relish:"0"`
+		U8   uint8             `relish:"1"`
+		U16  uint16            `relish:"2"`
+		U64  uint64            `relish:"3"`
+		U128 U128              `relish:"4"`
+		I8   int8              `relish:"5"`
+		I32  int32             `relish:"6"`
+		I64  int64             `relish:"7"`
+		I128 I128              `relish:"8"`
+		F32  float32           `relish:"9"`
+		F64  float64           `relish:"10"`
+		T    time.Time         `relish:"11"`
+		Null Null              `relish:"12"`
+		Arr  []string          `relish:"13"`
+		Fix  [2]uint16         `relish:"14"`
+		Map  map[uint32]string `relish:"15"`
+		Enum []Variant         `relish:"16"`
+		Ptr  *uint32           `relish:"17"`
+	}
+	want := All{
+		B: true, U8: 1, U16: 2, U64: 3, U128: U128{15: 1}, I8: -1, I32: -2, I64: -3, I128: I128{0: 9},
+		F32: 1.5, F64: -2.25, T: time.Unix(1700000000, 0).UTC(),
+		Arr: []string{"a", "bc"}, Fix: [2]uint16{4, 5}, Map: map[uint32]string{1: "one", 2: "two"},
+		Enum: []Variant{{N: ptr(int16(-7))}, {S: ptr("s")}}, Ptr: ptr(uint32(6)),
+	}
+	data, err := Marshal(want)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got All
+	if err := Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v\nwant %#v", got, want)
+	}
+}
+
+func TestDecode_Errors(t *testing.T) {
+	type S struct {
+		M map[string]uint8 `relish:"0"`
+	}
+	// Duplicate map key.
+	data := []byte{0x11, 0x16, 0x00, 0x10, 0x10, 0x0E, 0x02, 0x02, 'a', 0x01, 0x02, 'a', 0x02}
+	var s S
+	err := Unmarshal(data, &s)
+	if e, ok := err.(*Error); !ok || e.Kind != ErrDuplicateMapKey || e.Path != `.0{"a"}` {
+		t.Fatalf("got %v, want duplicate key at .0{\"a\"}", err)
+	}
+	// Wrong element type.
+	var u []uint16
+	err = Unmarshal([]byte{0x0F, 0x04, 0x02, 0x01}, &u)
+	if e, ok := err.(*Error); !ok || e.Kind != ErrTypeMismatch {
+		t.Fatalf("got %v, want type mismatch", err)
+	}
+	// Nulls take no bytes, so nothing may follow an array's null type.
+	var nulls []Null
+	err = Unmarshal([]byte{0x0F, 0x04, 0x00, 0x01}, &nulls)
+	if e, ok := err.(*Error); !ok || e.Kind != ErrInvalidValue {
+		t.Fatalf("got %v, want invalid value", err)
+	}
+}
+
+func TestDecoder_SkipValue(t *testing.T) {
+	stream := []byte{
+		0x11, 0x0E, 0x00, 0x0E, 0x08, 'a', 'b', 'c', 'd',
+		0x04, 0x01, 0x00, 0x00, 0x00,
+		0x00,
+		0x0E, 0x02, 'z',
+	}
+	d := NewDecoder(bytes.NewReader(stream))
+	for i := 0; i < 3; i++ {
+		if err := d.SkipValue(); err != nil {
+			t.Fatalf("SkipValue %d: %v", i, err)
+		}
+	}
+	var s string
+	if err := d.Decode(&s); err != nil || s != "z" {
+		t.Fatalf("Decode after skipping = %q, %v", s, err)
+	}
+	if err := d.SkipValue(); err != io.EOF {
+		t.Fatalf("SkipValue at end = %v, want io.EOF", err)
+	}
+	for _, data := range [][]byte{{0x0E, 0x08, 'a'}, {0x0E}, {0x0E, 0x01, 0x00}} {
+		if err := NewDecoder(bytes.NewReader(data)).SkipValue(); err != io.ErrUnexpectedEOF {
+			t.Fatalf("SkipValue(% x) = %v, want io.ErrUnexpectedEOF", data, err)
+		}
+	}
+}
+
+func TestDecode_Truncated(t *testing.T) {
+	// A string claiming 2 GiB of content followed by one byte.
+	data := []byte{0x0E, 0xFF, 0xFF, 0xFF, 0xFF, 'a'}
+	var before, after runtime.MemStats
+	runtime.ReadMemStats(&before)
+	var s string
+	err := NewDecoder(bytes.NewReader(data)).Decode(&s)
+	runtime.ReadMemStats(&after)
+	if err != io.ErrUnexpectedEOF {
+		t.Fatalf("Decode = %v, want io.ErrUnexpectedEOF", err)
+	}
+	if n := after.TotalAlloc - before.TotalAlloc; n > 1<<20 {
+		t.Fatalf("Decode of a truncated value allocated %d bytes", n)
+	}
+
+	// A value of the wrong type is skipped, not read.
+	d := NewDecoder(bytes.NewReader([]byte{0x0E, 0x02, 'a', 0x02, 0x07}))
+	var n uint32
+	if e, ok := d.Decode(&n).(*Error); !ok || e.Kind != ErrTypeMismatch {
+		t.Fatalf("Decode of a string into uint32 = %v, want type mismatch", e)
+	}
+	var u uint8
+	if err := d.Decode(&u); err != nil || u != 7 {
+		t.Fatalf("Decode after a mismatch = %d, %v", u, err)
+	}
+}
+
+func TestDecode_FieldMask(t *testing.T) {
+	type Line struct {
+		Sku  string `relish:"0"`
+		Note string `relish:"1"`
+	}
+	type Addr struct {
+		City string `relish:"1"`
+		Zip  string `relish:"2"`
+	}
+	type Order struct {
+		ID    uint32   `relish:"1"`
+		Memo  string   `relish:"2"`
+		Addr  Addr     `relish:"3"`
+		Lines []Line   `relish:"4"`
+		Tags  []string `relish:"5"`
+	}
+	full := Order{
+		ID: 7, Memo: "memo", Addr: Addr{City: "Ann Arbor", Zip: "48104"},
+		Lines: []Line{{"a", "x"}, {"b", "y"}}, Tags: []string{"t"},
+	}
+	data, err := Marshal(full)
+	if err != nil {
+		t.Fatal(err)
+	}
+	decode := func(paths ...string) Order {
+		t.Helper()
+		d := NewDecoder(bytes.NewReader(data))
+		if err := d.SetFieldMask(paths...); err != nil {
+			t.Fatal(err)
+		}
+		var got Order
+		if err := d.Decode(&got); err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	want := Order{ID: 7, Addr: Addr{Zip: "48104"}, Lines: []Line{{Sku: "a"}, {Sku: "b"}}}
+	if got := decode("1", "3.2", "4[*].0"); !reflect.DeepEqual(got, want) {
+		t.Fatalf("got %#v\nwant %#v", got, want)
+	}
+	if got := decode(".Addr", ".Addr.City", ".Tags[*]"); !reflect.DeepEqual(got, Order{Addr: full.Addr, Tags: full.Tags}) {
+		t.Fatalf("named mask: got %#v", got)
+	}
+	if got := decode(); !reflect.DeepEqual(got, full) {
+		t.Fatalf("no mask: got %#v", got)
+	}
+
+	d := NewDecoder(nil)
+	for _, p := range []string{"4[0]", `5{"k"}`, ".*"} {
+		if err := d.SetFieldMask(p); err == nil {
+			t.Fatalf("SetFieldMask(%q) succeeded", p)
+		}
+	}
+
+	// Skipped fields cost no allocations.
+	allocs := func(data []byte) float64 {
+		var o Order
+		return testing.AllocsPerRun(20, func() {
+			d := NewDecoder(bytes.NewReader(data))
+			_ = d.SetFieldMask("1")
+			_ = d.Decode(&o)
+		})
+	}
+	small, _ := Marshal(Order{ID: 7})
+	if got, want := allocs(data), allocs(small); got != want {
+		t.Fatalf("masked decode made %v allocations, want %v", got, want)
+	}
+}
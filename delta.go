@@ -0,0 +1,394 @@
+package relish
+
+import (
+	"bytes"
+	"encoding/binary"
+)
+
+// A delta is itself a Relish value: an array of operation structs, applied
+// in order. Each operation has the fields
+//
+//	0: u8           operation: deltaSet, deltaClear, deltaSplice,
+//	                deltaPut or deltaDelete
+//	1: array<enum>  path to the target, one element per segment: variant
+//	                0 holds a struct field ID (u8), 1 an enum variant ID
+//	                (u8), 2 an array index (u32) and 3 a map key (any TLV)
+//	2: any          new value (set, put)
+//	3: any          map key (put, delete)
+//	4: u32          first element to replace (splice)
+//	5: u32          number of elements to remove (splice)
+//	6: array        elements to insert (splice)
+//
+// Set replaces the value at the path, adding a struct field if it is
+// absent; clear removes a struct field. Splice edits the array at the
+// path, and put and delete add, replace or remove one entry of the map at
+// the path.
+const (
+	deltaSet byte = iota
+	deltaClear
+	deltaSplice
+	deltaPut
+	deltaDelete
+)
+
+type deltaOp struct {
+	op     byte
+	path   []pathSeg
+	value  []byte
+	key    []byte
+	index  int
+	remove int
+	insert []byte
+}
+
+// MakeDelta returns a delta that turns old into new when passed to
+// ApplyDelta. Unchanged parts of the values are not included: a delta
+// touches only the struct fields, array elements and map entries that
+// differ, recursing into nested values wherever their types agree.
+func MakeDelta(old, new []byte) ([]byte, error) {
+	co, err := Canonicalize(old)
+	if err != nil {
+		return nil, err
+	}
+	cn, err := Canonicalize(new)
+	if err != nil {
+		return nil, err
+	}
+	to, vo, _, _ := splitValue(co)
+	tn, vn, _, _ := splitValue(cn)
+	var m deltaMaker
+	m.value(nil, to, vo, tn, vn)
+	return encodeDelta(m.ops), nil
+}
+
+// ApplyDelta applies a delta produced by MakeDelta to base and returns the
+// result in canonical form. It fails with ErrPathNotFound if base lacks a
+// field, element or entry the delta expects, such as when the delta was
+// made against a different value.
+func ApplyDelta(base, delta []byte) ([]byte, error) {
+	if err := firstError(Validate(base)); err != nil {
+		return nil, err
+	}
+	ops, err := decodeDelta(delta)
+	if err != nil {
+		return nil, err
+	}
+	t, c, _, _ := splitValue(base)
+	for _, op := range ops {
+		if t, c, err = op.apply(t, c); err != nil {
+			return nil, err
+		}
+	}
+	return Canonicalize(appendValue(nil, t, c))
+}
+
+type deltaMaker struct {
+	ops []deltaOp
+}
+
+func (m *deltaMaker) add(op deltaOp) {
+	op.path = append([]pathSeg(nil), op.path...)
+	m.ops = append(m.ops, op)
+}
+
+// value records the operations that turn canonical value a into b.
+func (m *deltaMaker) value(segs []pathSeg, ta byte, a []byte, tb byte, b []byte) {
+	set := func() { m.add(deltaOp{op: deltaSet, path: segs, value: appendValue(nil, tb, b)}) }
+	if ta != tb {
+		set()
+		return
+	}
+	switch TypeID(ta) {
+	case TypeStruct:
+		for len(a) > 0 || len(b) > 0 {
+			switch {
+			case len(b) == 0 || (len(a) > 0 && a[0] < b[0]):
+				_, _, rest, _ := splitValue(a[1:])
+				m.add(deltaOp{op: deltaClear, path: append(segs, pathSeg{kind: segField, id: a[0]})})
+				a = rest
+			case len(a) == 0 || b[0] < a[0]:
+				_, _, rest, _ := splitValue(b[1:])
+				m.add(deltaOp{op: deltaSet, path: append(segs, pathSeg{kind: segField, id: b[0]}), value: b[1 : len(b)-len(rest)]})
+				b = rest
+			default:
+				fta, fa, ra, _ := splitValue(a[1:])
+				ftb, fb, rb, _ := splitValue(b[1:])
+				m.value(append(segs, pathSeg{kind: segField, id: a[0]}), fta, fa, ftb, fb)
+				a, b = ra, rb
+			}
+		}
+	case TypeEnum:
+		if a[0] != b[0] {
+			set()
+			return
+		}
+		vta, va, _, _ := splitValue(a[1:])
+		vtb, vb, _, _ := splitValue(b[1:])
+		m.value(append(segs, pathSeg{kind: segVariant, id: a[0]}), vta, va, vtb, vb)
+	case TypeMap:
+		if a[0] != b[0] || a[1] != b[1] {
+			set()
+			return
+		}
+		m.mapEntries(segs, a[0], a[1], a[2:], b[2:])
+	case TypeArray:
+		if a[0] != b[0] {
+			set()
+			return
+		}
+		m.array(segs, a[0], a[1:], b[1:])
+	default:
+		if !bytes.Equal(a, b) {
+			set()
+		}
+	}
+}
+
+func (m *deltaMaker) mapEntries(segs []pathSeg, kt, vt byte, a, b []byte) {
+	for len(a) > 0 || len(b) > 0 {
+		var ka, kb, va, vb, ra, rb []byte
+		if len(a) > 0 {
+			ka, va, ra, _ = splitEntry(kt, vt, a)
+		}
+		if len(b) > 0 {
+			kb, vb, rb, _ = splitEntry(kt, vt, b)
+		}
+		c := 0
+		switch {
+		case len(a) == 0:
+			c = 1
+		case len(b) == 0:
+			c = -1
+		default:
+			c = bytes.Compare(appendElem(nil, kt, ka), appendElem(nil, kt, kb))
+		}
+		switch {
+		case c < 0:
+			m.add(deltaOp{op: deltaDelete, path: segs, key: appendValue(nil, kt, ka)})
+			a = ra
+		case c > 0:
+			m.add(deltaOp{op: deltaPut, path: segs, key: appendValue(nil, kt, kb), value: appendValue(nil, vt, vb)})
+			b = rb
+		default:
+			m.value(append(segs, keySeg(kt, ka, 0)), vt, va, vt, vb)
+			a, b = ra, rb
+		}
+	}
+}
+
+// array records splices for the hunks between common elements, last hunk
+// first so that the indices of earlier hunks stay valid as they apply.
+func (m *deltaMaker) array(segs []pathSeg, et byte, a, b []byte) {
+	ea, eb := splitElems(et, a), splitElems(et, b)
+	hunks := alignElems(ea, eb)
+	for h := len(hunks) - 1; h >= 0; h-- {
+		hk := hunks[h]
+		n := min(len(hk.dels), len(hk.ins))
+		if len(hk.dels) > n || len(hk.ins) > n {
+			ins := []byte{et}
+			for _, j := range hk.ins[n:] {
+				ins = appendElem(ins, et, eb[j])
+			}
+			m.add(deltaOp{
+				op:     deltaSplice,
+				path:   segs,
+				index:  hk.at + n,
+				remove: len(hk.dels) - n,
+				insert: appendValue(nil, byte(TypeArray), ins),
+			})
+		}
+		for k := n - 1; k >= 0; k-- {
+			i := hk.dels[k]
+			m.value(append(segs, pathSeg{kind: segIndex, index: i}), et, ea[i], et, eb[hk.ins[k]])
+		}
+	}
+}
+
+func (op deltaOp) apply(t byte, c []byte) (byte, []byte, error) {
+	setValue := func(v []byte) editFunc {
+		return func(byte, []byte, bool) (byte, []byte, bool, error) {
+			vt, vc, _, err := splitValue(v)
+			return vt, vc, false, err
+		}
+	}
+	remove := func(_ byte, _ []byte, present bool) (byte, []byte, bool, error) {
+		if !present {
+			return 0, nil, false, &Error{Kind: ErrPathNotFound, Detail: "nothing to remove"}
+		}
+		return 0, nil, true, nil
+	}
+	keyPath := func() []pathSeg {
+		kt, kc, _, _ := splitValue(op.key)
+		return append(op.path[:len(op.path):len(op.path)], keySeg(kt, kc, 0))
+	}
+	switch op.op {
+	case deltaSet:
+		return editAt(t, c, op.path, setValue(op.value))
+	case deltaClear:
+		if len(op.path) == 0 || op.path[len(op.path)-1].kind != segField {
+			return 0, nil, &Error{Kind: ErrInvalidValue, Detail: "clear must target a struct field"}
+		}
+		return editAt(t, c, op.path, remove)
+	case deltaPut:
+		return editAt(t, c, keyPath(), setValue(op.value))
+	case deltaDelete:
+		return editAt(t, c, keyPath(), remove)
+	case deltaSplice:
+		return editAt(t, c, op.path, op.splice)
+	}
+	return 0, nil, &Error{Kind: ErrInvalidValue, Detail: "unknown delta operation"}
+}
+
+func (op deltaOp) splice(t byte, c []byte, present bool) (byte, []byte, bool, error) {
+	if !present || TypeID(t) != TypeArray {
+		return 0, nil, false, &Error{Kind: ErrTypeMismatch, Detail: "splice target is not an array"}
+	}
+	it, ic, _, err := splitValue(op.insert)
+	if err != nil {
+		return 0, nil, false, err
+	}
+	if TypeID(it) != TypeArray || ic[0] != c[0] {
+		return 0, nil, false, &Error{Kind: ErrTypeMismatch, Detail: "spliced elements do not match the array's element type"}
+	}
+	et := c[0]
+	elems := splitElems(et, c[1:])
+	if op.index > len(elems) || op.remove > len(elems)-op.index {
+		return 0, nil, false, &Error{Kind: ErrPathNotFound, Detail: "splice range outside array"}
+	}
+	out := []byte{et}
+	for _, e := range elems[:op.index] {
+		out = appendElem(out, et, e)
+	}
+	out = append(out, ic[1:]...)
+	for _, e := range elems[op.index+op.remove:] {
+		out = appendElem(out, et, e)
+	}
+	return t, out, false, nil
+}
+
+func encodeDelta(ops []deltaOp) []byte {
+	content := []byte{byte(TypeStruct)}
+	for _, op := range ops {
+		var f []byte
+		f = appendValue(append(f, 0), byte(TypeU8), []byte{op.op})
+		f = appendValue(append(f, 1), byte(TypeArray), encodeDeltaPath(op.path))
+		if op.value != nil {
+			f = append(append(f, 2), op.value...)
+		}
+		if op.key != nil {
+			f = append(append(f, 3), op.key...)
+		}
+		if op.op == deltaSplice {
+			f = appendValue(append(f, 4), byte(TypeU32), binary.LittleEndian.AppendUint32(nil, uint32(op.index)))
+			f = appendValue(append(f, 5), byte(TypeU32), binary.LittleEndian.AppendUint32(nil, uint32(op.remove)))
+			f = append(append(f, 6), op.insert...)
+		}
+		content = appendElem(content, byte(TypeStruct), f)
+	}
+	return appendValue(nil, byte(TypeArray), content)
+}
+
+func encodeDeltaPath(segs []pathSeg) []byte {
+	out := []byte{byte(TypeEnum)}
+	for _, s := range segs {
+		var e []byte
+		switch s.kind {
+		case segField:
+			e = appendValue([]byte{0}, byte(TypeU8), []byte{s.id})
+		case segVariant:
+			e = appendValue([]byte{1}, byte(TypeU8), []byte{s.id})
+		case segIndex:
+			e = appendValue([]byte{2}, byte(TypeU32), binary.LittleEndian.AppendUint32(nil, uint32(s.index)))
+		case segKey:
+			e = appendValue([]byte{3}, s.kt, s.raw)
+		}
+		out = appendElem(out, byte(TypeEnum), e)
+	}
+	return out
+}
+
+func decodeDelta(delta []byte) ([]deltaOp, error) {
+	if err := firstError(Validate(delta)); err != nil {
+		return nil, err
+	}
+	bad := func(detail string) error { return &Error{Kind: ErrInvalidValue, Detail: "delta: " + detail} }
+	t, c, _, _ := splitValue(delta)
+	if TypeID(t) != TypeArray || TypeID(c[0]) != TypeStruct {
+		return nil, bad("not an array of operations")
+	}
+	var ops []deltaOp
+	for _, oc := range splitElems(c[0], c[1:]) {
+		var op deltaOp
+		fields := map[byte][]byte{}
+		for rest := oc; len(rest) > 0; {
+			_, _, r, _ := splitValue(rest[1:])
+			fields[rest[0]] = rest[1 : len(rest)-len(r)]
+			rest = r
+		}
+		u32 := func(id byte) (int, bool) {
+			ft, fc, _, _ := splitValue(fields[id])
+			if TypeID(ft) != TypeU32 {
+				return 0, false
+			}
+			return int(binary.LittleEndian.Uint32(fc)), true
+		}
+		ft, fc, _, _ := splitValue(fields[0])
+		if fields[0] == nil || TypeID(ft) != TypeU8 {
+			return nil, bad("operation has no u8 kind")
+		}
+		op.op = fc[0]
+		path, err := decodeDeltaPath(fields[1])
+		if err != nil {
+			return nil, err
+		}
+		op.path = path
+		op.value, op.key = fields[2], fields[3]
+		switch op.op {
+		case deltaSet, deltaPut:
+			if op.value == nil {
+				return nil, bad("set/put without a value")
+			}
+		}
+		switch op.op {
+		case deltaPut, deltaDelete:
+			if op.key == nil {
+				return nil, bad("put/delete without a key")
+			}
+		case deltaSplice:
+			var ok1, ok2 bool
+			op.index, ok1 = u32(4)
+			op.remove, ok2 = u32(5)
+			op.insert = fields[6]
+			if !ok1 || !ok2 || op.insert == nil {
+				return nil, bad("splice needs index, count and elements")
+			}
+		}
+		ops = append(ops, op)
+	}
+	return ops, nil
+}
+
+func decodeDeltaPath(b []byte) ([]pathSeg, error) {
+	bad := &Error{Kind: ErrInvalidValue, Detail: "delta: malformed path"}
+	t, c, _, err := splitValue(b)
+	if b == nil || err != nil || TypeID(t) != TypeArray || TypeID(c[0]) != TypeEnum {
+		return nil, bad
+	}
+	var segs []pathSeg
+	for _, e := range splitElems(c[0], c[1:]) {
+		vt, vc, _, _ := splitValue(e[1:])
+		switch {
+		case e[0] == 0 && TypeID(vt) == TypeU8:
+			segs = append(segs, pathSeg{kind: segField, id: vc[0]})
+		case e[0] == 1 && TypeID(vt) == TypeU8:
+			segs = append(segs, pathSeg{kind: segVariant, id: vc[0]})
+		case e[0] == 2 && TypeID(vt) == TypeU32:
+			segs = append(segs, pathSeg{kind: segIndex, index: int(binary.LittleEndian.Uint32(vc))})
+		case e[0] == 3:
+			segs = append(segs, keySeg(vt, vc, 0))
+		default:
+			return nil, bad
+		}
+	}
+	return segs, nil
+}
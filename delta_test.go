@@ -0,0 +1,96 @@
+package relish
+
+import (
+	"testing"
+)
+
+func TestDelta_RoundTrip(t *testing.T) {
+	type Item struct {
+		Sku string `relish:"0"`
+		Qty uint32 `relish:"1"`
+	}
+	type Order struct {
+		ID    uint64            `relish:"0"`
+		Items []Item            `relish:"1"`
+		Tags  []string          `relish:"2"`
+		Attrs map[string]uint32 `relish:"3"`
+		Note  *string           `relish:"4,optional"`
+		Extra *string           `relish:"5,optional"`
+	}
+	before := Order{
+		ID:    1,
+		Items: []Item{{"a", 1}, {"b", 2}, {"c", 3}},
+		Tags:  []string{"x", "y", "z"},
+		Attrs: map[string]uint32{"k1": 1, "k2": 2, "k3": 3},
+		Note:  ptr("old"),
+	}
+	after := Order{
+		ID:    1,
+		Items: []Item{{"a", 1}, {"b", 5}, {"c", 3}, {"d", 4}},
+		Tags:  []string{"w", "x", "z"},
+		Attrs: map[string]uint32{"k1": 1, "k2": 20, "k4": 4},
+		Extra: ptr("new"),
+	}
+	a, err := Marshal(before)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Marshal(after)
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta, err := MakeDelta(a, b)
+	if err != nil {
+		t.Fatalf("MakeDelta: %v", err)
+	}
+	if errs := Validate(delta); errs != nil {
+		t.Fatalf("delta is not valid relish: %v", errs)
+	}
+	got, err := ApplyDelta(a, delta)
+	if err != nil {
+		t.Fatalf("ApplyDelta: %v", err)
+	}
+	if eq, err := Equal(got, b); err != nil || !eq {
+		changes, _ := Diff(b, got)
+		t.Fatalf("ApplyDelta result differs from target: %v", changes)
+	}
+
+	// Identical values produce an empty delta.
+	empty, err := MakeDelta(a, a)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x0F, 0x02, 0x11}; string(empty) != string(want) {
+		t.Fatalf("empty delta = %x, want %x", empty, want)
+	}
+}
+
+func TestDelta_WrongBase(t *testing.T) {
+	type S struct {
+		A *uint32 `relish:"0,optional"`
+		B uint32  `relish:"1"`
+	}
+	a, _ := Marshal(S{A: ptr(uint32(1)), B: 1})
+	b, _ := Marshal(S{B: 1})
+	delta, err := MakeDelta(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ApplyDelta(b, delta)
+	if e, ok := err.(*Error); !ok || e.Kind != ErrPathNotFound || e.Path != ".0" {
+		t.Fatalf("expected ErrPathNotFound at .0, got %v", err)
+	}
+}
+
+func TestDelta_RootReplace(t *testing.T) {
+	a := []byte{0x04, 0x01, 0x00, 0x00, 0x00}
+	b := []byte{0x0E, 0x04, 'h', 'i'}
+	delta, err := MakeDelta(a, b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := ApplyDelta(a, delta)
+	if err != nil || string(got) != string(b) {
+		t.Fatalf("ApplyDelta = %x, %v; want %x", got, err, b)
+	}
+}
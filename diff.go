@@ -0,0 +1,473 @@
+package relish
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"strconv"
+)
+
+// ChangeKind classifies a difference reported by Diff.
+type ChangeKind int
+
+const (
+	FieldAdded ChangeKind = iota + 1
+	FieldRemoved
+	TypeChanged
+	ValueChanged
+	VariantChanged
+	ElementInserted
+	ElementRemoved
+	KeyAdded
+	KeyRemoved
+)
+
+var changeKindNames = map[ChangeKind]string{
+	FieldAdded:      "field added",
+	FieldRemoved:    "field removed",
+	TypeChanged:     "type changed",
+	ValueChanged:    "value changed",
+	VariantChanged:  "variant changed",
+	ElementInserted: "element inserted",
+	ElementRemoved:  "element removed",
+	KeyAdded:        "key added",
+	KeyRemoved:      "key removed",
+}
+
+func (k ChangeKind) String() string {
+	if s, ok := changeKindNames[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("ChangeKind(%d)", int(k))
+}
+
+// Change is a single difference between two encoded values.
+type Change struct {
+	Kind ChangeKind
+	// Path locates the change. Inserted elements are addressed by their
+	// index in the new value; everything else by its position in the old.
+	Path string
+	// Old and New hold the differing values as complete TLVs in canonical
+	// form. Old is nil for additions and New is nil for removals.
+	Old, New []byte
+
+	segs []pathSeg
+}
+
+func (c Change) String() string {
+	return fmt.Sprintf("%s: %v: %s", displayPath(c.Path), c.Kind, c.describe())
+}
+
+func (c Change) describe() string {
+	switch {
+	case c.Old == nil:
+		return describeTLV(c.New)
+	case c.New == nil:
+		return describeTLV(c.Old)
+	}
+	return describeTLV(c.Old) + " -> " + describeTLV(c.New)
+}
+
+// Diff walks two encoded values and reports how b differs from a. Both
+// are compared in canonical form, so map entry order and other encoding
+// choices that Equal ignores never show up as changes. Array elements are
+// aligned on a longest common subsequence, so an inserted element is
+// reported once rather than as a change to every element after it. Arrays
+// that differ by more than a thousand insertions and removals are
+// compared position by position instead.
+func Diff(a, b []byte) ([]Change, error) {
+	ca, err := Canonicalize(a)
+	if err != nil {
+		return nil, err
+	}
+	cb, err := Canonicalize(b)
+	if err != nil {
+		return nil, err
+	}
+	ta, va, _, _ := splitValue(ca)
+	tb, vb, _, _ := splitValue(cb)
+	var d differ
+	d.value(nil, ta, va, tb, vb)
+	return d.changes, nil
+}
+
+// FormatDiff writes changes to w as a report with one line per change,
+// marked "+" for additions, "-" for removals and "~" for modifications.
+// If rt is non-nil, field and variant IDs in paths are replaced by the
+// names of the corresponding fields of rt.
+func FormatDiff(w io.Writer, changes []Change, rt reflect.Type) error {
+	for _, c := range changes {
+		mark := "~"
+		switch c.Kind {
+		case FieldAdded, ElementInserted, KeyAdded:
+			mark = "+"
+		case FieldRemoved, ElementRemoved, KeyRemoved:
+			mark = "-"
+		}
+		path := c.Path
+		if rt != nil {
+			path = namedPath(c.segs, rt)
+		}
+		if _, err := fmt.Fprintf(w, "%s %s: %s\n", mark, displayPath(path), c.describe()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func displayPath(p string) string {
+	if p == "" {
+		return "(root)"
+	}
+	return p
+}
+
+type differ struct {
+	changes []Change
+}
+
+func (d *differ) add(kind ChangeKind, segs []pathSeg, ot byte, old []byte, nt byte, new []byte) {
+	c := Change{Kind: kind, Path: formatPath(segs), segs: append([]pathSeg(nil), segs...)}
+	if old != nil {
+		c.Old = appendValue(nil, ot, old)
+	}
+	if new != nil {
+		c.New = appendValue(nil, nt, new)
+	}
+	d.changes = append(d.changes, c)
+}
+
+// value compares two canonical values given as type and content.
+func (d *differ) value(segs []pathSeg, ta byte, a []byte, tb byte, b []byte) {
+	if ta != tb {
+		d.add(TypeChanged, segs, ta, a, tb, b)
+		return
+	}
+	switch TypeID(ta) {
+	case TypeArray:
+		if a[0] != b[0] {
+			d.add(TypeChanged, segs, ta, a, tb, b)
+			return
+		}
+		d.array(segs, a[0], a[1:], b[1:])
+	case TypeMap:
+		if a[0] != b[0] || a[1] != b[1] {
+			d.add(TypeChanged, segs, ta, a, tb, b)
+			return
+		}
+		d.mapEntries(segs, a[0], a[1], a[2:], b[2:])
+	case TypeStruct:
+		d.fields(segs, a, b)
+	case TypeEnum:
+		if a[0] != b[0] {
+			d.add(VariantChanged, segs, ta, a, tb, b)
+			return
+		}
+		vta, va, _, _ := splitValue(a[1:])
+		vtb, vb, _, _ := splitValue(b[1:])
+		d.value(append(segs, pathSeg{kind: segVariant, id: a[0]}), vta, va, vtb, vb)
+	default:
+		if !bytes.Equal(a, b) {
+			d.add(ValueChanged, segs, ta, a, tb, b)
+		}
+	}
+}
+
+func (d *differ) fields(segs []pathSeg, a, b []byte) {
+	for len(a) > 0 || len(b) > 0 {
+		switch {
+		case len(b) == 0 || (len(a) > 0 && a[0] < b[0]):
+			t, c, rest, _ := splitValue(a[1:])
+			d.add(FieldRemoved, append(segs, pathSeg{kind: segField, id: a[0]}), t, c, 0, nil)
+			a = rest
+		case len(a) == 0 || b[0] < a[0]:
+			t, c, rest, _ := splitValue(b[1:])
+			d.add(FieldAdded, append(segs, pathSeg{kind: segField, id: b[0]}), 0, nil, t, c)
+			b = rest
+		default:
+			ta, ca, ra, _ := splitValue(a[1:])
+			tb, cb, rb, _ := splitValue(b[1:])
+			d.value(append(segs, pathSeg{kind: segField, id: a[0]}), ta, ca, tb, cb)
+			a, b = ra, rb
+		}
+	}
+}
+
+func (d *differ) mapEntries(segs []pathSeg, kt, vt byte, a, b []byte) {
+	for i, j := 0, 0; len(a) > 0 || len(b) > 0; {
+		var ka, kb, va, vb, ra, rb []byte
+		if len(a) > 0 {
+			ka, va, ra, _ = splitEntry(kt, vt, a)
+		}
+		if len(b) > 0 {
+			kb, vb, rb, _ = splitEntry(kt, vt, b)
+		}
+		c := 0
+		switch {
+		case len(a) == 0:
+			c = 1
+		case len(b) == 0:
+			c = -1
+		default:
+			c = bytes.Compare(appendElem(nil, kt, ka), appendElem(nil, kt, kb))
+		}
+		switch {
+		case c < 0:
+			d.add(KeyRemoved, append(segs, keySeg(kt, ka, i)), vt, va, 0, nil)
+			a, i = ra, i+1
+		case c > 0:
+			d.add(KeyAdded, append(segs, keySeg(kt, kb, j)), 0, nil, vt, vb)
+			b, j = rb, j+1
+		default:
+			d.value(append(segs, keySeg(kt, ka, i)), vt, va, vt, vb)
+			a, b, i, j = ra, rb, i+1, j+1
+		}
+	}
+}
+
+func (d *differ) array(segs []pathSeg, et byte, a, b []byte) {
+	ea, eb := splitElems(et, a), splitElems(et, b)
+	// Within each hunk, pair removed and inserted elements up as changes
+	// and report whatever is left over on either side.
+	for _, h := range alignElems(ea, eb) {
+		n := min(len(h.dels), len(h.ins))
+		for k := 0; k < n; k++ {
+			d.value(append(segs, pathSeg{kind: segIndex, index: h.dels[k]}), et, ea[h.dels[k]], et, eb[h.ins[k]])
+		}
+		for _, i := range h.dels[n:] {
+			d.add(ElementRemoved, append(segs, pathSeg{kind: segIndex, index: i}), et, ea[i], 0, nil)
+		}
+		for _, j := range h.ins[n:] {
+			d.add(ElementInserted, append(segs, pathSeg{kind: segIndex, index: j}), 0, nil, et, eb[j])
+		}
+	}
+}
+
+// arrayHunk is a run of consecutive elements removed from one array
+// (dels, indices into the old array) and inserted into another (ins,
+// indices into the new array) between two common elements.
+type arrayHunk struct {
+	at        int // index in the old array where the hunk starts
+	dels, ins []int
+}
+
+// maxAlignEdits bounds the edit distance alignElems searches for. Past
+// it, the arrays are too different for an alignment to be worth its cost,
+// and the differing middles are compared position by position instead.
+const maxAlignEdits = 1000
+
+// alignElems aligns two element lists on a longest common subsequence and
+// returns the hunks between common elements in ascending order.
+func alignElems(ea, eb [][]byte) []arrayHunk {
+	// Common prefixes and suffixes need no search.
+	p := 0
+	for p < len(ea) && p < len(eb) && bytes.Equal(ea[p], eb[p]) {
+		p++
+	}
+	q := 0
+	for q < len(ea)-p && q < len(eb)-p && bytes.Equal(ea[len(ea)-1-q], eb[len(eb)-1-q]) {
+		q++
+	}
+	var hunks []arrayHunk
+	cur := arrayHunk{at: p}
+	flush := func() {
+		if len(cur.dels) > 0 || len(cur.ins) > 0 {
+			hunks = append(hunks, cur)
+		}
+		cur = arrayHunk{}
+	}
+	i, j := p, p
+	for _, op := range editScript(ea[p:len(ea)-q], eb[p:len(eb)-q]) {
+		switch op {
+		case '=':
+			flush()
+			i, j = i+1, j+1
+			cur.at = i
+		case '-':
+			cur.dels = append(cur.dels, i)
+			i++
+		default:
+			cur.ins = append(cur.ins, j)
+			j++
+		}
+	}
+	flush()
+	return hunks
+}
+
+// editScript returns a shortest edit script turning a into b, found with
+// Myers's O(ND) algorithm, as a list of '=' (keep), '-' (delete from a)
+// and '+' (insert from b) operations. If it takes more than maxAlignEdits
+// edits, the script deletes all of a and inserts all of b.
+func editScript(a, b [][]byte) []byte {
+	n, m := len(a), len(b)
+	maxD := min(n+m, maxAlignEdits)
+	off := maxD + 1
+	// v[off+k] is the furthest x reached on diagonal k = x - y.
+	v := make([]int, 2*off+1)
+	var trace [][]int // trace[d][k+d] is v[off+k] after step d
+	found := false
+	for d := 0; d <= maxD && !found; d++ {
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || k != d && v[off+k-1] < v[off+k+1] {
+				x = v[off+k+1]
+			} else {
+				x = v[off+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && bytes.Equal(a[x], b[y]) {
+				x, y = x+1, y+1
+			}
+			v[off+k] = x
+			if x >= n && y >= m {
+				found = true
+			}
+		}
+		trace = append(trace, append([]int(nil), v[off-d:off+d+1]...))
+	}
+	if !found {
+		ops := bytes.Repeat([]byte{'-'}, n)
+		return append(ops, bytes.Repeat([]byte{'+'}, m)...)
+	}
+
+	// Walk back from the end, collecting operations in reverse. Each step
+	// after the first is a move down or right followed by a run of equal
+	// elements.
+	var ops []byte
+	x, y := n, m
+	for d := len(trace) - 1; d > 0; d-- {
+		prev := trace[d-1] // prev[k+d-1] is the x reached on diagonal k
+		k := x - y
+		down := k == -d || k != d && prev[k-1+d-1] < prev[k+1+d-1]
+		pk := k - 1
+		if down {
+			pk = k + 1
+		}
+		px := prev[pk+d-1]
+		py := px - pk
+		mx, my := px+1, py
+		if down {
+			mx, my = px, py+1
+		}
+		for x > mx && y > my {
+			x, y = x-1, y-1
+			ops = append(ops, '=')
+		}
+		if down {
+			ops = append(ops, '+')
+		} else {
+			ops = append(ops, '-')
+		}
+		x, y = px, py
+	}
+	for x > 0 && y > 0 {
+		x, y = x-1, y-1
+		ops = append(ops, '=')
+	}
+	for l, r := 0, len(ops)-1; l < r; l, r = l+1, r-1 {
+		ops[l], ops[r] = ops[r], ops[l]
+	}
+	return ops
+}
+
+// splitElems returns the contents of the elements of type et in b.
+func splitElems(et byte, b []byte) [][]byte {
+	var out [][]byte
+	for len(b) > 0 {
+		c, rest, err := splitElem(et, b)
+		if err != nil {
+			break
+		}
+		out = append(out, c)
+		b = rest
+	}
+	return out
+}
+
+// describeTLV renders a short, human-readable summary of an encoded value.
+func describeTLV(b []byte) string {
+	t, c, _, err := splitValue(b)
+	if err != nil {
+		return "<malformed>"
+	}
+	return describeValue(t, c)
+}
+
+func describeValue(t byte, c []byte) string {
+	le := binary.LittleEndian
+	switch TypeID(t) {
+	case TypeNull:
+		return "null"
+	case TypeBool:
+		return strconv.FormatBool(c[0] != 0)
+	case TypeU8:
+		return "u8 " + strconv.FormatUint(uint64(c[0]), 10)
+	case TypeU16:
+		return "u16 " + strconv.FormatUint(uint64(le.Uint16(c)), 10)
+	case TypeU32:
+		return "u32 " + strconv.FormatUint(uint64(le.Uint32(c)), 10)
+	case TypeU64:
+		return "u64 " + strconv.FormatUint(le.Uint64(c), 10)
+	case TypeI8:
+		return "i8 " + strconv.FormatInt(int64(int8(c[0])), 10)
+	case TypeI16:
+		return "i16 " + strconv.FormatInt(int64(int16(le.Uint16(c))), 10)
+	case TypeI32:
+		return "i32 " + strconv.FormatInt(int64(int32(le.Uint32(c))), 10)
+	case TypeI64:
+		return "i64 " + strconv.FormatInt(int64(le.Uint64(c)), 10)
+	case TypeU128, TypeI128:
+		be := make([]byte, 16)
+		for i := range be {
+			be[i] = c[15-i]
+		}
+		return TypeID(t).String() + " 0x" + hex.EncodeToString(be)
+	case TypeF32:
+		return "f32 " + strconv.FormatFloat(float64(math.Float32frombits(le.Uint32(c))), 'g', -1, 32)
+	case TypeF64:
+		return "f64 " + strconv.FormatFloat(math.Float64frombits(le.Uint64(c)), 'g', -1, 64)
+	case TypeTimestamp:
+		return "timestamp " + strconv.FormatUint(le.Uint64(c), 10)
+	case TypeString:
+		return strconv.Quote(string(c))
+	case TypeArray:
+		return fmt.Sprintf("array<%v> (%d elements)", TypeID(c[0]), len(splitElems(c[0], c[1:])))
+	case TypeMap:
+		return fmt.Sprintf("map<%v,%v> (%d entries)", TypeID(c[0]), TypeID(c[1]), countPairs(c[0], c[1], c[2:]))
+	case TypeStruct:
+		n := 0
+		for rest := c; len(rest) > 0; n++ {
+			if _, _, r, err := splitValue(rest[1:]); err == nil {
+				rest = r
+			} else {
+				break
+			}
+		}
+		return fmt.Sprintf("struct (%d fields)", n)
+	case TypeEnum:
+		vt, vc, _, err := splitValue(c[1:])
+		if err != nil {
+			return "<malformed>"
+		}
+		return fmt.Sprintf("enum %d: %s", c[0], describeValue(vt, vc))
+	}
+	return TypeID(t).String()
+}
+
+func countPairs(kt, vt byte, b []byte) int {
+	n := 0
+	for len(b) > 0 {
+		_, _, rest, err := splitEntry(kt, vt, b)
+		if err != nil {
+			break
+		}
+		b = rest
+		n++
+	}
+	return n
+}
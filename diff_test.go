@@ -0,0 +1,179 @@
+package relish
+
+import (
+	"bytes"
+	"math/rand"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	type Inner struct {
+		Value uint32 `relish:"0"`
+	}
+	type Doc struct {
+		Inner Inner            `relish:"0"`
+		Tags  []string         `relish:"1"`
+		Attrs map[string]uint8 `relish:"2"`
+		Note  *string          `relish:"3,optional"`
+		Count uint32           `relish:"4"`
+	}
+	a, err := Marshal(Doc{
+		Inner: Inner{Value: 1},
+		Tags:  []string{"a", "c"},
+		Attrs: map[string]uint8{"x": 1, "y": 2},
+		Count: 7,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := Marshal(Doc{
+		Inner: Inner{Value: 2},
+		Tags:  []string{"a", "b", "c"},
+		Attrs: map[string]uint8{"y": 2, "z": 3},
+		Note:  ptr("hi"),
+		Count: 7,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	changes, err := Diff(a, b)
+	if err != nil {
+		t.Fatalf("Diff: %v", err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{
+		`.0.0: value changed: u32 1 -> u32 2`,
+		`.1[1]: element inserted: "b"`,
+		`.2{"x"}: key removed: u8 1`,
+		`.2{"z"}: key added: u8 3`,
+		`.3: field added: "hi"`,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	var sb strings.Builder
+	if err := FormatDiff(&sb, changes, reflect.TypeOf(Doc{})); err != nil {
+		t.Fatal(err)
+	}
+	wantReport := `~ .Inner.Value: u32 1 -> u32 2
++ .Tags[1]: "b"
+- .Attrs{"x"}: u8 1
++ .Attrs{"z"}: u8 3
++ .Note: "hi"
+`
+	if sb.String() != wantReport {
+		t.Fatalf("report:\n%s\nwant:\n%s", sb.String(), wantReport)
+	}
+}
+
+func TestDiff_Equal(t *testing.T) {
+	a := []byte{0x10, 0x0C, 0x02, 0x02, 0x01, 0x0A, 0x02, 0x14}
+	b := []byte{0x10, 0x0C, 0x02, 0x02, 0x02, 0x14, 0x01, 0x0A}
+	changes, err := Diff(a, b)
+	if err != nil || len(changes) != 0 {
+		t.Fatalf("Diff = %v, %v; want no changes", changes, err)
+	}
+	changes, err = Diff([]byte{0x02, 0x01}, []byte{0x0E, 0x00})
+	if err != nil || len(changes) != 1 || changes[0].Kind != TypeChanged || changes[0].Path != "" {
+		t.Fatalf("Diff = %v, %v; want root type change", changes, err)
+	}
+}
+
+func TestDiff_LargeArrays(t *testing.T) {
+	const n = 100000
+	a := make([]uint32, n)
+	for i := range a {
+		a[i] = uint32(i)
+	}
+	// One insertion and one removal far apart.
+	b := append(append(append([]uint32{}, a[:1000]...), 1<<31), a[1000:n-1000]...)
+	b = append(b, a[n-999:]...)
+	ea, _ := Marshal(a)
+	eb, _ := Marshal(b)
+	changes, err := Diff(ea, eb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, c := range changes {
+		got = append(got, c.String())
+	}
+	want := []string{"[1000]: element inserted: u32 2147483648", "[99000]: element removed: u32 99000"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("changes:\n%s\nwant:\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	delta, err := MakeDelta(ea, eb)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err := ApplyDelta(ea, delta); err != nil || !bytes.Equal(got, eb) {
+		t.Fatalf("ApplyDelta(MakeDelta) differs from the new array: %v", err)
+	}
+
+	// Arrays with nothing in common are compared position by position.
+	for i := range b {
+		b[i] = uint32(n + i)
+	}
+	eb, _ = Marshal(b[:n])
+	if changes, err = Diff(ea, eb); err != nil || len(changes) != n || changes[0].Kind != ValueChanged {
+		t.Fatalf("Diff of disjoint arrays: %d changes, %v", len(changes), err)
+	}
+}
+
+func TestEditScript_Shortest(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	for iter := 0; iter < 500; iter++ {
+		a, b := make([][]byte, rng.Intn(12)), make([][]byte, rng.Intn(12))
+		for _, s := range [][][]byte{a, b} {
+			for i := range s {
+				s[i] = []byte{byte(rng.Intn(3))}
+			}
+		}
+		ops := editScript(a, b)
+		// The script must turn a into b.
+		var out [][]byte
+		i, j := 0, 0
+		for _, op := range ops {
+			switch op {
+			case '=':
+				if !bytes.Equal(a[i], b[j]) {
+					t.Fatalf("editScript(%v, %v) keeps unequal elements", a, b)
+				}
+				out = append(out, a[i])
+				i, j = i+1, j+1
+			case '-':
+				i++
+			case '+':
+				out = append(out, b[j])
+				j++
+			}
+		}
+		if i != len(a) || !reflect.DeepEqual(out, b) && len(b) > 0 {
+			t.Fatalf("editScript(%v, %v) = %q does not turn a into b", a, b, ops)
+		}
+		// And keep as many elements as a longest common subsequence.
+		lcs := make([][]int, len(a)+1)
+		for i := range lcs {
+			lcs[i] = make([]int, len(b)+1)
+		}
+		for i := len(a) - 1; i >= 0; i-- {
+			for j := len(b) - 1; j >= 0; j-- {
+				if bytes.Equal(a[i], b[j]) {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else {
+					lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+				}
+			}
+		}
+		if kept := bytes.Count(ops, []byte{'='}); kept != lcs[0][0] {
+			t.Fatalf("editScript(%v, %v) keeps %d elements, want %d", a, b, kept, lcs[0][0])
+		}
+	}
+}
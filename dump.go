@@ -0,0 +1,214 @@
+package relish
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"unicode/utf8"
+
+	intr "github.com/dadrian/relish/internal"
+)
+
+// Dump writes an annotated hex dump of the encoding in data to w. Each
+// line shows an offset, a run of bytes and what they mean: type IDs by
+// name, length prefixes with their decoded value and form, struct field
+// and enum variant IDs, array element types, map key and value types, and
+// decoded scalar values. Nesting is shown by indentation.
+//
+// Malformed input does not stop the dump. Bytes that cannot be parsed are
+// marked with "!!" and a description of the problem, and the dump resumes
+// wherever the framing still allows. Dump only returns errors from w.
+func Dump(w io.Writer, data []byte) error {
+	d := &dumper{w: w, data: data}
+	end := d.value(0, len(data), 0, "")
+	if end < len(data) {
+		d.bad(end, len(data), 0, "%d bytes of trailing data", len(data)-end)
+	}
+	return d.err
+}
+
+const dumpWidth = 16 // bytes per line
+
+type dumper struct {
+	w    io.Writer
+	data []byte
+	err  error
+}
+
+// line writes bytes [off, end) with desc at nesting depth. Runs longer
+// than dumpWidth continue on following lines.
+func (d *dumper) line(off, end, depth int, desc string) {
+	for first := true; first || off < end; first = false {
+		n := min(end-off, dumpWidth)
+		hex := fmt.Sprintf("% x", d.data[off:off+n])
+		if !first {
+			desc = ""
+		} else if desc != "" {
+			desc = strings.Repeat("  ", depth) + desc
+		}
+		if d.err == nil {
+			l := fmt.Sprintf("%06x  %-*s  %s", off, dumpWidth*3-1, hex, desc)
+			_, d.err = io.WriteString(d.w, strings.TrimRight(l, " ")+"\n")
+		}
+		off += n
+	}
+}
+
+// bad marks bytes [off, end) as malformed.
+func (d *dumper) bad(off, end, depth int, format string, args ...any) {
+	d.line(off, end, depth, "!! "+fmt.Sprintf(format, args...))
+}
+
+// value dumps the TLV at off, which must end by end, and returns the
+// offset just past it. label prefixes the description of the type byte.
+func (d *dumper) value(off, end, depth int, label string) int {
+	if off >= end {
+		d.bad(off, off, depth, "%smissing value", label)
+		return end
+	}
+	t := d.data[off]
+	if t&0x80 != 0 || !intr.IsKnownType(t) {
+		d.bad(off, end, depth, "%sinvalid type id 0x%02x; rest unparsed", label, t)
+		return end
+	}
+	d.line(off, off+1, depth, label+TypeID(t).String())
+	return d.elem(t, off+1, end, depth, "")
+}
+
+// elem dumps a value of type t laid out without its type byte, as in
+// arrays and maps and after a TLV's type byte, and returns the offset just
+// past it.
+func (d *dumper) elem(t byte, off, end, depth int, label string) int {
+	if sz, ok := intr.FixedSize(t); ok {
+		if end-off < sz {
+			d.bad(off, end, depth, "%s%v needs %d bytes, only %d left", label, TypeID(t), sz, end-off)
+			return end
+		}
+		if TypeID(t) == TypeBool {
+			if b := d.data[off]; b != 0x00 && b != 0xFF {
+				d.bad(off, off+1, depth, "%sbool byte 0x%02x is neither 0x00 nor 0xFF", label, b)
+				return off + 1
+			}
+		}
+		var b strings.Builder
+		writeText(&b, t, d.data[off:off+sz], nil, true)
+		d.line(off, off+sz, depth, label+b.String())
+		return off + sz
+	}
+	n, used, err := intr.SplitLen(d.data[off:end])
+	if err != nil {
+		d.bad(off, end, depth, "%sbad length prefix: %v; rest unparsed", label, err)
+		return end
+	}
+	form := "short form"
+	if used == 4 {
+		form = "long form"
+		if n <= 0x7F {
+			form = "long form, not minimal"
+		}
+	}
+	d.line(off, off+used, depth, fmt.Sprintf("%slength %d (%s)", label, n, form))
+	off += used
+	cend := off + n
+	if n > end-off {
+		d.bad(off, end, depth+1, "length %d exceeds the %d bytes left; rest unparsed", n, end-off)
+		return end
+	}
+	d.content(t, off, cend, depth+1)
+	return cend
+}
+
+// content dumps the content [off, end) of a varsize value of type t.
+func (d *dumper) content(t byte, off, end, depth int) {
+	switch TypeID(t) {
+	case TypeString:
+		c := d.data[off:end]
+		if !utf8.Valid(c) {
+			d.bad(off, end, depth, "invalid UTF-8")
+			return
+		}
+		d.line(off, end, depth, truncateQuote(string(c)))
+	case TypeArray:
+		if off == end {
+			d.bad(off, end, depth, "missing element type")
+			return
+		}
+		et := d.data[off]
+		if !intr.IsKnownType(et) {
+			d.bad(off, end, depth, "invalid element type 0x%02x; rest unparsed", et)
+			return
+		}
+		d.line(off, off+1, depth, "element type "+TypeID(et).String())
+		if intr.IsZeroSize(et) && off+1 < end {
+			d.bad(off+1, end, depth, "%d bytes after %v elements, which take none", end-off-1, TypeID(et))
+			return
+		}
+		for i, p := 0, off+1; p < end; i++ {
+			p = d.elem(et, p, end, depth, fmt.Sprintf("[%d] ", i))
+		}
+	case TypeMap:
+		if end-off < 2 {
+			d.bad(off, end, depth, "missing key and value types")
+			return
+		}
+		kt, vt := d.data[off], d.data[off+1]
+		for _, x := range []struct {
+			at   int
+			t    byte
+			what string
+		}{{off, kt, "key"}, {off + 1, vt, "value"}} {
+			if !intr.IsKnownType(x.t) {
+				d.bad(x.at, end, depth, "invalid %s type 0x%02x; rest unparsed", x.what, x.t)
+				return
+			}
+			d.line(x.at, x.at+1, depth, x.what+" type "+TypeID(x.t).String())
+		}
+		if intr.IsZeroSize(kt) && intr.IsZeroSize(vt) && off+2 < end {
+			d.bad(off+2, end, depth, "%d bytes after %v-to-%v entries, which take none", end-off-2, TypeID(kt), TypeID(vt))
+			return
+		}
+		for i, p := 0, off+2; p < end; i++ {
+			p = d.elem(kt, p, end, depth, fmt.Sprintf("key %d: ", i))
+			p = d.elem(vt, p, end, depth, fmt.Sprintf("value %d: ", i))
+		}
+	case TypeStruct:
+		prev := -1
+		for p := off; p < end; {
+			id := d.data[p]
+			switch {
+			case id&0x80 != 0:
+				d.bad(p, p+1, depth, "field id 0x%02x has its top bit set", id)
+			case int(id) <= prev:
+				d.bad(p, p+1, depth, "field %d out of order after field %d", id, prev)
+			default:
+				d.line(p, p+1, depth, fmt.Sprintf("field %d", id))
+			}
+			prev = int(id & 0x7F)
+			p = d.value(p+1, end, depth+1, "")
+		}
+	case TypeEnum:
+		if off == end {
+			d.bad(off, end, depth, "missing variant id")
+			return
+		}
+		id := d.data[off]
+		if id&0x80 != 0 {
+			d.bad(off, off+1, depth, "variant id 0x%02x has its top bit set", id)
+		} else {
+			d.line(off, off+1, depth, fmt.Sprintf("variant %d", id))
+		}
+		if p := d.value(off+1, end, depth+1, ""); p < end {
+			d.bad(p, end, depth, "%d bytes after the variant's value", end-p)
+		}
+	}
+}
+
+// truncateQuote quotes s, shortening long strings for display.
+func truncateQuote(s string) string {
+	const max = 40
+	if utf8.RuneCountInString(s) <= max {
+		return fmt.Sprintf("%q", s)
+	}
+	r := []rune(s)
+	return fmt.Sprintf("%q… (%d bytes)", string(r[:max]), len(s))
+}
@@ -0,0 +1,84 @@
+package relish
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDump(t *testing.T) {
+	data := []byte{
+		0x11, 0x1A, // struct, 13 bytes
+		0x00, 0x04, 0x2A, 0x00, 0x00, 0x00, // 0: u32 42
+		0x01, 0x0F, 0x08, 0x0E, 0x02, 'h', 0x00, // 1: array<string>["h", ""]
+	}
+	want := strings.Join([]string{
+		"000000  11                                               struct",
+		"000001  1a                                               length 13 (short form)",
+		"000002  00                                                 field 0",
+		"000003  04                                                   u32",
+		"000004  2a 00 00 00                                          42",
+		"000008  01                                                 field 1",
+		"000009  0f                                                   array",
+		"00000a  08                                                   length 4 (short form)",
+		"00000b  0e                                                     element type string",
+		"00000c  02                                                     [0] length 1 (short form)",
+		"00000d  68                                                       \"h\"",
+		"00000e  00                                                     [1] length 0 (short form)",
+		"00000f                                                           \"\"",
+		"",
+	}, "\n")
+	var b strings.Builder
+	if err := Dump(&b, data); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != want {
+		t.Fatalf("Dump =\n%s\nwant\n%s", b.String(), want)
+	}
+}
+
+func TestDump_Malformed(t *testing.T) {
+	for _, c := range []struct {
+		data []byte
+		want string
+	}{
+		{[]byte{0x04, 0x01}, "!! u32 needs 4 bytes, only 1 left"},
+		{[]byte{0x0E, 0x01, 0x05}, "!! bad length prefix"},
+		{[]byte{0x0E, 0x0A, 'a'}, "!! length 5 exceeds the 1 bytes left"},
+		{[]byte{0x0E, 0x03, 0x00, 0x00, 0x00, 0x61}, "length 1 (long form, not minimal)"},
+		{[]byte{0x11, 0x0C, 0x01, 0x01, 0xFF, 0x00, 0x01, 0x00}, "!! field 0 out of order after field 1"},
+		{[]byte{0x11, 0x08, 0x00, 0x0E, 0x02, 0xFF}, "!! invalid UTF-8"},
+		{[]byte{0x12, 0x08, 0x00, 0x01, 0xFF, 0x00}, "!! 1 bytes after the variant's value"},
+		{[]byte{0x90}, "!! invalid type id 0x90"},
+		{[]byte{0x00, 0x00}, "!! 1 bytes of trailing data"},
+		{[]byte{0x01, 0x7F}, "!! bool byte 0x7f is neither 0x00 nor 0xFF"},
+		{[]byte{0x0F, 0x04, 0x00, 0x01}, "!! 1 bytes after null elements, which take none"},
+		{[]byte{0x10, 0x06, 0x00, 0x00, 0x01}, "!! 1 bytes after null-to-null entries, which take none"},
+	} {
+		var b strings.Builder
+		if err := Dump(&b, c.data); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(b.String(), c.want) {
+			t.Fatalf("Dump(% x) =\n%s\nwant it to contain %q", c.data, b.String(), c.want)
+		}
+	}
+}
+
+func TestDump_ZeroSize(t *testing.T) {
+	for _, c := range []struct {
+		data []byte
+		want string
+	}{
+		{[]byte{0x00}, "null"},
+		{[]byte{0x0F, 0x02, 0x00}, "element type null"},
+		{[]byte{0x11, 0x04, 0x00, 0x00}, "null"},
+	} {
+		var b strings.Builder
+		if err := Dump(&b, c.data); err != nil {
+			t.Fatal(err)
+		}
+		if !strings.Contains(b.String(), c.want) || strings.Contains(b.String(), "!!") {
+			t.Fatalf("Dump(% x) =\n%s\nwant it to contain %q and no errors", c.data, b.String(), c.want)
+		}
+	}
+}
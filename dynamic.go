@@ -0,0 +1,426 @@
+package relish
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"reflect"
+	"sort"
+)
+
+// primitiveTypes maps primitive type IDs to the Go types dynamic values
+// of that type have.
+var primitiveTypes = map[TypeID]reflect.Type{
+	TypeBool:      reflect.TypeOf(false),
+	TypeU8:        reflect.TypeOf(uint8(0)),
+	TypeU16:       reflect.TypeOf(uint16(0)),
+	TypeU32:       reflect.TypeOf(uint32(0)),
+	TypeU64:       reflect.TypeOf(uint64(0)),
+	TypeU128:      u128Type,
+	TypeI8:        reflect.TypeOf(int8(0)),
+	TypeI16:       reflect.TypeOf(int16(0)),
+	TypeI32:       reflect.TypeOf(int32(0)),
+	TypeI64:       reflect.TypeOf(int64(0)),
+	TypeI128:      i128Type,
+	TypeF32:       reflect.TypeOf(float32(0)),
+	TypeF64:       reflect.TypeOf(float64(0)),
+	TypeString:    reflect.TypeOf(""),
+	TypeTimestamp: timeType,
+}
+
+// UnmarshalDynamic decodes data as a value of schema s without a Go type
+// to decode into. Values come back as:
+//
+//   - null as nil, and other primitives as bool, uint8 … uint64, U128,
+//     int8 … int64, I128, float32, float64, string or time.Time;
+//   - arrays as []any and maps as map[any]any;
+//   - structs as map[string]any keyed by field name, leaving out absent
+//     optional fields;
+//   - enums as a map[string]any with one entry, keyed by variant name.
+//     Marshal writes a Go struct whose fields are all optional as an enum
+//     only when exactly one field is set, and as a struct otherwise; an
+//     enum schema meeting such a struct gives one entry per known field,
+//     possibly none.
+//
+// Every value must have the type s gives it, required struct fields must
+// be present and enum variants must be known. As with Unmarshal, struct
+// fields the schema does not know are skipped, and a struct and an enum
+// are interchangeable on the wire.
+func UnmarshalDynamic(data []byte, s Schema) (any, error) {
+	if err := firstError(Validate(data)); err != nil {
+		return nil, err
+	}
+	t, c, _, _ := splitValue(data)
+	return decodeDynamic(t, c, s)
+}
+
+func decodeDynamic(t byte, c []byte, s Schema) (any, error) {
+	want := s.TypeID()
+	if TypeID(t) != want && !(structLike(t) && structLike(byte(want))) {
+		return nil, &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("got %v, schema wants %v", TypeID(t), s)}
+	}
+	switch d := s.(type) {
+	case PrimitiveDesc:
+		if d.Type == TypeNull {
+			return nil, nil
+		}
+		rt, ok := primitiveTypes[d.Type]
+		if !ok {
+			return nil, &Error{Kind: ErrInvalidTypeID, Detail: fmt.Sprintf("%v is not a primitive type", d.Type)}
+		}
+		v := reflect.New(rt).Elem()
+		if err := decodeValue(v, t, c, nil); err != nil {
+			return nil, err
+		}
+		return v.Interface(), nil
+	case *ArrayDesc:
+		et := c[0]
+		out := []any{}
+		for p, i := c[1:], 0; len(p) > 0; i++ {
+			ec, rest, _ := splitElem(et, p)
+			v, err := decodeDynamic(et, ec, d.Elem)
+			if err != nil {
+				return nil, prefixPath(err, pathIndex("", i))
+			}
+			out = append(out, v)
+			p = rest
+		}
+		return out, nil
+	case *MapDesc:
+		kt, vt := c[0], c[1]
+		out := make(map[any]any)
+		for p, i := c[2:], 0; len(p) > 0; i++ {
+			kc, vc, rest, _ := splitEntry(kt, vt, p)
+			k, err := decodeDynamic(kt, kc, d.Key)
+			if err != nil {
+				return nil, prefixPath(err, pathKey("", kt, kc, i))
+			}
+			if k != nil && !reflect.TypeOf(k).Comparable() {
+				return nil, &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("map key type %v is not supported", d.Key)}
+			}
+			v, err := decodeDynamic(vt, vc, d.Value)
+			if err != nil {
+				return nil, prefixPath(err, pathKey("", kt, kc, i))
+			}
+			out[k] = v
+			p = rest
+		}
+		return out, nil
+	case *StructDesc:
+		out := make(map[string]any)
+		err := eachMember(t, c, func(id byte, ft byte, fc []byte) error {
+			f, ok := d.Field(id)
+			if !ok {
+				return nil
+			}
+			v, err := decodeDynamic(ft, fc, f.Type)
+			if err != nil {
+				return prefixPath(err, pathField("", id))
+			}
+			out[f.Name] = v
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		for _, f := range d.Fields {
+			if _, ok := out[f.Name]; !ok && !f.Optional {
+				return nil, &Error{Kind: ErrInvalidValue, Detail: fmt.Sprintf("required field %d (%s) missing", f.ID, f.Name)}
+			}
+		}
+		return out, nil
+	case *EnumDesc:
+		out := make(map[string]any)
+		asStruct := TypeID(t) == TypeStruct
+		err := eachMember(t, c, func(id byte, vt byte, vc []byte) error {
+			if asStruct {
+				if f, ok := d.Variant(id); ok {
+					v, err := decodeDynamic(vt, vc, f.Type)
+					if err != nil {
+						return prefixPath(err, pathField("", id))
+					}
+					out[f.Name] = v
+				}
+				return nil
+			}
+			if len(out) > 0 {
+				return &Error{Kind: ErrInvalidValue, Detail: "enum holds more than one variant"}
+			}
+			f, ok := d.Variant(id)
+			if !ok {
+				return &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("unknown enum variant %d", id)}
+			}
+			v, err := decodeDynamic(vt, vc, f.Type)
+			if err != nil {
+				return prefixPath(err, pathVariant("", id))
+			}
+			out[f.Name] = v
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		if len(out) == 0 && !asStruct {
+			return nil, &Error{Kind: ErrInvalidValue, Detail: "enum holds no variant"}
+		}
+		return out, nil
+	}
+	return nil, &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("unknown schema type %T", s)}
+}
+
+// eachMember calls fn for each field of valid struct content c, or for
+// the variant of valid enum content c, as t says.
+func eachMember(t byte, c []byte, fn func(id, vt byte, vc []byte) error) error {
+	if TypeID(t) == TypeEnum {
+		vt, vc, _, _ := splitValue(c[1:])
+		return fn(c[0], vt, vc)
+	}
+	for p := c; len(p) > 0; {
+		vt, vc, rest, _ := splitValue(p[1:])
+		if err := fn(p[0], vt, vc); err != nil {
+			return err
+		}
+		p = rest
+	}
+	return nil
+}
+
+// MarshalDynamic encodes v as a value of schema s. v takes the forms
+// UnmarshalDynamic returns, with some leeway: any integer or float that
+// fits the schema's numeric type is accepted, arrays may be any slice,
+// maps any map, and structs and enums any map with string keys. A
+// struct's absent or nil optional fields are left out. An enum value with
+// no entry or several is written as a struct, as Marshal writes a Go
+// struct whose fields are all optional. A View of the schema's type is
+// copied as is.
+//
+// Map entries are written in canonical order, so equal inputs encode to
+// equal bytes.
+func MarshalDynamic(v any, s Schema) ([]byte, error) {
+	return encodeDynamic(nil, v, s)
+}
+
+// encodeDynamic appends the TLV encoding of v as schema s to b.
+func encodeDynamic(b []byte, v any, s Schema) ([]byte, error) {
+	if vw, ok := v.(View); ok {
+		if vw.Type() != s.TypeID() {
+			return nil, &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("got View of %v, schema wants %v", vw.Type(), s)}
+		}
+		return vw.AppendTLV(b), nil
+	}
+	t := byte(s.TypeID())
+	switch d := s.(type) {
+	case PrimitiveDesc:
+		if d.Type == TypeNull {
+			if v != nil && v != (Null{}) {
+				return nil, &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("cannot encode %T as null", v)}
+			}
+			return append(b, t), nil
+		}
+		rv, err := dynamicScalar(v, d.Type)
+		if err != nil {
+			return nil, err
+		}
+		tlv, err := Marshal(rv.Interface())
+		if err != nil {
+			return nil, err
+		}
+		return append(b, tlv...), nil
+	case *ArrayDesc:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+			return nil, &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("cannot encode %T as %v", v, s)}
+		}
+		c := []byte{byte(d.Elem.TypeID())}
+		for i := 0; i < rv.Len(); i++ {
+			tlv, err := encodeDynamicElem(rv.Index(i).Interface(), d.Elem)
+			if err != nil {
+				return nil, prefixPath(err, pathIndex("", i))
+			}
+			c = appendElemTLV(c, tlv)
+		}
+		return appendValue(b, t, c), nil
+	case *MapDesc:
+		rv := reflect.ValueOf(v)
+		if rv.Kind() != reflect.Map {
+			return nil, &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("cannot encode %T as %v", v, s)}
+		}
+		type pair struct{ k, v []byte }
+		pairs := make([]pair, 0, rv.Len())
+		for it, i := rv.MapRange(), 0; it.Next(); i++ {
+			kt, err := encodeDynamicElem(it.Key().Interface(), d.Key)
+			if err != nil {
+				return nil, err
+			}
+			vt, err := encodeDynamicElem(it.Value().Interface(), d.Value)
+			if err != nil {
+				_, kc, _, _ := splitValue(kt)
+				return nil, prefixPath(err, pathKey("", kt[0], kc, i))
+			}
+			pairs = append(pairs, pair{appendElemTLV(nil, kt), appendElemTLV(nil, vt)})
+		}
+		sort.Slice(pairs, func(i, j int) bool { return bytes.Compare(pairs[i].k, pairs[j].k) < 0 })
+		c := []byte{byte(d.Key.TypeID()), byte(d.Value.TypeID())}
+		for i, p := range pairs {
+			if i > 0 && bytes.Equal(p.k, pairs[i-1].k) {
+				return nil, &Error{Kind: ErrDuplicateMapKey, Detail: "distinct keys encode the same"}
+			}
+			c = append(append(c, p.k...), p.v...)
+		}
+		return appendValue(b, t, c), nil
+	case *StructDesc:
+		m, err := dynamicMembers(v, s, d.Fields)
+		if err != nil {
+			return nil, err
+		}
+		var c []byte
+		for _, f := range d.Fields {
+			fv, ok := m[f.Name]
+			if !ok || fv == nil && f.Optional {
+				if !f.Optional {
+					return nil, &Error{Kind: ErrInvalidValue, Detail: fmt.Sprintf("required field %d (%s) missing", f.ID, f.Name)}
+				}
+				continue
+			}
+			if c, err = encodeDynamic(append(c, f.ID), fv, f.Type); err != nil {
+				return nil, prefixPath(err, pathField("", f.ID))
+			}
+		}
+		return appendValue(b, t, c), nil
+	case *EnumDesc:
+		m, err := dynamicMembers(v, s, d.Variants)
+		if err != nil {
+			return nil, err
+		}
+		if len(m) != 1 {
+			// Write a struct of the variants present, as Marshal does.
+			var c []byte
+			for _, f := range d.Variants {
+				fv, ok := m[f.Name]
+				if !ok {
+					continue
+				}
+				if c, err = encodeDynamic(append(c, f.ID), fv, f.Type); err != nil {
+					return nil, prefixPath(err, pathField("", f.ID))
+				}
+			}
+			return appendValue(b, byte(TypeStruct), c), nil
+		}
+		for _, f := range d.Variants {
+			if fv, ok := m[f.Name]; ok {
+				c, err := encodeDynamic([]byte{f.ID}, fv, f.Type)
+				if err != nil {
+					return nil, prefixPath(err, pathVariant("", f.ID))
+				}
+				return appendValue(b, t, c), nil
+			}
+		}
+	}
+	return nil, &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("unknown schema type %T", s)}
+}
+
+// encodeDynamicElem returns the TLV encoding of v as schema s for an
+// array element or map entry, which must have s's type: an enum cannot
+// fall back to a struct there.
+func encodeDynamicElem(v any, s Schema) ([]byte, error) {
+	tlv, err := encodeDynamic(nil, v, s)
+	if err == nil && TypeID(tlv[0]) != s.TypeID() {
+		return nil, &Error{Kind: ErrInvalidValue, Detail: fmt.Sprintf("%v element needs exactly one variant", s)}
+	}
+	return tlv, err
+}
+
+// appendElemTLV appends the TLV encoding tlv to b without its type byte,
+// as array elements and map keys and values are laid out.
+func appendElemTLV(b, tlv []byte) []byte { return append(b, tlv[1:]...) }
+
+// dynamicMembers returns struct or enum value v as a map from member name
+// to value, rejecting names fields does not have.
+func dynamicMembers(v any, s Schema, fields []FieldDesc) (map[string]any, error) {
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Map || rv.Type().Key().Kind() != reflect.String {
+		return nil, &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("cannot encode %T as %v", v, s)}
+	}
+	m := make(map[string]any, rv.Len())
+	for it := rv.MapRange(); it.Next(); {
+		name := it.Key().String()
+		known := false
+		for _, f := range fields {
+			known = known || f.Name == name
+		}
+		if !known {
+			return nil, &Error{Kind: ErrInvalidFieldID, Detail: fmt.Sprintf("%v has no member %q", s, name)}
+		}
+		m[name] = it.Value().Interface()
+	}
+	return m, nil
+}
+
+// dynamicScalar converts v to the Go type of primitive type t. Numbers
+// convert between Go types when the value fits exactly.
+func dynamicScalar(v any, t TypeID) (reflect.Value, error) {
+	rt, ok := primitiveTypes[t]
+	if !ok {
+		return reflect.Value{}, &Error{Kind: ErrInvalidTypeID, Detail: fmt.Sprintf("%v is not a primitive type", t)}
+	}
+	rv := reflect.ValueOf(v)
+	if !rv.IsValid() {
+		return reflect.Value{}, &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("cannot encode nil as %v", t)}
+	}
+	if rv.Type() == rt {
+		return rv, nil
+	}
+	mismatch := &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("cannot encode %T as %v", v, t)}
+	out := reflect.New(rt).Elem()
+	switch rt.Kind() {
+	case reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		var u uint64
+		switch {
+		case rv.CanUint():
+			u = rv.Uint()
+		case rv.CanInt() && rv.Int() >= 0:
+			u = uint64(rv.Int())
+		case rv.CanFloat() && rv.Float() >= 0 && rv.Float() < math.MaxUint64 && rv.Float() == math.Trunc(rv.Float()):
+			u = uint64(rv.Float())
+		default:
+			return reflect.Value{}, mismatch
+		}
+		if out.OverflowUint(u) {
+			return reflect.Value{}, &Error{Kind: ErrInvalidValue, Detail: fmt.Sprintf("%v overflows %v", v, t)}
+		}
+		out.SetUint(u)
+	case reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		var i int64
+		switch {
+		case rv.CanInt():
+			i = rv.Int()
+		case rv.CanUint() && rv.Uint() <= math.MaxInt64:
+			i = int64(rv.Uint())
+		case rv.CanFloat() && rv.Float() >= math.MinInt64 && rv.Float() < math.MaxInt64 && rv.Float() == math.Trunc(rv.Float()):
+			i = int64(rv.Float())
+		default:
+			return reflect.Value{}, mismatch
+		}
+		if out.OverflowInt(i) {
+			return reflect.Value{}, &Error{Kind: ErrInvalidValue, Detail: fmt.Sprintf("%v overflows %v", v, t)}
+		}
+		out.SetInt(i)
+	case reflect.Float32, reflect.Float64:
+		switch {
+		case rv.CanFloat():
+			out.SetFloat(rv.Float())
+		case rv.CanInt():
+			out.SetFloat(float64(rv.Int()))
+		case rv.CanUint():
+			out.SetFloat(float64(rv.Uint()))
+		default:
+			return reflect.Value{}, mismatch
+		}
+	default:
+		if !rv.Type().ConvertibleTo(rt) || rv.Kind() != rt.Kind() {
+			return reflect.Value{}, mismatch
+		}
+		out.Set(rv.Convert(rt))
+	}
+	return out, nil
+}
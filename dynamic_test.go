@@ -0,0 +1,201 @@
+package relish
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestDynamic_MatchesStatic(t *testing.T) {
+	v := schemaNode{
+		Value:    "root",
+		Children: []schemaNode{{Value: "leaf", At: time.Unix(5, 0).UTC()}},
+		Attrs:    map[string]uint16{"b": 2, "a": 1},
+		At:       time.Unix(1700000000, 0).UTC(),
+	}
+	s, err := SchemaOf(reflect.TypeOf(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := UnmarshalDynamic(data, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]any{
+		"Value":    "root",
+		"Children": []any{map[string]any{"Value": "leaf", "Children": []any{}, "At": time.Unix(5, 0).UTC()}},
+		"Attrs":    map[any]any{"a": uint16(1), "b": uint16(2)},
+		"At":       time.Unix(1700000000, 0).UTC(),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("UnmarshalDynamic =\n%#v\nwant\n%#v", got, want)
+	}
+	back, err := MarshalDynamic(got, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	canon, err := Canonicalize(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(back, canon) {
+		t.Errorf("MarshalDynamic =\n% x\nwant\n% x", back, canon)
+	}
+}
+
+func TestDynamic_Enum(t *testing.T) {
+	s, err := SchemaOf(reflect.TypeOf(schemaShape{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := MarshalDynamic(map[string]any{"Circle": 2.5}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var shape schemaShape
+	if err := Unmarshal(data, &shape); err != nil {
+		t.Fatal(err)
+	}
+	if shape.Circle == nil || *shape.Circle != 2.5 || shape.Square != nil {
+		t.Fatalf("decoded %+v", shape)
+	}
+	got, err := UnmarshalDynamic(data, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, map[string]any{"Circle": 2.5}) {
+		t.Errorf("UnmarshalDynamic = %#v", got)
+	}
+}
+
+func TestDynamic_EnumAsStruct(t *testing.T) {
+	s, err := SchemaOf(reflect.TypeOf(schemaShape{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, sq := 1.5, uint32(3)
+	for _, tc := range []struct {
+		v    schemaShape
+		want map[string]any
+	}{
+		{schemaShape{}, map[string]any{}},
+		{schemaShape{Circle: &r, Square: &sq}, map[string]any{"Circle": 1.5, "Square": uint32(3)}},
+	} {
+		data, err := Marshal(tc.v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := UnmarshalDynamic(data, s)
+		if err != nil {
+			t.Fatalf("UnmarshalDynamic(% x): %v", data, err)
+		}
+		if !reflect.DeepEqual(got, tc.want) {
+			t.Errorf("UnmarshalDynamic(% x) = %#v, want %#v", data, got, tc.want)
+		}
+		back, err := MarshalDynamic(got, s)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(back, data) {
+			t.Errorf("MarshalDynamic(%v) = % x, want % x", got, back, data)
+		}
+	}
+
+	var e *Error
+	_, err = MarshalDynamic([]any{map[string]any{}}, &ArrayDesc{Elem: s})
+	if !errors.As(err, &e) || e.Kind != ErrInvalidValue || e.Path != "[0]" {
+		t.Errorf("MarshalDynamic of an empty enum element: err = %v, want ErrInvalidValue at [0]", err)
+	}
+}
+
+func TestDynamic_NullKeys(t *testing.T) {
+	s := &MapDesc{Key: PrimitiveDesc{Type: TypeNull}, Value: PrimitiveDesc{Type: TypeU8}}
+	got, err := UnmarshalDynamic([]byte{0x10, 0x06, 0x00, 0x02, 0x07}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, map[any]any{nil: uint8(7)}) {
+		t.Errorf("UnmarshalDynamic = %#v", got)
+	}
+
+	data, err := Marshal(map[Null]uint8{{}: 9})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ms, err := SchemaOf(reflect.TypeOf(map[Null]uint8{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got, err = UnmarshalDynamic(data, ms); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, map[any]any{nil: uint8(9)}) {
+		t.Errorf("UnmarshalDynamic(Marshal) = %#v", got)
+	}
+}
+
+func TestDynamic_Coercion(t *testing.T) {
+	s := &StructDesc{Fields: []FieldDesc{
+		{ID: 0, Name: "n", Type: PrimitiveDesc{Type: TypeU8}},
+		{ID: 1, Name: "x", Type: PrimitiveDesc{Type: TypeI64}, Optional: true},
+		{ID: 2, Name: "raw", Type: PrimitiveDesc{Type: TypeString}, Optional: true},
+	}}
+	str, _ := Marshal("hi")
+	view, _ := NewView(str)
+	data, err := MarshalDynamic(map[string]any{"n": 200.0, "x": nil, "raw": view}, s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []byte{0x11, 0x10, 0x00, 0x02, 0xC8, 0x02, 0x0E, 0x04, 'h', 'i'}
+	if !reflect.DeepEqual(data, want) {
+		t.Errorf("MarshalDynamic = % x, want % x", data, want)
+	}
+}
+
+func TestDynamic_Errors(t *testing.T) {
+	s := &StructDesc{Name: "rec", Fields: []FieldDesc{
+		{ID: 0, Name: "id", Type: PrimitiveDesc{Type: TypeU32}},
+		{ID: 1, Name: "tags", Type: &ArrayDesc{Elem: PrimitiveDesc{Type: TypeString}}, Optional: true},
+		{ID: 2, Name: "kind", Type: &EnumDesc{Variants: []FieldDesc{{ID: 0, Name: "a", Type: PrimitiveDesc{Type: TypeNull}}}}, Optional: true},
+	}}
+	for _, tc := range []struct {
+		v    any
+		kind ErrorKind
+		path string
+	}{
+		{map[string]any{}, ErrInvalidValue, ""},
+		{map[string]any{"id": -1}, ErrTypeMismatch, ".0"},
+		{map[string]any{"id": 1 << 40}, ErrInvalidValue, ".0"},
+		{map[string]any{"id": 1, "bogus": 1}, ErrInvalidFieldID, ""},
+		{map[string]any{"id": 1, "tags": []any{"x", 3}}, ErrTypeMismatch, ".1[1]"},
+		{map[string]any{"id": 1, "kind": map[string]any{"b": nil}}, ErrInvalidFieldID, ".2"},
+		{[]any{}, ErrTypeMismatch, ""},
+	} {
+		var e *Error
+		_, err := MarshalDynamic(tc.v, s)
+		if !errors.As(err, &e) || e.Kind != tc.kind || e.Path != tc.path {
+			t.Errorf("MarshalDynamic(%v): err = %v, want kind %v at %q", tc.v, err, tc.kind, tc.path)
+		}
+	}
+
+	for _, tc := range []struct {
+		data []byte
+		kind ErrorKind
+	}{
+		{[]byte{0x11, 0x00}, ErrInvalidValue},                                                          // id missing
+		{[]byte{0x11, 0x08, 0x00, 0x03, 0x01, 0x00}, ErrTypeMismatch},                                  // u16 id
+		{[]byte{0x11, 0x16, 0x00, 0x04, 0x01, 0, 0, 0, 0x02, 0x12, 0x04, 0x01, 0x00}, ErrTypeMismatch}, // unknown variant
+	} {
+		var e *Error
+		_, err := UnmarshalDynamic(tc.data, s)
+		if !errors.As(err, &e) || e.Kind != tc.kind {
+			t.Errorf("UnmarshalDynamic(% x): err = %v, want kind %v", tc.data, err, tc.kind)
+		}
+	}
+}
@@ -0,0 +1,316 @@
+package relish
+
+import (
+	"bytes"
+	"fmt"
+)
+
+// SetField returns a copy of data with the value at path replaced by
+// newValue, which is marshaled unless it is a View. Path uses the syntax
+// of Query, without names or wildcards. A missing struct field is
+// inserted in field ID order, a missing map key is added, and an index
+// equal to an array's length appends an element. Only the values along
+// path are re-encoded; their length prefixes are recomputed and move
+// between the short and long forms as needed.
+func SetField(data []byte, path string, newValue any) ([]byte, error) {
+	v, ok := newValue.(View)
+	if !ok {
+		b, err := Marshal(newValue)
+		if err != nil {
+			return nil, err
+		}
+		if v, err = NewView(b); err != nil {
+			return nil, err
+		}
+	}
+	return edit(data, path, func(byte, []byte, bool) (byte, []byte, bool, error) {
+		return byte(v.t), v.c, false, nil
+	})
+}
+
+// DeleteField returns a copy of data with the struct field, array element
+// or map entry at path removed. Path uses the syntax of SetField.
+func DeleteField(data []byte, path string) ([]byte, error) {
+	return edit(data, path, func(_ byte, _ []byte, present bool) (byte, []byte, bool, error) {
+		if !present {
+			return 0, nil, false, editError(ErrPathNotFound, "nothing to delete")
+		}
+		return 0, nil, true, nil
+	})
+}
+
+func edit(data []byte, path string, fn editFunc) ([]byte, error) {
+	segs, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, s := range segs {
+		if s.wild || s.name != "" {
+			return nil, &Error{Kind: ErrSyntax, Detail: fmt.Sprintf("path %q: %s needs a concrete id, index or key", path, s)}
+		}
+	}
+	t, c, rest, err := splitValue(data)
+	if err != nil {
+		return nil, err
+	}
+	if len(rest) != 0 {
+		return nil, &Error{Offset: int64(len(data) - len(rest)), Kind: ErrTrailingData, Detail: "data after value"}
+	}
+	nt, nc, err := editAt(t, c, segs, fn)
+	if err != nil {
+		return nil, err
+	}
+	return appendValue(nil, nt, nc), nil
+}
+
+// editFunc computes the replacement for the value at the end of a path.
+// It receives the current value, or present=false if the path names a
+// struct field, map entry or array slot that does not exist yet, and
+// returns the new value or remove=true to delete it.
+type editFunc func(t byte, c []byte, present bool) (nt byte, nc []byte, remove bool, err error)
+
+// editAt applies fn to the value reached by following segs from the value
+// with type t and content c, and returns the rebuilt value. Every
+// container along the path is re-encoded, so their length prefixes are
+// recomputed and may switch between the short and long forms. New struct
+// fields are inserted in field ID order.
+func editAt(t byte, c []byte, segs []pathSeg, fn editFunc) (byte, []byte, error) {
+	nt, nc, remove, err := editChild(t, c, segs, fn)
+	if err != nil {
+		return 0, nil, err
+	}
+	if remove {
+		return 0, nil, &Error{Kind: ErrTypeMismatch, Detail: "cannot remove the root value"}
+	}
+	return nt, nc, nil
+}
+
+func editChild(t byte, c []byte, segs []pathSeg, fn editFunc) (byte, []byte, bool, error) {
+	if len(segs) == 0 {
+		return fn(t, c, true)
+	}
+	if err := shortContent(t, c); err != nil {
+		return 0, nil, false, err
+	}
+	s, rest := segs[0], segs[1:]
+	if s.kind == segField && TypeID(t) == TypeEnum {
+		// As in Query, a field segment selects an enum's variant.
+		s.kind = segVariant
+	}
+	var out []byte
+	var err error
+	switch s.kind {
+	case segField:
+		if TypeID(t) != TypeStruct {
+			err = editError(ErrTypeMismatch, "%v is not a struct", TypeID(t))
+			break
+		}
+		out, err = editField(c, s, rest, fn)
+	case segVariant:
+		if TypeID(t) != TypeEnum {
+			err = editError(ErrTypeMismatch, "%v is not an enum", TypeID(t))
+			break
+		}
+		if c[0] != s.id {
+			err = editError(ErrPathNotFound, "enum holds variant %d", c[0])
+			break
+		}
+		out, err = editVariant(c, rest, fn)
+	case segIndex:
+		if TypeID(t) != TypeArray {
+			err = editError(ErrTypeMismatch, "%v is not an array", TypeID(t))
+			break
+		}
+		out, err = editElem(c, s, rest, fn)
+	case segKey:
+		if TypeID(t) != TypeMap {
+			err = editError(ErrTypeMismatch, "%v is not a map", TypeID(t))
+			break
+		}
+		out, err = editEntry(c, s, rest, fn)
+	}
+	if err != nil {
+		return 0, nil, false, prefixPath(err, s.String())
+	}
+	return t, out, false, nil
+}
+
+// shortContent reports an array, map or enum whose content is too short to
+// hold its element types or variant ID, which data from outside may be.
+func shortContent(t byte, c []byte) error {
+	switch {
+	case TypeID(t) == TypeArray && len(c) < 1:
+		return &Error{Kind: ErrInvalidValue, Detail: "array has no element type"}
+	case TypeID(t) == TypeMap && len(c) < 2:
+		return &Error{Kind: ErrInvalidValue, Detail: "map has no key/value types"}
+	case TypeID(t) == TypeEnum && len(c) < 1:
+		return &Error{Kind: ErrEnumLengthMismatch, Detail: "enum has no variant id"}
+	}
+	return nil
+}
+
+// editError reports a problem at the current path segment; editChild
+// fills in the path as the error propagates.
+func editError(kind ErrorKind, format string, args ...any) error {
+	return &Error{Kind: kind, Detail: fmt.Sprintf(format, args...)}
+}
+
+// editField edits field s.id within struct content c.
+func editField(c []byte, s pathSeg, rest []pathSeg, fn editFunc) ([]byte, error) {
+	out := make([]byte, 0, len(c))
+	for p := c; ; {
+		if len(p) == 0 || p[0] > s.id {
+			// Field is absent; it would go here.
+			if len(rest) > 0 {
+				return nil, editError(ErrPathNotFound, "no such field")
+			}
+			nt, nc, remove, err := fn(0, nil, false)
+			if err != nil {
+				return nil, err
+			}
+			if !remove {
+				out = appendValue(append(out, s.id), nt, nc)
+			}
+			return append(out, p...), nil
+		}
+		id := p[0]
+		ft, fc, next, err := splitValue(p[1:])
+		if err != nil {
+			return nil, err
+		}
+		if id == s.id {
+			nt, nc, remove, err := editChild(ft, fc, rest, fn)
+			if err != nil {
+				return nil, err
+			}
+			if !remove {
+				out = appendValue(append(out, id), nt, nc)
+			}
+			return append(out, next...), nil
+		}
+		out = append(out, p[:len(p)-len(next)]...)
+		p = next
+	}
+}
+
+// editVariant edits the value of the enum with content c.
+func editVariant(c []byte, rest []pathSeg, fn editFunc) ([]byte, error) {
+	vt, vc, _, err := splitValue(c[1:])
+	if err != nil {
+		return nil, err
+	}
+	nt, nc, remove, err := editChild(vt, vc, rest, fn)
+	if err != nil {
+		return nil, err
+	}
+	if remove {
+		return nil, &Error{Kind: ErrTypeMismatch, Detail: "cannot remove an enum's variant value"}
+	}
+	return appendValue([]byte{c[0]}, nt, nc), nil
+}
+
+// editElem edits element s.index within array content c. An index equal
+// to the array's length appends a new element.
+func editElem(c []byte, s pathSeg, rest []pathSeg, fn editFunc) ([]byte, error) {
+	et := c[0]
+	out := append(make([]byte, 0, len(c)), et)
+	p := c[1:]
+	for i := 0; ; i++ {
+		if len(p) == 0 {
+			if i != s.index || len(rest) > 0 {
+				return nil, editError(ErrPathNotFound, "array has %d elements", i)
+			}
+			nt, nc, remove, err := fn(0, nil, false)
+			if err != nil || remove {
+				return out, err
+			}
+			if nt != et {
+				return nil, editError(ErrTypeMismatch, "element must be %v, not %v", TypeID(et), TypeID(nt))
+			}
+			return appendElem(out, et, nc), nil
+		}
+		ec, next, err := splitElem(et, p)
+		if err != nil {
+			return nil, err
+		}
+		if i == s.index {
+			nt, nc, remove, err := editChild(et, ec, rest, fn)
+			if err != nil {
+				return nil, err
+			}
+			if !remove {
+				if nt != et {
+					return nil, editError(ErrTypeMismatch, "element must be %v, not %v", TypeID(et), TypeID(nt))
+				}
+				out = appendElem(out, et, nc)
+			}
+			return append(out, next...), nil
+		}
+		out = append(out, p[:len(p)-len(next)]...)
+		p = next
+	}
+}
+
+// editEntry edits the entry selected by s within map content c. A key
+// that is not present is added at the end of the map unless s selects
+// the entry by index.
+func editEntry(c []byte, s pathSeg, rest []pathSeg, fn editFunc) ([]byte, error) {
+	kt, vt := c[0], c[1]
+	if s.raw != nil && s.kt != kt {
+		return nil, editError(ErrTypeMismatch, "map key must be %v, not %v", TypeID(kt), TypeID(s.kt))
+	}
+	if s.raw == nil && s.key != "" {
+		raw, ok := keyContent(kt, s.key)
+		if !ok {
+			return nil, editError(ErrTypeMismatch, "%s is not a %v key", s.key, TypeID(kt))
+		}
+		s.raw, s.kt = raw, kt
+	}
+	out := append(make([]byte, 0, len(c)), kt, vt)
+	p := c[2:]
+	for i := 0; len(p) > 0; i++ {
+		kc, vc, next, err := splitEntry(kt, vt, p)
+		if err != nil {
+			return nil, err
+		}
+		if s.matchKey(kt, kc, i) {
+			nt, nc, remove, err := editChild(vt, vc, rest, fn)
+			if err != nil {
+				return nil, err
+			}
+			if !remove {
+				if nt != vt {
+					return nil, editError(ErrTypeMismatch, "map value must be %v, not %v", TypeID(vt), TypeID(nt))
+				}
+				out = appendElem(appendElem(out, kt, kc), vt, nc)
+			}
+			return append(out, next...), nil
+		}
+		out = append(out, p[:len(p)-len(next)]...)
+		p = next
+	}
+	if s.raw == nil || len(rest) > 0 {
+		return nil, editError(ErrPathNotFound, "no such key")
+	}
+	nt, nc, remove, err := fn(0, nil, false)
+	if err != nil || remove {
+		return out, err
+	}
+	if nt != vt {
+		return nil, editError(ErrTypeMismatch, "map value must be %v, not %v", TypeID(vt), TypeID(nt))
+	}
+	return appendElem(appendElem(out, kt, s.raw), vt, nc), nil
+}
+
+// matchKey reports whether the i-th map entry, with key content kc of
+// type kt, is the entry s selects.
+func (s pathSeg) matchKey(kt byte, kc []byte, i int) bool {
+	switch {
+	case s.raw != nil:
+		return s.kt == kt && bytes.Equal(s.raw, kc)
+	case s.key == "":
+		return s.index == i
+	}
+	lit, ok := keyLiteral(kt, kc)
+	return ok && lit == s.key
+}
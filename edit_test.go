@@ -0,0 +1,154 @@
+package relish
+
+import (
+	"bytes"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSetField(t *testing.T) {
+	type Inner struct {
+		Name string  `relish:"0"`
+		Note *string `relish:"1,optional"`
+	}
+	type Msg struct {
+		ID    uint32           `relish:"0"`
+		Trace *string          `relish:"1,optional"`
+		Inner Inner            `relish:"2"`
+		Attrs map[string]uint8 `relish:"3"`
+		Vals  []uint32         `relish:"4"`
+	}
+	base := Msg{ID: 7, Inner: Inner{Name: "n"}, Attrs: map[string]uint8{"a": 1}, Vals: []uint32{1, 2}}
+	data, err := Marshal(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	long := strings.Repeat("x", 200)
+	cases := []struct {
+		path  string
+		value any
+		want  func(m *Msg)
+	}{
+		{".1", "trace-abc", func(m *Msg) { m.Trace = ptr("trace-abc") }},
+		{".0", uint32(9), func(m *Msg) { m.ID = 9 }},
+		{".2.1", long, func(m *Msg) { m.Inner.Note = ptr(long) }},
+		{`.3{"a"}`, uint8(5), func(m *Msg) { m.Attrs = map[string]uint8{"a": 5} }},
+		{".4[1]", uint32(8), func(m *Msg) { m.Vals = []uint32{1, 8} }},
+		{".4[2]", uint32(3), func(m *Msg) { m.Vals = []uint32{1, 2, 3} }},
+	}
+	for _, c := range cases {
+		got, err := SetField(data, c.path, c.value)
+		if err != nil {
+			t.Fatalf("SetField(%q): %v", c.path, err)
+		}
+		m := base
+		c.want(&m)
+		want, err := Marshal(m)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("SetField(%q) =\n% x\nwant\n% x", c.path, got, want)
+		}
+	}
+
+	// Growing past 127 bytes switches the enclosing lengths to the long form.
+	got, err := SetField(data, ".2.1", long)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if data[1]&1 != 0 || got[1]&1 != 1 {
+		t.Fatalf("expected short length to be promoted: before %#x, after %#x", data[1], got[1])
+	}
+
+	// New map keys are appended.
+	got, err = SetField(data, `.3{"b"}`, uint8(2))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if vs, _ := Query(got, `.3{"b"}`); len(vs) != 1 {
+		t.Fatalf("added key not found")
+	}
+
+	for _, c := range []struct {
+		path  string
+		value any
+		kind  ErrorKind
+	}{
+		{".4[0]", "s", ErrTypeMismatch},
+		{".4[5]", uint32(1), ErrPathNotFound},
+		{".0.1", uint32(1), ErrTypeMismatch},
+		{".5.1", uint32(1), ErrPathNotFound},
+		{`.3{1}`, uint8(1), ErrTypeMismatch},
+		{".4[*]", uint32(1), ErrSyntax},
+	} {
+		_, err := SetField(data, c.path, c.value)
+		var e *Error
+		if !errors.As(err, &e) || e.Kind != c.kind {
+			t.Fatalf("SetField(%q) error = %v, want %v", c.path, err, c.kind)
+		}
+	}
+}
+
+func TestDeleteField(t *testing.T) {
+	type Msg struct {
+		ID    uint32           `relish:"0"`
+		Trace *string          `relish:"1,optional"`
+		Attrs map[string]uint8 `relish:"3"`
+		Vals  []string         `relish:"4"`
+	}
+	base := Msg{ID: 7, Trace: ptr("t"), Attrs: map[string]uint8{"a": 1}, Vals: []string{"x", "y"}}
+	data, err := Marshal(base)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cases := []struct {
+		path string
+		want func(m *Msg)
+	}{
+		{".1", func(m *Msg) { m.Trace = nil }},
+		{`.3{"a"}`, func(m *Msg) { m.Attrs = map[string]uint8{} }},
+		{".4[0]", func(m *Msg) { m.Vals = []string{"y"} }},
+	}
+	for _, c := range cases {
+		got, err := DeleteField(data, c.path)
+		if err != nil {
+			t.Fatalf("DeleteField(%q): %v", c.path, err)
+		}
+		m := base
+		c.want(&m)
+		want, _ := Marshal(m)
+		if !bytes.Equal(got, want) {
+			t.Fatalf("DeleteField(%q) =\n% x\nwant\n% x", c.path, got, want)
+		}
+	}
+	if _, err := DeleteField(data, ".2"); err == nil {
+		t.Fatalf("expected error deleting absent field")
+	}
+	if _, err := DeleteField(data, ""); err == nil {
+		t.Fatalf("expected error deleting the root")
+	}
+}
+
+func TestSetField_Malformed(t *testing.T) {
+	cases := []struct {
+		data []byte
+		path string
+		kind ErrorKind
+	}{
+		{[]byte{0x10, 0x00}, `{"a"}`, ErrInvalidValue},
+		{[]byte{0x10, 0x02, 0x0E}, `{"a"}`, ErrInvalidValue},
+		{[]byte{0x0F, 0x00}, "[0]", ErrInvalidValue},
+		{[]byte{0x12, 0x00}, ".1", ErrEnumLengthMismatch},
+		{[]byte{0x11, 0x06, 0x00, 0x12, 0x00}, ".0.1", ErrEnumLengthMismatch},
+		{[]byte{0x0F, 0x04, 0x00, 0x01}, "[0]", ErrInvalidValue},
+		{[]byte{0x11, 0x04, 0x00, 0x0E}, ".1", ErrUnexpectedEOF},
+	}
+	for _, c := range cases {
+		_, err := SetField(c.data, c.path, "x")
+		if e, ok := err.(*Error); !ok || e.Kind != c.kind {
+			t.Errorf("SetField(%x, %q) = %v, want %v", c.data, c.path, err, c.kind)
+		}
+	}
+}
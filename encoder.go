@@ -1,21 +1,35 @@
 package relish
 
 import (
+	"bytes"
 	"io"
+	"math"
 	"reflect"
 	"sort"
+	"time"
 
 	intr "github.com/dadrian/relish/internal"
 )
 
 // Encoder writes Relish-encoded values to an io.Writer.
 type Encoder struct {
-	w io.Writer
+	w         io.Writer
+	canonical bool
 }
 
 // NewEncoder creates a new streaming encoder.
 func NewEncoder(w io.Writer) *Encoder { return &Encoder{w: w} }
 
+// SetCanonical enables or disables canonical encoding. In canonical mode
+// map entries are written in ascending order of their encoded key bytes,
+// every NaN is written as the quiet NaN with no payload and negative zero
+// is written as positive zero, so equal values always encode to the same
+// bytes. See Canonicalize for rewriting existing encodings.
+func (e *Encoder) SetCanonical(on bool) { e.canonical = on }
+
+// sub returns an encoder with the same settings writing to w.
+func (e *Encoder) sub(w io.Writer) *Encoder { return &Encoder{w: w, canonical: e.canonical} }
+
 // Encode writes the TLV for v.
 func (e *Encoder) Encode(v any) error { return e.encodeValue(reflect.ValueOf(v)) }
 
@@ -35,10 +49,24 @@ func (e *Encoder) WriteI128(v I128) error   { return intr.WriteI128TLV(e.w, [16]
 func (e *Encoder) WriteF32(v float32) error { return intr.WriteF32TLV(e.w, v) }
 func (e *Encoder) WriteF64(v float64) error { return intr.WriteF64TLV(e.w, v) }
 
-// Varsize stubs remain unimplemented for now.
+// Varsize writers. WriteArray accepts a slice or array and WriteMap a map.
 func (e *Encoder) WriteString(s string) error { return intr.WriteStringTLV(e.w, s) }
-func (e *Encoder) WriteArray(elems any) error { return ErrNotImplemented }
-func (e *Encoder) WriteMap(m any) error       { return ErrNotImplemented }
+
+func (e *Encoder) WriteArray(elems any) error {
+	rv := reflect.ValueOf(elems)
+	if rv.Kind() != reflect.Slice && rv.Kind() != reflect.Array {
+		return &Error{Kind: ErrTypeMismatch, Detail: "WriteArray requires a slice or array"}
+	}
+	return e.encodeArray(rv)
+}
+
+func (e *Encoder) WriteMap(m any) error {
+	rv := reflect.ValueOf(m)
+	if rv.Kind() != reflect.Map {
+		return &Error{Kind: ErrTypeMismatch, Detail: "WriteMap requires a map"}
+	}
+	return e.encodeMap(rv)
+}
 
 // encodeValue writes the TLV for v.
 func (e *Encoder) encodeValue(rv reflect.Value) error {
@@ -50,6 +78,34 @@ func (e *Encoder) encodeValue(rv reflect.Value) error {
 		}
 		rv = rv.Elem()
 	}
+	if rv.Kind() == reflect.Interface {
+		if rv.IsNil() {
+			return &Error{Kind: ErrTypeMismatch, Detail: "cannot encode nil interface"}
+		}
+		return e.encodeValue(rv.Elem())
+	}
+	if m, ok := marshalerOf(rv); ok {
+		a := Appender{Buf: make([]byte, 0, m.RelishSize()), Canonical: e.canonical}
+		if err := m.MarshalRelish(&a); err != nil {
+			return err
+		}
+		_, err := e.w.Write(a.Buf)
+		return err
+	}
+	switch rv.Type() {
+	case u128Type:
+		return intr.WriteU128TLV(e.w, rv.Interface().(U128))
+	case i128Type:
+		return intr.WriteI128TLV(e.w, rv.Interface().(I128))
+	case nullType:
+		return intr.WriteNullTLV(e.w)
+	case timeType:
+		sec := rv.Interface().(time.Time).Unix()
+		if sec < 0 {
+			return &Error{Kind: ErrTypeMismatch, Detail: "timestamp before Unix epoch"}
+		}
+		return intr.WriteTimestampTLV(e.w, uint64(sec))
+	}
 	switch rv.Kind() {
 	case reflect.Bool:
 		return intr.WriteBoolTLV(e.w, rv.Bool())
@@ -70,11 +126,23 @@ func (e *Encoder) encodeValue(rv reflect.Value) error {
 	case reflect.Int64:
 		return intr.WriteI64TLV(e.w, int64(rv.Int()))
 	case reflect.Float32:
-		return intr.WriteF32TLV(e.w, float32(rv.Float()))
+		v := float32(rv.Float())
+		if e.canonical {
+			v = canonicalF32(v)
+		}
+		return intr.WriteF32TLV(e.w, v)
 	case reflect.Float64:
-		return intr.WriteF64TLV(e.w, float64(rv.Float()))
+		v := rv.Float()
+		if e.canonical {
+			v = canonicalF64(v)
+		}
+		return intr.WriteF64TLV(e.w, v)
 	case reflect.String:
 		return intr.WriteStringTLV(e.w, rv.String())
+	case reflect.Slice, reflect.Array:
+		return e.encodeArray(rv)
+	case reflect.Map:
+		return e.encodeMap(rv)
 	case reflect.Struct:
 		return e.encodeStruct(rv)
 	default:
@@ -113,7 +181,7 @@ func (e *Encoder) encodeStruct(rv reflect.Value) error {
 			fv := fi.value
 			if fv.Kind() == reflect.Pointer && !fv.IsNil() {
 				return intr.WriteEnumTLV(e.w, byte(fi.id), func(w io.Writer) error {
-					return NewEncoder(w).encodeValue(fv)
+					return e.sub(w).encodeValue(fv)
 				})
 			}
 		}
@@ -121,7 +189,7 @@ func (e *Encoder) encodeStruct(rv reflect.Value) error {
 	// Struct encoding: write fields in increasing ID order
 	sort.Slice(fields, func(i, j int) bool { return fields[i].id < fields[j].id })
 	return intr.WriteStructTLV(e.w, func(w io.Writer) error {
-		enc := NewEncoder(w)
+		enc := e.sub(w)
 		for _, fi := range fields {
 			fv := fi.value
 			if fi.optional && fv.Kind() == reflect.Pointer && fv.IsNil() {
@@ -141,6 +209,188 @@ func (e *Encoder) encodeStruct(rv reflect.Value) error {
 	})
 }
 
+func (e *Encoder) encodeArray(rv reflect.Value) error {
+	et, err := typeIDOf(rv.Type().Elem())
+	if err != nil {
+		return err
+	}
+	buf := intr.GetBuffer()
+	defer intr.PutBuffer(buf)
+	for i := 0; i < rv.Len(); i++ {
+		if err := e.encodeElem(buf, et, rv.Index(i)); err != nil {
+			return err
+		}
+	}
+	return intr.WriteArrayTLV(e.w, et, intr.SizedArrayContents{
+		Size: func() (int, error) { return buf.Len(), nil },
+		Write: func(w io.Writer) error {
+			_, err := w.Write(buf.Bytes())
+			return err
+		},
+	})
+}
+
+func (e *Encoder) encodeMap(rv reflect.Value) error {
+	rt := rv.Type()
+	kt, err := typeIDOf(rt.Key())
+	if err != nil {
+		return err
+	}
+	vt, err := typeIDOf(rt.Elem())
+	if err != nil {
+		return err
+	}
+	type pair struct{ k, v []byte }
+	pairs := make([]pair, 0, rv.Len())
+	it := rv.MapRange()
+	for it.Next() {
+		var kb, vb bytes.Buffer
+		if err := e.encodeElem(&kb, kt, it.Key()); err != nil {
+			return err
+		}
+		if err := e.encodeElem(&vb, vt, it.Value()); err != nil {
+			return err
+		}
+		pairs = append(pairs, pair{kb.Bytes(), vb.Bytes()})
+	}
+	if e.canonical {
+		sort.Slice(pairs, func(i, j int) bool { return bytes.Compare(pairs[i].k, pairs[j].k) < 0 })
+		for i := 1; i < len(pairs); i++ {
+			if bytes.Equal(pairs[i].k, pairs[i-1].k) {
+				// Distinct NaN keys all become the one canonical NaN.
+				return &Error{Kind: ErrDuplicateMapKey, Detail: "keys are equal in canonical form"}
+			}
+		}
+	}
+	return intr.WriteMapTLV(e.w, kt, vt, func(w io.Writer) error {
+		for _, p := range pairs {
+			if _, err := w.Write(p.k); err != nil {
+				return err
+			}
+			if _, err := w.Write(p.v); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// encodeElem writes v in the element layout used inside arrays and maps,
+// i.e. its TLV without the type byte, which must equal et.
+func (e *Encoder) encodeElem(w io.Writer, et byte, v reflect.Value) error {
+	buf := intr.GetBuffer()
+	defer intr.PutBuffer(buf)
+	if err := e.sub(buf).encodeValue(v); err != nil {
+		return err
+	}
+	b := buf.Bytes()
+	if b[0] != et {
+		return &Error{Kind: ErrTypeMismatch, Detail: "element encoded as " + TypeID(b[0]).String() + ", want " + TypeID(et).String()}
+	}
+	_, err := w.Write(b[1:])
+	return err
+}
+
+var (
+	u128Type = reflect.TypeOf(U128{})
+	i128Type = reflect.TypeOf(I128{})
+	nullType = reflect.TypeOf(Null{})
+	timeType = reflect.TypeOf(time.Time{})
+)
+
+// typeIDOf returns the Relish type a Go type encodes to. Structs whose
+// tagged fields are all optional are enums, as in encodeStruct.
+func typeIDOf(rt reflect.Type) (byte, error) {
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	switch rt {
+	case u128Type:
+		return byte(TypeU128), nil
+	case i128Type:
+		return byte(TypeI128), nil
+	case nullType:
+		return byte(TypeNull), nil
+	case timeType:
+		return byte(TypeTimestamp), nil
+	}
+	switch rt.Kind() {
+	case reflect.Bool:
+		return byte(TypeBool), nil
+	case reflect.Uint8:
+		return byte(TypeU8), nil
+	case reflect.Uint16:
+		return byte(TypeU16), nil
+	case reflect.Uint32:
+		return byte(TypeU32), nil
+	case reflect.Uint64:
+		return byte(TypeU64), nil
+	case reflect.Int8:
+		return byte(TypeI8), nil
+	case reflect.Int16:
+		return byte(TypeI16), nil
+	case reflect.Int32:
+		return byte(TypeI32), nil
+	case reflect.Int64:
+		return byte(TypeI64), nil
+	case reflect.Float32:
+		return byte(TypeF32), nil
+	case reflect.Float64:
+		return byte(TypeF64), nil
+	case reflect.String:
+		return byte(TypeString), nil
+	case reflect.Slice, reflect.Array:
+		return byte(TypeArray), nil
+	case reflect.Map:
+		return byte(TypeMap), nil
+	case reflect.Struct:
+		if isEnumType(rt) {
+			return byte(TypeEnum), nil
+		}
+		return byte(TypeStruct), nil
+	}
+	return 0, &Error{Kind: ErrNotImplementedKind, Detail: "no relish type for " + rt.String()}
+}
+
+// isEnumType reports whether every tagged field of struct type rt is
+// optional, which makes its values encode as enums.
+func isEnumType(rt reflect.Type) bool {
+	n := 0
+	for i := 0; i < rt.NumField(); i++ {
+		_, optional, _, ok := intr.ParseRelishTag(rt.Field(i))
+		if !ok {
+			continue
+		}
+		if !optional {
+			return false
+		}
+		n++
+	}
+	return n > 0
+}
+
+// canonicalF32 and canonicalF64 map every NaN to the quiet NaN with no
+// payload and negative zero to positive zero.
+func canonicalF32(v float32) float32 {
+	if math.IsNaN(float64(v)) {
+		return math.Float32frombits(0x7FC00000)
+	}
+	if v == 0 {
+		return 0
+	}
+	return v
+}
+
+func canonicalF64(v float64) float64 {
+	if math.IsNaN(v) {
+		return math.Float64frombits(0x7FF8000000000000)
+	}
+	if v == 0 {
+		return 0
+	}
+	return v
+}
+
 func isZeroValue(v reflect.Value) bool {
 	switch v.Kind() {
 	case reflect.Pointer, reflect.Interface, reflect.Slice, reflect.Map:
@@ -0,0 +1,43 @@
+package relish
+
+import (
+	"bytes"
+	"testing"
+	"time"
+)
+
+func TestEncoder_Types(t *testing.T) {
+	cases := []struct {
+		name string
+		v    any
+		want []byte
+	}{
+		{"array", []uint16{1, 2}, []byte{0x0F, 0x0A, 0x03, 0x01, 0x00, 0x02, 0x00}},
+		{"strings", [2]string{"a", ""}, []byte{0x0F, 0x08, 0x0E, 0x02, 'a', 0x00}},
+		{"map", map[string]bool{"k": true}, []byte{0x10, 0x0A, 0x0E, 0x01, 0x02, 'k', 0xFF}},
+		{"u128", U128{0: 1}, append([]byte{0x06, 0x01}, make([]byte, 15)...)},
+		{"null", Null{}, []byte{0x00}},
+		{"time", time.Unix(1, 0), []byte{0x13, 0x01, 0, 0, 0, 0, 0, 0, 0}},
+		{"interface", struct {
+			V any `relish:"0"`
+		}{uint8(7)}, []byte{0x11, 0x06, 0x00, 0x02, 0x07}},
+	}
+	for _, c := range cases {
+		var buf bytes.Buffer
+		if err := NewEncoder(&buf).Encode(c.v); err != nil {
+			t.Errorf("%s: %v", c.name, err)
+			continue
+		}
+		if !bytes.Equal(buf.Bytes(), c.want) {
+			t.Errorf("%s: got %x want %x", c.name, buf.Bytes(), c.want)
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := NewEncoder(&buf).Encode([]any{uint8(1)}); err == nil {
+		t.Error("encoding []any succeeded")
+	}
+	if err := NewEncoder(&buf).Encode(time.Unix(-1, 0)); err == nil {
+		t.Error("encoding a timestamp before 1970 succeeded")
+	}
+}
@@ -0,0 +1,236 @@
+package relish
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// Fingerprint identifies a schema: the SHA-256 hash of its canonical
+// encoding by MarshalSchema with every type, field and variant name left
+// empty. It covers only what the encoding depends on, IDs, types and
+// optional fields, so a schema written in the IDL with field x and the Go
+// type generated from it with field X have the same fingerprint, and so
+// do schemas that differ only by a renamed field. Descriptors must be
+// shared as SchemaOf and the idl package share them, one per named type;
+// a schema describing the same struct twice has a different fingerprint.
+type Fingerprint [sha256.Size]byte
+
+// String returns f in hexadecimal.
+func (f Fingerprint) String() string { return hex.EncodeToString(f[:]) }
+
+// ParseFingerprint parses the hexadecimal form of a fingerprint.
+func ParseFingerprint(s string) (Fingerprint, error) {
+	var f Fingerprint
+	b, err := hex.DecodeString(s)
+	if err != nil || len(b) != len(f) {
+		return f, &Error{Kind: ErrSyntax, Detail: fmt.Sprintf("fingerprint %q is not %d hex bytes", s, len(f))}
+	}
+	copy(f[:], b)
+	return f, nil
+}
+
+// FingerprintOf returns the fingerprint of s.
+func FingerprintOf(s Schema) (Fingerprint, error) {
+	_, f, err := schemaFingerprint(s)
+	return f, err
+}
+
+// schemaFingerprint returns the canonical encoding of s and its
+// fingerprint.
+func schemaFingerprint(s Schema) ([]byte, Fingerprint, error) {
+	var enc [2][]byte
+	for i, anonymous := range []bool{false, true} {
+		b, err := marshalSchema(s, anonymous)
+		if err != nil {
+			return nil, Fingerprint{}, err
+		}
+		if enc[i], err = Canonicalize(b); err != nil {
+			return nil, Fingerprint{}, err
+		}
+	}
+	return enc[0], sha256.Sum256(enc[1]), nil
+}
+
+// typeSchema is what Wrap and Unwrap know of a Go type.
+type typeSchema struct {
+	schema      Schema
+	encoded     []byte
+	fingerprint Fingerprint
+}
+
+var typeSchemas sync.Map // reflect.Type -> *typeSchema
+
+func typeSchemaOf(rt reflect.Type) (*typeSchema, error) {
+	if ts, ok := typeSchemas.Load(rt); ok {
+		return ts.(*typeSchema), nil
+	}
+	s, err := SchemaOf(rt)
+	if err != nil {
+		return nil, err
+	}
+	b, f, err := schemaFingerprint(s)
+	if err != nil {
+		return nil, err
+	}
+	ts, _ := typeSchemas.LoadOrStore(rt, &typeSchema{schema: s, encoded: b, fingerprint: f})
+	return ts.(*typeSchema), nil
+}
+
+// Envelope is a self-describing message: an encoded value with the
+// fingerprint of the schema it was written with and, optionally, that
+// schema itself, so that data stored for years can still be read once
+// the types that wrote it have changed.
+type Envelope struct {
+	Fingerprint Fingerprint `relish:"0"`
+	// Schema is the schema as MarshalSchema writes it, or nil if readers
+	// are expected to know it.
+	Schema []byte `relish:"1,omitempty"`
+	// Payload is the encoded value.
+	Payload []byte `relish:"2"`
+}
+
+// Wrap encodes v and returns the encoding of an Envelope holding it and
+// the fingerprint of the schema SchemaOf derives for its type. If inline
+// is set the envelope carries the schema too.
+func Wrap(v any, inline bool) ([]byte, error) {
+	if v == nil {
+		return nil, &Error{Kind: ErrInvalidValue, Detail: "Wrap needs a non-nil value"}
+	}
+	ts, err := typeSchemaOf(reflect.TypeOf(v))
+	if err != nil {
+		return nil, err
+	}
+	payload, err := Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	e := Envelope{Fingerprint: ts.fingerprint, Payload: payload}
+	if inline {
+		e.Schema = ts.encoded
+	}
+	return Marshal(&e)
+}
+
+// UnmarshalEnvelope decodes data as an Envelope.
+func UnmarshalEnvelope(data []byte) (*Envelope, error) {
+	var e Envelope
+	if err := Unmarshal(data, &e); err != nil {
+		return nil, err
+	}
+	return &e, nil
+}
+
+// Unwrap decodes the envelope in data and its payload into v, which must
+// be a non-nil pointer, and returns the envelope. If the payload was
+// written with another schema than v's type has, Unwrap resolves that
+// schema with r, which may be nil to use only the inline schema, and
+// decodes the payload only if CheckCompatible finds no breaking change
+// between the two; otherwise it returns that error.
+func Unwrap(data []byte, v any, r *Registry) (*Envelope, error) {
+	e, err := UnmarshalEnvelope(data)
+	if err != nil {
+		return nil, err
+	}
+	rv := reflect.ValueOf(v)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return nil, &Error{Kind: ErrInvalidValue, Detail: "Unwrap needs a non-nil pointer"}
+	}
+	ts, err := typeSchemaOf(rv.Type().Elem())
+	if err != nil {
+		return nil, err
+	}
+	if e.Fingerprint != ts.fingerprint {
+		writer, err := r.Resolve(e)
+		if err != nil {
+			return nil, err
+		}
+		if _, err := CheckCompatible(writer, ts.schema); err != nil {
+			return nil, err
+		}
+	}
+	if err := Unmarshal(e.Payload, v); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// UnwrapDynamic decodes the envelope in data and decodes its payload with
+// UnmarshalDynamic, using the schema r or the envelope itself provides.
+// It returns the value and its schema.
+func UnwrapDynamic(data []byte, r *Registry) (any, Schema, error) {
+	e, err := UnmarshalEnvelope(data)
+	if err != nil {
+		return nil, nil, err
+	}
+	s, err := r.Resolve(e)
+	if err != nil {
+		return nil, nil, err
+	}
+	v, err := UnmarshalDynamic(e.Payload, s)
+	if err != nil {
+		return nil, nil, err
+	}
+	return v, s, nil
+}
+
+// Registry maps fingerprints to the schemas they identify, for readers of
+// envelopes that do not carry their schema. The zero value is an empty
+// registry ready to use, and a Registry is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	schemas map[Fingerprint]Schema
+}
+
+// Register adds s to r and returns its fingerprint. Schemas differing only
+// in names have the same fingerprint, so the later one replaces the other.
+func (r *Registry) Register(s Schema) (Fingerprint, error) {
+	f, err := FingerprintOf(s)
+	if err != nil {
+		return f, err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.schemas == nil {
+		r.schemas = make(map[Fingerprint]Schema)
+	}
+	r.schemas[f] = s
+	return f, nil
+}
+
+// Lookup returns the schema registered with fingerprint f.
+func (r *Registry) Lookup(f Fingerprint) (Schema, bool) {
+	if r == nil {
+		return nil, false
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	s, ok := r.schemas[f]
+	return s, ok
+}
+
+// Resolve returns the schema e was written with: the one registered with
+// its fingerprint, or else its inline schema, which must match the
+// fingerprint. r may be nil, for envelopes that carry their schema.
+func (r *Registry) Resolve(e *Envelope) (Schema, error) {
+	if s, ok := r.Lookup(e.Fingerprint); ok {
+		return s, nil
+	}
+	if e.Schema == nil {
+		return nil, &Error{Kind: ErrIncompatible, Detail: fmt.Sprintf("schema %s is not registered and not inline", e.Fingerprint)}
+	}
+	s, err := UnmarshalSchema(e.Schema)
+	if err != nil {
+		return nil, err
+	}
+	f, err := FingerprintOf(s)
+	if err != nil {
+		return nil, err
+	}
+	if f != e.Fingerprint {
+		return nil, &Error{Kind: ErrInvalidValue, Detail: fmt.Sprintf("inline schema has fingerprint %s, envelope says %s", f, e.Fingerprint)}
+	}
+	return s, nil
+}
@@ -0,0 +1,130 @@
+package relish
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type envPointV1 struct {
+	X int32 `relish:"0"`
+	Y int32 `relish:"1"`
+}
+
+type envPointV2 struct {
+	X     int32   `relish:"0"`
+	Y     int32   `relish:"1"`
+	Label *string `relish:"2,optional"`
+}
+
+type envPointV3 struct {
+	X string `relish:"0"`
+}
+
+func TestFingerprint(t *testing.T) {
+	s, err := SchemaOf(reflect.TypeOf(envPointV1{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := FingerprintOf(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Fingerprints are stored for years: they must never change.
+	const want = "417e6e8ff139601640eb81479af1bafa6f1fd5996b177d18d8f5469b734d67d6"
+	if f.String() != want {
+		t.Errorf("FingerprintOf = %s, want %s", f, want)
+	}
+	// A schema built by hand matches the one SchemaOf derives.
+	hand := &StructDesc{Name: "envPointV1", Fields: []FieldDesc{
+		{ID: 0, Name: "X", Type: PrimitiveDesc{Type: TypeI32}},
+		{ID: 1, Name: "Y", Type: PrimitiveDesc{Type: TypeI32}},
+	}}
+	if g, _ := FingerprintOf(hand); g != f {
+		t.Errorf("hand-built schema has fingerprint %s, want %s", g, f)
+	}
+	// Names do not matter, as they do not reach the encoding.
+	renamed := &StructDesc{Name: "Point", Fields: []FieldDesc{
+		{ID: 0, Name: "x", Type: PrimitiveDesc{Type: TypeI32}},
+		{ID: 1, Name: "y", Type: PrimitiveDesc{Type: TypeI32}},
+	}}
+	if g, _ := FingerprintOf(renamed); g != f {
+		t.Errorf("renamed schema has fingerprint %s, want %s", g, f)
+	}
+	if g, err := ParseFingerprint(f.String()); err != nil || g != f {
+		t.Errorf("ParseFingerprint(%s) = %s, %v", f, g, err)
+	}
+	if _, err := ParseFingerprint("abc"); err == nil {
+		t.Error("ParseFingerprint(abc) succeeded")
+	}
+	s2, _ := SchemaOf(reflect.TypeOf(envPointV2{}))
+	if g, _ := FingerprintOf(s2); g == f {
+		t.Error("different schemas have the same fingerprint")
+	}
+}
+
+func TestEnvelope(t *testing.T) {
+	var we *Error
+	if _, err := Wrap(nil, false); !errors.As(err, &we) || we.Kind != ErrInvalidValue {
+		t.Errorf("Wrap(nil) = %v, want an invalid value error", err)
+	}
+	data, err := Wrap(envPointV1{X: 1, Y: -2}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var p envPointV1
+	e, err := Unwrap(data, &p, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != (envPointV1{X: 1, Y: -2}) || e.Schema != nil {
+		t.Errorf("Unwrap = %+v, envelope %+v", p, e)
+	}
+
+	// A reader with a newer, compatible type needs the writer's schema.
+	var p2 envPointV2
+	var ke *Error
+	if _, err := Unwrap(data, &p2, nil); !errors.As(err, &ke) || ke.Kind != ErrIncompatible {
+		t.Errorf("Unwrap without the writer's schema: %v", err)
+	}
+	var reg Registry
+	s1, _ := SchemaOf(reflect.TypeOf(envPointV1{}))
+	if _, err := reg.Register(s1); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Unwrap(data, &p2, &reg); err != nil || p2.X != 1 || p2.Y != -2 {
+		t.Errorf("Unwrap with registry = %+v, %v", p2, err)
+	}
+
+	// An inline schema needs no registry, and breaking changes are
+	// refused.
+	inline, err := Wrap(&envPointV1{X: 3}, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Unwrap(inline, &p2, nil); err != nil || p2.X != 3 {
+		t.Errorf("Unwrap with inline schema = %+v, %v", p2, err)
+	}
+	var p3 envPointV3
+	if _, err := Unwrap(inline, &p3, nil); !errors.As(err, &ke) || ke.Kind != ErrIncompatible || ke.Path != ".0" {
+		t.Errorf("Unwrap into incompatible type: %v", err)
+	}
+
+	v, s, err := UnwrapDynamic(inline, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := map[string]any{"X": int32(3), "Y": int32(0)}; !reflect.DeepEqual(v, want) || s.String() != "struct envPointV1" {
+		t.Errorf("UnwrapDynamic = %#v, %v", v, s)
+	}
+
+	// An inline schema must match the fingerprint.
+	e, err = UnmarshalEnvelope(inline)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.Fingerprint[0] ^= 1
+	if _, err := reg.Resolve(e); !errors.As(err, &ke) || ke.Kind != ErrInvalidValue {
+		t.Errorf("Resolve with mismatched inline schema: %v", err)
+	}
+}
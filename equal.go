@@ -0,0 +1,209 @@
+package relish
+
+import (
+	"bytes"
+	"encoding/binary"
+	"hash"
+	"math"
+)
+
+// Equal reports whether a and b encode the same value. Encodings that
+// differ only in map entry order, NaN payloads, the sign of zero or
+// length prefix form are equal; see Canonicalize.
+//
+// Struct fields are compared by ID, and a field that is absent from one
+// side is never equal to a field that is present on the other, whatever
+// its value: an omitted optional field is distinct from one holding Null
+// or a zero value, just as None is distinct from Some on the wire.
+func Equal(a, b []byte) (bool, error) {
+	ca, err := Canonicalize(a)
+	if err != nil {
+		return false, err
+	}
+	cb, err := Canonicalize(b)
+	if err != nil {
+		return false, err
+	}
+	return bytes.Equal(ca, cb), nil
+}
+
+// Compare imposes a total order on encoded values consistent with Equal:
+// it returns 0 exactly when Equal reports true, and -1 or +1 otherwise.
+//
+// Values of different types order by type ID. Integers, floats and
+// timestamps order numerically, with NaN after +Inf; strings order by
+// their bytes; arrays order by element type and then element by element.
+// Structs compare lexicographically as sequences of (field ID, value)
+// pairs, and maps likewise as sequences of (key, value) entries in
+// canonical key order. Enums order by variant ID and then value.
+func Compare(a, b []byte) (int, error) {
+	ca, err := Canonicalize(a)
+	if err != nil {
+		return 0, err
+	}
+	cb, err := Canonicalize(b)
+	if err != nil {
+		return 0, err
+	}
+	ta, va, _, _ := splitValue(ca)
+	tb, vb, _, _ := splitValue(cb)
+	return compareValues(ta, va, tb, vb), nil
+}
+
+// Hash writes the canonical encoding of data to h, so values that are
+// Equal produce the same digest whatever encoding each producer chose.
+func Hash(data []byte, h hash.Hash) error {
+	c, err := Canonicalize(data)
+	if err != nil {
+		return err
+	}
+	_, err = h.Write(c)
+	return err
+}
+
+// compareValues compares two canonical values given as type and content.
+func compareValues(ta byte, a []byte, tb byte, b []byte) int {
+	if ta != tb {
+		return cmpInt(int64(ta), int64(tb))
+	}
+	le := binary.LittleEndian
+	switch TypeID(ta) {
+	case TypeNull:
+		return 0
+	case TypeBool, TypeU8:
+		return cmpUint(uint64(a[0]), uint64(b[0]))
+	case TypeU16:
+		return cmpUint(uint64(le.Uint16(a)), uint64(le.Uint16(b)))
+	case TypeU32:
+		return cmpUint(uint64(le.Uint32(a)), uint64(le.Uint32(b)))
+	case TypeU64, TypeTimestamp:
+		return cmpUint(le.Uint64(a), le.Uint64(b))
+	case TypeI8:
+		return cmpInt(int64(int8(a[0])), int64(int8(b[0])))
+	case TypeI16:
+		return cmpInt(int64(int16(le.Uint16(a))), int64(int16(le.Uint16(b))))
+	case TypeI32:
+		return cmpInt(int64(int32(le.Uint32(a))), int64(int32(le.Uint32(b))))
+	case TypeI64:
+		return cmpInt(int64(le.Uint64(a)), int64(le.Uint64(b)))
+	case TypeU128:
+		return cmpUint128(a, b, false)
+	case TypeI128:
+		return cmpUint128(a, b, true)
+	case TypeF32:
+		return cmpFloat(float64(math.Float32frombits(le.Uint32(a))), float64(math.Float32frombits(le.Uint32(b))))
+	case TypeF64:
+		return cmpFloat(math.Float64frombits(le.Uint64(a)), math.Float64frombits(le.Uint64(b)))
+	case TypeString:
+		return bytes.Compare(a, b)
+	case TypeArray:
+		if a[0] != b[0] {
+			return cmpInt(int64(a[0]), int64(b[0]))
+		}
+		et := a[0]
+		ra, rb := a[1:], b[1:]
+		for len(ra) > 0 && len(rb) > 0 {
+			ea, na, _ := splitElem(et, ra)
+			eb, nb, _ := splitElem(et, rb)
+			if c := compareValues(et, ea, et, eb); c != 0 {
+				return c
+			}
+			ra, rb = na, nb
+		}
+		return cmpInt(int64(len(ra)), int64(len(rb)))
+	case TypeMap:
+		if c := bytes.Compare(a[:2], b[:2]); c != 0 {
+			return c
+		}
+		kt, vt := a[0], a[1]
+		ra, rb := a[2:], b[2:]
+		for len(ra) > 0 && len(rb) > 0 {
+			ka, va, na, _ := splitEntry(kt, vt, ra)
+			kb, vb, nb, _ := splitEntry(kt, vt, rb)
+			if c := compareValues(kt, ka, kt, kb); c != 0 {
+				return c
+			}
+			if c := compareValues(vt, va, vt, vb); c != 0 {
+				return c
+			}
+			ra, rb = na, nb
+		}
+		return cmpInt(int64(len(ra)), int64(len(rb)))
+	case TypeStruct:
+		ra, rb := a, b
+		for len(ra) > 0 && len(rb) > 0 {
+			if ra[0] != rb[0] {
+				return cmpInt(int64(ra[0]), int64(rb[0]))
+			}
+			fta, fa, na, _ := splitValue(ra[1:])
+			ftb, fb, nb, _ := splitValue(rb[1:])
+			if c := compareValues(fta, fa, ftb, fb); c != 0 {
+				return c
+			}
+			ra, rb = na, nb
+		}
+		return cmpInt(int64(len(ra)), int64(len(rb)))
+	case TypeEnum:
+		if a[0] != b[0] {
+			return cmpInt(int64(a[0]), int64(b[0]))
+		}
+		vta, va, _, _ := splitValue(a[1:])
+		vtb, vb, _, _ := splitValue(b[1:])
+		return compareValues(vta, va, vtb, vb)
+	}
+	return bytes.Compare(a, b)
+}
+
+func cmpUint(a, b uint64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpInt(a, b int64) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// cmpFloat orders canonical floats numerically with NaN greatest.
+func cmpFloat(a, b float64) int {
+	switch an, bn := math.IsNaN(a), math.IsNaN(b); {
+	case an && bn:
+		return 0
+	case an:
+		return 1
+	case bn:
+		return -1
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+// cmpUint128 compares little-endian 128-bit integers, two's complement
+// if signed.
+func cmpUint128(a, b []byte, signed bool) int {
+	if signed && (a[15]^b[15])&0x80 != 0 {
+		if a[15]&0x80 != 0 {
+			return -1
+		}
+		return 1
+	}
+	for i := 15; i >= 0; i-- {
+		if a[i] != b[i] {
+			return cmpUint(uint64(a[i]), uint64(b[i]))
+		}
+	}
+	return 0
+}
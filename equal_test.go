@@ -0,0 +1,65 @@
+package relish
+
+import (
+	"crypto/sha256"
+	"testing"
+)
+
+func TestEqual_MapOrder(t *testing.T) {
+	a := []byte{0x10, 0x0C, 0x02, 0x02, 0x01, 0x0A, 0x02, 0x14}
+	b := []byte{0x10, 0x0C, 0x02, 0x02, 0x02, 0x14, 0x01, 0x0A}
+	eq, err := Equal(a, b)
+	if err != nil || !eq {
+		t.Fatalf("Equal = %v, %v; want true", eq, err)
+	}
+	c, err := Compare(a, b)
+	if err != nil || c != 0 {
+		t.Fatalf("Compare = %d, %v; want 0", c, err)
+	}
+	ha, hb := sha256.New(), sha256.New()
+	if err := Hash(a, ha); err != nil {
+		t.Fatal(err)
+	}
+	if err := Hash(b, hb); err != nil {
+		t.Fatal(err)
+	}
+	if string(ha.Sum(nil)) != string(hb.Sum(nil)) {
+		t.Fatalf("hashes differ for equal values")
+	}
+}
+
+func TestEqual_AbsentField(t *testing.T) {
+	absent := []byte{0x11, 0x0C, 0x00, 0x04, 0x0A, 0x00, 0x00, 0x00}
+	null := []byte{0x11, 0x10, 0x00, 0x04, 0x0A, 0x00, 0x00, 0x00, 0x01, 0x00}
+	eq, err := Equal(absent, null)
+	if err != nil || eq {
+		t.Fatalf("Equal = %v, %v; want false", eq, err)
+	}
+}
+
+func TestCompare(t *testing.T) {
+	cases := []struct {
+		a, b []byte
+		want int
+	}{
+		{[]byte{0x04, 0x00, 0x01, 0x00, 0x00}, []byte{0x04, 0xFF, 0x00, 0x00, 0x00}, 1},
+		{[]byte{0x09, 0xFF, 0xFF, 0xFF, 0xFF}, []byte{0x09, 0x01, 0x00, 0x00, 0x00}, -1},
+		{[]byte{0x0E, 0x02, 'b'}, []byte{0x0E, 0x04, 'a', 'z'}, 1},
+		{[]byte{0x0C, 0x00, 0x00, 0xC0, 0x7F}, []byte{0x0C, 0x00, 0x00, 0x80, 0x7F}, 1},
+		{[]byte{0x02, 0x05}, []byte{0x0E, 0x00}, -1},
+		{[]byte{0x0F, 0x04, 0x02, 0x01}, []byte{0x0F, 0x06, 0x02, 0x01, 0x00}, -1},
+		{[]byte{0x0C, 0x00, 0x00, 0x00, 0x80}, []byte{0x0C, 0x00, 0x00, 0x00, 0x00}, 0},
+	}
+	for i, c := range cases {
+		got, err := Compare(c.a, c.b)
+		if err != nil {
+			t.Fatalf("case %d: %v", i, err)
+		}
+		if got != c.want {
+			t.Fatalf("case %d: got %d want %d", i, got, c.want)
+		}
+		if rev, _ := Compare(c.b, c.a); rev != -c.want {
+			t.Fatalf("case %d: reverse got %d want %d", i, rev, -c.want)
+		}
+	}
+}
@@ -16,23 +16,72 @@ const (
 	ErrTypeMismatch
 	ErrEnumLengthMismatch
 	ErrNotImplementedKind
+	ErrTrailingData
+	ErrInvalidValue
+	ErrPathNotFound
+	ErrSyntax
+	ErrIncompatible
 )
 
+var errorKindNames = map[ErrorKind]string{
+	ErrInvalidTypeID:      "invalid type id",
+	ErrInvalidFieldID:     "invalid field id",
+	ErrFieldOrder:         "field order",
+	ErrDuplicateMapKey:    "duplicate map key",
+	ErrInvalidUTF8:        "invalid utf-8",
+	ErrLengthOverflow:     "length overflow",
+	ErrUnexpectedEOF:      "unexpected EOF",
+	ErrTypeMismatch:       "type mismatch",
+	ErrEnumLengthMismatch: "enum length mismatch",
+	ErrNotImplementedKind: "not implemented",
+	ErrTrailingData:       "trailing data",
+	ErrInvalidValue:       "invalid value",
+	ErrPathNotFound:       "path not found",
+	ErrSyntax:             "syntax error",
+	ErrIncompatible:       "incompatible schema",
+}
+
+func (k ErrorKind) String() string {
+	if s, ok := errorKindNames[k]; ok {
+		return s
+	}
+	return fmt.Sprintf("ErrorKind(%d)", int(k))
+}
+
 // Error carries offset and classification for better diagnostics.
+// Path, when set, locates the offending value by field IDs, array
+// indices, enum variants and map keys (for example `.3.1[2]` or `.4{"k"}`).
 type Error struct {
 	Offset int64
 	Kind   ErrorKind
 	Detail string
+	Path   string
 }
 
 func (e *Error) Error() string {
 	if e == nil {
 		return "<nil>"
 	}
+	where := ""
 	if e.Offset > 0 {
-		return fmt.Sprintf("relish: %v at %d: %s", e.Kind, e.Offset, e.Detail)
+		where = fmt.Sprintf(" at %d", e.Offset)
+	}
+	if e.Path != "" {
+		where += " (" + e.Path + ")"
+	}
+	return fmt.Sprintf("relish: %v%s: %s", e.Kind, where, e.Detail)
+}
+
+// prefixPath prepends the path segment p to the Path of err, if err is an
+// *Error, as the error propagates out of a nested value.
+func prefixPath(err error, p string) error {
+	e, ok := err.(*Error)
+	if !ok {
+		return err
 	}
-	return fmt.Sprintf("relish: %v: %s", e.Kind, e.Detail)
+	e2 := *e
+	e2.Path = p + e.Path
+	return &e2
 }
 
 // ErrNotImplemented is returned by stubbed methods.
@@ -0,0 +1,6 @@
+package relish
+
+// SetReflectOnly makes the Encoder and Decoder ignore Marshaler and
+// Unmarshaler methods while on, so tests can compare generated codecs
+// with the reflection path.
+func SetReflectOnly(on bool) { reflectOnly = on }
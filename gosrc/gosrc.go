@@ -0,0 +1,363 @@
+// Package gosrc derives Relish schemas from Go source code, for tools
+// that work on types they are not compiled with. It follows the rules
+// relish.SchemaOf applies to compiled types, resolving type names by
+// syntax alone: builtin types, types declared in the package, time.Time,
+// and relish.U128, I128 and Null.
+package gosrc
+
+import (
+	"fmt"
+	"go/ast"
+	"go/build"
+	"go/parser"
+	"go/token"
+	"go/types"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dadrian/relish"
+	intr "github.com/dadrian/relish/internal"
+)
+
+// relishPath is the import path of package relish.
+const relishPath = "github.com/dadrian/relish"
+
+// Package is the parsed source of one Go package.
+type Package struct {
+	Name  string
+	Fset  *token.FileSet
+	Files []*ast.File
+
+	specs []typeSpec
+}
+
+// typeSpec is a type declaration and the file it is in.
+type typeSpec struct {
+	spec *ast.TypeSpec
+	file *ast.File
+}
+
+// ParseDir parses the Go files in dir that the go command would build
+// for the current platform, leaving out tests, as one package. Files
+// excluded by build constraints, such as //go:build ignore generators or
+// files for other operating systems, are skipped.
+func ParseDir(dir string) (*Package, error) {
+	bp, err := build.Default.ImportDir(dir, 0)
+	if err != nil {
+		return nil, fmt.Errorf("gosrc: %v", err)
+	}
+	var files []string
+	for _, n := range append(bp.GoFiles, bp.CgoFiles...) {
+		files = append(files, filepath.Join(dir, n))
+	}
+	return ParseFiles(files...)
+}
+
+// ParseFiles parses the named Go files as one package.
+func ParseFiles(names ...string) (*Package, error) {
+	fset := token.NewFileSet()
+	var files []*ast.File
+	for _, name := range names {
+		src, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		f, err := parser.ParseFile(fset, name, src, parser.ParseComments)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, f)
+	}
+	return NewPackage(fset, files)
+}
+
+// NewPackage returns the package made of files, which must have been
+// parsed with fset and all have the same package name.
+func NewPackage(fset *token.FileSet, files []*ast.File) (*Package, error) {
+	p := &Package{Fset: fset, Files: files}
+	for _, f := range files {
+		if p.Name == "" {
+			p.Name = f.Name.Name
+		} else if f.Name.Name != p.Name {
+			return nil, fmt.Errorf("gosrc: %v: package %s, expected %s", fset.Position(f.Package), f.Name.Name, p.Name)
+		}
+		for _, d := range f.Decls {
+			g, ok := d.(*ast.GenDecl)
+			if !ok || g.Tok != token.TYPE {
+				continue
+			}
+			for _, s := range g.Specs {
+				p.specs = append(p.specs, typeSpec{s.(*ast.TypeSpec), f})
+			}
+		}
+	}
+	return p, nil
+}
+
+// TypeSpec returns the declaration of the named type, or nil.
+func (p *Package) TypeSpec(name string) *ast.TypeSpec {
+	if s := p.lookup(name); s != nil {
+		return s.spec
+	}
+	return nil
+}
+
+func (p *Package) lookup(name string) *typeSpec {
+	for i := range p.specs {
+		if p.specs[i].spec.Name.Name == name {
+			return &p.specs[i]
+		}
+	}
+	return nil
+}
+
+// TaggedTypes returns the names of the struct types with at least one
+// relish-tagged field, in source order.
+func (p *Package) TaggedTypes() []string {
+	var names []string
+	for _, s := range p.specs {
+		st, ok := s.spec.Type.(*ast.StructType)
+		if !ok || s.spec.TypeParams != nil {
+			continue
+		}
+		for _, f := range st.Fields.List {
+			if _, _, _, ok := ParseTag(f); ok {
+				names = append(names, s.spec.Name.Name)
+				break
+			}
+		}
+	}
+	return names
+}
+
+// ParseTag parses the relish tag of f as intr.ParseRelishTag does for
+// compiled fields.
+func ParseTag(f *ast.Field) (id int, optional, omitempty, ok bool) {
+	if f.Tag == nil {
+		return 0, false, false, false
+	}
+	tag, err := strconv.Unquote(f.Tag.Value)
+	if err != nil {
+		return 0, false, false, false
+	}
+	return intr.ParseRelishTag(reflect.StructField{Tag: reflect.StructTag(tag)})
+}
+
+// Error is an error at a position in the source.
+type Error struct {
+	Pos token.Position
+	Msg string
+}
+
+func (e *Error) Error() string { return e.Pos.String() + ": " + e.Msg }
+
+// Schema returns the schema of the type declared as name. Types that
+// refer to each other share descriptors, as with relish.SchemaOf.
+func (p *Package) Schema(name string) (relish.Schema, error) {
+	s := p.lookup(name)
+	if s == nil {
+		return nil, fmt.Errorf("gosrc: package %s declares no type %s", p.Name, name)
+	}
+	r := &resolver{p: p, seen: make(map[*ast.TypeSpec]relish.Schema)}
+	return r.spec(s)
+}
+
+type resolver struct {
+	p    *Package
+	seen map[*ast.TypeSpec]relish.Schema
+	// resolving holds non-struct type declarations being resolved, to
+	// catch invalid recursion such as type T []T.
+	resolving map[*ast.TypeSpec]bool
+}
+
+func (r *resolver) errorf(pos token.Pos, format string, args ...any) error {
+	return &Error{Pos: r.p.Fset.Position(pos), Msg: fmt.Sprintf(format, args...)}
+}
+
+func (r *resolver) spec(s *typeSpec) (relish.Schema, error) {
+	if d, ok := r.seen[s.spec]; ok {
+		return d, nil
+	}
+	if s.spec.TypeParams != nil {
+		return nil, r.errorf(s.spec.Pos(), "generic type %s is not supported", s.spec.Name.Name)
+	}
+	if st, ok := s.spec.Type.(*ast.StructType); ok {
+		return r.structType(s.spec.Name.Name, st, s.file, s.spec)
+	}
+	if r.resolving == nil {
+		r.resolving = make(map[*ast.TypeSpec]bool)
+	}
+	if r.resolving[s.spec] {
+		return nil, r.errorf(s.spec.Pos(), "invalid recursive type %s", s.spec.Name.Name)
+	}
+	r.resolving[s.spec] = true
+	defer delete(r.resolving, s.spec)
+	return r.expr(s.spec.Type, s.file)
+}
+
+// builtins maps predeclared Go types to Relish types.
+var builtins = map[string]relish.TypeID{
+	"bool":    relish.TypeBool,
+	"uint8":   relish.TypeU8,
+	"byte":    relish.TypeU8,
+	"uint16":  relish.TypeU16,
+	"uint32":  relish.TypeU32,
+	"uint64":  relish.TypeU64,
+	"int8":    relish.TypeI8,
+	"int16":   relish.TypeI16,
+	"int32":   relish.TypeI32,
+	"rune":    relish.TypeI32,
+	"int64":   relish.TypeI64,
+	"float32": relish.TypeF32,
+	"float64": relish.TypeF64,
+	"string":  relish.TypeString,
+}
+
+// relishTypes maps package relish's types to Relish types.
+var relishTypes = map[string]relish.TypeID{
+	"U128": relish.TypeU128,
+	"I128": relish.TypeI128,
+	"Null": relish.TypeNull,
+}
+
+func (r *resolver) expr(e ast.Expr, file *ast.File) (relish.Schema, error) {
+	switch e := e.(type) {
+	case *ast.ParenExpr:
+		return r.expr(e.X, file)
+	case *ast.StarExpr:
+		return r.expr(e.X, file)
+	case *ast.Ident:
+		if t, ok := relishTypes[e.Name]; ok && r.p.Name == "relish" {
+			return relish.PrimitiveDesc{Type: t}, nil
+		}
+		if s := r.p.lookup(e.Name); s != nil {
+			return r.spec(s)
+		}
+		if t, ok := builtins[e.Name]; ok {
+			return relish.PrimitiveDesc{Type: t}, nil
+		}
+		return nil, r.errorf(e.Pos(), "no relish type for %s", e.Name)
+	case *ast.SelectorExpr:
+		pkg, ok := e.X.(*ast.Ident)
+		if !ok {
+			break
+		}
+		path := importPath(file, pkg.Name)
+		if path == "time" && e.Sel.Name == "Time" {
+			return relish.PrimitiveDesc{Type: relish.TypeTimestamp}, nil
+		}
+		if t, ok := relishTypes[e.Sel.Name]; ok && path == relishPath {
+			return relish.PrimitiveDesc{Type: t}, nil
+		}
+	case *ast.ArrayType:
+		elem, err := r.expr(e.Elt, file)
+		if err != nil {
+			return nil, err
+		}
+		return &relish.ArrayDesc{Elem: elem}, nil
+	case *ast.MapType:
+		key, err := r.expr(e.Key, file)
+		if err != nil {
+			return nil, err
+		}
+		value, err := r.expr(e.Value, file)
+		if err != nil {
+			return nil, err
+		}
+		return &relish.MapDesc{Key: key, Value: value}, nil
+	case *ast.StructType:
+		return r.structType("", e, file, nil)
+	}
+	return nil, r.errorf(e.Pos(), "no relish type for %s", types.ExprString(e))
+}
+
+// structType returns the descriptor of struct type st, declared as name
+// by spec if it is not anonymous.
+func (r *resolver) structType(name string, st *ast.StructType, file *ast.File, spec *ast.TypeSpec) (relish.Schema, error) {
+	type member struct {
+		id       int
+		name     string
+		optional bool
+		typ      ast.Expr
+	}
+	var members []member
+	enum := false
+	for _, f := range st.Fields.List {
+		id, optional, omitempty, ok := ParseTag(f)
+		if !ok {
+			continue
+		}
+		names := []string{embeddedName(f.Type)}
+		if len(f.Names) > 0 {
+			names = names[:0]
+			for _, n := range f.Names {
+				names = append(names, n.Name)
+			}
+		}
+		for _, n := range names {
+			if len(members) == 0 {
+				enum = optional
+			}
+			enum = enum && optional
+			members = append(members, member{id, n, optional || omitempty, f.Type})
+		}
+	}
+	var fields *[]relish.FieldDesc
+	var d relish.Schema
+	if enum {
+		e := &relish.EnumDesc{Name: name}
+		d, fields = e, &e.Variants
+	} else {
+		s := &relish.StructDesc{Name: name}
+		d, fields = s, &s.Fields
+	}
+	if spec != nil {
+		r.seen[spec] = d
+	}
+	ids := make(map[int]string)
+	for _, m := range members {
+		if prev, dup := ids[m.id]; dup {
+			return nil, r.errorf(m.typ.Pos(), "%s.%s: field id %d already used by %s", name, m.name, m.id, prev)
+		}
+		ids[m.id] = m.name
+		t, err := r.expr(m.typ, file)
+		if err != nil {
+			return nil, err
+		}
+		*fields = append(*fields, relish.FieldDesc{ID: byte(m.id), Name: m.name, Type: t, Optional: m.optional})
+	}
+	sort.SliceStable(*fields, func(i, j int) bool { return (*fields)[i].ID < (*fields)[j].ID })
+	return d, nil
+}
+
+// importPath returns the path of the package file imports as name.
+func importPath(file *ast.File, name string) string {
+	for _, imp := range file.Imports {
+		path, _ := strconv.Unquote(imp.Path.Value)
+		local := path[strings.LastIndex(path, "/")+1:]
+		if imp.Name != nil {
+			local = imp.Name.Name
+		}
+		if local == name {
+			return path
+		}
+	}
+	return ""
+}
+
+// embeddedName returns the field name of an embedded field of type t.
+func embeddedName(t ast.Expr) string {
+	switch t := t.(type) {
+	case *ast.StarExpr:
+		return embeddedName(t.X)
+	case *ast.SelectorExpr:
+		return t.Sel.Name
+	case *ast.Ident:
+		return t.Name
+	}
+	return ""
+}
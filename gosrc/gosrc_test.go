@@ -0,0 +1,177 @@
+package gosrc
+
+import (
+	"bytes"
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/dadrian/relish"
+)
+
+// src declares the same types as the compiled ones below.
+const src = `package orders
+
+import (
+	"time"
+
+	rl "github.com/dadrian/relish"
+)
+
+type Status uint8
+
+type Tags []string
+
+type Order struct {
+	ID      uint64            ` + "`relish:\"0\"`" + `
+	Note    *string           ` + "`relish:\"1,optional\"`" + `
+	Items   []Item            ` + "`relish:\"2\"`" + `
+	Status  Status            ` + "`relish:\"3,omitempty\"`" + `
+	Tags    Tags              ` + "`relish:\"4\"`" + `
+	Shape   Shape             ` + "`relish:\"5\"`" + `
+	Parent  *Order            ` + "`relish:\"6,optional\"`" + `
+	Big     rl.U128           ` + "`relish:\"7\"`" + `
+	Counts  map[string]uint32 ` + "`relish:\"8\"`" + `
+	At      time.Time         ` + "`relish:\"9\"`" + `
+	scratch int
+}
+
+type Item struct {
+	SKU string ` + "`relish:\"1\"`" + `
+	Qty int32  ` + "`relish:\"0\"`" + `
+}
+
+type Shape struct {
+	Circle *float64 ` + "`relish:\"0,optional\"`" + `
+	None   *rl.Null ` + "`relish:\"1,optional\"`" + `
+}
+`
+
+type Status uint8
+
+type Tags []string
+
+type Order struct {
+	ID      uint64            `relish:"0"`
+	Note    *string           `relish:"1,optional"`
+	Items   []Item            `relish:"2"`
+	Status  Status            `relish:"3,omitempty"`
+	Tags    Tags              `relish:"4"`
+	Shape   Shape             `relish:"5"`
+	Parent  *Order            `relish:"6,optional"`
+	Big     relish.U128       `relish:"7"`
+	Counts  map[string]uint32 `relish:"8"`
+	At      time.Time         `relish:"9"`
+	scratch int
+}
+
+type Item struct {
+	SKU string `relish:"1"`
+	Qty int32  `relish:"0"`
+}
+
+type Shape struct {
+	Circle *float64     `relish:"0,optional"`
+	None   *relish.Null `relish:"1,optional"`
+}
+
+func parse(t *testing.T, src string) *Package {
+	t.Helper()
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "orders.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := NewPackage(fset, []*ast.File{f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestSchema_MatchesSchemaOf(t *testing.T) {
+	p := parse(t, src)
+	if got, want := p.TaggedTypes(), []string{"Order", "Item", "Shape"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("TaggedTypes = %q, want %q", got, want)
+	}
+	for _, v := range []any{Order{}, Item{}, Shape{}} {
+		rt := reflect.TypeOf(v)
+		want, err := relish.SchemaOf(rt)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := p.Schema(rt.Name())
+		if err != nil {
+			t.Fatal(err)
+		}
+		wb, _ := relish.MarshalSchema(want)
+		gb, _ := relish.MarshalSchema(got)
+		if !bytes.Equal(gb, wb) {
+			t.Errorf("%s: schema differs from SchemaOf:\n% x\n% x", rt.Name(), gb, wb)
+		}
+	}
+}
+
+func TestSchema_Errors(t *testing.T) {
+	p := parse(t, `package x
+
+import "net"
+
+type A struct {
+	N int `+"`relish:\"0\"`"+`
+}
+
+type B struct {
+	IP net.IP `+"`relish:\"0\"`"+`
+}
+
+type C struct {
+	X uint8 `+"`relish:\"0\"`"+`
+	Y uint8 `+"`relish:\"0\"`"+`
+}
+
+type D []D
+`)
+	for name, want := range map[string]string{
+		"A": "orders.go:6:4: no relish type for int",
+		"B": "orders.go:10:5: no relish type for net.IP",
+		"C": "orders.go:15:4: C.Y: field id 0 already used by X",
+		"D": "orders.go:18:6: invalid recursive type D",
+		"E": "gosrc: package x declares no type E",
+	} {
+		_, err := p.Schema(name)
+		if err == nil || !strings.HasSuffix(err.Error(), want) {
+			t.Errorf("Schema(%s) = %v, want %s", name, err, want)
+		}
+	}
+}
+
+func TestParseDir_BuildConstraints(t *testing.T) {
+	dir := t.TempDir()
+	for name, src := range map[string]string{
+		"orders.go":      "package orders\n\ntype Order struct {\n\tID uint64 `relish:\"0\"`\n}\n",
+		"gen.go":         "//go:build ignore\n\npackage main\n\ntype Gen struct{}\n",
+		"orders_test.go": "package orders_test\n",
+		"other.go":       "//go:build relishnever\n\npackage orders\n\ntype Order struct{}\n",
+	} {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(src), 0o666); err != nil {
+			t.Fatal(err)
+		}
+	}
+	p, err := ParseDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(p.Files) != 1 || p.TypeSpec("Order") == nil {
+		t.Fatalf("ParseDir parsed %d files, want only orders.go", len(p.Files))
+	}
+	if _, err := ParseDir(t.TempDir()); err == nil {
+		t.Error("ParseDir of an empty directory succeeded")
+	}
+}
@@ -0,0 +1,194 @@
+package idl
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dadrian/relish"
+)
+
+// Primitives maps the primitive type names of the language to their
+// Relish type IDs.
+var Primitives = map[string]relish.TypeID{
+	"null":      relish.TypeNull,
+	"bool":      relish.TypeBool,
+	"u8":        relish.TypeU8,
+	"u16":       relish.TypeU16,
+	"u32":       relish.TypeU32,
+	"u64":       relish.TypeU64,
+	"u128":      relish.TypeU128,
+	"i8":        relish.TypeI8,
+	"i16":       relish.TypeI16,
+	"i32":       relish.TypeI32,
+	"i64":       relish.TypeI64,
+	"i128":      relish.TypeI128,
+	"f32":       relish.TypeF32,
+	"f64":       relish.TypeF64,
+	"string":    relish.TypeString,
+	"timestamp": relish.TypeTimestamp,
+}
+
+// keywords may not be used as declaration names.
+var keywords = map[string]bool{"struct": true, "enum": true, "optional": true, "array": true, "map": true}
+
+// Check reports the semantic errors in f, in source order:
+//
+//   - declaration names must be unique and not primitive type names or
+//     keywords;
+//   - member IDs must be below 128, so their top bit is clear, and member
+//     IDs and names must be unique within a declaration;
+//   - types must exist and take the right number of arguments;
+//   - map keys must be primitive, and not null or floating point, so that
+//     every target language can hash them;
+//   - enums need at least one variant, and variants cannot be optional;
+//   - a struct with fields needs a required one, since Go encodes a
+//     struct whose fields are all optional as an enum when exactly one is
+//     set;
+//   - a struct cannot contain itself through required fields, which
+//     would need infinitely large values.
+func Check(f *File) error {
+	var errs ErrorList
+	errorf := func(pos Pos, format string, args ...any) {
+		errs = append(errs, &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+	}
+	decls := make(map[string]*Decl)
+	for _, d := range f.Decls {
+		switch {
+		case isPrimitive(d.Name) || keywords[d.Name]:
+			errorf(d.Pos, "%s name %q is reserved", d.Kind(), d.Name)
+		case decls[d.Name] != nil:
+			errorf(d.Pos, "%s %s redeclared; previous declaration at %v", d.Kind(), d.Name, decls[d.Name].Pos)
+		default:
+			decls[d.Name] = d
+		}
+	}
+	for _, d := range f.Decls {
+		if d.Enum && len(d.Members) == 0 {
+			errorf(d.Pos, "enum %s has no variants", d.Name)
+		}
+		if !d.Enum && allOptional(d) {
+			errorf(d.Pos, "struct %s has only optional fields; make one required or declare an enum", d.Name)
+		}
+		ids := make(map[int]*Member)
+		names := make(map[string]*Member)
+		for _, m := range d.Members {
+			switch {
+			case m.ID < 0 || m.ID > 0x7F:
+				errorf(m.Pos, "%s.%s: ID %d out of range; IDs must be 0 to 127", d.Name, m.Name, m.ID)
+			case ids[m.ID] != nil:
+				errorf(m.Pos, "%s.%s: ID %d already used by %s", d.Name, m.Name, m.ID, ids[m.ID].Name)
+			default:
+				ids[m.ID] = m
+			}
+			if prev := names[m.Name]; prev != nil {
+				errorf(m.Pos, "%s.%s: name already used at %v", d.Name, m.Name, prev.Pos)
+			} else {
+				names[m.Name] = m
+			}
+			if d.Enum && m.Optional {
+				errorf(m.Pos, "%s.%s: enum variants cannot be optional", d.Name, m.Name)
+			}
+			checkType(m.Type, decls, errorf)
+		}
+	}
+	for _, d := range f.Decls {
+		if decls[d.Name] == d && !d.Enum {
+			if path := cycle(d, d, decls, nil); path != nil {
+				errorf(d.Pos, "struct %s contains itself through required fields %s", d.Name, joinPath(path))
+			}
+		}
+	}
+	sort.SliceStable(errs, func(i, j int) bool {
+		a, b := errs[i].Pos, errs[j].Pos
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line || a.Line == b.Line && a.Col < b.Col
+	})
+	return errs.Err()
+}
+
+// allOptional reports whether d has members and all of them are optional.
+func allOptional(d *Decl) bool {
+	for _, m := range d.Members {
+		if !m.Optional {
+			return false
+		}
+	}
+	return len(d.Members) > 0
+}
+
+func checkType(t *Type, decls map[string]*Decl, errorf func(Pos, string, ...any)) {
+	want := 0
+	switch {
+	case t.Name == "array":
+		want = 1
+	case t.Name == "map":
+		want = 2
+	case isPrimitive(t.Name), decls[t.Name] != nil:
+	default:
+		errorf(t.Pos, "unknown type %s", t.Name)
+		return
+	}
+	if len(t.Args) != want {
+		if want == 0 {
+			errorf(t.Pos, "type %s takes no type arguments", t.Name)
+		} else {
+			errorf(t.Pos, "%s needs %d type arguments, has %d", t.Name, want, len(t.Args))
+		}
+		return
+	}
+	for _, a := range t.Args {
+		checkType(a, decls, errorf)
+	}
+	if t.Name == "map" {
+		// Unknown key types have been reported already.
+		k := t.Args[0]
+		if known := isPrimitive(k.Name) || decls[k.Name] != nil || len(k.Args) > 0; known && !validKey(k.Name) {
+			errorf(k.Pos, "invalid map key type %s; keys must be bool, integer, string or timestamp", k)
+		}
+	}
+}
+
+func isPrimitive(name string) bool {
+	_, ok := Primitives[name]
+	return ok
+}
+
+// validKey reports whether maps may have keys of type name.
+func validKey(name string) bool {
+	return isPrimitive(name) && name != "null" && name != "f32" && name != "f64"
+}
+
+// cycle returns the required fields leading from struct d back to struct
+// target, or nil if there is no such path. seen holds the path so far.
+func cycle(d, target *Decl, decls map[string]*Decl, seen []*Member) []*Member {
+	for _, m := range d.Members {
+		if m.Optional {
+			continue
+		}
+		next := decls[m.Type.Name]
+		if next == nil || next.Enum || len(m.Type.Args) != 0 {
+			continue
+		}
+		path := append(seen[:len(seen):len(seen)], m)
+		if next == target {
+			return path
+		}
+		if len(path) > len(decls) {
+			continue
+		}
+		if p := cycle(next, target, decls, path); p != nil {
+			return p
+		}
+	}
+	return nil
+}
+
+func joinPath(path []*Member) string {
+	s := ""
+	for _, m := range path {
+		s += "." + m.Name
+	}
+	return s
+}
@@ -0,0 +1,166 @@
+package idl
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"strings"
+	"unicode"
+)
+
+// goTypes maps primitive type names to Go types.
+var goTypes = map[string]string{
+	"null":      "relish.Null",
+	"bool":      "bool",
+	"u8":        "uint8",
+	"u16":       "uint16",
+	"u32":       "uint32",
+	"u64":       "uint64",
+	"u128":      "relish.U128",
+	"i8":        "int8",
+	"i16":       "int16",
+	"i32":       "int32",
+	"i64":       "int64",
+	"i128":      "relish.I128",
+	"f32":       "float32",
+	"f64":       "float64",
+	"string":    "string",
+	"timestamp": "time.Time",
+}
+
+// GenerateGo returns Go source declaring the types of f, which must have
+// passed Check, in package pkg. Structs become Go structs whose fields
+// carry `relish:"id"` tags; optional fields are pointers tagged
+// `relish:"id,optional"`. Enums become Go structs with one optional
+// pointer field per variant, which the Encoder writes as an enum when
+// exactly one is set.
+//
+// Names are converted to exported Go identifiers: snake_case becomes
+// CamelCase, and common initialisms such as id and url are upper-cased.
+// GenerateGo fails if two names convert to the same identifier.
+func GenerateGo(f *File, pkg string) ([]byte, error) {
+	g := &goGen{file: f, names: make(map[string]string)}
+	declNames := make(map[string]string)
+	for _, d := range f.Decls {
+		n := GoName(d.Name)
+		if prev, ok := declNames[n]; ok {
+			return nil, fmt.Errorf("idl: %v: %s and %s are both %s in Go", d.Pos, prev, d.Name, n)
+		}
+		declNames[n] = d.Name
+		g.names[d.Name] = n
+	}
+	var body bytes.Buffer
+	for i, d := range f.Decls {
+		if i > 0 {
+			body.WriteString("\n")
+		}
+		if err := g.decl(&body, d); err != nil {
+			return nil, err
+		}
+	}
+
+	var out bytes.Buffer
+	source := f.Name
+	if source == "" {
+		source = "a schema"
+	}
+	fmt.Fprintf(&out, "// Code generated from %s. DO NOT EDIT.\n\npackage %s\n", source, pkg)
+	var imports []string
+	if g.usesTime {
+		imports = append(imports, `"time"`)
+	}
+	if g.usesRelish {
+		if len(imports) > 0 {
+			imports = append(imports, "")
+		}
+		imports = append(imports, `"github.com/dadrian/relish"`)
+	}
+	if len(imports) > 0 {
+		fmt.Fprintf(&out, "\nimport (\n%s\n)\n", strings.Join(imports, "\n"))
+	}
+	if body.Len() > 0 {
+		out.WriteString("\n")
+		out.Write(body.Bytes())
+	}
+	src, err := format.Source(out.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("idl: formatting generated code: %v", err)
+	}
+	return src, nil
+}
+
+type goGen struct {
+	file       *File
+	names      map[string]string // declaration name to Go name
+	usesTime   bool
+	usesRelish bool
+}
+
+func (g *goGen) decl(b *bytes.Buffer, d *Decl) error {
+	fmt.Fprintf(b, "type %s struct {\n", g.names[d.Name])
+	fields := make(map[string]string)
+	for _, m := range d.Members {
+		n := GoName(m.Name)
+		if prev, ok := fields[n]; ok {
+			return fmt.Errorf("idl: %v: %s.%s and %s.%s are both %s in Go", m.Pos, d.Name, prev, d.Name, m.Name, n)
+		}
+		fields[n] = m.Name
+		t := g.goType(m.Type)
+		tag := fmt.Sprint(m.ID)
+		if m.Optional || d.Enum {
+			t = "*" + t
+			tag += ",optional"
+		}
+		fmt.Fprintf(b, "\t%s %s `relish:\"%s\"`\n", n, t, tag)
+	}
+	b.WriteString("}\n")
+	return nil
+}
+
+func (g *goGen) goType(t *Type) string {
+	switch t.Name {
+	case "array":
+		return "[]" + g.goType(t.Args[0])
+	case "map":
+		return "map[" + g.goType(t.Args[0]) + "]" + g.goType(t.Args[1])
+	}
+	if gt, ok := goTypes[t.Name]; ok {
+		g.usesTime = g.usesTime || strings.HasPrefix(gt, "time.")
+		g.usesRelish = g.usesRelish || strings.HasPrefix(gt, "relish.")
+		return gt
+	}
+	return g.names[t.Name]
+}
+
+// initialisms are upper-cased in Go names, following Go's conventions.
+var initialisms = map[string]bool{
+	"api": true, "ascii": true, "cpu": true, "css": true, "dns": true,
+	"html": true, "http": true, "https": true, "id": true, "ip": true,
+	"json": true, "ttl": true, "tcp": true, "tls": true, "udp": true,
+	"ui": true, "uid": true, "uri": true, "url": true, "utf8": true,
+	"uuid": true, "xml": true,
+}
+
+// GoName converts a schema name to an exported Go identifier. Parts
+// separated by underscores are capitalized and joined, with initialisms
+// upper-cased: "order_id" becomes "OrderID".
+func GoName(name string) string {
+	var b strings.Builder
+	for _, part := range strings.Split(name, "_") {
+		if part == "" {
+			continue
+		}
+		if initialisms[strings.ToLower(part)] {
+			b.WriteString(strings.ToUpper(part))
+			continue
+		}
+		r := []rune(part)
+		r[0] = unicode.ToUpper(r[0])
+		b.WriteString(string(r))
+	}
+	s := b.String()
+	if s == "" || !unicode.IsLetter([]rune(s)[0]) {
+		s = "X" + s
+	}
+	return s
+}
@@ -0,0 +1,78 @@
+package idl
+
+import (
+	"testing"
+)
+
+func TestGenerateGo(t *testing.T) {
+	f, err := Parse("order.relish", []byte(orderSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	src, err := GenerateGo(f, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = "// Code generated from order.relish. DO NOT EDIT.\n" +
+		`
+package orders
+
+import (
+	"time"
+
+	"github.com/dadrian/relish"
+)
+
+type Order struct {
+	ID     uint64            ` + "`relish:\"0\"`" + `
+	Note   *string           ` + "`relish:\"1,optional\"`" + `
+	Items  []Item            ` + "`relish:\"2\"`" + `
+	Counts map[string]uint32 ` + "`relish:\"3\"`" + `
+	Shape  Shape             ` + "`relish:\"4\"`" + `
+	Parent *Order            ` + "`relish:\"5,optional\"`" + `
+}
+
+type Item struct {
+	Sku     string    ` + "`relish:\"0\"`" + `
+	AddedAt time.Time ` + "`relish:\"1\"`" + `
+}
+
+type Shape struct {
+	Circle *Circle      ` + "`relish:\"0,optional\"`" + `
+	Rect   *Rect        ` + "`relish:\"1,optional\"`" + `
+	None   *relish.Null ` + "`relish:\"2,optional\"`" + `
+}
+
+type Circle struct {
+	Radius float64 ` + "`relish:\"0\"`" + `
+}
+
+type Rect struct {
+	W float32 ` + "`relish:\"0\"`" + `
+	H float32 ` + "`relish:\"1\"`" + `
+}
+`
+	if string(src) != want {
+		t.Errorf("GenerateGo =\n%s\nwant\n%s", src, want)
+	}
+}
+
+func TestGenerateGo_NameClash(t *testing.T) {
+	f, err := Parse("x", []byte(`struct A { 0: u8 user_id; 1: u8 userID; }`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GenerateGo(f, "x"); err == nil || err.Error() != "idl: x:1:27: A.user_id and A.userID are both UserID in Go" {
+		t.Errorf("GenerateGo = %v", err)
+	}
+}
+
+func TestGoName(t *testing.T) {
+	for in, want := range map[string]string{
+		"id": "ID", "order_id": "OrderID", "addedAt": "AddedAt", "_x": "X", "2d": "X2d", "http_url": "HTTPURL",
+	} {
+		if got := GoName(in); got != want {
+			t.Errorf("GoName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Package idl implements a small schema language for Relish types, so
+// that one definition can drive generated code in every language that
+// speaks Relish.
+//
+// A file is a list of struct and enum declarations:
+//
+//	// Comments run to the end of the line.
+//	struct Order {
+//		0: u64 id;
+//		1: optional string note;
+//		2: array<Item> items;
+//		3: map<string, u32> counts;
+//	}
+//
+//	enum Shape {
+//		0: Circle;
+//		1: Rect;
+//		2: f64 radius;
+//	}
+//
+// Each member has a numeric ID, a type and a name. Struct fields may be
+// marked optional. An enum variant's name defaults to its type's name, so
+// a variant holding a declared type can be written as just that type.
+//
+// Types are the primitive type names of the Relish specification (null,
+// bool, u8 … u128, i8 … i128, f32, f64, string, timestamp), array<T>,
+// map<K, V> and the names of declared structs and enums, which may be used
+// before they are declared.
+package idl
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Pos is a position in a source file.
+type Pos struct {
+	File      string
+	Line, Col int
+}
+
+func (p Pos) String() string {
+	if p.File == "" {
+		return fmt.Sprintf("%d:%d", p.Line, p.Col)
+	}
+	return fmt.Sprintf("%s:%d:%d", p.File, p.Line, p.Col)
+}
+
+// File is a parsed schema file.
+type File struct {
+	Name  string
+	Decls []*Decl
+}
+
+// Lookup returns the declaration with the given name, or nil.
+func (f *File) Lookup(name string) *Decl {
+	for _, d := range f.Decls {
+		if d.Name == name {
+			return d
+		}
+	}
+	return nil
+}
+
+// Decl is a struct or enum declaration.
+type Decl struct {
+	Pos     Pos
+	Enum    bool
+	Name    string
+	Members []*Member
+}
+
+// Kind returns "struct" or "enum".
+func (d *Decl) Kind() string {
+	if d.Enum {
+		return "enum"
+	}
+	return "struct"
+}
+
+// Member is a struct field or enum variant.
+type Member struct {
+	Pos      Pos
+	ID       int
+	Optional bool
+	Type     *Type
+	Name     string
+}
+
+// Type is a type expression: a primitive or declared type name, or
+// array or map with their type arguments.
+type Type struct {
+	Pos  Pos
+	Name string
+	Args []*Type
+}
+
+func (t *Type) String() string {
+	if len(t.Args) == 0 {
+		return t.Name
+	}
+	args := make([]string, len(t.Args))
+	for i, a := range t.Args {
+		args[i] = a.String()
+	}
+	return t.Name + "<" + strings.Join(args, ", ") + ">"
+}
+
+// Error is a syntax or semantic error at a position in a schema file.
+type Error struct {
+	Pos Pos
+	Msg string
+}
+
+func (e *Error) Error() string { return e.Pos.String() + ": " + e.Msg }
+
+// ErrorList is a list of errors, in source order.
+type ErrorList []*Error
+
+func (l ErrorList) Error() string {
+	switch len(l) {
+	case 0:
+		return "no errors"
+	case 1:
+		return l[0].Error()
+	}
+	return fmt.Sprintf("%s (and %d more errors)", l[0], len(l)-1)
+}
+
+// Err returns l as an error, or nil if it is empty.
+func (l ErrorList) Err() error {
+	if len(l) == 0 {
+		return nil
+	}
+	return l
+}
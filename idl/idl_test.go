@@ -0,0 +1,187 @@
+package idl
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dadrian/relish"
+)
+
+const orderSchema = `
+// An order and its parts.
+struct Order {
+	0: u64 id;
+	1: optional string note;
+	2: array<Item> items;
+	3: map<string, u32> counts;
+	4: Shape shape;
+	5: optional Order parent;
+}
+
+struct Item { 0: string sku; 1: timestamp added_at; }
+
+enum Shape {
+	0: Circle;
+	1: Rect;
+	2: null none;
+}
+
+struct Circle { 0: f64 radius; }
+struct Rect { 0: f32 w; 1: f32 h; }
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse("order.relish", []byte(orderSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := Check(f); err != nil {
+		t.Fatal(err)
+	}
+	if len(f.Decls) != 5 {
+		t.Fatalf("got %d declarations, want 5", len(f.Decls))
+	}
+	o := f.Lookup("Order")
+	if o == nil || o.Enum || len(o.Members) != 6 {
+		t.Fatalf("Order = %+v", o)
+	}
+	m := o.Members[1]
+	if m.ID != 1 || !m.Optional || m.Name != "note" || m.Type.String() != "string" {
+		t.Errorf("Order.note = %+v", m)
+	}
+	if got := o.Members[3].Type.String(); got != "map<string, u32>" {
+		t.Errorf("counts type = %s", got)
+	}
+	if p := o.Members[2].Pos; p.Line != 6 || p.Col != 2 || p.File != "order.relish" {
+		t.Errorf("items position = %v", p)
+	}
+	s := f.Lookup("Shape")
+	if !s.Enum || s.Members[0].Name != "Circle" || s.Members[2].Name != "none" {
+		t.Errorf("Shape = %+v", s)
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, tc := range []struct{ src, want string }{
+		{`struct {`, `x:1:8: expected struct name, found "{"`},
+		{`struct A { 0 u8 a; }`, `x:1:14: expected ":", found "u8"`},
+		{`struct A { 0: u8; }`, `x:1:17: expected field name, found ";"`},
+		{`struct A { 0: array<u8 a; }`, `x:1:24: expected ">", found "a"`},
+		{"struct A {\n\t0: u8 a;\n", `x:3:1: expected member ID or "}", found end of file`},
+		{`message A {}`, `x:1:1: expected "struct" or "enum", found "message"`},
+		{`struct A { 0: u8 a$; }`, `x:1:19: expected ";", found invalid character "$"`},
+	} {
+		_, err := Parse("x", []byte(tc.src))
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("Parse(%q) = %v, want %s", tc.src, err, tc.want)
+		}
+	}
+}
+
+func TestCheck(t *testing.T) {
+	const src = `struct A {
+	0: u8 a;
+	0: u8 b;
+	128: u8 c;
+	3: u8 a;
+	4: B b2;
+	5: map<f64, u8> m;
+	6: map<array<u8>, u8> m2;
+	7: array<u8, u8> x;
+	8: u8<string> y;
+	9: C c1;
+}
+enum B { 0: optional u8 v; }
+enum E {}
+struct u8 {}
+struct A {}
+struct C { 0: D d; }
+struct D { 0: optional C c; 1: array<C> cs; 2: C c2; }
+struct P { 0: optional string name; 1: optional u32 age; }
+`
+	f, err := Parse("x", []byte(src))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = Check(f)
+	list, ok := err.(ErrorList)
+	if !ok {
+		t.Fatalf("Check = %v", err)
+	}
+	var got []string
+	for _, e := range list {
+		got = append(got, e.Error())
+	}
+	want := []string{
+		"x:3:2: A.b: ID 0 already used by a",
+		"x:4:2: A.c: ID 128 out of range; IDs must be 0 to 127",
+		"x:5:2: A.a: name already used at x:2:2",
+		"x:7:9: invalid map key type f64; keys must be bool, integer, string or timestamp",
+		"x:8:9: invalid map key type array<u8>; keys must be bool, integer, string or timestamp",
+		"x:9:5: array needs 1 type arguments, has 2",
+		"x:10:5: type u8 takes no type arguments",
+		"x:13:10: B.v: enum variants cannot be optional",
+		"x:14:1: enum E has no variants",
+		`x:15:1: struct name "u8" is reserved`,
+		"x:16:1: struct A redeclared; previous declaration at x:1:1",
+		"x:17:1: struct C contains itself through required fields .d.c2",
+		"x:18:1: struct D contains itself through required fields .c2.d",
+		"x:19:1: struct P has only optional fields; make one required or declare an enum",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check errors:\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
+
+func TestSchema(t *testing.T) {
+	f, err := Parse("order.relish", []byte(orderSchema))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := f.Schema("Order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	o := s.(*relish.StructDesc)
+	if o.Fields[5].Type != s {
+		t.Error("recursive reference not shared")
+	}
+	var got []string
+	for _, fd := range o.Fields {
+		got = append(got, fd.Name+" "+fd.Type.String())
+	}
+	want := []string{"id u64", "note string", "items array<struct Item>", "counts map<string,u32>", "shape enum Shape", "parent struct Order"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fields = %q, want %q", got, want)
+	}
+	if _, err := f.Schema("Nope"); err == nil {
+		t.Error("Schema of undeclared type succeeded")
+	}
+}
+
+// Point is the Go type GenerateGo writes for struct Point below.
+type Point struct {
+	X int32 `relish:"0"`
+	Y int32 `relish:"1"`
+}
+
+func TestSchema_FingerprintMatchesGo(t *testing.T) {
+	f, err := Parse("point.relish", []byte("struct Point { 0: i32 x; 1: i32 y; }"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s, err := f.Schema("Point")
+	if err != nil {
+		t.Fatal(err)
+	}
+	gs, err := relish.SchemaOf(reflect.TypeOf(Point{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fp, _ := relish.FingerprintOf(s)
+	gfp, _ := relish.FingerprintOf(gs)
+	if fp != gfp {
+		t.Errorf("IDL fingerprint %s, Go fingerprint %s", fp, gfp)
+	}
+}
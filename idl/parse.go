@@ -0,0 +1,245 @@
+package idl
+
+import (
+	"fmt"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Parse parses the schema file src. name is used in positions. The
+// result is only syntactically checked; run Check before using it.
+func Parse(name string, src []byte) (*File, error) {
+	p := &parser{src: src, pos: Pos{File: name, Line: 1, Col: 1}}
+	p.next()
+	f := &File{Name: name}
+	for p.tok != tokEOF {
+		d := p.decl()
+		if d == nil {
+			break
+		}
+		f.Decls = append(f.Decls, d)
+	}
+	return f, p.errs.Err()
+}
+
+type token int
+
+const (
+	tokEOF token = iota
+	tokIdent
+	tokInt
+	tokPunct
+	tokInvalid
+)
+
+type parser struct {
+	src  []byte
+	off  int
+	pos  Pos // position of src[off]
+	errs ErrorList
+
+	// The current token.
+	tok    token
+	lit    string
+	tokPos Pos
+}
+
+func (p *parser) errorf(pos Pos, format string, args ...any) {
+	p.errs = append(p.errs, &Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// advance moves past the rune at the current offset.
+func (p *parser) advance() {
+	r, n := utf8.DecodeRune(p.src[p.off:])
+	p.off += n
+	if r == '\n' {
+		p.pos.Line++
+		p.pos.Col = 1
+	} else {
+		p.pos.Col++
+	}
+}
+
+// next reads the next token, skipping white space and comments.
+func (p *parser) next() {
+	for p.off < len(p.src) {
+		c := p.src[p.off]
+		if c == ' ' || c == '\t' || c == '\r' || c == '\n' {
+			p.advance()
+			continue
+		}
+		if c == '/' && p.off+1 < len(p.src) && p.src[p.off+1] == '/' {
+			for p.off < len(p.src) && p.src[p.off] != '\n' {
+				p.advance()
+			}
+			continue
+		}
+		break
+	}
+	p.tokPos = p.pos
+	if p.off >= len(p.src) {
+		p.tok, p.lit = tokEOF, ""
+		return
+	}
+	start := p.off
+	r, _ := utf8.DecodeRune(p.src[p.off:])
+	switch {
+	case r == '_' || unicode.IsLetter(r):
+		for p.off < len(p.src) {
+			r, _ := utf8.DecodeRune(p.src[p.off:])
+			if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			p.advance()
+		}
+		p.tok = tokIdent
+	case r >= '0' && r <= '9':
+		for p.off < len(p.src) && p.src[p.off] >= '0' && p.src[p.off] <= '9' {
+			p.advance()
+		}
+		p.tok = tokInt
+	case r < utf8.RuneSelf && isPunct(byte(r)):
+		p.advance()
+		p.tok = tokPunct
+	default:
+		p.advance()
+		p.tok = tokInvalid
+	}
+	p.lit = string(p.src[start:p.off])
+}
+
+func isPunct(c byte) bool {
+	switch c {
+	case '{', '}', ':', ';', '<', '>', ',':
+		return true
+	}
+	return false
+}
+
+// describe names the current token for error messages.
+func (p *parser) describe() string {
+	switch p.tok {
+	case tokEOF:
+		return "end of file"
+	case tokInvalid:
+		return fmt.Sprintf("invalid character %q", p.lit)
+	}
+	return strconv.Quote(p.lit)
+}
+
+// expect consumes the punctuation lit, reporting false with an error if
+// the current token is anything else.
+func (p *parser) expect(lit string) bool {
+	if p.tok != tokPunct || p.lit != lit {
+		p.errorf(p.tokPos, "expected %q, found %s", lit, p.describe())
+		return false
+	}
+	p.next()
+	return true
+}
+
+// ident consumes an identifier. what describes it in errors.
+func (p *parser) ident(what string) (string, bool) {
+	if p.tok != tokIdent {
+		p.errorf(p.tokPos, "expected %s, found %s", what, p.describe())
+		return "", false
+	}
+	s := p.lit
+	p.next()
+	return s, true
+}
+
+// decl parses a declaration. It returns nil after an error, as there is
+// no reliable point to resume at.
+func (p *parser) decl() *Decl {
+	d := &Decl{Pos: p.tokPos}
+	switch {
+	case p.tok == tokIdent && p.lit == "struct":
+	case p.tok == tokIdent && p.lit == "enum":
+		d.Enum = true
+	default:
+		p.errorf(p.tokPos, "expected \"struct\" or \"enum\", found %s", p.describe())
+		return nil
+	}
+	p.next()
+	var ok bool
+	if d.Name, ok = p.ident(d.Kind() + " name"); !ok || !p.expect("{") {
+		return nil
+	}
+	for !(p.tok == tokPunct && p.lit == "}") {
+		m := p.member(d)
+		if m == nil {
+			return nil
+		}
+		d.Members = append(d.Members, m)
+	}
+	p.next()
+	return d
+}
+
+// member parses `ID: [optional] Type [Name];`.
+func (p *parser) member(d *Decl) *Member {
+	m := &Member{Pos: p.tokPos}
+	if p.tok != tokInt {
+		p.errorf(p.tokPos, "expected member ID or \"}\", found %s", p.describe())
+		return nil
+	}
+	id, err := strconv.Atoi(p.lit)
+	if err != nil {
+		id = -1
+	}
+	m.ID = id
+	p.next()
+	if !p.expect(":") {
+		return nil
+	}
+	if p.tok == tokIdent && p.lit == "optional" {
+		m.Optional = true
+		p.next()
+	}
+	if m.Type = p.typ(); m.Type == nil {
+		return nil
+	}
+	if p.tok == tokIdent {
+		m.Name = p.lit
+		p.next()
+	} else if !d.Enum {
+		p.errorf(p.tokPos, "expected field name, found %s", p.describe())
+		return nil
+	} else {
+		m.Name = m.Type.Name
+	}
+	if !p.expect(";") {
+		return nil
+	}
+	return m
+}
+
+// typ parses a type expression.
+func (p *parser) typ() *Type {
+	t := &Type{Pos: p.tokPos}
+	var ok bool
+	if t.Name, ok = p.ident("type"); !ok {
+		return nil
+	}
+	if p.tok != tokPunct || p.lit != "<" {
+		return t
+	}
+	p.next()
+	for {
+		a := p.typ()
+		if a == nil {
+			return nil
+		}
+		t.Args = append(t.Args, a)
+		if p.tok == tokPunct && p.lit == "," {
+			p.next()
+			continue
+		}
+		if !p.expect(">") {
+			return nil
+		}
+		return t
+	}
+}
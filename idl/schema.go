@@ -0,0 +1,58 @@
+package idl
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/dadrian/relish"
+)
+
+// Schema returns the descriptor of the struct or enum declared as name
+// in f, which must have passed Check. Declarations it refers to are
+// described by shared descriptors, so recursive types yield cyclic
+// schemas, as with relish.SchemaOf.
+func (f *File) Schema(name string) (relish.Schema, error) {
+	d := f.Lookup(name)
+	if d == nil {
+		return nil, fmt.Errorf("idl: %s declares no type %s", f.Name, name)
+	}
+	return f.declSchema(d, make(map[*Decl]relish.Schema)), nil
+}
+
+func (f *File) declSchema(d *Decl, seen map[*Decl]relish.Schema) relish.Schema {
+	if s, ok := seen[d]; ok {
+		return s
+	}
+	var members *[]relish.FieldDesc
+	if d.Enum {
+		e := &relish.EnumDesc{Name: d.Name}
+		seen[d], members = e, &e.Variants
+	} else {
+		s := &relish.StructDesc{Name: d.Name}
+		seen[d], members = s, &s.Fields
+	}
+	for _, m := range d.Members {
+		*members = append(*members, relish.FieldDesc{
+			ID:       byte(m.ID),
+			Name:     m.Name,
+			Type:     f.typeSchema(m.Type, seen),
+			Optional: m.Optional,
+		})
+	}
+	ms := *members
+	sort.SliceStable(ms, func(i, j int) bool { return ms[i].ID < ms[j].ID })
+	return seen[d]
+}
+
+func (f *File) typeSchema(t *Type, seen map[*Decl]relish.Schema) relish.Schema {
+	switch t.Name {
+	case "array":
+		return &relish.ArrayDesc{Elem: f.typeSchema(t.Args[0], seen)}
+	case "map":
+		return &relish.MapDesc{Key: f.typeSchema(t.Args[0], seen), Value: f.typeSchema(t.Args[1], seen)}
+	}
+	if id, ok := Primitives[t.Name]; ok {
+		return relish.PrimitiveDesc{Type: id}
+	}
+	return f.declSchema(f.Lookup(t.Name), seen)
+}
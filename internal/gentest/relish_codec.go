@@ -0,0 +1,1145 @@
+// Code generated by relishgen. DO NOT EDIT.
+
+package gentest
+
+import (
+	"fmt"
+	"github.com/dadrian/relish"
+)
+
+// MarshalRelish appends the Relish encoding of v to a.
+func (v *Line) MarshalRelish(a *relish.Appender) error {
+	if err := a.Start(relish.TypeStruct); err != nil {
+		return err
+	}
+	m := a.Begin()
+	a.Buf = append(a.Buf, 0)
+	a.Type(relish.TypeString)
+	if err := a.String(v.SKU); err != nil {
+		return err
+	}
+	a.Buf = append(a.Buf, 1)
+	a.Type(relish.TypeI32)
+	a.I32(v.Qty)
+	return a.End(m)
+}
+
+// RelishSize returns the length of the Relish encoding of v.
+func (v *Line) RelishSize() int {
+	n := 0
+	n++
+	n += 1 + relish.LenSize(len(v.SKU)) + len(v.SKU)
+	n++
+	n += 5
+	return 1 + relish.LenSize(n) + n
+}
+
+// UnmarshalRelish decodes the Relish value with type t and content c
+// into v.
+func (v *Line) UnmarshalRelish(t relish.TypeID, c []byte) error {
+	if err := relish.CheckType(t, relish.TypeStruct, "gentest.Line"); err != nil {
+		return err
+	}
+	if t == relish.TypeEnum {
+		id, _, _, err := relish.SplitVariant(c)
+		if err != nil {
+			return err
+		}
+		switch id {
+		case 0:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 1:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		default:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "unknown enum variant"}
+		}
+	}
+	prev := -1
+	for p := c; len(p) > 0; {
+		id, ft, fc, rest, err := relish.NextField(p, prev)
+		if err != nil {
+			return err
+		}
+		p, prev = rest, int(id)
+		switch id {
+		case 0:
+			if err := relish.CheckType(ft, relish.TypeString, "string"); err != nil {
+				return relish.InField(err, id)
+			}
+			x1, err := relish.DecodeString(fc)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			v.SKU = x1
+		case 1:
+			if err := relish.CheckType(ft, relish.TypeI32, "int32"); err != nil {
+				return relish.InField(err, id)
+			}
+			v.Qty = int32(relish.DecodeU32(fc))
+		}
+	}
+	return nil
+}
+
+// MarshalRelish appends the Relish encoding of v to a.
+func (v *Order) MarshalRelish(a *relish.Appender) error {
+	if err := a.Start(relish.TypeStruct); err != nil {
+		return err
+	}
+	m := a.Begin()
+	a.Buf = append(a.Buf, 0)
+	a.Type(relish.TypeU32)
+	a.U32(uint32(v.ID))
+	if v.Note != nil {
+		a.Buf = append(a.Buf, 1)
+		var x2 string
+		if v.Note != nil {
+			x2 = *v.Note
+		}
+		a.Type(relish.TypeString)
+		if err := a.String(x2); err != nil {
+			return err
+		}
+	}
+	a.Buf = append(a.Buf, 2)
+	a.Type(relish.TypeArray)
+	m3 := a.Begin()
+	a.Buf = append(a.Buf, byte(relish.TypeStruct))
+	for i4 := range v.Lines {
+		a.Elem(relish.TypeStruct)
+		if err := v.Lines[i4].MarshalRelish(a); err != nil {
+			return err
+		}
+	}
+	if err := a.End(m3); err != nil {
+		return err
+	}
+	a.Buf = append(a.Buf, 3)
+	a.Type(relish.TypeMap)
+	m5 := a.Begin()
+	a.Buf = append(a.Buf, byte(relish.TypeString), byte(relish.TypeU16))
+	s6 := len(a.Buf)
+	for k7, v8 := range v.Counts {
+		if err := a.String(k7); err != nil {
+			return err
+		}
+		a.U16(v8)
+	}
+	if err := a.SortPairs(s6, relish.TypeString, relish.TypeU16); err != nil {
+		return err
+	}
+	if err := a.End(m5); err != nil {
+		return err
+	}
+	if v.Labels != nil {
+		a.Buf = append(a.Buf, 4)
+		a.Type(relish.TypeMap)
+		m9 := a.Begin()
+		a.Buf = append(a.Buf, byte(relish.TypeString), byte(relish.TypeU32))
+		s10 := len(a.Buf)
+		for k11, v12 := range v.Labels {
+			if err := a.String(k11); err != nil {
+				return err
+			}
+			a.U32(uint32(v12))
+		}
+		if err := a.SortPairs(s10, relish.TypeString, relish.TypeU32); err != nil {
+			return err
+		}
+		if err := a.End(m9); err != nil {
+			return err
+		}
+	}
+	a.Buf = append(a.Buf, 5)
+	a.Type(relish.TypeU128)
+	a.U128(v.Big)
+	a.Buf = append(a.Buf, 6)
+	a.Type(relish.TypeI128)
+	a.I128(v.Neg)
+	a.Buf = append(a.Buf, 7)
+	a.Type(relish.TypeTimestamp)
+	if err := a.Timestamp(v.At); err != nil {
+		return err
+	}
+	if v.Parent != nil {
+		a.Buf = append(a.Buf, 8)
+		p13 := v.Parent
+		if p13 == nil {
+			p13 = new(Order)
+		}
+		if err := (*p13).MarshalRelish(a); err != nil {
+			return err
+		}
+	}
+	a.Buf = append(a.Buf, 9)
+	if err := v.Shape.MarshalRelish(a); err != nil {
+		return err
+	}
+	a.Buf = append(a.Buf, 10)
+	a.Type(relish.TypeArray)
+	m14 := a.Begin()
+	a.Buf = append(a.Buf, byte(relish.TypeU8))
+	a.Buf = append(a.Buf, v.Blob...)
+	if err := a.End(m14); err != nil {
+		return err
+	}
+	a.Buf = append(a.Buf, 11)
+	a.Type(relish.TypeArray)
+	m15 := a.Begin()
+	a.Buf = append(a.Buf, byte(relish.TypeArray))
+	for i16 := range v.Grid {
+		m17 := a.Begin()
+		a.Buf = append(a.Buf, byte(relish.TypeI8))
+		for i18 := range v.Grid[i16] {
+			a.I8(v.Grid[i16][i18])
+		}
+		if err := a.End(m17); err != nil {
+			return err
+		}
+	}
+	if err := a.End(m15); err != nil {
+		return err
+	}
+	a.Buf = append(a.Buf, 12)
+	a.Type(relish.TypeF32)
+	a.F32(v.Ratio)
+	if v.Scale != 0 {
+		a.Buf = append(a.Buf, 13)
+		a.Type(relish.TypeF64)
+		a.F64(v.Scale)
+	}
+	a.Buf = append(a.Buf, 14)
+	a.Type(relish.TypeArray)
+	m19 := a.Begin()
+	a.Buf = append(a.Buf, byte(relish.TypeBool))
+	for i20 := range v.Flags {
+		a.Bool(v.Flags[i20])
+	}
+	if err := a.End(m19); err != nil {
+		return err
+	}
+	a.Buf = append(a.Buf, 15)
+	a.Type(relish.TypeNull)
+	a.Buf = append(a.Buf, 16)
+	a.Type(relish.TypeMap)
+	m21 := a.Begin()
+	a.Buf = append(a.Buf, byte(relish.TypeI64), byte(relish.TypeEnum))
+	s22 := len(a.Buf)
+	for k23, v24 := range v.Shapes {
+		a.I64(k23)
+		p25 := v24
+		if p25 == nil {
+			p25 = new(Shape)
+		}
+		a.Elem(relish.TypeEnum)
+		if err := (*p25).MarshalRelish(a); err != nil {
+			return err
+		}
+	}
+	if err := a.SortPairs(s22, relish.TypeI64, relish.TypeEnum); err != nil {
+		return err
+	}
+	if err := a.End(m21); err != nil {
+		return err
+	}
+	if v.Tags != nil {
+		a.Buf = append(a.Buf, 17)
+		a.Type(relish.TypeArray)
+		m26 := a.Begin()
+		a.Buf = append(a.Buf, byte(relish.TypeString))
+		for i27 := range v.Tags {
+			if err := a.String(v.Tags[i27]); err != nil {
+				return err
+			}
+		}
+		if err := a.End(m26); err != nil {
+			return err
+		}
+	}
+	if v.Any != nil {
+		a.Buf = append(a.Buf, 18)
+		if err := a.Encode(v.Any); err != nil {
+			return err
+		}
+	}
+	a.Buf = append(a.Buf, 19)
+	if err := a.Encode(v.Inline); err != nil {
+		return err
+	}
+	a.Buf = append(a.Buf, 20)
+	a.Type(relish.TypeMap)
+	m28 := a.Begin()
+	a.Buf = append(a.Buf, byte(relish.TypeU8), byte(relish.TypeArray))
+	s29 := len(a.Buf)
+	for k30, v31 := range v.Nested {
+		a.U8(k30)
+		m32 := a.Begin()
+		a.Buf = append(a.Buf, byte(relish.TypeStruct))
+		for i33 := range v31 {
+			a.Elem(relish.TypeStruct)
+			if err := v31[i33].MarshalRelish(a); err != nil {
+				return err
+			}
+		}
+		if err := a.End(m32); err != nil {
+			return err
+		}
+	}
+	if err := a.SortPairs(s29, relish.TypeU8, relish.TypeArray); err != nil {
+		return err
+	}
+	if err := a.End(m28); err != nil {
+		return err
+	}
+	a.Buf = append(a.Buf, 21)
+	p34 := v.Ptr
+	if p34 == nil {
+		p34 = new(Line)
+	}
+	if err := (*p34).MarshalRelish(a); err != nil {
+		return err
+	}
+	a.Buf = append(a.Buf, 22)
+	var x35 uint64
+	if v.Count != nil {
+		x35 = *v.Count
+	}
+	a.Type(relish.TypeU64)
+	a.U64(x35)
+	if v.Sum != 0 {
+		a.Buf = append(a.Buf, 23)
+		a.Type(relish.TypeI64)
+		a.I64(v.Sum)
+	}
+	a.Buf = append(a.Buf, 24)
+	if err := v.Opt.MarshalRelish(a); err != nil {
+		return err
+	}
+	return a.End(m)
+}
+
+// RelishSize returns the length of the Relish encoding of v.
+func (v *Order) RelishSize() int {
+	n := 0
+	n++
+	n += 5
+	if v.Note != nil {
+		n++
+		var x36 string
+		if v.Note != nil {
+			x36 = *v.Note
+		}
+		n += 1 + relish.LenSize(len(x36)) + len(x36)
+	}
+	n++
+	c37 := 1
+	for i38 := range v.Lines {
+		c37 += v.Lines[i38].RelishSize() - 1
+	}
+	n += 1 + relish.LenSize(c37) + c37
+	n++
+	c39 := 2
+	for k40, _ := range v.Counts {
+		c39 += relish.LenSize(len(k40)) + len(k40)
+		c39 += 2
+	}
+	n += 1 + relish.LenSize(c39) + c39
+	if v.Labels != nil {
+		n++
+		c41 := 2
+		for k42, _ := range v.Labels {
+			c41 += relish.LenSize(len(k42)) + len(k42)
+			c41 += 4
+		}
+		n += 1 + relish.LenSize(c41) + c41
+	}
+	n++
+	n += 17
+	n++
+	n += 17
+	n++
+	n += 9
+	if v.Parent != nil {
+		n++
+		p43 := v.Parent
+		if p43 == nil {
+			p43 = new(Order)
+		}
+		n += (*p43).RelishSize()
+	}
+	n++
+	n += v.Shape.RelishSize()
+	n++
+	c44 := 1 + len(v.Blob)*1
+	n += 1 + relish.LenSize(c44) + c44
+	n++
+	c45 := 1
+	for i46 := range v.Grid {
+		c47 := 1 + len(v.Grid[i46])*1
+		c45 += relish.LenSize(c47) + c47
+	}
+	n += 1 + relish.LenSize(c45) + c45
+	n++
+	n += 5
+	if v.Scale != 0 {
+		n++
+		n += 9
+	}
+	n++
+	c48 := 1 + len(v.Flags)*1
+	n += 1 + relish.LenSize(c48) + c48
+	n++
+	n += 1
+	n++
+	c49 := 2
+	for _, v50 := range v.Shapes {
+		c49 += 8
+		p51 := v50
+		if p51 == nil {
+			p51 = new(Shape)
+		}
+		c49 += (*p51).RelishSize() - 1
+	}
+	n += 1 + relish.LenSize(c49) + c49
+	if v.Tags != nil {
+		n++
+		c52 := 1
+		for i53 := range v.Tags {
+			c52 += relish.LenSize(len(v.Tags[i53])) + len(v.Tags[i53])
+		}
+		n += 1 + relish.LenSize(c52) + c52
+	}
+	if v.Any != nil {
+		n++
+		n += relish.SizeOf(v.Any)
+	}
+	n++
+	n += relish.SizeOf(v.Inline)
+	n++
+	c54 := 2
+	for _, v55 := range v.Nested {
+		c54 += 1
+		c56 := 1
+		for i57 := range v55 {
+			c56 += v55[i57].RelishSize() - 1
+		}
+		c54 += relish.LenSize(c56) + c56
+	}
+	n += 1 + relish.LenSize(c54) + c54
+	n++
+	p58 := v.Ptr
+	if p58 == nil {
+		p58 = new(Line)
+	}
+	n += (*p58).RelishSize()
+	n++
+	n += 9
+	if v.Sum != 0 {
+		n++
+		n += 9
+	}
+	n++
+	n += v.Opt.RelishSize()
+	return 1 + relish.LenSize(n) + n
+}
+
+// UnmarshalRelish decodes the Relish value with type t and content c
+// into v.
+func (v *Order) UnmarshalRelish(t relish.TypeID, c []byte) error {
+	if err := relish.CheckType(t, relish.TypeStruct, "gentest.Order"); err != nil {
+		return err
+	}
+	if t == relish.TypeEnum {
+		id, vt, vc, err := relish.SplitVariant(c)
+		if err != nil {
+			return err
+		}
+		switch id {
+		case 0:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 1:
+			if v.Note == nil {
+				v.Note = new(string)
+			}
+			if err := relish.CheckType(vt, relish.TypeString, "string"); err != nil {
+				return relish.InVariant(err, id)
+			}
+			x59, err := relish.DecodeString(vc)
+			if err != nil {
+				return relish.InVariant(err, id)
+			}
+			(*v.Note) = x59
+		case 2:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 3:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 4:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 5:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 6:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 7:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 8:
+			if v.Parent == nil {
+				v.Parent = new(Order)
+			}
+			if err := (*v.Parent).UnmarshalRelish(vt, vc); err != nil {
+				return relish.InVariant(err, id)
+			}
+		case 9:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 10:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 11:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 12:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 13:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 14:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 15:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 16:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 17:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 18:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 19:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 20:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 21:
+			if v.Ptr == nil {
+				v.Ptr = new(Line)
+			}
+			if err := (*v.Ptr).UnmarshalRelish(vt, vc); err != nil {
+				return relish.InVariant(err, id)
+			}
+		case 22:
+			if v.Count == nil {
+				v.Count = new(uint64)
+			}
+			if err := relish.CheckType(vt, relish.TypeU64, "uint64"); err != nil {
+				return relish.InVariant(err, id)
+			}
+			(*v.Count) = relish.DecodeU64(vc)
+		case 23:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		case 24:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "enum field must be pointer"}
+		default:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "unknown enum variant"}
+		}
+		return nil
+	}
+	prev := -1
+	for p := c; len(p) > 0; {
+		id, ft, fc, rest, err := relish.NextField(p, prev)
+		if err != nil {
+			return err
+		}
+		p, prev = rest, int(id)
+		switch id {
+		case 0:
+			if err := relish.CheckType(ft, relish.TypeU32, "gentest.ID"); err != nil {
+				return relish.InField(err, id)
+			}
+			v.ID = ID(relish.DecodeU32(fc))
+		case 1:
+			if v.Note == nil {
+				v.Note = new(string)
+			}
+			if err := relish.CheckType(ft, relish.TypeString, "string"); err != nil {
+				return relish.InField(err, id)
+			}
+			x60, err := relish.DecodeString(fc)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			(*v.Note) = x60
+		case 2:
+			if err := relish.CheckType(ft, relish.TypeArray, "[]gentest.Line"); err != nil {
+				return relish.InField(err, id)
+			}
+			et61, el62, err := relish.SplitArray(fc)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			if err := relish.CheckElemType(et61, relish.TypeStruct, "gentest.Line"); err != nil {
+				return relish.InField(err, id)
+			}
+			n63, err := relish.CountElems(et61, el62)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			v.Lines = make([]Line, n63)
+			for i64 := 0; i64 < n63; i64++ {
+				var ec65 []byte
+				ec65, el62, _ = relish.SplitElem(et61, el62)
+				if err := v.Lines[i64].UnmarshalRelish(et61, ec65); err != nil {
+					return relish.InField(relish.InIndex(err, i64), id)
+				}
+			}
+		case 3:
+			if err := relish.CheckType(ft, relish.TypeMap, "map[string]uint16"); err != nil {
+				return relish.InField(err, id)
+			}
+			kt66, vt67, pr68, err := relish.SplitMap(fc)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			if err := relish.CheckElemType(kt66, relish.TypeString, "string"); err != nil {
+				return relish.InField(err, id)
+			}
+			if err := relish.CheckElemType(vt67, relish.TypeU16, "uint16"); err != nil {
+				return relish.InField(err, id)
+			}
+			out69 := make(map[string]uint16)
+			for i70 := 0; len(pr68) > 0; i70++ {
+				kc71, vc72, next73, err := relish.SplitEntry(kt66, vt67, pr68)
+				if err != nil {
+					return relish.InField(err, id)
+				}
+				var k74 string
+				if err := relish.CheckType(kt66, relish.TypeString, "string"); err != nil {
+					return relish.InField(err, id)
+				}
+				x76, err := relish.DecodeString(kc71)
+				if err != nil {
+					return relish.InField(err, id)
+				}
+				k74 = x76
+				if _, dup := out69[k74]; dup {
+					return relish.InField(relish.InKey(&relish.Error{Kind: relish.ErrDuplicateMapKey, Detail: "duplicate map key"}, kt66, kc71, i70), id)
+				}
+				var v75 uint16
+				if err := relish.CheckType(vt67, relish.TypeU16, "uint16"); err != nil {
+					return relish.InField(relish.InKey(err, kt66, kc71, i70), id)
+				}
+				v75 = relish.DecodeU16(vc72)
+				out69[k74] = v75
+				pr68 = next73
+			}
+			v.Counts = out69
+		case 4:
+			if err := relish.CheckType(ft, relish.TypeMap, "gentest.Labels"); err != nil {
+				return relish.InField(err, id)
+			}
+			kt77, vt78, pr79, err := relish.SplitMap(fc)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			if err := relish.CheckElemType(kt77, relish.TypeString, "string"); err != nil {
+				return relish.InField(err, id)
+			}
+			if err := relish.CheckElemType(vt78, relish.TypeU32, "gentest.ID"); err != nil {
+				return relish.InField(err, id)
+			}
+			out80 := make(Labels)
+			for i81 := 0; len(pr79) > 0; i81++ {
+				kc82, vc83, next84, err := relish.SplitEntry(kt77, vt78, pr79)
+				if err != nil {
+					return relish.InField(err, id)
+				}
+				var k85 string
+				if err := relish.CheckType(kt77, relish.TypeString, "string"); err != nil {
+					return relish.InField(err, id)
+				}
+				x87, err := relish.DecodeString(kc82)
+				if err != nil {
+					return relish.InField(err, id)
+				}
+				k85 = x87
+				if _, dup := out80[k85]; dup {
+					return relish.InField(relish.InKey(&relish.Error{Kind: relish.ErrDuplicateMapKey, Detail: "duplicate map key"}, kt77, kc82, i81), id)
+				}
+				var v86 ID
+				if err := relish.CheckType(vt78, relish.TypeU32, "gentest.ID"); err != nil {
+					return relish.InField(relish.InKey(err, kt77, kc82, i81), id)
+				}
+				v86 = ID(relish.DecodeU32(vc83))
+				out80[k85] = v86
+				pr79 = next84
+			}
+			v.Labels = out80
+		case 5:
+			if err := relish.CheckType(ft, relish.TypeU128, "relish.U128"); err != nil {
+				return relish.InField(err, id)
+			}
+			v.Big = relish.U128(fc)
+		case 6:
+			if err := relish.CheckType(ft, relish.TypeI128, "relish.I128"); err != nil {
+				return relish.InField(err, id)
+			}
+			v.Neg = relish.I128(fc)
+		case 7:
+			if err := relish.CheckType(ft, relish.TypeTimestamp, "time.Time"); err != nil {
+				return relish.InField(err, id)
+			}
+			x88, err := relish.DecodeTimestamp(fc)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			v.At = x88
+		case 8:
+			if v.Parent == nil {
+				v.Parent = new(Order)
+			}
+			if err := (*v.Parent).UnmarshalRelish(ft, fc); err != nil {
+				return relish.InField(err, id)
+			}
+		case 9:
+			if err := v.Shape.UnmarshalRelish(ft, fc); err != nil {
+				return relish.InField(err, id)
+			}
+		case 10:
+			if err := relish.CheckType(ft, relish.TypeArray, "[]uint8"); err != nil {
+				return relish.InField(err, id)
+			}
+			et89, el90, err := relish.SplitArray(fc)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			if err := relish.CheckElemType(et89, relish.TypeU8, "uint8"); err != nil {
+				return relish.InField(err, id)
+			}
+			n91, err := relish.CountElems(et89, el90)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			v.Blob = make([]byte, n91)
+			copy(v.Blob, el90)
+		case 11:
+			if err := relish.CheckType(ft, relish.TypeArray, "[2][3]int8"); err != nil {
+				return relish.InField(err, id)
+			}
+			et92, el93, err := relish.SplitArray(fc)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			if err := relish.CheckElemType(et92, relish.TypeArray, "[3]int8"); err != nil {
+				return relish.InField(err, id)
+			}
+			n94, err := relish.CountElems(et92, el93)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			if n94 != 2 {
+				return relish.InField(&relish.Error{Kind: relish.ErrTypeMismatch, Detail: fmt.Sprintf("array has %d elements, [2][3]int8 holds 2", n94)}, id)
+			}
+			for i95 := 0; i95 < n94; i95++ {
+				var ec96 []byte
+				ec96, el93, _ = relish.SplitElem(et92, el93)
+				if err := relish.CheckType(et92, relish.TypeArray, "[3]int8"); err != nil {
+					return relish.InField(relish.InIndex(err, i95), id)
+				}
+				et97, el98, err := relish.SplitArray(ec96)
+				if err != nil {
+					return relish.InField(relish.InIndex(err, i95), id)
+				}
+				if err := relish.CheckElemType(et97, relish.TypeI8, "int8"); err != nil {
+					return relish.InField(relish.InIndex(err, i95), id)
+				}
+				n99, err := relish.CountElems(et97, el98)
+				if err != nil {
+					return relish.InField(relish.InIndex(err, i95), id)
+				}
+				if n99 != 3 {
+					return relish.InField(relish.InIndex(&relish.Error{Kind: relish.ErrTypeMismatch, Detail: fmt.Sprintf("array has %d elements, [3]int8 holds 3", n99)}, i95), id)
+				}
+				for i100 := 0; i100 < n99; i100++ {
+					var ec101 []byte
+					ec101, el98, _ = relish.SplitElem(et97, el98)
+					if err := relish.CheckType(et97, relish.TypeI8, "int8"); err != nil {
+						return relish.InField(relish.InIndex(relish.InIndex(err, i100), i95), id)
+					}
+					v.Grid[i95][i100] = int8(ec101[0])
+				}
+			}
+		case 12:
+			if err := relish.CheckType(ft, relish.TypeF32, "float32"); err != nil {
+				return relish.InField(err, id)
+			}
+			v.Ratio = relish.DecodeF32(fc)
+		case 13:
+			if err := relish.CheckType(ft, relish.TypeF64, "float64"); err != nil {
+				return relish.InField(err, id)
+			}
+			v.Scale = relish.DecodeF64(fc)
+		case 14:
+			if err := relish.CheckType(ft, relish.TypeArray, "[]bool"); err != nil {
+				return relish.InField(err, id)
+			}
+			et102, el103, err := relish.SplitArray(fc)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			if err := relish.CheckElemType(et102, relish.TypeBool, "bool"); err != nil {
+				return relish.InField(err, id)
+			}
+			n104, err := relish.CountElems(et102, el103)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			v.Flags = make([]bool, n104)
+			for i105 := 0; i105 < n104; i105++ {
+				var ec106 []byte
+				ec106, el103, _ = relish.SplitElem(et102, el103)
+				if err := relish.CheckType(et102, relish.TypeBool, "bool"); err != nil {
+					return relish.InField(relish.InIndex(err, i105), id)
+				}
+				x107, err := relish.DecodeBool(ec106)
+				if err != nil {
+					return relish.InField(relish.InIndex(err, i105), id)
+				}
+				v.Flags[i105] = x107
+			}
+		case 15:
+			if err := relish.CheckType(ft, relish.TypeNull, "relish.Null"); err != nil {
+				return relish.InField(err, id)
+			}
+		case 16:
+			if err := relish.CheckType(ft, relish.TypeMap, "map[int64]*gentest.Shape"); err != nil {
+				return relish.InField(err, id)
+			}
+			kt108, vt109, pr110, err := relish.SplitMap(fc)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			if err := relish.CheckElemType(kt108, relish.TypeI64, "int64"); err != nil {
+				return relish.InField(err, id)
+			}
+			if err := relish.CheckElemType(vt109, relish.TypeEnum, "*gentest.Shape"); err != nil {
+				return relish.InField(err, id)
+			}
+			out111 := make(map[int64]*Shape)
+			for i112 := 0; len(pr110) > 0; i112++ {
+				kc113, vc114, next115, err := relish.SplitEntry(kt108, vt109, pr110)
+				if err != nil {
+					return relish.InField(err, id)
+				}
+				var k116 int64
+				if err := relish.CheckType(kt108, relish.TypeI64, "int64"); err != nil {
+					return relish.InField(err, id)
+				}
+				k116 = int64(relish.DecodeU64(kc113))
+				if _, dup := out111[k116]; dup {
+					return relish.InField(relish.InKey(&relish.Error{Kind: relish.ErrDuplicateMapKey, Detail: "duplicate map key"}, kt108, kc113, i112), id)
+				}
+				var v117 *Shape
+				if v117 == nil {
+					v117 = new(Shape)
+				}
+				if err := (*v117).UnmarshalRelish(vt109, vc114); err != nil {
+					return relish.InField(relish.InKey(err, kt108, kc113, i112), id)
+				}
+				out111[k116] = v117
+				pr110 = next115
+			}
+			v.Shapes = out111
+		case 17:
+			if err := relish.CheckType(ft, relish.TypeArray, "[]string"); err != nil {
+				return relish.InField(err, id)
+			}
+			et118, el119, err := relish.SplitArray(fc)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			if err := relish.CheckElemType(et118, relish.TypeString, "string"); err != nil {
+				return relish.InField(err, id)
+			}
+			n120, err := relish.CountElems(et118, el119)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			v.Tags = make([]string, n120)
+			for i121 := 0; i121 < n120; i121++ {
+				var ec122 []byte
+				ec122, el119, _ = relish.SplitElem(et118, el119)
+				if err := relish.CheckType(et118, relish.TypeString, "string"); err != nil {
+					return relish.InField(relish.InIndex(err, i121), id)
+				}
+				x123, err := relish.DecodeString(ec122)
+				if err != nil {
+					return relish.InField(relish.InIndex(err, i121), id)
+				}
+				v.Tags[i121] = x123
+			}
+		case 18:
+			if err := relish.DecodeValue(&v.Any, ft, fc); err != nil {
+				return relish.InField(err, id)
+			}
+		case 19:
+			if err := relish.DecodeValue(&v.Inline, ft, fc); err != nil {
+				return relish.InField(err, id)
+			}
+		case 20:
+			if err := relish.CheckType(ft, relish.TypeMap, "map[uint8][]gentest.Line"); err != nil {
+				return relish.InField(err, id)
+			}
+			kt124, vt125, pr126, err := relish.SplitMap(fc)
+			if err != nil {
+				return relish.InField(err, id)
+			}
+			if err := relish.CheckElemType(kt124, relish.TypeU8, "uint8"); err != nil {
+				return relish.InField(err, id)
+			}
+			if err := relish.CheckElemType(vt125, relish.TypeArray, "[]gentest.Line"); err != nil {
+				return relish.InField(err, id)
+			}
+			out127 := make(map[uint8][]Line)
+			for i128 := 0; len(pr126) > 0; i128++ {
+				kc129, vc130, next131, err := relish.SplitEntry(kt124, vt125, pr126)
+				if err != nil {
+					return relish.InField(err, id)
+				}
+				var k132 uint8
+				if err := relish.CheckType(kt124, relish.TypeU8, "uint8"); err != nil {
+					return relish.InField(err, id)
+				}
+				k132 = kc129[0]
+				if _, dup := out127[k132]; dup {
+					return relish.InField(relish.InKey(&relish.Error{Kind: relish.ErrDuplicateMapKey, Detail: "duplicate map key"}, kt124, kc129, i128), id)
+				}
+				var v133 []Line
+				if err := relish.CheckType(vt125, relish.TypeArray, "[]gentest.Line"); err != nil {
+					return relish.InField(relish.InKey(err, kt124, kc129, i128), id)
+				}
+				et134, el135, err := relish.SplitArray(vc130)
+				if err != nil {
+					return relish.InField(relish.InKey(err, kt124, kc129, i128), id)
+				}
+				if err := relish.CheckElemType(et134, relish.TypeStruct, "gentest.Line"); err != nil {
+					return relish.InField(relish.InKey(err, kt124, kc129, i128), id)
+				}
+				n136, err := relish.CountElems(et134, el135)
+				if err != nil {
+					return relish.InField(relish.InKey(err, kt124, kc129, i128), id)
+				}
+				v133 = make([]Line, n136)
+				for i137 := 0; i137 < n136; i137++ {
+					var ec138 []byte
+					ec138, el135, _ = relish.SplitElem(et134, el135)
+					if err := v133[i137].UnmarshalRelish(et134, ec138); err != nil {
+						return relish.InField(relish.InKey(relish.InIndex(err, i137), kt124, kc129, i128), id)
+					}
+				}
+				out127[k132] = v133
+				pr126 = next131
+			}
+			v.Nested = out127
+		case 21:
+			if v.Ptr == nil {
+				v.Ptr = new(Line)
+			}
+			if err := (*v.Ptr).UnmarshalRelish(ft, fc); err != nil {
+				return relish.InField(err, id)
+			}
+		case 22:
+			if v.Count == nil {
+				v.Count = new(uint64)
+			}
+			if err := relish.CheckType(ft, relish.TypeU64, "uint64"); err != nil {
+				return relish.InField(err, id)
+			}
+			(*v.Count) = relish.DecodeU64(fc)
+		case 23:
+			if err := relish.CheckType(ft, relish.TypeI64, "int64"); err != nil {
+				return relish.InField(err, id)
+			}
+			v.Sum = int64(relish.DecodeU64(fc))
+		case 24:
+			if err := v.Opt.UnmarshalRelish(ft, fc); err != nil {
+				return relish.InField(err, id)
+			}
+		}
+	}
+	return nil
+}
+
+// MarshalRelish appends the Relish encoding of v to a.
+func (v *Shape) MarshalRelish(a *relish.Appender) error {
+	n := 0
+	if v.Circle != nil {
+		n++
+	}
+	if v.Square != nil {
+		n++
+	}
+	if v.Empty != nil {
+		n++
+	}
+	if n == 1 {
+		if err := a.Start(relish.TypeEnum); err != nil {
+			return err
+		}
+		m := a.Begin()
+		switch {
+		case v.Circle != nil:
+			a.Buf = append(a.Buf, 0)
+			a.Type(relish.TypeF64)
+			a.F64((*v.Circle))
+		case v.Square != nil:
+			a.Buf = append(a.Buf, 1)
+			if err := (*v.Square).MarshalRelish(a); err != nil {
+				return err
+			}
+		case v.Empty != nil:
+			a.Buf = append(a.Buf, 2)
+			a.Type(relish.TypeNull)
+		}
+		return a.End(m)
+	}
+	if err := a.Start(relish.TypeStruct); err != nil {
+		return err
+	}
+	m := a.Begin()
+	if v.Circle != nil {
+		a.Buf = append(a.Buf, 0)
+		var x139 float64
+		if v.Circle != nil {
+			x139 = *v.Circle
+		}
+		a.Type(relish.TypeF64)
+		a.F64(x139)
+	}
+	if v.Square != nil {
+		a.Buf = append(a.Buf, 1)
+		p140 := v.Square
+		if p140 == nil {
+			p140 = new(Line)
+		}
+		if err := (*p140).MarshalRelish(a); err != nil {
+			return err
+		}
+	}
+	if v.Empty != nil {
+		a.Buf = append(a.Buf, 2)
+		a.Type(relish.TypeNull)
+	}
+	return a.End(m)
+}
+
+// RelishSize returns the length of the Relish encoding of v.
+func (v *Shape) RelishSize() int {
+	n := 0
+	k := 0
+	if v.Circle != nil {
+		k++
+	}
+	if v.Square != nil {
+		k++
+	}
+	if v.Empty != nil {
+		k++
+	}
+	if k == 1 {
+		switch {
+		case v.Circle != nil:
+			n = 1
+			n += 9
+		case v.Square != nil:
+			n = 1
+			n += (*v.Square).RelishSize()
+		case v.Empty != nil:
+			n = 1
+			n += 1
+		}
+		return 1 + relish.LenSize(n) + n
+	}
+	if v.Circle != nil {
+		n++
+		n += 9
+	}
+	if v.Square != nil {
+		n++
+		p141 := v.Square
+		if p141 == nil {
+			p141 = new(Line)
+		}
+		n += (*p141).RelishSize()
+	}
+	if v.Empty != nil {
+		n++
+		n += 1
+	}
+	return 1 + relish.LenSize(n) + n
+}
+
+// UnmarshalRelish decodes the Relish value with type t and content c
+// into v.
+func (v *Shape) UnmarshalRelish(t relish.TypeID, c []byte) error {
+	if err := relish.CheckType(t, relish.TypeEnum, "gentest.Shape"); err != nil {
+		return err
+	}
+	if t == relish.TypeEnum {
+		id, vt, vc, err := relish.SplitVariant(c)
+		if err != nil {
+			return err
+		}
+		switch id {
+		case 0:
+			if v.Circle == nil {
+				v.Circle = new(float64)
+			}
+			if err := relish.CheckType(vt, relish.TypeF64, "float64"); err != nil {
+				return relish.InVariant(err, id)
+			}
+			(*v.Circle) = relish.DecodeF64(vc)
+		case 1:
+			if v.Square == nil {
+				v.Square = new(Line)
+			}
+			if err := (*v.Square).UnmarshalRelish(vt, vc); err != nil {
+				return relish.InVariant(err, id)
+			}
+		case 2:
+			if v.Empty == nil {
+				v.Empty = new(relish.Null)
+			}
+			if err := relish.CheckType(vt, relish.TypeNull, "relish.Null"); err != nil {
+				return relish.InVariant(err, id)
+			}
+		default:
+			return &relish.Error{Kind: relish.ErrTypeMismatch, Detail: "unknown enum variant"}
+		}
+		return nil
+	}
+	prev := -1
+	for p := c; len(p) > 0; {
+		id, ft, fc, rest, err := relish.NextField(p, prev)
+		if err != nil {
+			return err
+		}
+		p, prev = rest, int(id)
+		switch id {
+		case 0:
+			if v.Circle == nil {
+				v.Circle = new(float64)
+			}
+			if err := relish.CheckType(ft, relish.TypeF64, "float64"); err != nil {
+				return relish.InField(err, id)
+			}
+			(*v.Circle) = relish.DecodeF64(fc)
+		case 1:
+			if v.Square == nil {
+				v.Square = new(Line)
+			}
+			if err := (*v.Square).UnmarshalRelish(ft, fc); err != nil {
+				return relish.InField(err, id)
+			}
+		case 2:
+			if v.Empty == nil {
+				v.Empty = new(relish.Null)
+			}
+			if err := relish.CheckType(ft, relish.TypeNull, "relish.Null"); err != nil {
+				return relish.InField(err, id)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+// Package gentest holds types whose codecs are generated by relishgen, to
+// test the generated code against the reflection-based encoder.
+package gentest
+
+import (
+	"time"
+
+	"github.com/dadrian/relish"
+)
+
+//go:generate go run ../../cmd/relishgen
+
+// ID is a named integer type.
+type ID uint32
+
+// Labels is a named map type.
+type Labels map[string]ID
+
+// Order exercises every kind of field.
+type Order struct {
+	ID       ID                `relish:"0"`
+	Note     *string           `relish:"1,optional"`
+	Lines    []Line            `relish:"2"`
+	Counts   map[string]uint16 `relish:"3"`
+	Labels   Labels            `relish:"4,omitempty"`
+	Big      relish.U128       `relish:"5"`
+	Neg      relish.I128       `relish:"6"`
+	At       time.Time         `relish:"7"`
+	Parent   *Order            `relish:"8,optional"`
+	Shape    Shape             `relish:"9"`
+	Blob     []byte            `relish:"10"`
+	Grid     [2][3]int8        `relish:"11"`
+	Ratio    float32           `relish:"12"`
+	Scale    float64           `relish:"13,omitempty"`
+	Flags    []bool            `relish:"14"`
+	Nothing  relish.Null       `relish:"15"`
+	Shapes   map[int64]*Shape  `relish:"16"`
+	Tags     []string          `relish:"17,omitempty"`
+	Any      any               `relish:"18,omitempty"`
+	Inline   struct{ X int16 } `relish:"19"`
+	Nested   map[uint8][]Line  `relish:"20"`
+	Ptr      *Line             `relish:"21"`
+	Count    *uint64           `relish:"22"`
+	Sum      int64             `relish:"23,omitempty"`
+	Opt      Line              `relish:"24,optional"`
+	internal string
+}
+
+// Line is a struct used in arrays.
+type Line struct {
+	SKU string `relish:"0"`
+	Qty int32  `relish:"1"`
+}
+
+// Shape is an enum: all its fields are optional.
+type Shape struct {
+	Circle *float64     `relish:"0,optional"`
+	Square *Line        `relish:"1,optional"`
+	Empty  *relish.Null `relish:"2,optional"`
+}
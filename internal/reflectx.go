@@ -7,25 +7,55 @@ import (
 )
 
 // ParseRelishTag parses `relish:"<id>[,optional][,omitempty]"` into components.
-// Returns (id, optional, omitempty, ok).
+// Returns (id, optional, omitempty, ok). A field tagged
+// `relish:"<id>,reserved"` only retires the ID and is not encoded, so ok
+// is false for it; see ParseReservedTag.
 func ParseRelishTag(f reflect.StructField) (int, bool, bool, bool) {
-	tag := f.Tag.Get("relish")
-	if tag == "" || tag == "-" {
-		return 0, false, false, false
-	}
-	parts := strings.Split(tag, ",")
-	id64, err := strconv.ParseInt(parts[0], 10, 64)
-	if err != nil || id64 < 0 || id64 >= 0x80 {
+	id, opts, ok := splitRelishTag(f)
+	if !ok {
 		return 0, false, false, false
 	}
 	var optional, omitempty bool
-	for _, p := range parts[1:] {
+	for _, p := range opts {
 		switch strings.TrimSpace(p) {
 		case "optional":
 			optional = true
 		case "omitempty":
 			omitempty = true
+		case "reserved":
+			return 0, false, false, false
 		}
 	}
-	return int(id64), optional, omitempty, true
+	return id, optional, omitempty, true
+}
+
+// ParseReservedTag returns the ID of a field tagged
+// `relish:"<id>,reserved"`, which declares that the ID is retired and
+// must not be used again in its struct:
+//
+//	_ struct{} `relish:"3,reserved"`
+func ParseReservedTag(f reflect.StructField) (int, bool) {
+	id, opts, ok := splitRelishTag(f)
+	if !ok {
+		return 0, false
+	}
+	for _, p := range opts {
+		if strings.TrimSpace(p) == "reserved" {
+			return id, true
+		}
+	}
+	return 0, false
+}
+
+func splitRelishTag(f reflect.StructField) (int, []string, bool) {
+	tag := f.Tag.Get("relish")
+	if tag == "" || tag == "-" {
+		return 0, nil, false
+	}
+	parts := strings.Split(tag, ",")
+	id64, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil || id64 < 0 || id64 >= 0x80 {
+		return 0, nil, false
+	}
+	return int(id64), parts[1:], true
 }
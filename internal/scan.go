@@ -0,0 +1,81 @@
+package internal
+
+import "errors"
+
+// Slice-based helpers for walking encoded values in place, without
+// copying them out through an io.Reader.
+
+var (
+	// ErrShortBuffer reports that an encoding runs past the end of its input.
+	ErrShortBuffer = errors.New("unexpected end of data")
+	// ErrUnknownType reports a type ID with the top bit clear that SPEC.md
+	// does not define, so the size of its value cannot be determined.
+	ErrUnknownType = errors.New("unknown type id")
+)
+
+// IsKnownType reports whether t is one of the type IDs defined by SPEC.md.
+func IsKnownType(t byte) bool { return t <= 0x13 }
+
+// IsZeroSize reports whether values of type t have no content, as null's
+// do. Arrays and maps of such values cannot be walked element by element,
+// since an element takes no bytes.
+func IsZeroSize(t byte) bool {
+	n, ok := FixedSize(t)
+	return ok && n == 0
+}
+
+// SplitLen decodes the tagged-varint length at the start of b and returns
+// the length and the number of prefix bytes used.
+func SplitLen(b []byte) (int, int, error) {
+	if len(b) == 0 {
+		return 0, 0, ErrShortBuffer
+	}
+	if b[0]&0x01 != 0 && len(b) < 4 {
+		return 0, 0, ErrShortBuffer
+	}
+	n, used := DecodeLen(b)
+	if n < 0 {
+		return 0, 0, errors.New("invalid length")
+	}
+	return n, used, nil
+}
+
+// SplitElem measures a value of type t at the start of b in the layout used
+// for array elements and map keys/values: raw bytes for fixed-size types and
+// [len][content] for varsize types. It returns the size of the length
+// prefix (0 for fixed-size types) and of the content. The content is not
+// required to be present in b; callers check hdr+n against their bounds.
+func SplitElem(t byte, b []byte) (hdr int, n int, err error) {
+	if t&0x80 != 0 {
+		return 0, 0, errInvalidTypeID
+	}
+	if sz, ok := FixedSize(t); ok {
+		return 0, sz, nil
+	}
+	if !IsVarSize(t) {
+		return 0, 0, ErrUnknownType
+	}
+	n, used, err := SplitLen(b)
+	if err != nil {
+		return 0, 0, err
+	}
+	return used, n, nil
+}
+
+// SplitTLV measures the TLV at the start of b and returns its type ID, the
+// size of its header (type byte plus any length prefix) and the size of its
+// content. As with SplitElem, the content itself may extend past b.
+func SplitTLV(b []byte) (t byte, hdr int, n int, err error) {
+	if len(b) == 0 {
+		return 0, 0, 0, ErrShortBuffer
+	}
+	t = b[0]
+	h, n, err := SplitElem(t, b[1:])
+	if err != nil {
+		return t, 0, 0, err
+	}
+	return t, 1 + h, n, nil
+}
+
+// IsInvalidType reports whether err was caused by a type ID with its top bit set.
+func IsInvalidType(err error) bool { return errors.Is(err, errInvalidTypeID) }
@@ -0,0 +1,911 @@
+package relish
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// JSONUnknownKey is the JSON object key under which ToJSON keeps struct
+// fields and enum variants that the schema does not describe, so that
+// FromJSON can restore them. It maps field or variant IDs to the
+// base64-encoded TLV of the value, as in {"7": "DgRoaQ=="}.
+const JSONUnknownKey = "$unknown"
+
+// JSONTypeKey and JSONValueKey annotate a value whose type cannot be told
+// from its JSON alone when ToJSON has no schema, as in
+// {"$type": "u8", "$value": 7} or {"$type": "map<u32,string>", "$value":
+// [[1, "a"]]}. The type is written as in the text format.
+const (
+	JSONTypeKey  = "$type"
+	JSONValueKey = "$value"
+)
+
+// maxRFC3339 is the last second RFC 3339 can write, 9999-12-31T23:59:59Z.
+const maxRFC3339 = 253402300799
+
+// ToJSON converts a Relish encoding to JSON. The schema is a reflect.Type,
+// or a Go value whose type is used, describing the encoded value; struct
+// fields and enum variants then appear under the names of the
+// corresponding Go fields. With a nil schema their IDs are used as keys.
+// A Schema descriptor is not accepted; UnmarshalDynamic decodes by one.
+//
+// The mapping is lossless given the same schema:
+//
+//   - null, bools and strings map to their JSON counterparts;
+//   - u8 to u32, i8 to i32, f32 and f64 map to numbers, except that
+//     non-finite floats are the strings "NaN", "Infinity" and "-Infinity"
+//     (or "nan(0x...)" for a NaN other than the quiet NaN);
+//   - u64, i64, u128 and i128 map to decimal strings;
+//   - timestamps map to RFC 3339 strings in UTC, or to numbers of seconds
+//     after the year 9999;
+//   - arrays map to arrays, and maps with string keys to objects;
+//     maps with other keys map to arrays of [key, value] pairs;
+//   - structs map to objects, and enums to {"variant": value}.
+//
+// Fields and variants the schema does not describe, including those whose
+// encoded type differs from the Go field's, are kept under JSONUnknownKey.
+//
+// Without a schema the mapping is lossless too. Values whose type FromJSON
+// would not infer from their JSON, such as a u8, an enum or an array of
+// u64, are wrapped in an object under JSONTypeKey and JSONValueKey, and
+// their elements and entries are then written for that type.
+func ToJSON(data []byte, schema any) ([]byte, error) {
+	if err := firstError(Validate(data)); err != nil {
+		return nil, err
+	}
+	t, c, _, _ := splitValue(data)
+	rt, err := schemaType(schema)
+	if err != nil {
+		return nil, err
+	}
+	if rt != nil && !fitsType(t, c, rt) {
+		return nil, &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("%v does not match schema %v", TypeID(t), rt)}
+	}
+	var b bytes.Buffer
+	writeJSON(&b, t, c, rt, rt != nil, anyType)
+	return b.Bytes(), nil
+}
+
+// schemaType returns the Go type described by schema. A Schema describes
+// no Go type, and its names need not be Go field names, so it is rejected
+// rather than taken for the descriptor's own type.
+func schemaType(schema any) (reflect.Type, error) {
+	switch s := schema.(type) {
+	case nil:
+		return nil, nil
+	case reflect.Type:
+		return s, nil
+	case Schema:
+		return nil, &Error{Kind: ErrInvalidValue, Detail: fmt.Sprintf("JSON schema must be a Go type or value, not a relish.Schema (%v)", s)}
+	}
+	return reflect.TypeOf(schema), nil
+}
+
+// fitsType reports whether the value with type t and content c has the
+// shape FromJSON would produce for Go type rt, looking only at the value
+// itself and, for arrays and maps, its element types.
+func fitsType(t byte, c []byte, rt reflect.Type) bool {
+	want, err := typeIDOf(rt)
+	if err != nil {
+		return false
+	}
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	switch {
+	case TypeID(t) == TypeStruct && TypeID(want) == TypeEnum:
+		return true
+	case t != want:
+		return false
+	case TypeID(t) == TypeArray:
+		et, err := typeIDOf(rt.Elem())
+		return err == nil && et == c[0]
+	case TypeID(t) == TypeMap:
+		kt, err1 := typeIDOf(rt.Key())
+		vt, err2 := typeIDOf(rt.Elem())
+		return err1 == nil && err2 == nil && kt == c[0] && vt == c[1]
+	}
+	return true
+}
+
+// writeJSON writes the value with type t and content c. If schema is set,
+// rt describes the value; otherwise IDs are used as keys, and want is the
+// type FromJSON will expect for the value, or anyType if it will infer
+// one.
+func writeJSON(b *bytes.Buffer, t byte, c []byte, rt reflect.Type, schema bool, want byte) {
+	for rt != nil && rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	typed := false
+	if !schema && !plainJSON(t, c, want) {
+		b.WriteString(`{"` + JSONTypeKey + `":`)
+		writeJSONString(b, jsonTypeName(t, c))
+		b.WriteString(`,"` + JSONValueKey + `":`)
+		defer b.WriteByte('}')
+		typed = true
+	}
+	elemWant := func(i int, et byte) byte {
+		if typed {
+			return et
+		}
+		return firstAny(i, et)
+	}
+	le := binary.LittleEndian
+	switch TypeID(t) {
+	case TypeNull:
+		b.WriteString("null")
+	case TypeBool:
+		b.WriteString(strconv.FormatBool(c[0] == 0xFF))
+	case TypeU8, TypeU16, TypeU32, TypeI8, TypeI16, TypeI32:
+		lit, _ := keyLiteral(t, c)
+		b.WriteString(lit)
+	case TypeU64, TypeI64:
+		lit, _ := keyLiteral(t, c)
+		writeJSONString(b, lit)
+	case TypeU128, TypeI128:
+		writeJSONString(b, int128(c, TypeID(t) == TypeI128).String())
+	case TypeF32:
+		bits := le.Uint32(c)
+		writeJSONFloat(b, float64(math.Float32frombits(bits)), uint64(bits), 32, 0x7FC00000)
+	case TypeF64:
+		bits := le.Uint64(c)
+		writeJSONFloat(b, math.Float64frombits(bits), bits, 64, 0x7FF8000000000000)
+	case TypeTimestamp:
+		if sec := le.Uint64(c); sec > maxRFC3339 {
+			b.WriteString(strconv.FormatUint(sec, 10))
+		} else {
+			writeJSONString(b, time.Unix(int64(sec), 0).UTC().Format(time.RFC3339))
+		}
+	case TypeString:
+		writeJSONString(b, string(c))
+	case TypeArray:
+		var ert reflect.Type
+		if rt != nil {
+			ert = rt.Elem()
+		}
+		b.WriteByte('[')
+		for i, ec := range splitElems(c[0], c[1:]) {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			writeJSON(b, c[0], ec, ert, schema, elemWant(i, c[0]))
+		}
+		b.WriteByte(']')
+	case TypeMap:
+		kt, vt := c[0], c[1]
+		var krt, vrt reflect.Type
+		if rt != nil {
+			krt, vrt = rt.Key(), rt.Elem()
+		}
+		open, sep, close := "[", ",", "]"
+		if TypeID(kt) == TypeString {
+			open, sep, close = "{", ":", "}"
+		}
+		b.WriteString(open)
+		for i, p := 0, c[2:]; len(p) > 0; i++ {
+			kc, vc, next, _ := splitEntry(kt, vt, p)
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			if open == "[" {
+				b.WriteByte('[')
+			}
+			writeJSON(b, kt, kc, krt, schema, kt)
+			b.WriteString(sep)
+			writeJSON(b, vt, vc, vrt, schema, elemWant(i, vt))
+			if open == "[" {
+				b.WriteByte(']')
+			}
+			p = next
+		}
+		b.WriteString(close)
+	case TypeStruct, TypeEnum:
+		fields := c
+		if TypeID(t) == TypeEnum {
+			_, _, rest, _ := splitValue(c[1:])
+			fields = c[:len(c)-len(rest)]
+		}
+		var unknown []byte
+		n := 0
+		b.WriteByte('{')
+		for p := fields; len(p) > 0; {
+			ft, fc, next, _ := splitValue(p[1:])
+			name, frt := fieldByID(rt, p[0])
+			switch {
+			case !schema:
+				name = strconv.Itoa(int(p[0]))
+			case name == "" || !fitsType(ft, fc, frt):
+				unknown = append(unknown, p[:len(p)-len(next)]...)
+				p = next
+				continue
+			}
+			if n > 0 {
+				b.WriteByte(',')
+			}
+			n++
+			writeJSONString(b, name)
+			b.WriteByte(':')
+			writeJSON(b, ft, fc, frt, schema, anyType)
+			p = next
+		}
+		if len(unknown) > 0 {
+			if n > 0 {
+				b.WriteByte(',')
+			}
+			writeJSONString(b, JSONUnknownKey)
+			b.WriteString(":{")
+			for p := unknown; len(p) > 0; {
+				_, _, next, _ := splitValue(p[1:])
+				if len(p) < len(unknown) {
+					b.WriteByte(',')
+				}
+				writeJSONString(b, strconv.Itoa(int(p[0])))
+				b.WriteByte(':')
+				writeJSONString(b, base64.StdEncoding.EncodeToString(p[1:len(p)-len(next)]))
+				p = next
+			}
+			b.WriteByte('}')
+		}
+		b.WriteByte('}')
+	}
+}
+
+// plainJSON reports whether FromJSON reads the value with type t and
+// content c back from its JSON without a JSONTypeKey annotation, when it
+// expects a value of type want or, if want is anyType, infers the type.
+func plainJSON(t byte, c []byte, want byte) bool {
+	switch TypeID(t) {
+	case TypeNull, TypeBool, TypeString, TypeStruct:
+		return true
+	case TypeArray:
+		elems := splitElems(c[0], c[1:])
+		if len(elems) == 0 {
+			return TypeID(c[0]) == TypeNull
+		}
+		for i, ec := range elems {
+			if !plainJSON(c[0], ec, firstAny(i, c[0])) {
+				return false
+			}
+		}
+		return true
+	case TypeMap:
+		if want != t || TypeID(c[0]) != TypeString {
+			return false
+		}
+		if len(c) == 2 {
+			return TypeID(c[1]) == TypeNull
+		}
+		for i, p := 0, c[2:]; len(p) > 0; i++ {
+			_, vc, next, _ := splitEntry(c[0], c[1], p)
+			if !plainJSON(c[1], vc, firstAny(i, c[1])) {
+				return false
+			}
+			p = next
+		}
+		return true
+	}
+	if want == t {
+		return true
+	}
+	switch TypeID(t) {
+	case TypeU32, TypeI32, TypeF64:
+		var lit bytes.Buffer
+		writeJSON(&lit, t, c, nil, false, t)
+		it, ic, ok := inferNumber(lit.String())
+		return ok && it == t && bytes.Equal(ic, c)
+	}
+	return false
+}
+
+// firstAny returns anyType for element 0 and et for the others, the types
+// FromJSON expects for the elements of an untyped array or map.
+func firstAny(i int, et byte) byte {
+	if i == 0 {
+		return anyType
+	}
+	return et
+}
+
+// inferNumber returns the type and content FromJSON infers for a JSON
+// number: u32, i32 if negative, and otherwise f64.
+func inferNumber(lit string) (byte, []byte, bool) {
+	for _, t := range []TypeID{TypeU32, TypeI32, TypeF64} {
+		if c, ok := scalarContent(byte(t), lit); ok {
+			return byte(t), c, true
+		}
+	}
+	return 0, nil, false
+}
+
+// jsonTypeName returns the JSONTypeKey name of the type of the value with
+// type t and content c.
+func jsonTypeName(t byte, c []byte) string {
+	switch TypeID(t) {
+	case TypeArray:
+		return "array<" + TypeID(c[0]).String() + ">"
+	case TypeMap:
+		return "map<" + TypeID(c[0]).String() + "," + TypeID(c[1]).String() + ">"
+	}
+	return TypeID(t).String()
+}
+
+// parseJSONType parses a JSONTypeKey name, returning the type and, for
+// arrays and maps, the element or key and value types.
+func parseJSONType(s string) (byte, []byte, bool) {
+	name, args, generic := strings.Cut(s, "<")
+	t, ok := typeByName[name]
+	if !ok {
+		return 0, nil, false
+	}
+	n := 0
+	switch TypeID(t) {
+	case TypeArray:
+		n = 1
+	case TypeMap:
+		n = 2
+	}
+	if !generic || !strings.HasSuffix(args, ">") {
+		return t, nil, !generic && n == 0
+	}
+	var params []byte
+	for _, a := range strings.Split(strings.TrimSuffix(args, ">"), ",") {
+		p, ok := typeByName[a]
+		if !ok {
+			return 0, nil, false
+		}
+		params = append(params, p)
+	}
+	return t, params, len(params) == n
+}
+
+func writeJSONString(b *bytes.Buffer, s string) {
+	enc := json.NewEncoder(b)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	b.Truncate(b.Len() - 1) // Encode appends a newline
+}
+
+func writeJSONFloat(b *bytes.Buffer, f float64, bits uint64, size int, quietNaN uint64) {
+	switch {
+	case math.IsInf(f, 1):
+		b.WriteString(`"Infinity"`)
+	case math.IsInf(f, -1):
+		b.WriteString(`"-Infinity"`)
+	case f != f && bits == quietNaN:
+		b.WriteString(`"NaN"`)
+	case f != f:
+		fmt.Fprintf(b, `"nan(%#x)"`, bits)
+	default:
+		b.WriteString(strconv.FormatFloat(f, 'g', -1, size))
+	}
+}
+
+// FromJSON converts JSON produced by ToJSON, or written by hand in the
+// same form, back to a Relish encoding. With the schema given to ToJSON
+// the original bytes are restored exactly, provided struct fields were
+// in ID order. Object keys may be Go field names or field IDs, and
+// numbers may also be given as strings.
+//
+// Without a schema, values annotated with JSONTypeKey take that type, and
+// the types of others are inferred from the JSON: objects become structs
+// keyed by field ID, arrays take the type of their first element (null
+// for an empty array), strings become strings, integers become u32 or, if
+// negative, i32, and other numbers become f64. Output of ToJSON without a
+// schema therefore round-trips exactly as well.
+func FromJSON(data []byte, schema any) ([]byte, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	r := &jsonReader{dec: dec}
+	rt, err := schemaType(schema)
+	if err != nil {
+		return nil, err
+	}
+	t, c, err := r.value(rt)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		return nil, r.errorf(ErrSyntax, "data after JSON value")
+	}
+	return appendValue(nil, t, c), nil
+}
+
+type jsonReader struct {
+	dec *json.Decoder
+}
+
+func (r *jsonReader) errorf(kind ErrorKind, format string, args ...any) error {
+	return &Error{Offset: r.dec.InputOffset(), Kind: kind, Detail: fmt.Sprintf(format, args...)}
+}
+
+func (r *jsonReader) token() (json.Token, error) {
+	tok, err := r.dec.Token()
+	if err != nil {
+		var se *json.SyntaxError
+		if errors.As(err, &se) {
+			return nil, &Error{Offset: se.Offset, Kind: ErrSyntax, Detail: se.Error()}
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, &Error{Offset: r.dec.InputOffset(), Kind: ErrSyntax, Detail: err.Error()}
+	}
+	return tok, nil
+}
+
+// value reads the next JSON value as a value of Go type rt, or without a
+// schema if rt is nil.
+func (r *jsonReader) value(rt reflect.Type) (byte, []byte, error) {
+	for rt != nil && rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	if rt == nil {
+		return r.dynamic(anyType)
+	}
+	want, err := typeIDOf(rt)
+	if err != nil {
+		return 0, nil, err
+	}
+	tok, err := r.token()
+	if err != nil {
+		return 0, nil, err
+	}
+	switch TypeID(want) {
+	case TypeArray:
+		if tok != json.Delim('[') {
+			return 0, nil, r.mismatch(tok, want)
+		}
+		return r.array(want, rt)
+	case TypeMap:
+		return r.mapValue(tok, nil, 0, 0, rt)
+	case TypeStruct, TypeEnum:
+		if tok != json.Delim('{') {
+			return 0, nil, r.mismatch(tok, want)
+		}
+		return r.object(rt, isEnumType(rt), nil)
+	}
+	return r.scalar(tok, want)
+}
+
+func (r *jsonReader) mismatch(tok json.Token, want byte) error {
+	return r.errorf(ErrTypeMismatch, "cannot use JSON %s as %v", jsonKind(tok), TypeID(want))
+}
+
+// scalar converts tok, a JSON value other than an array or object, to a
+// value of type want.
+func (r *jsonReader) scalar(tok json.Token, want byte) (byte, []byte, error) {
+	mismatch := func() (byte, []byte, error) {
+		return 0, nil, r.mismatch(tok, want)
+	}
+	switch TypeID(want) {
+	case TypeArray, TypeMap, TypeStruct, TypeEnum:
+		return mismatch()
+	case TypeNull:
+		if tok != nil {
+			return mismatch()
+		}
+		return want, nil, nil
+	case TypeBool:
+		v, ok := tok.(bool)
+		if !ok {
+			return mismatch()
+		}
+		c, _ := scalarContent(want, strconv.FormatBool(v))
+		return want, c, nil
+	case TypeString:
+		s, ok := tok.(string)
+		if !ok {
+			return mismatch()
+		}
+		return want, []byte(s), nil
+	case TypeTimestamp:
+		s, ok := tok.(string)
+		if !ok {
+			break
+		}
+		tm, err := time.Parse(time.RFC3339, s)
+		if err != nil || tm.Unix() < 0 {
+			return 0, nil, r.errorf(ErrInvalidValue, "invalid timestamp %q", s)
+		}
+		return want, binary.LittleEndian.AppendUint64(nil, uint64(tm.Unix())), nil
+	}
+	// Numbers, which may also be written as strings.
+	var lit string
+	switch v := tok.(type) {
+	case json.Number:
+		lit = string(v)
+	case string:
+		lit = v
+		switch v {
+		case "NaN":
+			lit = "nan"
+		case "Infinity":
+			lit = "inf"
+		case "-Infinity":
+			lit = "-inf"
+		}
+	default:
+		return mismatch()
+	}
+	c, ok := scalarContent(want, lit)
+	if !ok {
+		return 0, nil, r.errorf(ErrInvalidValue, "invalid %v value %q", TypeID(want), lit)
+	}
+	return want, c, nil
+}
+
+func jsonKind(tok json.Token) string {
+	switch tok.(type) {
+	case nil:
+		return "null"
+	case bool:
+		return "bool"
+	case json.Number:
+		return "number"
+	case string:
+		return "string"
+	case json.Delim:
+		if tok == json.Delim('[') {
+			return "array"
+		}
+		return "object"
+	}
+	return fmt.Sprint(tok)
+}
+
+// array reads the elements of a JSON array whose '[' has been read, as
+// an array of Go type rt or, without a schema, of element type et. If et
+// is anyType the first element sets it.
+func (r *jsonReader) array(et byte, rt reflect.Type) (byte, []byte, error) {
+	var ert reflect.Type
+	if rt != nil {
+		et, _ = typeIDOf(rt.Elem())
+		ert = rt.Elem()
+	}
+	var out []byte
+	for i := 0; r.dec.More(); i++ {
+		var t byte
+		var c []byte
+		var err error
+		if rt != nil {
+			t, c, err = r.value(ert)
+		} else {
+			t, c, err = r.dynamic(et)
+		}
+		if err != nil {
+			return 0, nil, prefixPath(err, pathIndex("", i))
+		}
+		if et == anyType {
+			et = t
+		}
+		if t != et {
+			return 0, nil, prefixPath(r.errorf(ErrTypeMismatch, "array element is %v, not %v", TypeID(t), TypeID(et)), pathIndex("", i))
+		}
+		out = appendElem(out, et, c)
+	}
+	if et == anyType {
+		et = byte(TypeNull)
+	}
+	if _, err := r.token(); err != nil {
+		return 0, nil, err
+	}
+	return byte(TypeArray), append([]byte{et}, out...), nil
+}
+
+// mapValue reads a map of Go type rt or, without a schema, with key type
+// kt and value type vt: an object if its keys are strings, and otherwise
+// an array of [key, value] pairs. tok is the opening token, and key the
+// object's first key if it has been read. If vt is anyType the first
+// value sets it.
+func (r *jsonReader) mapValue(tok, key json.Token, kt, vt byte, rt reflect.Type) (byte, []byte, error) {
+	if rt != nil {
+		kt, _ = typeIDOf(rt.Key())
+		vt, _ = typeIDOf(rt.Elem())
+	}
+	var entries []byte
+	seen := make(map[string]bool)
+	add := func(kc, vc []byte) error {
+		if seen[string(kc)] {
+			return r.errorf(ErrDuplicateMapKey, "duplicate map key")
+		}
+		seen[string(kc)] = true
+		entries = appendElem(appendElem(entries, kt, kc), vt, vc)
+		return nil
+	}
+	elem := func(rt reflect.Type, want byte) (byte, []byte, error) {
+		if rt != nil {
+			return r.value(rt)
+		}
+		return r.dynamic(want)
+	}
+	value := func() ([]byte, error) {
+		var vrt reflect.Type
+		if rt != nil {
+			vrt = rt.Elem()
+		}
+		t, c, err := elem(vrt, vt)
+		if err == nil && vt == anyType {
+			vt = t
+		}
+		if err == nil && t != vt {
+			err = r.errorf(ErrTypeMismatch, "map value is %v, not %v", TypeID(t), TypeID(vt))
+		}
+		return c, err
+	}
+	if TypeID(kt) == TypeString {
+		if tok != json.Delim('{') {
+			return 0, nil, r.errorf(ErrTypeMismatch, "cannot use JSON %s as map with string keys", jsonKind(tok))
+		}
+		for key != nil || r.dec.More() {
+			if key == nil {
+				var err error
+				if key, err = r.token(); err != nil {
+					return 0, nil, err
+				}
+			}
+			kc := []byte(key.(string))
+			key = nil
+			vc, err := value()
+			if err != nil {
+				return 0, nil, prefixPath(err, "{"+strconv.Quote(string(kc))+"}")
+			}
+			if err := add(kc, vc); err != nil {
+				return 0, nil, err
+			}
+		}
+	} else {
+		if tok != json.Delim('[') {
+			return 0, nil, r.errorf(ErrTypeMismatch, "cannot use JSON %s as map; want [key, value] pairs", jsonKind(tok))
+		}
+		for i := 0; r.dec.More(); i++ {
+			if tok, err := r.token(); err != nil || tok != json.Delim('[') {
+				return 0, nil, r.errorf(ErrTypeMismatch, "map entry %d is not a [key, value] pair", i)
+			}
+			var krt reflect.Type
+			if rt != nil {
+				krt = rt.Key()
+			}
+			t, kc, err := elem(krt, kt)
+			if err == nil && t != kt {
+				err = r.errorf(ErrTypeMismatch, "map key is %v, not %v", TypeID(t), TypeID(kt))
+			}
+			if err != nil {
+				return 0, nil, prefixPath(err, "{#"+strconv.Itoa(i)+"}")
+			}
+			vc, err := value()
+			if err != nil {
+				return 0, nil, prefixPath(err, pathKey("", kt, kc, i))
+			}
+			if tok, err := r.token(); err != nil || tok != json.Delim(']') {
+				return 0, nil, r.errorf(ErrTypeMismatch, "map entry %d is not a [key, value] pair", i)
+			}
+			if err := add(kc, vc); err != nil {
+				return 0, nil, err
+			}
+		}
+	}
+	if _, err := r.token(); err != nil {
+		return 0, nil, err
+	}
+	if vt == anyType {
+		vt = byte(TypeNull)
+	}
+	return byte(TypeMap), append([]byte{kt, vt}, entries...), nil
+}
+
+// object reads a JSON object, whose '{' and, if key is not nil, first key
+// have been read, as a struct of Go type rt, or as an enum if enum is set
+// and the object has one entry.
+func (r *jsonReader) object(rt reflect.Type, enum bool, key json.Token) (byte, []byte, error) {
+	type field struct {
+		id  byte
+		tlv []byte
+	}
+	var fields []field
+	seen := make(map[byte]bool)
+	add := func(id byte, tlv []byte) error {
+		if seen[id] {
+			return r.errorf(ErrSyntax, "duplicate field %d", id)
+		}
+		seen[id] = true
+		fields = append(fields, field{id, tlv})
+		return nil
+	}
+	for key != nil || r.dec.More() {
+		if key == nil {
+			var err error
+			if key, err = r.token(); err != nil {
+				return 0, nil, err
+			}
+		}
+		name := key.(string)
+		key = nil
+		if name == JSONUnknownKey {
+			if err := r.unknown(add); err != nil {
+				return 0, nil, err
+			}
+			continue
+		}
+		var id byte
+		var ft reflect.Type
+		if n, err := strconv.ParseUint(name, 10, 8); err == nil && n < 0x80 {
+			id = byte(n)
+			_, ft = fieldByID(rt, id)
+		} else {
+			var ok bool
+			if id, ft, ok = fieldByName(rt, name); !ok {
+				return 0, nil, r.errorf(ErrPathNotFound, "no field named %q", name)
+			}
+		}
+		if rt != nil && ft == nil {
+			return 0, nil, r.errorf(ErrPathNotFound, "no field with id %d", id)
+		}
+		t, c, err := r.value(ft)
+		if err != nil {
+			return 0, nil, prefixPath(err, pathField("", id))
+		}
+		if err := add(id, appendValue(nil, t, c)); err != nil {
+			return 0, nil, err
+		}
+	}
+	if _, err := r.token(); err != nil {
+		return 0, nil, err
+	}
+	if enum && len(fields) == 1 {
+		return byte(TypeEnum), append([]byte{fields[0].id}, fields[0].tlv...), nil
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].id < fields[j].id })
+	var out []byte
+	for _, f := range fields {
+		out = append(append(out, f.id), f.tlv...)
+	}
+	return byte(TypeStruct), out, nil
+}
+
+// unknown reads the object under JSONUnknownKey and passes each field to
+// add.
+func (r *jsonReader) unknown(add func(byte, []byte) error) error {
+	if tok, err := r.token(); err != nil || tok != json.Delim('{') {
+		return r.errorf(ErrTypeMismatch, "%s must be an object", JSONUnknownKey)
+	}
+	for r.dec.More() {
+		tok, err := r.token()
+		if err != nil {
+			return err
+		}
+		n, err := strconv.ParseUint(tok.(string), 10, 8)
+		if err != nil || n >= 0x80 {
+			return r.errorf(ErrInvalidFieldID, "invalid field id %q", tok)
+		}
+		tok, err = r.token()
+		if err != nil {
+			return err
+		}
+		s, _ := tok.(string)
+		tlv, err := base64.StdEncoding.DecodeString(s)
+		if err != nil {
+			return r.errorf(ErrInvalidValue, "field %d: invalid base64", n)
+		}
+		if err := firstError(Validate(tlv)); err != nil {
+			return prefixPath(err, pathField("", byte(n)))
+		}
+		if err := add(byte(n), tlv); err != nil {
+			return err
+		}
+	}
+	_, err := r.token()
+	return err
+}
+
+// dynamic reads the next JSON value without a schema. want is the type
+// the enclosing value implies for it, or anyType if it has to be inferred.
+func (r *jsonReader) dynamic(want byte) (byte, []byte, error) {
+	tok, err := r.token()
+	if err != nil {
+		return 0, nil, err
+	}
+	switch {
+	case tok == json.Delim('{'):
+		return r.dynamicObject(want)
+	case tok == json.Delim('['):
+		if want != anyType && TypeID(want) != TypeArray {
+			return 0, nil, r.mismatch(tok, want)
+		}
+		return r.array(anyType, nil)
+	case want != anyType:
+		return r.scalar(tok, want)
+	}
+	switch v := tok.(type) {
+	case nil:
+		return byte(TypeNull), nil, nil
+	case bool:
+		c, _ := scalarContent(byte(TypeBool), strconv.FormatBool(v))
+		return byte(TypeBool), c, nil
+	case string:
+		return byte(TypeString), []byte(v), nil
+	case json.Number:
+		if t, c, ok := inferNumber(string(v)); ok {
+			return t, c, nil
+		}
+		return 0, nil, r.errorf(ErrInvalidValue, "number %s out of range", v)
+	}
+	return 0, nil, r.errorf(ErrSyntax, "unexpected %v", tok)
+}
+
+// dynamicObject reads a JSON object, whose '{' has been read, without a
+// schema: a JSONTypeKey annotation, a map with string keys if want is a
+// map, and otherwise a struct or enum.
+func (r *jsonReader) dynamicObject(want byte) (byte, []byte, error) {
+	var key json.Token
+	if r.dec.More() {
+		var err error
+		if key, err = r.token(); err != nil {
+			return 0, nil, err
+		}
+		if key == JSONTypeKey {
+			return r.typed()
+		}
+	}
+	switch TypeID(want) {
+	case TypeMap:
+		return r.mapValue(json.Delim('{'), key, byte(TypeString), anyType, nil)
+	case TypeStruct, TypeEnum, anyType:
+		return r.object(nil, TypeID(want) == TypeEnum, key)
+	}
+	return 0, nil, r.mismatch(json.Delim('{'), want)
+}
+
+// typed reads the rest of a JSON object whose '{' and first key,
+// JSONTypeKey, have been read.
+func (r *jsonReader) typed() (byte, []byte, error) {
+	tok, err := r.token()
+	if err != nil {
+		return 0, nil, err
+	}
+	name, _ := tok.(string)
+	t, params, ok := parseJSONType(name)
+	if !ok {
+		return 0, nil, r.errorf(ErrInvalidValue, "invalid %s %q", JSONTypeKey, name)
+	}
+	if tok, err := r.token(); err != nil || tok != JSONValueKey {
+		return 0, nil, r.errorf(ErrSyntax, "%s must be followed by %s", JSONTypeKey, JSONValueKey)
+	}
+	var c []byte
+	switch TypeID(t) {
+	case TypeArray:
+		if tok, err = r.token(); err == nil && tok != json.Delim('[') {
+			err = r.mismatch(tok, t)
+		}
+		if err == nil {
+			_, c, err = r.array(params[0], nil)
+		}
+	case TypeMap:
+		if tok, err = r.token(); err == nil {
+			_, c, err = r.mapValue(tok, nil, params[0], params[1], nil)
+		}
+	default:
+		var got byte
+		got, c, err = r.dynamic(t)
+		if err == nil && got != t {
+			err = r.errorf(ErrTypeMismatch, "%s value is %v, not %v", JSONValueKey, TypeID(got), TypeID(t))
+		}
+	}
+	if err != nil {
+		return 0, nil, err
+	}
+	if tok, err := r.token(); err != nil || tok != json.Delim('}') {
+		return 0, nil, r.errorf(ErrSyntax, "unexpected key after %s", JSONValueKey)
+	}
+	return t, c, nil
+}
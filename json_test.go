@@ -0,0 +1,223 @@
+package relish
+
+import (
+	"bytes"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type jsonShape struct {
+	Circle *float32 `relish:"0,optional"`
+	Label  *string  `relish:"1,optional"`
+}
+
+type jsonMsg struct {
+	ID     uint32            `relish:"0"`
+	Big    uint64            `relish:"1"`
+	Huge   U128              `relish:"2"`
+	Neg    I128              `relish:"3"`
+	At     time.Time         `relish:"4"`
+	Shape  jsonShape         `relish:"5"`
+	Tags   map[string]int8   `relish:"6"`
+	ByCode map[uint16]string `relish:"7"`
+	Vals   []float64         `relish:"8"`
+	Note   *string           `relish:"9,optional"`
+}
+
+func TestJSON_Schema(t *testing.T) {
+	v := jsonMsg{
+		ID: 7, Big: math.MaxUint64, Huge: U128{15: 0x80}, Neg: I128{0: 0xFF, 1: 0xFF, 2: 0xFF, 3: 0xFF, 4: 0xFF, 5: 0xFF, 6: 0xFF, 7: 0xFF, 8: 0xFF, 9: 0xFF, 10: 0xFF, 11: 0xFF, 12: 0xFF, 13: 0xFF, 14: 0xFF, 15: 0xFF},
+		At: time.Unix(1700000000, 0).UTC(), Shape: jsonShape{Label: ptr("sq")},
+		Tags: map[string]int8{"a": -1}, ByCode: map[uint16]string{404: "nf"},
+		Vals: []float64{1.5, math.Inf(1), math.Float64frombits(0x7FF8000000000000), math.NaN()},
+	}
+	data, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := ToJSON(data, reflect.TypeOf(v))
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"ID":7,"Big":"18446744073709551615","Huge":"170141183460469231731687303715884105728","Neg":"-1",` +
+		`"At":"2023-11-14T22:13:20Z","Shape":{"Label":"sq"},"Tags":{"a":-1},"ByCode":[[404,"nf"]],` +
+		`"Vals":[1.5,"Infinity","NaN","nan(0x7ff8000000000001)"]}`
+	if string(js) != want {
+		t.Fatalf("ToJSON =\n%s\nwant\n%s", js, want)
+	}
+	back, err := FromJSON(js, v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(back, data) {
+		t.Fatalf("FromJSON =\n% x\nwant\n% x", back, data)
+	}
+}
+
+func TestJSON_UnknownFields(t *testing.T) {
+	type Old struct {
+		ID uint32 `relish:"0"`
+	}
+	type New struct {
+		ID    uint32 `relish:"0"`
+		Name  string `relish:"1"`
+		Flags []bool `relish:"3"`
+	}
+	data, _ := Marshal(New{ID: 1, Name: "x", Flags: []bool{true}})
+	js, err := ToJSON(data, Old{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"ID":1,"$unknown":{"1":"DgJ4","3":"DwQB/w=="}}`; string(js) != want {
+		t.Fatalf("ToJSON = %s, want %s", js, want)
+	}
+	back, err := FromJSON(js, Old{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(back, data) {
+		t.Fatalf("FromJSON = % x, want % x", back, data)
+	}
+}
+
+func TestJSON_SchemaLess(t *testing.T) {
+	type Inner struct {
+		S string `relish:"0"`
+	}
+	type Msg struct {
+		A uint32  `relish:"0"`
+		B int32   `relish:"2"`
+		C float64 `relish:"3"`
+		D []Inner `relish:"4"`
+		E bool    `relish:"5"`
+	}
+	data, _ := Marshal(Msg{A: 1, B: -2, C: 0.5, D: []Inner{{"x"}}, E: true})
+	js, err := ToJSON(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := `{"0":1,"2":-2,"3":0.5,"4":[{"0":"x"}],"5":true}`; string(js) != want {
+		t.Fatalf("ToJSON = %s, want %s", js, want)
+	}
+	back, err := FromJSON(js, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(back, data) {
+		t.Fatalf("FromJSON = % x, want % x", back, data)
+	}
+}
+
+func TestFromJSON_Errors(t *testing.T) {
+	for _, c := range []struct {
+		js   string
+		kind ErrorKind
+		path string
+	}{
+		{`{"ID": "x"}`, ErrInvalidValue, ".0"},
+		{`{"ID": 1,}`, ErrSyntax, ""},
+		{`{"Nope": 1}`, ErrPathNotFound, ""},
+		{`{"Vals": [1, true]}`, ErrTypeMismatch, ".8[1]"},
+		{`{"Tags": {"a": 1, "a": 2}}`, ErrDuplicateMapKey, ".6"},
+		{`{"ByCode": {"1": "x"}}`, ErrTypeMismatch, ".7"},
+		{`{"ID": 1} 2`, ErrSyntax, ""},
+	} {
+		_, err := FromJSON([]byte(c.js), jsonMsg{})
+		e, ok := err.(*Error)
+		if !ok || e.Kind != c.kind || e.Path != c.path {
+			t.Fatalf("FromJSON(%s) error = %v, want %v at %q", c.js, err, c.kind, c.path)
+		}
+	}
+}
+
+func TestJSON_SchemaLessTyped(t *testing.T) {
+	type Msg struct {
+		Small  uint8             `relish:"0"`
+		Shape  jsonShape         `relish:"1"`
+		At     time.Time         `relish:"2"`
+		Late   time.Time         `relish:"3"`
+		ByCode map[uint16]string `relish:"4"`
+		Tags   map[string]int8   `relish:"5"`
+		Names  map[string]string `relish:"6"`
+		Empty  []uint16          `relish:"7"`
+		Ints   []int32           `relish:"8"`
+		Floats []float64         `relish:"9"`
+		Nested [][]uint64        `relish:"10"`
+	}
+	data, err := Marshal(Msg{
+		Small: 7, Shape: jsonShape{Label: ptr("sq")},
+		At: time.Unix(1700000000, 0), Late: time.Unix(maxRFC3339+1, 0),
+		ByCode: map[uint16]string{404: "nf"}, Tags: map[string]int8{"a": -1},
+		Names: map[string]string{"k": "v"}, Empty: []uint16{},
+		Ints: []int32{-1, 5}, Floats: []float64{1, math.NaN()},
+		Nested: [][]uint64{{1}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	js, err := ToJSON(data, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `{"0":{"$type":"u8","$value":7},"1":{"$type":"enum","$value":{"1":"sq"}},` +
+		`"2":{"$type":"timestamp","$value":"2023-11-14T22:13:20Z"},"3":{"$type":"timestamp","$value":253402300800},` +
+		`"4":{"$type":"map<u16,string>","$value":[[404,"nf"]]},"5":{"$type":"map<string,i8>","$value":{"a":-1}},` +
+		`"6":{"$type":"map<string,string>","$value":{"k":"v"}},"7":{"$type":"array<u16>","$value":[]},"8":[-1,5],` +
+		`"9":{"$type":"array<f64>","$value":[1,"nan(0x7ff8000000000001)"]},` +
+		`"10":{"$type":"array<array>","$value":[{"$type":"array<u64>","$value":["1"]}]}}`
+	if string(js) != want {
+		t.Fatalf("ToJSON =\n%s\nwant\n%s", js, want)
+	}
+	back, err := FromJSON(js, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(back, data) {
+		t.Fatalf("FromJSON =\n% x\nwant\n% x", back, data)
+	}
+
+	// Timestamps past RFC 3339's range are numbers with a schema too.
+	late, _ := Marshal(time.Unix(maxRFC3339+1, 0))
+	if js, err := ToJSON(late, time.Time{}); err != nil || string(js) != "253402300800" {
+		t.Fatalf("ToJSON(late timestamp) = %s, %v", js, err)
+	}
+	if back, err := FromJSON([]byte("253402300800"), time.Time{}); err != nil || !bytes.Equal(back, late) {
+		t.Fatalf("FromJSON(late timestamp) = % x, %v", back, err)
+	}
+
+	for _, js := range []string{
+		`{"$type":"u9","$value":1}`,
+		`{"$type":"array","$value":[]}`,
+		`{"$type":"u8","$value":1,"x":2}`,
+		`{"$type":"u8"}`,
+		`{"$type":"array<u8>","$value":[1,"x"]}`,
+		`{"$type":"enum","$value":{"0":1,"1":2}}`,
+	} {
+		if _, err := FromJSON([]byte(js), nil); err == nil {
+			t.Errorf("FromJSON(%s) succeeded", js)
+		}
+	}
+}
+
+func TestJSON_SchemaDescriptor(t *testing.T) {
+	s, err := SchemaOf(reflect.TypeOf(jsonMsg{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := Marshal(jsonMsg{ID: 1, At: time.Unix(0, 0)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e *Error
+	for _, schema := range []any{s, PrimitiveDesc{Type: TypeU8}} {
+		if _, err := ToJSON(data, schema); !errors.As(err, &e) || e.Kind != ErrInvalidValue {
+			t.Errorf("ToJSON with %v: err = %v, want ErrInvalidValue", schema, err)
+		}
+		if _, err := FromJSON([]byte(`{"ID": 1}`), schema); !errors.As(err, &e) || e.Kind != ErrInvalidValue {
+			t.Errorf("FromJSON with %v: err = %v, want ErrInvalidValue", schema, err)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+// Package lockfile records the field IDs that Relish struct and enum types
+// have used, so that an ID is never given to a different field once data
+// carrying the old one may exist. It is the discipline of protobuf's
+// reserved statement, applied to Relish's 7-bit field IDs.
+//
+// A lockfile is a text file, checked in next to the types it covers, with
+// one line per ID of each type:
+//
+//	Order 0 field ID u32
+//	Order 1 field Lines array<struct Line>
+//	Order 2 retired Note string
+//	Order 3 retired
+//
+// A field line holds the name and Relish type of the field using the ID.
+// When the field is removed its line becomes retired, keeping the name
+// and type it had. An ID retired in the source with a reserved tag before
+// the lockfile saw it used has a bare retired line:
+//
+//	_ struct{} `relish:"3,reserved"`
+//
+// Update checks a package against its lockfile: an ID may not change its
+// Relish type, and a retired ID may not be used again except by the field
+// it retired.
+package lockfile
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/token"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dadrian/relish"
+	"github.com/dadrian/relish/gosrc"
+	intr "github.com/dadrian/relish/internal"
+)
+
+// Entry records the use of one field ID of a type.
+type Entry struct {
+	Type    string
+	ID      int
+	Retired bool
+	// Name and Relish are the field name and its Relish type, as
+	// relish.Schema.String writes it. They are empty for an ID that was
+	// reserved without having been used.
+	Name   string
+	Relish string
+}
+
+func (e Entry) String() string {
+	state := "field"
+	if e.Retired {
+		state = "retired"
+	}
+	return strings.TrimSpace(fmt.Sprintf("%s %d %s %s %s", e.Type, e.ID, state, e.Name, e.Relish))
+}
+
+// File is a parsed lockfile. Entries are sorted by type, then ID.
+type File struct {
+	Entries []Entry
+}
+
+const header = "# Relish field IDs. Maintained by relishlock; check it in.\n"
+
+// Parse parses the lockfile src, reporting errors against name.
+func Parse(name string, src []byte) (*File, error) {
+	f := &File{}
+	seen := make(map[[2]string]bool)
+	for i, line := range strings.Split(string(src), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		errorf := func(format string, args ...any) error {
+			return fmt.Errorf("%s:%d: %s", name, i+1, fmt.Sprintf(format, args...))
+		}
+		w := strings.Fields(line)
+		if len(w) < 3 {
+			return nil, errorf("want type, field ID and state, found %q", line)
+		}
+		id, err := strconv.Atoi(w[1])
+		if err != nil || id < 0 || id > 127 {
+			return nil, errorf("invalid field ID %q", w[1])
+		}
+		e := Entry{Type: w[0], ID: id}
+		switch w[2] {
+		case "field":
+			if len(w) < 5 {
+				return nil, errorf("field entry needs a name and a Relish type")
+			}
+		case "retired":
+			e.Retired = true
+			if len(w) == 4 {
+				return nil, errorf("retired entry needs a Relish type after the name")
+			}
+		default:
+			return nil, errorf("unknown state %q, want field or retired", w[2])
+		}
+		if len(w) > 3 {
+			e.Name, e.Relish = w[3], strings.Join(w[4:], " ")
+		}
+		k := [2]string{e.Type, w[1]}
+		if seen[k] {
+			return nil, errorf("%s %d listed twice", e.Type, e.ID)
+		}
+		seen[k] = true
+		f.Entries = append(f.Entries, e)
+	}
+	f.sort()
+	return f, nil
+}
+
+func (f *File) sort() {
+	sort.Slice(f.Entries, func(i, j int) bool {
+		a, b := f.Entries[i], f.Entries[j]
+		if a.Type != b.Type {
+			return a.Type < b.Type
+		}
+		return a.ID < b.ID
+	})
+}
+
+// Format returns the text of f.
+func (f *File) Format() []byte {
+	var b bytes.Buffer
+	b.WriteString(header)
+	for i, e := range f.Entries {
+		if i > 0 && e.Type != f.Entries[i-1].Type {
+			b.WriteByte('\n')
+		}
+		b.WriteString(e.String())
+		b.WriteByte('\n')
+	}
+	return b.Bytes()
+}
+
+// Type is the current declaration of a struct or enum type: its fields
+// or variants, and the IDs it reserves.
+type Type struct {
+	Name     string
+	Fields   []relish.FieldDesc
+	Reserved []int
+}
+
+// Conflict is a use of a field ID that the lockfile forbids.
+type Conflict struct {
+	Type string
+	ID   int
+	Msg  string
+}
+
+func (c Conflict) String() string { return fmt.Sprintf("%s.%d: %s", c.Type, c.ID, c.Msg) }
+
+// Update returns f brought up to date with types, which hold every type
+// of the package: new IDs are added, IDs no longer used are retired, and
+// renamed fields get their new names. A type missing from types has all
+// its IDs retired. If any ID is used in a way the lockfile forbids, Update
+// returns the conflicts instead.
+func Update(f *File, types []Type) (*File, []Conflict) {
+	type key struct {
+		typ string
+		id  int
+	}
+	entries := make(map[key]Entry)
+	for _, e := range f.Entries {
+		entries[key{e.Type, e.ID}] = e
+	}
+	var conflicts []Conflict
+	conflict := func(t string, id int, format string, args ...any) {
+		conflicts = append(conflicts, Conflict{Type: t, ID: id, Msg: fmt.Sprintf(format, args...)})
+	}
+	used := make(map[key]bool)
+	for _, t := range types {
+		for _, fd := range t.Fields {
+			k := key{t.Name, int(fd.ID)}
+			used[k] = true
+			cur := Entry{Type: t.Name, ID: int(fd.ID), Name: fd.Name, Relish: fd.Type.String()}
+			e, ok := entries[k]
+			switch {
+			case !ok:
+			case e.Retired && e.Name == "":
+				conflict(t.Name, k.id, "field %s uses an ID reserved before it was used; give it a new ID", fd.Name)
+				continue
+			case e.Retired && (e.Name != cur.Name || e.Relish != cur.Relish):
+				conflict(t.Name, k.id, "field %s %s uses the ID retired from %s %s; give it a new ID", fd.Name, cur.Relish, e.Name, e.Relish)
+				continue
+			case e.Relish != cur.Relish:
+				conflict(t.Name, k.id, "field %s has type %s, but the ID is locked to %s; give the new type a new ID", fd.Name, cur.Relish, e.Relish)
+				continue
+			}
+			entries[k] = cur
+		}
+		for _, id := range t.Reserved {
+			k := key{t.Name, id}
+			if used[k] {
+				conflict(t.Name, id, "ID is reserved but used by a field")
+				continue
+			}
+			e, ok := entries[k]
+			if !ok {
+				e = Entry{Type: t.Name, ID: id}
+			}
+			e.Retired = true
+			entries[k] = e
+		}
+	}
+	for k, e := range entries {
+		if !used[k] && !e.Retired {
+			e.Retired = true
+			entries[k] = e
+		}
+	}
+	if len(conflicts) > 0 {
+		sort.SliceStable(conflicts, func(i, j int) bool {
+			if conflicts[i].Type != conflicts[j].Type {
+				return conflicts[i].Type < conflicts[j].Type
+			}
+			return conflicts[i].ID < conflicts[j].ID
+		})
+		return nil, conflicts
+	}
+	out := &File{}
+	for _, e := range entries {
+		out.Entries = append(out.Entries, e)
+	}
+	out.sort()
+	return out, nil
+}
+
+// Load returns the struct types of the Go package in dir that have
+// relish-tagged fields or reserve IDs, in source order. A struct type
+// whose tagged fields are all optional is an enum, as relish.SchemaOf
+// describes it, and its variants are its fields.
+func Load(dir string) ([]Type, error) {
+	p, err := gosrc.ParseDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	var types []Type
+	for _, file := range p.Files {
+		for _, d := range file.Decls {
+			g, ok := d.(*ast.GenDecl)
+			if !ok || g.Tok != token.TYPE {
+				continue
+			}
+			for _, s := range g.Specs {
+				spec := s.(*ast.TypeSpec)
+				st, ok := spec.Type.(*ast.StructType)
+				if !ok || spec.TypeParams != nil {
+					continue
+				}
+				t := Type{Name: spec.Name.Name}
+				tagged := false
+				for _, f := range st.Fields.List {
+					if _, _, _, ok := gosrc.ParseTag(f); ok {
+						tagged = true
+					} else if id, ok := reservedID(f); ok {
+						t.Reserved = append(t.Reserved, id)
+					}
+				}
+				if tagged {
+					s, err := p.Schema(t.Name)
+					if err != nil {
+						return nil, err
+					}
+					switch s := s.(type) {
+					case *relish.StructDesc:
+						t.Fields = s.Fields
+					case *relish.EnumDesc:
+						t.Fields = s.Variants
+					}
+				}
+				if tagged || len(t.Reserved) > 0 {
+					types = append(types, t)
+				}
+			}
+		}
+	}
+	return types, nil
+}
+
+func reservedID(f *ast.Field) (int, bool) {
+	if f.Tag == nil {
+		return 0, false
+	}
+	tag, err := strconv.Unquote(f.Tag.Value)
+	if err != nil {
+		return 0, false
+	}
+	return intr.ParseReservedTag(reflect.StructField{Tag: reflect.StructTag(tag)})
+}
@@ -0,0 +1,137 @@
+package lockfile
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dadrian/relish"
+)
+
+const lockSrc = `# Relish field IDs. Maintained by relishlock; check it in.
+Line 0 field SKU string
+
+Order 0 field ID u32
+Order 1 retired Note string
+Order 2 field Lines array<struct Line>
+Order 5 retired
+`
+
+func field(id byte, name string, t relish.Schema) relish.FieldDesc {
+	return relish.FieldDesc{ID: id, Name: name, Type: t}
+}
+
+var (
+	u32    = relish.PrimitiveDesc{Type: relish.TypeU32}
+	str    = relish.PrimitiveDesc{Type: relish.TypeString}
+	lineT  = &relish.StructDesc{Name: "Line"}
+	linesT = &relish.ArrayDesc{Elem: lineT}
+)
+
+func TestParse_Format(t *testing.T) {
+	f, err := Parse("relish.lock", []byte(lockSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := string(f.Format()); got != lockSrc {
+		t.Errorf("Format =\n%s\nwant\n%s", got, lockSrc)
+	}
+	for _, tc := range []struct{ src, want string }{
+		{"Order x field A u8", `relish.lock:1: invalid field ID "x"`},
+		{"Order 1 field A", "relish.lock:1: field entry needs a name and a Relish type"},
+		{"\nOrder 1 gone", `relish.lock:2: unknown state "gone", want field or retired`},
+		{"Order 1 retired\nOrder 1 retired", "relish.lock:2: Order 1 listed twice"},
+	} {
+		if _, err := Parse("relish.lock", []byte(tc.src)); err == nil || err.Error() != tc.want {
+			t.Errorf("Parse(%q) = %v, want %s", tc.src, err, tc.want)
+		}
+	}
+}
+
+func TestUpdate(t *testing.T) {
+	f, err := Parse("relish.lock", []byte(lockSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Renaming a field and restoring a retired one are fine; Line is gone.
+	got, conflicts := Update(f, []Type{{
+		Name:     "Order",
+		Fields:   []relish.FieldDesc{field(0, "OrderID", u32), field(1, "Note", str), field(3, "Total", u32)},
+		Reserved: []int{2, 5},
+	}})
+	if conflicts != nil {
+		t.Fatal(conflicts)
+	}
+	want := `# Relish field IDs. Maintained by relishlock; check it in.
+Line 0 retired SKU string
+
+Order 0 field OrderID u32
+Order 1 field Note string
+Order 2 retired Lines array<struct Line>
+Order 3 field Total u32
+Order 5 retired
+`
+	if s := string(got.Format()); s != want {
+		t.Errorf("Update =\n%s\nwant\n%s", s, want)
+	}
+
+	_, conflicts = Update(f, []Type{
+		{Name: "Line", Fields: []relish.FieldDesc{field(0, "SKU", u32)}},
+		{
+			Name:     "Order",
+			Fields:   []relish.FieldDesc{field(0, "ID", u32), field(1, "Memo", str), field(2, "Lines", linesT), field(5, "New", str)},
+			Reserved: []int{2},
+		},
+	})
+	var msgs []string
+	for _, c := range conflicts {
+		msgs = append(msgs, c.String())
+	}
+	wantMsgs := []string{
+		"Line.0: field SKU has type u32, but the ID is locked to string; give the new type a new ID",
+		"Order.1: field Memo string uses the ID retired from Note string; give it a new ID",
+		"Order.2: ID is reserved but used by a field",
+		"Order.5: field New uses an ID reserved before it was used; give it a new ID",
+	}
+	if !reflect.DeepEqual(msgs, wantMsgs) {
+		t.Errorf("conflicts =\n%s\nwant\n%s", strings.Join(msgs, "\n"), strings.Join(wantMsgs, "\n"))
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	src := "package p\n\n" +
+		"type Order struct {\n" +
+		"\tID    uint32   `relish:\"0\"`\n" +
+		"\tLines []Line   `relish:\"2\"`\n" +
+		"\t_     struct{} `relish:\"1,reserved\"`\n" +
+		"}\n\n" +
+		"type Line struct {\n\tSKU string `relish:\"0\"`\n}\n\n" +
+		"type Old struct {\n\t_ struct{} `relish:\"0,reserved\"`\n}\n\n" +
+		"type Plain struct{ X int }\n"
+	if err := os.WriteFile(filepath.Join(dir, "p.go"), []byte(src), 0o666); err != nil {
+		t.Fatal(err)
+	}
+	types, err := Load(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, conflicts := Update(&File{}, types)
+	if conflicts != nil {
+		t.Fatal(conflicts)
+	}
+	want := `# Relish field IDs. Maintained by relishlock; check it in.
+Line 0 field SKU string
+
+Old 0 retired
+
+Order 0 field ID u32
+Order 1 retired
+Order 2 field Lines array<struct Line>
+`
+	if s := string(got.Format()); s != want {
+		t.Errorf("Load and Update =\n%s\nwant\n%s", s, want)
+	}
+}
@@ -2,10 +2,20 @@ package relish
 
 import (
 	"bytes"
+	"reflect"
 )
 
 // Marshal encodes v into a Relish TLV byte slice.
 func Marshal(v any) ([]byte, error) {
+	if m, ok := v.(Marshaler); ok && !reflectOnly {
+		if rv := reflect.ValueOf(v); rv.Kind() != reflect.Pointer || !rv.IsNil() {
+			a := Appender{Buf: make([]byte, 0, m.RelishSize())}
+			if err := m.MarshalRelish(&a); err != nil {
+				return nil, err
+			}
+			return a.Buf, nil
+		}
+	}
 	var buf bytes.Buffer
 	enc := NewEncoder(&buf)
 	if err := enc.Encode(v); err != nil {
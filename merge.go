@@ -0,0 +1,137 @@
+package relish
+
+// MergeOption adjusts how Merge combines values.
+type MergeOption func(*merger)
+
+// MergeAppendArrays makes Merge append the elements of an overlay array
+// to the base array, instead of replacing it, when both have the same
+// element type.
+func MergeAppendArrays() MergeOption {
+	return func(m *merger) { m.appendArrays = true }
+}
+
+// Merge returns base with overlay layered on top, following protobuf's
+// merge rules:
+//
+//   - fields set in an overlay struct replace the same fields of the base
+//     struct, and fields only in the base are kept; where both fields are
+//     structs they are merged recursively;
+//   - an overlay enum holding the same variant as the base merges into
+//     it, and otherwise replaces it;
+//   - map entries are merged by key, with overlay entries replacing base
+//     entries with the same key and new keys added after the base's;
+//   - arrays are replaced, or appended to with MergeAppendArrays;
+//   - any other value, or a value of a different type, is replaced.
+//
+// Struct fields in the result stay in strictly increasing ID order. Both
+// inputs must be valid; the first error Validate reports is returned
+// otherwise.
+func Merge(base, overlay []byte, opts ...MergeOption) ([]byte, error) {
+	var m merger
+	for _, o := range opts {
+		o(&m)
+	}
+	if err := firstError(Validate(base)); err != nil {
+		return nil, err
+	}
+	if err := firstError(Validate(overlay)); err != nil {
+		return nil, err
+	}
+	tb, cb, _, _ := splitValue(base)
+	to, co, _, _ := splitValue(overlay)
+	t, c := m.merge(tb, cb, to, co)
+	return appendValue(make([]byte, 0, len(base)+len(overlay)), t, c), nil
+}
+
+type merger struct {
+	appendArrays bool
+}
+
+// merge returns the type and content of overlay value (to, co) merged
+// into base value (tb, cb). Both must be valid.
+func (m *merger) merge(tb byte, cb []byte, to byte, co []byte) (byte, []byte) {
+	if tb != to {
+		return to, co
+	}
+	switch TypeID(tb) {
+	case TypeStruct:
+		return tb, m.mergeStruct(cb, co)
+	case TypeEnum:
+		if cb[0] != co[0] {
+			return to, co
+		}
+		vtb, vcb, _, _ := splitValue(cb[1:])
+		vto, vco, _, _ := splitValue(co[1:])
+		vt, vc := m.merge(vtb, vcb, vto, vco)
+		return tb, appendValue([]byte{cb[0]}, vt, vc)
+	case TypeMap:
+		if cb[0] != co[0] || cb[1] != co[1] {
+			return to, co
+		}
+		return tb, mergeMap(cb, co)
+	case TypeArray:
+		if !m.appendArrays || cb[0] != co[0] {
+			return to, co
+		}
+		out := make([]byte, 0, len(cb)+len(co)-1)
+		return tb, append(append(out, cb...), co[1:]...)
+	}
+	return to, co
+}
+
+// mergeStruct merges the fields of struct content co into cb, walking
+// both in field ID order.
+func (m *merger) mergeStruct(cb, co []byte) []byte {
+	out := make([]byte, 0, len(cb)+len(co))
+	for len(cb) > 0 || len(co) > 0 {
+		switch {
+		case len(co) == 0 || len(cb) > 0 && cb[0] < co[0]:
+			_, _, next, _ := splitValue(cb[1:])
+			out = append(out, cb[:len(cb)-len(next)]...)
+			cb = next
+		case len(cb) == 0 || co[0] < cb[0]:
+			_, _, next, _ := splitValue(co[1:])
+			out = append(out, co[:len(co)-len(next)]...)
+			co = next
+		default:
+			id := cb[0]
+			tb, vb, nb, _ := splitValue(cb[1:])
+			to, vo, no, _ := splitValue(co[1:])
+			t, c := m.merge(tb, vb, to, vo)
+			out = appendValue(append(out, id), t, c)
+			cb, co = nb, no
+		}
+	}
+	return out
+}
+
+// mergeMap merges the entries of map content co into cb. Entries with a
+// key already in cb replace its value in place; the rest are appended.
+func mergeMap(cb, co []byte) []byte {
+	kt, vt := cb[0], cb[1]
+	var over [][]byte
+	byKey := make(map[string]int)
+	for p := co[2:]; len(p) > 0; {
+		kc, _, next, _ := splitEntry(kt, vt, p)
+		byKey[string(kc)] = len(over)
+		over = append(over, p[:len(p)-len(next)])
+		p = next
+	}
+	used := make([]bool, len(over))
+	out := append(make([]byte, 0, len(cb)+len(co)), kt, vt)
+	for p := cb[2:]; len(p) > 0; {
+		kc, _, next, _ := splitEntry(kt, vt, p)
+		pair := p[:len(p)-len(next)]
+		if i, ok := byKey[string(kc)]; ok {
+			pair, used[i] = over[i], true
+		}
+		out = append(out, pair...)
+		p = next
+	}
+	for i, pair := range over {
+		if !used[i] {
+			out = append(out, pair...)
+		}
+	}
+	return out
+}
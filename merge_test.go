@@ -0,0 +1,98 @@
+package relish
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestMerge(t *testing.T) {
+	type Limits struct {
+		CPU *uint32 `relish:"0,optional"`
+		Mem *uint32 `relish:"1,optional"`
+		Tag *string `relish:"2,optional"`
+	}
+	type Config struct {
+		Name   *string           `relish:"0,optional"`
+		Port   *uint16           `relish:"2,optional"`
+		Limits *Limits           `relish:"3,optional"`
+		Hosts  []string          `relish:"4,omitempty"`
+		Env    map[string]string `relish:"5,omitempty"`
+		Debug  *bool             `relish:"7,optional"`
+	}
+	marshal := func(v any) []byte {
+		t.Helper()
+		b, err := Marshal(v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return b
+	}
+	base := marshal(Config{
+		Name:   ptr("svc"),
+		Port:   ptr(uint16(80)),
+		Limits: &Limits{CPU: ptr(uint32(1)), Mem: ptr(uint32(512))},
+		Hosts:  []string{"a"},
+		Env:    map[string]string{"A": "1"},
+	})
+	overlay := marshal(Config{
+		Port:   ptr(uint16(8080)),
+		Limits: &Limits{Mem: ptr(uint32(1024)), Tag: ptr("big")},
+		Hosts:  []string{"b"},
+		Env:    map[string]string{"A": "2"},
+		Debug:  ptr(true),
+	})
+
+	got, err := Merge(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := marshal(Config{
+		Name:   ptr("svc"),
+		Port:   ptr(uint16(8080)),
+		Limits: &Limits{CPU: ptr(uint32(1)), Mem: ptr(uint32(1024)), Tag: ptr("big")},
+		Hosts:  []string{"b"},
+		Env:    map[string]string{"A": "2"},
+		Debug:  ptr(true),
+	})
+	if !bytes.Equal(got, want) {
+		t.Fatalf("Merge =\n% x\nwant\n% x", got, want)
+	}
+
+	got, err = Merge(base, overlay, MergeAppendArrays())
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs, _ := Query(got, ".4[*]")
+	if len(vs) != 2 {
+		t.Fatalf("appended array has %d elements, want 2", len(vs))
+	}
+}
+
+func TestMerge_Maps(t *testing.T) {
+	base, _ := Marshal(map[string]uint8{"a": 1})
+	overlay, _ := Marshal(map[string]uint8{"a": 3, "c": 4})
+	got, err := Merge(base, overlay)
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, _ := NewView(got)
+	for k, want := range map[string]uint8{"a": 3, "c": 4} {
+		e, ok := v.MapLookup(k)
+		if n, _ := e.U8(); !ok || n != want {
+			t.Fatalf("%q = %d, want %d", k, n, want)
+		}
+	}
+	if v.Len() != 2 {
+		t.Fatalf("merged map has %d entries, want 2", v.Len())
+	}
+
+	// Values of different types are replaced.
+	other, _ := Marshal(uint32(9))
+	got, err = Merge(base, other)
+	if err != nil || !bytes.Equal(got, other) {
+		t.Fatalf("Merge(map, u32) = % x, %v", got, err)
+	}
+	if _, err := Merge(base, []byte{0x11, 0x02}); err == nil {
+		t.Fatalf("expected error for invalid overlay")
+	}
+}
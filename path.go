@@ -0,0 +1,240 @@
+package relish
+
+import (
+	"encoding/binary"
+	"reflect"
+	"strconv"
+	"unicode/utf8"
+
+	intr "github.com/dadrian/relish/internal"
+)
+
+// Paths locate a value inside an encoded TLV tree. They are built from
+// segments appended to the path of the enclosing value:
+//
+//	.N      struct field with ID N
+//	<N>     enum variant with ID N
+//	[i]     array element i
+//	{key}   map entry whose key is the literal key (a quoted string,
+//	        an integer or a bool)
+//	{#i}    map entry i, for keys that have no literal form
+//
+// The root value has the empty path. Paths given to Query may also use
+// Go field names in place of IDs and the wildcards .*, [*] and {*}.
+
+func pathField(p string, id byte) string   { return p + "." + strconv.Itoa(int(id)) }
+func pathVariant(p string, id byte) string { return p + "<" + strconv.Itoa(int(id)) + ">" }
+func pathIndex(p string, i int) string     { return p + "[" + strconv.Itoa(i) + "]" }
+
+// pathKey renders the map entry segment for the i-th pair, whose key has
+// type kt and element-layout content key.
+func pathKey(p string, kt byte, key []byte, i int) string {
+	if lit, ok := keyLiteral(kt, key); ok {
+		return p + "{" + lit + "}"
+	}
+	return p + "{#" + strconv.Itoa(i) + "}"
+}
+
+// keyLiteral renders a map key's content as a path literal. It reports
+// false for key types that have no literal form or malformed content.
+func keyLiteral(kt byte, key []byte) (string, bool) {
+	if sz, ok := intr.FixedSize(kt); ok && len(key) != sz {
+		return "", false
+	}
+	switch TypeID(kt) {
+	case TypeString:
+		if !utf8.Valid(key) {
+			return "", false
+		}
+		return strconv.Quote(string(key)), true
+	case TypeBool:
+		switch key[0] {
+		case 0x00:
+			return "false", true
+		case 0xFF:
+			return "true", true
+		}
+		return "", false
+	case TypeU8:
+		return strconv.FormatUint(uint64(key[0]), 10), true
+	case TypeU16:
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint16(key)), 10), true
+	case TypeU32:
+		return strconv.FormatUint(uint64(binary.LittleEndian.Uint32(key)), 10), true
+	case TypeU64:
+		return strconv.FormatUint(binary.LittleEndian.Uint64(key), 10), true
+	case TypeI8:
+		return strconv.FormatInt(int64(int8(key[0])), 10), true
+	case TypeI16:
+		return strconv.FormatInt(int64(int16(binary.LittleEndian.Uint16(key))), 10), true
+	case TypeI32:
+		return strconv.FormatInt(int64(int32(binary.LittleEndian.Uint32(key))), 10), true
+	case TypeI64:
+		return strconv.FormatInt(int64(binary.LittleEndian.Uint64(key)), 10), true
+	}
+	return "", false
+}
+
+// keyContent is the inverse of keyLiteral: it returns the content of the
+// map key of type kt written as lit, or false if lit does not denote a key
+// of that type.
+func keyContent(kt byte, lit string) ([]byte, bool) {
+	le := binary.LittleEndian
+	switch TypeID(kt) {
+	case TypeString:
+		s, err := strconv.Unquote(lit)
+		return []byte(s), err == nil && len(lit) > 0 && lit[0] == '"'
+	case TypeBool:
+		switch lit {
+		case "false":
+			return []byte{0x00}, true
+		case "true":
+			return []byte{0xFF}, true
+		}
+		return nil, false
+	case TypeU8, TypeU16, TypeU32, TypeU64:
+		sz, _ := intr.FixedSize(kt)
+		n, err := strconv.ParseUint(lit, 10, sz*8)
+		if err != nil {
+			return nil, false
+		}
+		return le.AppendUint64(nil, n)[:sz], true
+	case TypeI8, TypeI16, TypeI32, TypeI64:
+		sz, _ := intr.FixedSize(kt)
+		n, err := strconv.ParseInt(lit, 10, sz*8)
+		if err != nil {
+			return nil, false
+		}
+		return le.AppendUint64(nil, uint64(n))[:sz], true
+	}
+	return nil, false
+}
+
+// pathSeg is one parsed segment of a path.
+type pathSeg struct {
+	kind  segKind
+	id    byte   // segField, segVariant
+	index int    // segIndex, and segKey when key is empty
+	key   string // segKey: the key literal, or empty for {#index}
+	// For segKey segments taken from encoded data rather than parsed,
+	// kt and raw hold the key's type and content bytes.
+	kt  byte
+	raw []byte
+	// Parsed paths may name fields and variants instead of giving their
+	// IDs until resolved against a Go type, and may use wildcards.
+	name string
+	wild bool
+}
+
+type segKind int
+
+const (
+	segField segKind = iota
+	segVariant
+	segIndex
+	segKey
+)
+
+func (s pathSeg) String() string {
+	if s.wild {
+		switch s.kind {
+		case segField:
+			return ".*"
+		case segIndex:
+			return "[*]"
+		case segKey:
+			return "{*}"
+		}
+	}
+	if s.name != "" {
+		if s.kind == segVariant {
+			return "<" + s.name + ">"
+		}
+		return "." + s.name
+	}
+	switch s.kind {
+	case segField:
+		return pathField("", s.id)
+	case segVariant:
+		return pathVariant("", s.id)
+	case segIndex:
+		return pathIndex("", s.index)
+	case segKey:
+		if s.key == "" {
+			return "{#" + strconv.Itoa(s.index) + "}"
+		}
+		return "{" + s.key + "}"
+	}
+	return ""
+}
+
+func formatPath(segs []pathSeg) string {
+	var out string
+	for _, s := range segs {
+		out += s.String()
+	}
+	return out
+}
+
+// keySeg returns the segment for the i-th map entry with key content key.
+func keySeg(kt byte, key []byte, i int) pathSeg {
+	lit, _ := keyLiteral(kt, key)
+	return pathSeg{kind: segKey, key: lit, index: i, kt: kt, raw: key}
+}
+
+// namedPath renders segs with struct field and enum variant IDs replaced
+// by the names of the corresponding Go fields of rt, as far as rt
+// describes the value. Segments it cannot resolve keep their IDs.
+func namedPath(segs []pathSeg, rt reflect.Type) string {
+	var out string
+	for _, s := range segs {
+		for rt != nil && rt.Kind() == reflect.Pointer {
+			rt = rt.Elem()
+		}
+		switch s.kind {
+		case segField, segVariant:
+			name, ft := fieldByID(rt, s.id)
+			if name == "" {
+				out += s.String()
+				rt = nil
+				continue
+			}
+			if s.kind == segField {
+				out += "." + name
+			} else {
+				out += "<" + name + ">"
+			}
+			rt = ft
+		case segIndex:
+			out += s.String()
+			if rt != nil && (rt.Kind() == reflect.Slice || rt.Kind() == reflect.Array) {
+				rt = rt.Elem()
+			} else {
+				rt = nil
+			}
+		case segKey:
+			out += s.String()
+			if rt != nil && rt.Kind() == reflect.Map {
+				rt = rt.Elem()
+			} else {
+				rt = nil
+			}
+		}
+	}
+	return out
+}
+
+// fieldByID returns the name and type of the field of struct type rt
+// tagged with id, or "" if there is none.
+func fieldByID(rt reflect.Type, id byte) (string, reflect.Type) {
+	if rt == nil || rt.Kind() != reflect.Struct {
+		return "", nil
+	}
+	for i := 0; i < rt.NumField(); i++ {
+		f := rt.Field(i)
+		if fid, _, _, ok := intr.ParseRelishTag(f); ok && fid == int(id) {
+			return f.Name, f.Type
+		}
+	}
+	return "", nil
+}
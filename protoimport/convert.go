@@ -0,0 +1,354 @@
+// Package protoimport converts Protocol Buffers definitions into Relish
+// schemas, so that services moving from protobuf to Relish can keep their
+// message definitions.
+//
+// Parse reads .proto files (proto2 or proto3) with a self-contained
+// parser, and Convert maps their messages to an idl.File:
+//
+//   - A message becomes a struct. Nested messages are flattened: Inner in
+//     Outer becomes Outer_Inner.
+//   - A field number becomes the field ID. Relish IDs must be below 128,
+//     so larger numbers are errors.
+//   - repeated T becomes array<T> and map<K, V> becomes map<K, V>.
+//   - Fields labelled optional are optional, as are fields holding a
+//     message in proto3 and unlabelled fields in proto2. Other proto3
+//     fields and proto2 required fields are required.
+//   - A oneof becomes an enum whose variants are its fields. The message
+//     holds it as an optional field whose ID is the oneof's lowest field
+//     number.
+//   - A message whose fields all become optional, such as a proto3
+//     message holding only messages or a oneof, is an error: Go encodes
+//     such a struct as an enum when exactly one field is set.
+//   - Relish enums are tagged unions, not named integers, so a proto enum
+//     field becomes an i32 field. Result.GenerateGo declares the enum's
+//     values as int32 constants.
+//   - google.protobuf.Timestamp becomes timestamp, which holds whole
+//     seconds.
+//
+// Scalar types map to the Relish type of the same size: int32, sint32 and
+// sfixed32 to i32; uint32 and fixed32 to u32; likewise for 64 bits;
+// double and float to f64 and f32; bytes to array<u8>.
+//
+// Constructs with no Relish equivalent, such as services, extensions,
+// options and reserved ranges, are skipped and listed in Result.Notes.
+package protoimport
+
+import (
+	"bytes"
+	"fmt"
+	"go/format"
+	"sort"
+	"strings"
+
+	"github.com/dadrian/relish/idl"
+)
+
+// Note describes a construct that was dropped or changed in conversion.
+type Note struct {
+	Pos idl.Pos
+	Msg string
+}
+
+func (n Note) String() string { return n.Pos.String() + ": " + n.Msg }
+
+// Result is the outcome of Convert.
+type Result struct {
+	Schema *idl.File
+	Enums  []*Enum // proto enums, by their flattened names
+	Notes  []Note  // constructs with no Relish equivalent, in source order
+}
+
+// scalars maps protobuf scalar types to Relish types.
+var scalars = map[string]string{
+	"double":   "f64",
+	"float":    "f32",
+	"int32":    "i32",
+	"sint32":   "i32",
+	"sfixed32": "i32",
+	"int64":    "i64",
+	"sint64":   "i64",
+	"sfixed64": "i64",
+	"uint32":   "u32",
+	"fixed32":  "u32",
+	"uint64":   "u64",
+	"fixed64":  "u64",
+	"bool":     "bool",
+	"string":   "string",
+	"bytes":    "array<u8>",
+}
+
+// Convert converts the messages of files to a checked schema. Types are
+// resolved across all the files, so a file and the files it imports
+// should be converted together.
+func Convert(files ...*File) (*Result, error) {
+	c := &converter{
+		types: make(map[string]*protoType),
+		res:   &Result{Schema: &idl.File{}},
+	}
+	var names []string
+	for _, f := range files {
+		names = append(names, f.Name)
+		for _, m := range f.Messages {
+			c.index(f.Package, "", m)
+		}
+		for _, e := range f.Enums {
+			c.indexEnum(f.Package, "", e)
+		}
+	}
+	c.res.Schema.Name = strings.Join(names, ", ")
+	for _, f := range files {
+		c.res.Notes = append(c.res.Notes, f.notes...)
+		for _, m := range f.Messages {
+			c.message(f, f.Package, "", m)
+		}
+	}
+	if len(c.errs) == 0 {
+		if err := idl.Check(c.res.Schema); err != nil {
+			return nil, err
+		}
+	}
+	sort.SliceStable(c.errs, func(i, j int) bool { return posLess(c.errs[i].Pos, c.errs[j].Pos) })
+	sort.SliceStable(c.res.Notes, func(i, j int) bool { return posLess(c.res.Notes[i].Pos, c.res.Notes[j].Pos) })
+	if err := c.errs.Err(); err != nil {
+		return nil, err
+	}
+	return c.res, nil
+}
+
+func posLess(a, b idl.Pos) bool {
+	if a.File != b.File {
+		return a.File < b.File
+	}
+	if a.Line != b.Line {
+		return a.Line < b.Line
+	}
+	return a.Col < b.Col
+}
+
+// protoType is a message or enum indexed by its fully qualified name.
+type protoType struct {
+	decl string // flattened name
+	enum bool
+}
+
+type converter struct {
+	types map[string]*protoType
+	res   *Result
+	errs  idl.ErrorList
+}
+
+func qualify(scope, name string) string {
+	if scope == "" {
+		return name
+	}
+	return scope + "." + name
+}
+
+func flatten(outer, name string) string {
+	if outer == "" {
+		return name
+	}
+	return outer + "_" + name
+}
+
+func (c *converter) index(scope, outer string, m *Message) {
+	full := qualify(scope, m.Name)
+	decl := flatten(outer, m.Name)
+	c.types[full] = &protoType{decl: decl}
+	for _, sub := range m.Messages {
+		c.index(full, decl, sub)
+	}
+	for _, e := range m.Enums {
+		c.indexEnum(full, decl, e)
+	}
+}
+
+func (c *converter) indexEnum(scope, outer string, e *Enum) {
+	decl := flatten(outer, e.Name)
+	c.types[qualify(scope, e.Name)] = &protoType{decl: decl, enum: true}
+	c.res.Enums = append(c.res.Enums, &Enum{Pos: e.Pos, Name: decl, Values: e.Values})
+	c.res.Notes = append(c.res.Notes, Note{Pos: e.Pos, Msg: fmt.Sprintf("enum %s becomes i32; Relish enums are tagged unions, not named integers", decl)})
+}
+
+func (c *converter) errorf(pos idl.Pos, format string, args ...any) {
+	c.errs = append(c.errs, &idl.Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+// resolve looks name up the way protoc does: in scope, then in each
+// enclosing scope out to the package root. A leading dot makes name fully
+// qualified.
+func (c *converter) resolve(scope, name string) *protoType {
+	if strings.HasPrefix(name, ".") {
+		return c.types[name[1:]]
+	}
+	for {
+		if t, ok := c.types[qualify(scope, name)]; ok {
+			return t
+		}
+		if scope == "" {
+			return nil
+		}
+		i := strings.LastIndex(scope, ".")
+		if i < 0 {
+			scope = ""
+		} else {
+			scope = scope[:i]
+		}
+	}
+}
+
+// typeOf converts the proto type name to a Relish type. It reports
+// whether the type is a message, which has presence in proto3.
+func (c *converter) typeOf(pos idl.Pos, scope, name string) (t *idl.Type, message bool) {
+	if s, ok := scalars[name]; ok {
+		if s == "array<u8>" {
+			return &idl.Type{Pos: pos, Name: "array", Args: []*idl.Type{{Pos: pos, Name: "u8"}}}, false
+		}
+		return &idl.Type{Pos: pos, Name: s}, false
+	}
+	switch strings.TrimPrefix(name, ".") {
+	case "google.protobuf.Timestamp":
+		c.res.Notes = append(c.res.Notes, Note{Pos: pos, Msg: "google.protobuf.Timestamp becomes timestamp, which drops nanoseconds"})
+		return &idl.Type{Pos: pos, Name: "timestamp"}, true
+	}
+	pt := c.resolve(scope, name)
+	if pt == nil {
+		if strings.HasPrefix(strings.TrimPrefix(name, "."), "google.protobuf.") {
+			c.errorf(pos, "%s has no Relish equivalent", name)
+		} else {
+			c.errorf(pos, "undefined type %s", name)
+		}
+		return nil, false
+	}
+	if pt.enum {
+		return &idl.Type{Pos: pos, Name: "i32"}, false
+	}
+	return &idl.Type{Pos: pos, Name: pt.decl}, true
+}
+
+// id checks that a field number fits in a Relish field ID.
+func (c *converter) id(msg string, f *Field) bool {
+	if f.Number > 127 {
+		c.errorf(f.Pos, "%s.%s: field number %d out of range; Relish field IDs must be 0 to 127", msg, f.Name, f.Number)
+		return false
+	}
+	return true
+}
+
+func (c *converter) message(f *File, scope, outer string, m *Message) {
+	full := qualify(scope, m.Name)
+	decl := &idl.Decl{Pos: m.Pos, Name: flatten(outer, m.Name)}
+	c.res.Schema.Decls = append(c.res.Schema.Decls, decl)
+	for _, fd := range m.Fields {
+		if !c.id(decl.Name, fd) {
+			continue
+		}
+		mem := &idl.Member{Pos: fd.Pos, ID: fd.Number, Name: fd.Name}
+		if fd.Type == "map" {
+			k, _ := c.typeOf(fd.Pos, full, fd.KeyType)
+			v, _ := c.typeOf(fd.Pos, full, fd.ValueType)
+			if k == nil || v == nil {
+				continue
+			}
+			mem.Type = &idl.Type{Pos: fd.Pos, Name: "map", Args: []*idl.Type{k, v}}
+			decl.Members = append(decl.Members, mem)
+			continue
+		}
+		t, message := c.typeOf(fd.Pos, full, fd.Type)
+		if t == nil {
+			continue
+		}
+		switch fd.Label {
+		case "repeated":
+			t = &idl.Type{Pos: fd.Pos, Name: "array", Args: []*idl.Type{t}}
+		case "optional":
+			mem.Optional = true
+		case "":
+			mem.Optional = message || f.Syntax == "proto2"
+		}
+		mem.Type = t
+		decl.Members = append(decl.Members, mem)
+	}
+	for _, o := range m.Oneofs {
+		c.oneof(decl, full, o)
+	}
+	if allOptional(decl) {
+		c.errorf(m.Pos, "message %s: every field is optional in Relish, and Go encodes such a struct as an enum when exactly one field is set", decl.Name)
+	}
+	sort.SliceStable(decl.Members, func(i, j int) bool { return decl.Members[i].ID < decl.Members[j].ID })
+	for _, sub := range m.Messages {
+		c.message(f, full, decl.Name, sub)
+	}
+}
+
+// allOptional reports whether d has members and all of them are optional.
+func allOptional(d *idl.Decl) bool {
+	for _, m := range d.Members {
+		if !m.Optional {
+			return false
+		}
+	}
+	return len(d.Members) > 0
+}
+
+func (c *converter) oneof(parent *idl.Decl, scope string, o *Oneof) {
+	if len(o.Fields) == 0 {
+		c.errorf(o.Pos, "%s.%s: empty oneof", parent.Name, o.Name)
+		return
+	}
+	enum := &idl.Decl{Pos: o.Pos, Enum: true, Name: parent.Name + "_" + o.Name}
+	low := -1
+	for _, fd := range o.Fields {
+		if !c.id(parent.Name, fd) {
+			continue
+		}
+		if fd.Type == "map" {
+			c.errorf(fd.Pos, "%s.%s: map fields are not allowed in a oneof", parent.Name, fd.Name)
+			continue
+		}
+		t, _ := c.typeOf(fd.Pos, scope, fd.Type)
+		if t == nil {
+			continue
+		}
+		enum.Members = append(enum.Members, &idl.Member{Pos: fd.Pos, ID: fd.Number, Type: t, Name: fd.Name})
+		if low < 0 || fd.Number < low {
+			low = fd.Number
+		}
+	}
+	if low < 0 {
+		return
+	}
+	sort.SliceStable(enum.Members, func(i, j int) bool { return enum.Members[i].ID < enum.Members[j].ID })
+	c.res.Schema.Decls = append(c.res.Schema.Decls, enum)
+	parent.Members = append(parent.Members, &idl.Member{
+		Pos: o.Pos, ID: low, Optional: true, Name: o.Name,
+		Type: &idl.Type{Pos: o.Pos, Name: enum.Name},
+	})
+	c.res.Notes = append(c.res.Notes, Note{Pos: o.Pos, Msg: fmt.Sprintf("oneof %s.%s becomes enum %s at field ID %d, its lowest field number", parent.Name, o.Name, enum.Name, low)})
+}
+
+// GenerateGo returns Go source for r's schema in package pkg, as
+// idl.GenerateGo does, followed by int32 constants for the values of each
+// proto enum. A value V of enum E is named E_V, as protoc-gen-go names it.
+func (r *Result) GenerateGo(pkg string) ([]byte, error) {
+	src, err := idl.GenerateGo(r.Schema, pkg)
+	if err != nil {
+		return nil, err
+	}
+	if len(r.Enums) == 0 {
+		return src, nil
+	}
+	b := bytes.NewBuffer(src)
+	for _, e := range r.Enums {
+		fmt.Fprintf(b, "\n// Values of proto enum %s.\nconst (\n", e.Name)
+		for _, v := range e.Values {
+			fmt.Fprintf(b, "\t%s_%s int32 = %d\n", idl.GoName(e.Name), v.Name, v.Number)
+		}
+		b.WriteString(")\n")
+	}
+	out, err := format.Source(b.Bytes())
+	if err != nil {
+		return nil, fmt.Errorf("protoimport: formatting generated code: %v", err)
+	}
+	return out, nil
+}
@@ -0,0 +1,548 @@
+package protoimport
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dadrian/relish/idl"
+)
+
+// File is a parsed .proto file.
+type File struct {
+	Name     string
+	Syntax   string // "proto2" or "proto3"
+	Package  string
+	Messages []*Message
+	Enums    []*Enum
+
+	notes []Note // constructs skipped while parsing
+}
+
+// Message is a message declaration.
+type Message struct {
+	Pos      idl.Pos
+	Name     string
+	Fields   []*Field
+	Oneofs   []*Oneof
+	Messages []*Message
+	Enums    []*Enum
+}
+
+// Field is a message field. Map fields have Type "map" and KeyType and
+// ValueType set.
+type Field struct {
+	Pos       idl.Pos
+	Label     string // "", "optional", "required" or "repeated"
+	Type      string
+	KeyType   string
+	ValueType string
+	Name      string
+	Number    int
+}
+
+// Oneof is a oneof group of fields.
+type Oneof struct {
+	Pos    idl.Pos
+	Name   string
+	Fields []*Field
+}
+
+// Enum is an enum declaration.
+type Enum struct {
+	Pos    idl.Pos
+	Name   string
+	Values []EnumValue
+}
+
+// EnumValue is a named enum constant.
+type EnumValue struct {
+	Name   string
+	Number int
+}
+
+// Parse parses the .proto source src. name is used in positions.
+// Declarations that have no Relish equivalent, such as services and
+// extensions, are skipped and recorded for Convert's report.
+func Parse(name string, src []byte) (*File, error) {
+	p := &parser{src: src, pos: idl.Pos{File: name, Line: 1, Col: 1}}
+	p.next()
+	f := &File{Name: name, Syntax: "proto2"}
+	p.file(f)
+	f.notes = p.notes
+	return f, p.errs.Err()
+}
+
+type tokKind int
+
+const (
+	tEOF tokKind = iota
+	tIdent
+	tInt
+	tFloat
+	tString
+	tPunct
+)
+
+type parser struct {
+	src   []byte
+	off   int
+	pos   idl.Pos
+	errs  idl.ErrorList
+	notes []Note
+
+	kind tokKind
+	lit  string
+	tpos idl.Pos
+}
+
+func (p *parser) errorf(pos idl.Pos, format string, args ...any) {
+	p.errs = append(p.errs, &idl.Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) note(pos idl.Pos, format string, args ...any) {
+	p.notes = append(p.notes, Note{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *parser) advance() {
+	r, n := utf8.DecodeRune(p.src[p.off:])
+	p.off += n
+	if r == '\n' {
+		p.pos.Line++
+		p.pos.Col = 1
+	} else {
+		p.pos.Col++
+	}
+}
+
+func (p *parser) peek(i int) byte {
+	if p.off+i < len(p.src) {
+		return p.src[p.off+i]
+	}
+	return 0
+}
+
+// next reads the next token, skipping white space and comments.
+func (p *parser) next() {
+	for p.off < len(p.src) {
+		c := p.src[p.off]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			p.advance()
+			continue
+		case c == '/' && p.peek(1) == '/':
+			for p.off < len(p.src) && p.src[p.off] != '\n' {
+				p.advance()
+			}
+			continue
+		case c == '/' && p.peek(1) == '*':
+			p.advance()
+			p.advance()
+			for p.off < len(p.src) && !(p.src[p.off] == '*' && p.peek(1) == '/') {
+				p.advance()
+			}
+			p.advance()
+			p.advance()
+			continue
+		}
+		break
+	}
+	p.tpos = p.pos
+	if p.off >= len(p.src) {
+		p.kind, p.lit = tEOF, ""
+		return
+	}
+	start := p.off
+	r, _ := utf8.DecodeRune(p.src[p.off:])
+	c := p.src[p.off]
+	switch {
+	case r == '_' || unicode.IsLetter(r):
+		for p.off < len(p.src) {
+			r, _ := utf8.DecodeRune(p.src[p.off:])
+			if r != '_' && !unicode.IsLetter(r) && !unicode.IsDigit(r) {
+				break
+			}
+			p.advance()
+		}
+		p.kind = tIdent
+	case c >= '0' && c <= '9' || c == '.' && p.peek(1) >= '0' && p.peek(1) <= '9':
+		p.kind = tInt
+		for p.off < len(p.src) {
+			c := p.src[p.off]
+			if c == '.' || (c == 'e' || c == 'E') && !strings.HasPrefix(string(p.src[start:p.off]), "0x") {
+				p.kind = tFloat
+				if (c == 'e' || c == 'E') && (p.peek(1) == '-' || p.peek(1) == '+') {
+					p.advance()
+				}
+			} else if c != '_' && !unicode.IsLetter(rune(c)) && !unicode.IsDigit(rune(c)) {
+				break
+			}
+			p.advance()
+		}
+	case c == '"' || c == '\'':
+		p.advance()
+		for p.off < len(p.src) && p.src[p.off] != c && p.src[p.off] != '\n' {
+			if p.src[p.off] == '\\' {
+				p.advance()
+			}
+			p.advance()
+		}
+		if p.off >= len(p.src) || p.src[p.off] != c {
+			p.errorf(p.tpos, "unterminated string")
+		}
+		p.advance()
+		p.kind = tString
+	default:
+		p.advance()
+		p.kind = tPunct
+	}
+	p.lit = string(p.src[start:p.off])
+}
+
+func (p *parser) is(lit string) bool {
+	return (p.kind == tIdent || p.kind == tPunct) && p.lit == lit
+}
+
+func (p *parser) got(lit string) bool {
+	if p.is(lit) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *parser) describe() string {
+	if p.kind == tEOF {
+		return "end of file"
+	}
+	return strconv.Quote(p.lit)
+}
+
+func (p *parser) expect(lit string) bool {
+	if p.got(lit) {
+		return true
+	}
+	p.errorf(p.tpos, "expected %q, found %s", lit, p.describe())
+	return false
+}
+
+func (p *parser) ident(what string) (string, bool) {
+	if p.kind != tIdent {
+		p.errorf(p.tpos, "expected %s, found %s", what, p.describe())
+		return "", false
+	}
+	s := p.lit
+	p.next()
+	return s, true
+}
+
+// fullIdent parses a dotted name, with a leading dot if it has one.
+func (p *parser) fullIdent(what string) (string, bool) {
+	var b strings.Builder
+	if p.got(".") {
+		b.WriteString(".")
+	}
+	for {
+		s, ok := p.ident(what)
+		if !ok {
+			return "", false
+		}
+		b.WriteString(s)
+		if !p.is(".") {
+			return b.String(), true
+		}
+		p.next()
+		b.WriteString(".")
+	}
+}
+
+// skipStatement skips to the end of the current statement: a semicolon,
+// or a braced block, at nesting depth zero.
+func (p *parser) skipStatement() {
+	depth := 0
+	for p.kind != tEOF {
+		switch {
+		case p.is("{"):
+			depth++
+		case p.is("}"):
+			depth--
+			if depth <= 0 {
+				p.next()
+				return
+			}
+		case p.is(";") && depth == 0:
+			p.next()
+			return
+		}
+		p.next()
+	}
+}
+
+func (p *parser) file(f *File) {
+	for p.kind != tEOF {
+		pos := p.tpos
+		switch {
+		case p.got(";"):
+		case p.got("syntax"):
+			if p.expect("=") && p.kind == tString {
+				f.Syntax, _ = strconv.Unquote(p.lit)
+				if f.Syntax != "proto2" && f.Syntax != "proto3" {
+					p.errorf(p.tpos, "unknown syntax %s", p.lit)
+				}
+			}
+			p.skipStatement()
+		case p.is("edition"):
+			p.errorf(pos, "editions are not supported; use syntax = \"proto3\"")
+			p.skipStatement()
+		case p.got("package"):
+			f.Package, _ = p.fullIdent("package name")
+			p.skipStatement()
+		case p.got("import"):
+			p.note(pos, "import %s not followed; pass the imported file too to use its types", p.lit)
+			p.skipStatement()
+		case p.is("option"):
+			p.option(pos)
+		case p.got("message"):
+			if m := p.message(pos); m != nil {
+				f.Messages = append(f.Messages, m)
+			}
+		case p.got("enum"):
+			if e := p.enum(pos); e != nil {
+				f.Enums = append(f.Enums, e)
+			}
+		case p.is("service"), p.is("extend"):
+			p.note(pos, "%s %s skipped: no Relish equivalent", p.lit, p.peekName())
+			p.skipStatement()
+		default:
+			p.errorf(pos, "unexpected %s", p.describe())
+			p.skipStatement()
+		}
+		if len(p.errs) > 0 && p.kind == tEOF {
+			return
+		}
+	}
+}
+
+// peekName returns the name after the current keyword, for notes. It does
+// not consume anything.
+func (p *parser) peekName() string {
+	save := *p
+	p.next()
+	name := p.lit
+	*p = save
+	return name
+}
+
+func (p *parser) option(pos idl.Pos) {
+	p.next()
+	name := p.lit
+	if p.got("(") {
+		name, _ = p.fullIdent("option name")
+		name = "(" + name + ")"
+	}
+	p.note(pos, "option %s ignored", name)
+	p.skipStatement()
+}
+
+func (p *parser) message(pos idl.Pos) *Message {
+	name, ok := p.ident("message name")
+	if !ok || !p.expect("{") {
+		p.skipStatement()
+		return nil
+	}
+	m := &Message{Pos: pos, Name: name}
+	for !p.got("}") {
+		if p.kind == tEOF {
+			p.errorf(p.tpos, "unexpected end of file in message %s", name)
+			return m
+		}
+		pos := p.tpos
+		switch {
+		case p.got(";"):
+		case p.is("option"):
+			p.option(pos)
+		case p.is("reserved"):
+			p.note(pos, "%s: reserved numbers and names not carried over", name)
+			p.skipStatement()
+		case p.is("extensions"), p.is("extend"):
+			p.note(pos, "%s: %s skipped: no Relish equivalent", name, p.lit)
+			p.skipStatement()
+		case p.got("message"):
+			if sub := p.message(pos); sub != nil {
+				m.Messages = append(m.Messages, sub)
+			}
+		case p.got("enum"):
+			if e := p.enum(pos); e != nil {
+				m.Enums = append(m.Enums, e)
+			}
+		case p.got("oneof"):
+			if o := p.oneof(pos, name); o != nil {
+				m.Oneofs = append(m.Oneofs, o)
+			}
+		default:
+			if f := p.field(pos, name, true); f != nil {
+				m.Fields = append(m.Fields, f)
+			}
+		}
+	}
+	return m
+}
+
+func (p *parser) oneof(pos idl.Pos, msg string) *Oneof {
+	name, ok := p.ident("oneof name")
+	if !ok || !p.expect("{") {
+		p.skipStatement()
+		return nil
+	}
+	o := &Oneof{Pos: pos, Name: name}
+	for !p.got("}") {
+		if p.kind == tEOF {
+			p.errorf(p.tpos, "unexpected end of file in oneof %s", name)
+			return o
+		}
+		pos := p.tpos
+		switch {
+		case p.got(";"):
+		case p.is("option"):
+			p.option(pos)
+		default:
+			if f := p.field(pos, msg, false); f != nil {
+				o.Fields = append(o.Fields, f)
+			}
+		}
+	}
+	return o
+}
+
+// field parses a field, or a map field, of message msg. Labels are only
+// allowed outside oneofs.
+func (p *parser) field(pos idl.Pos, msg string, labels bool) *Field {
+	f := &Field{Pos: pos}
+	if labels && (p.is("optional") || p.is("required") || p.is("repeated")) {
+		f.Label = p.lit
+		p.next()
+	}
+	if p.is("group") {
+		p.note(pos, "%s: group %s skipped: no Relish equivalent", msg, p.peekName())
+		p.skipStatement()
+		return nil
+	}
+	var ok bool
+	if p.got("map") {
+		f.Type = "map"
+		if !p.expect("<") {
+			p.skipStatement()
+			return nil
+		}
+		if f.KeyType, ok = p.fullIdent("map key type"); !ok || !p.expect(",") {
+			p.skipStatement()
+			return nil
+		}
+		if f.ValueType, ok = p.fullIdent("map value type"); !ok || !p.expect(">") {
+			p.skipStatement()
+			return nil
+		}
+	} else if f.Type, ok = p.fullIdent("field type"); !ok {
+		p.skipStatement()
+		return nil
+	}
+	if f.Name, ok = p.ident("field name"); !ok || !p.expect("=") {
+		p.skipStatement()
+		return nil
+	}
+	if p.kind != tInt {
+		p.errorf(p.tpos, "expected field number, found %s", p.describe())
+		p.skipStatement()
+		return nil
+	}
+	n, err := strconv.ParseInt(p.lit, 0, 32)
+	if err != nil {
+		p.errorf(p.tpos, "invalid field number %s", p.lit)
+		p.skipStatement()
+		return nil
+	}
+	f.Number = int(n)
+	p.next()
+	if p.got("[") {
+		for {
+			pos, name := p.tpos, p.lit
+			if p.got("(") {
+				name, _ = p.fullIdent("option name")
+				name = "(" + name + ")"
+				p.expect(")")
+			} else {
+				p.next()
+			}
+			p.note(pos, "%s.%s: field option %s ignored", msg, f.Name, name)
+			for !p.is(",") && !p.is("]") && p.kind != tEOF {
+				if p.is("{") {
+					p.skipStatement()
+					continue
+				}
+				p.next()
+			}
+			if !p.got(",") {
+				break
+			}
+		}
+		p.expect("]")
+	}
+	if !p.expect(";") {
+		p.skipStatement()
+		return nil
+	}
+	return f
+}
+
+func (p *parser) enum(pos idl.Pos) *Enum {
+	name, ok := p.ident("enum name")
+	if !ok || !p.expect("{") {
+		p.skipStatement()
+		return nil
+	}
+	e := &Enum{Pos: pos, Name: name}
+	for !p.got("}") {
+		if p.kind == tEOF {
+			p.errorf(p.tpos, "unexpected end of file in enum %s", name)
+			return e
+		}
+		pos := p.tpos
+		switch {
+		case p.got(";"):
+		case p.is("option"):
+			p.option(pos)
+		case p.is("reserved"):
+			p.note(pos, "%s: reserved numbers and names not carried over", name)
+			p.skipStatement()
+		default:
+			v := EnumValue{}
+			if v.Name, ok = p.ident("enum value name"); !ok || !p.expect("=") {
+				p.skipStatement()
+				continue
+			}
+			neg := p.got("-")
+			n, err := strconv.ParseInt(p.lit, 0, 32)
+			if p.kind != tInt || err != nil {
+				p.errorf(p.tpos, "expected enum value number, found %s", p.describe())
+				p.skipStatement()
+				continue
+			}
+			if neg {
+				n = -n
+			}
+			v.Number = int(n)
+			p.next()
+			if p.is("[") {
+				p.note(p.tpos, "%s.%s: value options ignored", name, v.Name)
+				for !p.is(";") && p.kind != tEOF {
+					p.next()
+				}
+			}
+			p.expect(";")
+			e.Values = append(e.Values, v)
+		}
+	}
+	return e
+}
@@ -0,0 +1,184 @@
+package protoimport
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const protoSrc = `// Orders.
+syntax = "proto3";
+
+package shop.v1;
+
+import "google/protobuf/timestamp.proto";
+
+option go_package = "example.com/shop";
+
+/* Block comment with message Fake {} inside. */
+message Order {
+  uint64 order_id = 1;
+  optional string note = 2;
+  repeated Line lines = 3;
+  map<string, int32> counts = 4 [deprecated = true];
+  Status status = 5;
+  google.protobuf.Timestamp at = 6;
+  Order parent = 7;
+  oneof payment {
+    string card = 9;
+    Cash cash = 8;
+  }
+  reserved 10 to 12;
+
+  message Cash {
+    bytes note = 1;
+  }
+
+  enum Status {
+    STATUS_UNKNOWN = 0;
+    STATUS_PAID = 1;
+  }
+}
+
+message Line {
+  string sku = 1;
+  sint64 qty = 2;
+  .shop.v1.Order.Status status = 3;
+}
+
+service Orders {
+  rpc Get(Order) returns (Order) { option idempotency_level = NO_SIDE_EFFECTS; }
+}
+`
+
+func TestConvert(t *testing.T) {
+	f, err := Parse("order.proto", []byte(protoSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Convert(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range res.Schema.Decls {
+		for _, m := range d.Members {
+			opt := ""
+			if m.Optional {
+				opt = "optional "
+			}
+			got = append(got, d.Kind()+" "+d.Name+"."+m.Name+" "+strconv.Itoa(m.ID)+": "+opt+m.Type.String())
+		}
+	}
+	want := []string{
+		"struct Order.order_id 1: u64",
+		"struct Order.note 2: optional string",
+		"struct Order.lines 3: array<Line>",
+		"struct Order.counts 4: map<string, i32>",
+		"struct Order.status 5: i32",
+		"struct Order.at 6: optional timestamp",
+		"struct Order.parent 7: optional Order",
+		"struct Order.payment 8: optional Order_payment",
+		"enum Order_payment.cash 8: Order_Cash",
+		"enum Order_payment.card 9: string",
+		"struct Order_Cash.note 1: array<u8>",
+		"struct Line.sku 1: string",
+		"struct Line.qty 2: i64",
+		"struct Line.status 3: i32",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Convert =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+
+	var notes []string
+	for _, n := range res.Notes {
+		notes = append(notes, n.String())
+	}
+	wantNotes := []string{
+		`order.proto:6:1: import "google/protobuf/timestamp.proto" not followed; pass the imported file too to use its types`,
+		"order.proto:8:1: option go_package ignored",
+		"order.proto:15:34: Order.counts: field option deprecated ignored",
+		"order.proto:17:3: google.protobuf.Timestamp becomes timestamp, which drops nanoseconds",
+		"order.proto:19:3: oneof Order.payment becomes enum Order_payment at field ID 8, its lowest field number",
+		"order.proto:23:3: Order: reserved numbers and names not carried over",
+		"order.proto:29:3: enum Order_Status becomes i32; Relish enums are tagged unions, not named integers",
+		"order.proto:41:1: service Orders skipped: no Relish equivalent",
+	}
+	if !reflect.DeepEqual(notes, wantNotes) {
+		t.Errorf("Notes =\n%s\nwant\n%s", strings.Join(notes, "\n"), strings.Join(wantNotes, "\n"))
+	}
+
+	src, err := res.GenerateGo("shop")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"OrderID uint64 ", "Note    *string ", "Payment *OrderPayment ",
+		"Cash *OrderCash `relish:\"8,optional\"`", "Note []uint8 ",
+		"OrderStatus_STATUS_PAID    int32 = 1",
+	} {
+		if !strings.Contains(string(src), line) {
+			t.Errorf("generated Go lacks %q:\n%s", line, src)
+		}
+	}
+}
+
+func TestConvert_Proto2(t *testing.T) {
+	f, err := Parse("x.proto", []byte(`syntax = "proto2";
+message A {
+  required int32 a = 1;
+  optional int32 b = 2 [default = 7];
+}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	res, err := Convert(f)
+	if err != nil {
+		t.Fatal(err)
+	}
+	m := res.Schema.Decls[0].Members
+	if m[0].Optional || !m[1].Optional {
+		t.Errorf("optional = %v, %v; want false, true", m[0].Optional, m[1].Optional)
+	}
+	if len(res.Notes) != 1 || res.Notes[0].Msg != "A.b: field option default ignored" {
+		t.Errorf("Notes = %v", res.Notes)
+	}
+}
+
+func TestConvert_Errors(t *testing.T) {
+	for _, tc := range []struct{ src, want string }{
+		{"message A {\n  int32 x = 128;\n}", "x.proto:2:3: A.x: field number 128 out of range; Relish field IDs must be 0 to 127"},
+		{"message A {\n  oneof o { int32 x = 200; }\n}", "x.proto:2:13: A.x: field number 200 out of range; Relish field IDs must be 0 to 127"},
+		{"message A {\n  B b = 1;\n}", "x.proto:2:3: undefined type B"},
+		{"message A {\n  google.protobuf.Any any = 1;\n}", "x.proto:2:3: google.protobuf.Any has no Relish equivalent"},
+		{"message A {\n  required A a = 1;\n}", "x.proto:1:1: struct A contains itself through required fields .a"},
+		{"syntax = \"proto3\";\nmessage Wrapper {\n  oneof kind { string s = 1; int32 i = 2; }\n}",
+			"x.proto:2:1: message Wrapper: every field is optional in Relish, and Go encodes such a struct as an enum when exactly one field is set"},
+		{"syntax = \"proto3\";\nmessage Pair {\n  Pair a = 1;\n  Pair b = 2;\n}",
+			"x.proto:2:1: message Pair: every field is optional in Relish, and Go encodes such a struct as an enum when exactly one field is set"},
+	} {
+		f, err := Parse("x.proto", []byte(tc.src))
+		if err == nil {
+			_, err = Convert(f)
+		}
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("Convert(%q) = %v, want %s", tc.src, err, tc.want)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, tc := range []struct{ src, want string }{
+		{"message A {\n  int32 x = ;\n}", "x.proto:2:13: expected field number, found \";\""},
+		{"message A {\n  int32 = 1;\n}", "x.proto:2:9: expected field name, found \"=\""},
+		{"message A {", "x.proto:1:12: unexpected end of file in message A"},
+		{`syntax = "proto4";`, `x.proto:1:10: unknown syntax "proto4"`},
+		{"edition = \"2023\";", `x.proto:1:1: editions are not supported; use syntax = "proto3"`},
+	} {
+		_, err := Parse("x.proto", []byte(tc.src))
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("Parse(%q) = %v, want %s", tc.src, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,401 @@
+package relish
+
+import (
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+
+	intr "github.com/dadrian/relish/internal"
+)
+
+// Query returns the values in data selected by path, in encoding order.
+// A path is a sequence of segments:
+//
+//	.N      struct field with ID N
+//	<N>     enum variant with ID N
+//	[i]     array element i
+//	{key}   map entry under key: a quoted string, an integer or a bool
+//	{#i}    map entry i, in encoding order
+//	.*      every struct field (or the variant of an enum)
+//	[*]     every array element
+//	{*}     every map value
+//
+// For example .3.1[2] is element 2 of field 1 of field 3, and
+// .4[*].0 is field 0 of every element of the array at field 4.
+// The leading dot may be omitted. A field segment applied to an enum
+// selects the variant with that ID, so .2.1 also matches .2<1>. A path
+// that selects nothing returns no values and no error.
+func Query(data []byte, path string) ([]View, error) {
+	return QueryNamed(data, path, nil)
+}
+
+// QueryNamed is like Query, but also accepts field and variant names, as
+// in .Order.Items[2].Sku, wherever the path would otherwise give an ID.
+// The schema is a reflect.Type, whose Go field names are used, or a
+// Schema, whose FieldDesc names are. Names resolve through nested
+// structs, pointers, slices and maps of a reflect.Type, and through the
+// fields, variants, array elements and map values of a Schema.
+func QueryNamed(data []byte, path string, schema any) ([]View, error) {
+	segs, err := parsePath(path)
+	if err != nil {
+		return nil, err
+	}
+	switch s := schema.(type) {
+	case nil:
+	case reflect.Type:
+		err = resolveNames(segs, s)
+	case Schema:
+		err = resolveSchemaNames(segs, s)
+	default:
+		err = &Error{Kind: ErrInvalidValue, Detail: fmt.Sprintf("QueryNamed schema must be a reflect.Type or a Schema, not %T", schema)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	v, err := NewView(data)
+	if err != nil {
+		return nil, err
+	}
+	return queryView(v, segs, nil), nil
+}
+
+func queryView(v View, segs []pathSeg, out []View) []View {
+	if len(segs) == 0 {
+		return append(out, v)
+	}
+	s, rest := segs[0], segs[1:]
+	// Arrays and maps too short to hold their element types match
+	// nothing, as View's accessors report them absent.
+	switch {
+	case s.kind == segField && v.t == TypeStruct:
+		if !s.wild {
+			if f, ok := v.Field(s.id); ok {
+				out = queryView(f, rest, out)
+			}
+			return out
+		}
+		for p := v.c; len(p) > 0; {
+			t, c, next, err := splitValue(p[1:])
+			if err != nil {
+				break
+			}
+			out = queryView(View{t: TypeID(t), c: c, valid: true}, rest, out)
+			p = next
+		}
+	case (s.kind == segField || s.kind == segVariant) && v.t == TypeEnum:
+		if id, val := v.Variant(); val.Valid() && (s.wild || id == s.id) {
+			out = queryView(val, rest, out)
+		}
+	case s.kind == segIndex && v.t == TypeArray && len(v.c) >= 1:
+		if !s.wild {
+			if e, ok := v.Index(s.index); ok {
+				out = queryView(e, rest, out)
+			}
+			return out
+		}
+		et := TypeID(v.c[0])
+		for _, c := range splitElems(v.c[0], v.c[1:]) {
+			out = queryView(View{t: et, c: c, valid: true}, rest, out)
+		}
+	case s.kind == segKey && v.t == TypeMap && len(v.c) >= 2:
+		kt, vt := v.c[0], v.c[1]
+		for i, p := 0, v.c[2:]; len(p) > 0; i++ {
+			kc, vc, next, err := splitEntry(kt, vt, p)
+			if err != nil {
+				break
+			}
+			if s.wild || s.matchKey(kt, kc, i) {
+				out = queryView(View{t: TypeID(vt), c: vc, valid: true}, rest, out)
+			}
+			p = next
+		}
+	}
+	return out
+}
+
+// parsePath parses a path expression into segments. Names are left for
+// resolveNames.
+func parsePath(path string) ([]pathSeg, error) {
+	p := &pathParser{s: path}
+	var segs []pathSeg
+	for p.i < len(p.s) {
+		seg, err := p.segment(len(segs) == 0)
+		if err != nil {
+			return nil, err
+		}
+		segs = append(segs, seg)
+	}
+	return segs, nil
+}
+
+type pathParser struct {
+	s string
+	i int
+}
+
+func (p *pathParser) errorf(format string, args ...any) error {
+	return &Error{Offset: int64(p.i), Kind: ErrSyntax, Detail: fmt.Sprintf("path %q: ", p.s) + fmt.Sprintf(format, args...)}
+}
+
+func (p *pathParser) segment(first bool) (pathSeg, error) {
+	switch c := p.s[p.i]; {
+	case c == '.':
+		p.i++
+		return p.fieldRef(segField, true)
+	case c == '<':
+		p.i++
+		seg, err := p.fieldRef(segVariant, false)
+		if err != nil {
+			return seg, err
+		}
+		return seg, p.expect('>')
+	case c == '[':
+		p.i++
+		seg := pathSeg{kind: segIndex}
+		if p.peek('*') {
+			seg.wild = true
+		} else {
+			n, err := p.number()
+			if err != nil {
+				return seg, err
+			}
+			seg.index = n
+		}
+		return seg, p.expect(']')
+	case c == '{':
+		p.i++
+		seg, err := p.key()
+		if err != nil {
+			return seg, err
+		}
+		return seg, p.expect('}')
+	case first:
+		// The leading dot is optional.
+		return p.fieldRef(segField, true)
+	}
+	return pathSeg{}, p.errorf("unexpected %q", p.s[p.i])
+}
+
+// fieldRef parses a field or variant ID or name, or a wildcard.
+func (p *pathParser) fieldRef(kind segKind, wildOK bool) (pathSeg, error) {
+	seg := pathSeg{kind: kind}
+	if wildOK && p.peek('*') {
+		seg.wild = true
+		return seg, nil
+	}
+	if p.i < len(p.s) && isDigit(p.s[p.i]) {
+		n, err := p.number()
+		if err != nil {
+			return seg, err
+		}
+		if n >= 0x80 {
+			return seg, p.errorf("id %d out of range", n)
+		}
+		seg.id = byte(n)
+		return seg, nil
+	}
+	start := p.i
+	for p.i < len(p.s) && (p.s[p.i] == '_' || unicode.IsLetter(rune(p.s[p.i])) || isDigit(p.s[p.i])) {
+		p.i++
+	}
+	if p.i == start {
+		return seg, p.errorf("expected field id or name")
+	}
+	seg.name = p.s[start:p.i]
+	return seg, nil
+}
+
+func (p *pathParser) key() (pathSeg, error) {
+	seg := pathSeg{kind: segKey}
+	switch {
+	case p.peek('*'):
+		seg.wild = true
+		return seg, nil
+	case p.peek('#'):
+		n, err := p.number()
+		seg.index = n
+		return seg, err
+	case p.i < len(p.s) && p.s[p.i] == '"':
+		rest := p.s[p.i:]
+		q, err := strconv.QuotedPrefix(rest)
+		if err != nil {
+			return seg, p.errorf("bad string literal")
+		}
+		v, _ := strconv.Unquote(q)
+		p.i += len(q)
+		seg.key = strconv.Quote(v)
+		return seg, nil
+	}
+	start := p.i
+	for p.i < len(p.s) && p.s[p.i] != '}' {
+		p.i++
+	}
+	lit := strings.TrimSpace(p.s[start:p.i])
+	switch {
+	case lit == "true" || lit == "false":
+		seg.key = lit
+	case strings.HasPrefix(lit, "-"):
+		n, err := strconv.ParseInt(lit, 10, 64)
+		if err != nil {
+			p.i = start
+			return seg, p.errorf("bad integer key %q", lit)
+		}
+		seg.key = strconv.FormatInt(n, 10)
+	default:
+		n, err := strconv.ParseUint(lit, 10, 64)
+		if err != nil {
+			p.i = start
+			return seg, p.errorf("bad key %q", lit)
+		}
+		seg.key = strconv.FormatUint(n, 10)
+	}
+	return seg, nil
+}
+
+func (p *pathParser) number() (int, error) {
+	start := p.i
+	for p.i < len(p.s) && isDigit(p.s[p.i]) {
+		p.i++
+	}
+	n, err := strconv.Atoi(p.s[start:p.i])
+	if err != nil {
+		p.i = start
+		return 0, p.errorf("expected number")
+	}
+	return n, nil
+}
+
+// peek consumes c if it is next.
+func (p *pathParser) peek(c byte) bool {
+	if p.i < len(p.s) && p.s[p.i] == c {
+		p.i++
+		return true
+	}
+	return false
+}
+
+func (p *pathParser) expect(c byte) error {
+	if !p.peek(c) {
+		return p.errorf("expected %q", c)
+	}
+	return nil
+}
+
+func isDigit(c byte) bool { return c >= '0' && c <= '9' }
+
+// resolveNames replaces field and variant names in segs with the IDs of
+// the matching fields of rt, following rt down the path.
+func resolveNames(segs []pathSeg, rt reflect.Type) error {
+	for i := range segs {
+		s := &segs[i]
+		for rt != nil && rt.Kind() == reflect.Pointer {
+			rt = rt.Elem()
+		}
+		switch {
+		case s.wild:
+			rt = elemType(rt, s.kind)
+		case s.kind == segField || s.kind == segVariant:
+			if s.name == "" {
+				_, rt = fieldByID(rt, s.id)
+				continue
+			}
+			id, ft, ok := fieldByName(rt, s.name)
+			if !ok {
+				return &Error{Kind: ErrPathNotFound, Path: formatPath(segs[:i+1]), Detail: fmt.Sprintf("no field named %q", s.name)}
+			}
+			s.id, s.name, rt = id, "", ft
+		default:
+			rt = elemType(rt, s.kind)
+		}
+	}
+	return nil
+}
+
+// resolveSchemaNames is resolveNames for the field and variant names of
+// schema s.
+func resolveSchemaNames(segs []pathSeg, s Schema) error {
+	for i := range segs {
+		seg := &segs[i]
+		switch {
+		case seg.wild:
+			s = elemSchema(s, seg.kind)
+		case seg.kind == segField || seg.kind == segVariant:
+			f, ok := memberSchema(s, seg.id, seg.name)
+			if !ok && seg.name != "" {
+				return &Error{Kind: ErrPathNotFound, Path: formatPath(segs[:i+1]), Detail: fmt.Sprintf("no field named %q", seg.name)}
+			}
+			if ok {
+				seg.id = f.ID
+			}
+			seg.name, s = "", f.Type
+		default:
+			s = elemSchema(s, seg.kind)
+		}
+	}
+	return nil
+}
+
+// memberSchema returns the field or variant of s named name, or with ID
+// id if name is empty.
+func memberSchema(s Schema, id byte, name string) (FieldDesc, bool) {
+	var members []FieldDesc
+	switch d := s.(type) {
+	case *StructDesc:
+		members = d.Fields
+	case *EnumDesc:
+		members = d.Variants
+	}
+	for _, f := range members {
+		if name == "" && f.ID == id || name != "" && f.Name == name {
+			return f, true
+		}
+	}
+	return FieldDesc{}, false
+}
+
+// elemSchema returns the schema reached from s by an index or key
+// segment, or nil if it is not known.
+func elemSchema(s Schema, kind segKind) Schema {
+	switch d := s.(type) {
+	case *ArrayDesc:
+		if kind == segIndex {
+			return d.Elem
+		}
+	case *MapDesc:
+		if kind == segKey {
+			return d.Value
+		}
+	}
+	return nil
+}
+
+// elemType returns the type reached from rt by an index or key segment,
+// or nil if it is not known.
+func elemType(rt reflect.Type, kind segKind) reflect.Type {
+	if rt == nil {
+		return nil
+	}
+	switch {
+	case kind == segIndex && (rt.Kind() == reflect.Slice || rt.Kind() == reflect.Array):
+		return rt.Elem()
+	case kind == segKey && rt.Kind() == reflect.Map:
+		return rt.Elem()
+	}
+	return nil
+}
+
+// fieldByName returns the relish ID and type of the tagged field of
+// struct type rt with the given Go name.
+func fieldByName(rt reflect.Type, name string) (byte, reflect.Type, bool) {
+	if rt == nil || rt.Kind() != reflect.Struct {
+		return 0, nil, false
+	}
+	f, ok := rt.FieldByName(name)
+	if !ok {
+		return 0, nil, false
+	}
+	id, _, _, ok := intr.ParseRelishTag(f)
+	return byte(id), f.Type, ok
+}
@@ -0,0 +1,138 @@
+package relish
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	type Item struct {
+		Sku string `relish:"0"`
+		Qty uint32 `relish:"1"`
+	}
+	type Shape struct {
+		Circle *uint32 `relish:"0,optional"`
+		Rect   *string `relish:"1,optional"`
+	}
+	type Order struct {
+		Items []Item           `relish:"1"`
+		Attrs map[string]uint8 `relish:"3"`
+		Shape Shape            `relish:"4"`
+	}
+	type Envelope struct {
+		Order Order `relish:"2"`
+	}
+	data, err := Marshal(Envelope{Order: Order{
+		Items: []Item{{"a", 1}, {"b", 2}, {"c", 3}},
+		Attrs: map[string]uint8{"k": 9},
+		Shape: Shape{Circle: ptr(uint32(5))},
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	str := func(v View) any { s, _ := v.Str(); return s }
+	u32 := func(v View) any { n, _ := v.U32(); return n }
+	u8 := func(v View) any { n, _ := v.U8(); return n }
+	cases := []struct {
+		path string
+		get  func(View) any
+		want []any
+	}{
+		{".2.1[2].0", str, []any{"c"}},
+		{"2.1[*].1", u32, []any{uint32(1), uint32(2), uint32(3)}},
+		{`.2.3{"k"}`, u8, []any{uint8(9)}},
+		{`.2.3{#0}`, u8, []any{uint8(9)}},
+		{`.2.3{"missing"}`, u8, nil},
+		{".2.4<0>", u32, []any{uint32(5)}},
+		{".2.4.0", u32, []any{uint32(5)}},
+		{".2.4<1>", u32, nil},
+		{".2.1[7]", u32, nil},
+	}
+	for _, c := range cases {
+		vs, err := Query(data, c.path)
+		if err != nil {
+			t.Fatalf("Query(%q): %v", c.path, err)
+		}
+		var got []any
+		for _, v := range vs {
+			got = append(got, c.get(v))
+		}
+		if !reflect.DeepEqual(got, c.want) {
+			t.Fatalf("Query(%q) = %v, want %v", c.path, got, c.want)
+		}
+	}
+
+	vs, err := QueryNamed(data, ".Order.Items[1].Sku", reflect.TypeOf(Envelope{}))
+	if err != nil || len(vs) != 1 || str(vs[0]) != "b" {
+		t.Fatalf("QueryNamed = %v, %v", vs, err)
+	}
+	vs, err = QueryNamed(data, ".Order.Shape<Circle>", reflect.TypeOf(Envelope{}))
+	if err != nil || len(vs) != 1 || u32(vs[0]) != uint32(5) {
+		t.Fatalf("QueryNamed variant = %v, %v", vs, err)
+	}
+	if _, err := QueryNamed(data, ".Order.Nope", reflect.TypeOf(Envelope{})); err == nil {
+		t.Fatalf("expected error for unknown field name")
+	}
+
+	// A Schema resolves names through its FieldDesc names.
+	s, err := SchemaOf(reflect.TypeOf(Envelope{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	vs, err = QueryNamed(data, ".Order.Items[*].Sku", s)
+	if err != nil || len(vs) != 3 || str(vs[2]) != "c" {
+		t.Fatalf("QueryNamed with a Schema = %v, %v", vs, err)
+	}
+	vs, err = QueryNamed(data, ".2.Shape<Circle>", s)
+	if err != nil || len(vs) != 1 || u32(vs[0]) != uint32(5) {
+		t.Fatalf("QueryNamed variant with a Schema = %v, %v", vs, err)
+	}
+	attrs := &StructDesc{Fields: []FieldDesc{{ID: 2, Name: "order", Type: &StructDesc{Fields: []FieldDesc{
+		{ID: 3, Name: "attrs", Type: &MapDesc{Key: PrimitiveDesc{Type: TypeString}, Value: PrimitiveDesc{Type: TypeU8}}},
+	}}}}}
+	vs, err = QueryNamed(data, `.order.attrs{"k"}`, attrs)
+	if err != nil || len(vs) != 1 || u8(vs[0]) != uint8(9) {
+		t.Fatalf("QueryNamed with a hand-written Schema = %v, %v", vs, err)
+	}
+	if _, err := QueryNamed(data, ".order.Items", attrs); err == nil {
+		t.Fatalf("expected error for a name the Schema lacks")
+	}
+	if _, err := QueryNamed(data, ".Order", Envelope{}); err == nil {
+		t.Fatalf("expected error for a schema that is neither a reflect.Type nor a Schema")
+	}
+}
+
+func TestParsePath_Errors(t *testing.T) {
+	for _, p := range []string{".", ".128", "[x]", "{", `{"a}`, ".1[2", "<*>", "]"} {
+		_, err := parsePath(p)
+		if e, ok := err.(*Error); !ok || e.Kind != ErrSyntax {
+			t.Fatalf("parsePath(%q) = %v, want syntax error", p, err)
+		}
+	}
+	segs, err := parsePath(`.1<2>[3]{"x"}{-4}{#5}.*[*]{*}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := formatPath(segs); got != `.1<2>[3]{"x"}{-4}{#5}.*[*]{*}` {
+		t.Fatalf("round trip = %s", got)
+	}
+}
+
+func TestQuery_Malformed(t *testing.T) {
+	// Containers cut short before their element types match nothing.
+	cases := []struct {
+		data []byte
+		path string
+	}{
+		{[]byte{0x10, 0x00}, "{*}"},
+		{[]byte{0x0F, 0x00}, "[*]"},
+		{[]byte{0x10, 0x02, 0x0E}, `{"a"}`},
+		{[]byte{0x0F, 0x04, 0x00, 0x01}, "[*]"},
+	}
+	for _, c := range cases {
+		vs, err := Query(c.data, c.path)
+		if err != nil || len(vs) != 0 {
+			t.Errorf("Query(%x, %q) = %v, %v", c.data, c.path, vs, err)
+		}
+	}
+}
@@ -0,0 +1,106 @@
+package relish
+
+import (
+	"fmt"
+
+	intr "github.com/dadrian/relish/internal"
+)
+
+// Helpers for working on encoded values in place. They check framing
+// only; callers that need the full set of parsing requirements run
+// Validate first.
+
+// splitValue splits the TLV at the start of b into its type ID, its
+// content bytes and whatever follows it.
+func splitValue(b []byte) (byte, []byte, []byte, error) {
+	t, hdr, n, err := intr.SplitTLV(b)
+	if err != nil {
+		return 0, nil, nil, framingError(err)
+	}
+	if n > len(b)-hdr {
+		return 0, nil, nil, &Error{Kind: ErrUnexpectedEOF, Detail: "value extends past end of input"}
+	}
+	return t, b[hdr : hdr+n], b[hdr+n:], nil
+}
+
+// splitElem splits an array element of type t (laid out without a type
+// byte) from the start of b, which must not be empty. Elements of a
+// zero-size type such as null take no bytes, so an array of them has no
+// elements and b holds bytes that belong to none.
+func splitElem(t byte, b []byte) ([]byte, []byte, error) {
+	if intr.IsZeroSize(t) {
+		return nil, nil, &Error{Kind: ErrInvalidValue, Detail: fmt.Sprintf("%d bytes after %v elements, which take none", len(b), TypeID(t))}
+	}
+	return measureElem(t, b)
+}
+
+// splitEntry splits a map entry with key type kt and value type vt from the
+// start of b, which must not be empty, and returns the key and value
+// content. As with splitElem, an entry whose key and value both have
+// zero-size types takes no bytes and cannot start b.
+func splitEntry(kt, vt byte, b []byte) ([]byte, []byte, []byte, error) {
+	if intr.IsZeroSize(kt) && intr.IsZeroSize(vt) {
+		return nil, nil, nil, &Error{Kind: ErrInvalidValue, Detail: fmt.Sprintf("%d bytes after %v-to-%v entries, which take none", len(b), TypeID(kt), TypeID(vt))}
+	}
+	kc, r, err := measureElem(kt, b)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	vc, rest, err := measureElem(vt, r)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	return kc, vc, rest, nil
+}
+
+// measureElem splits a value of type t laid out without a type byte from
+// the start of b.
+func measureElem(t byte, b []byte) ([]byte, []byte, error) {
+	hdr, n, err := intr.SplitElem(t, b)
+	if err != nil {
+		return nil, nil, framingError(err)
+	}
+	if n > len(b)-hdr {
+		return nil, nil, &Error{Kind: ErrUnexpectedEOF, Detail: "element extends past end of input"}
+	}
+	return b[hdr : hdr+n], b[hdr+n:], nil
+}
+
+func framingError(err error) error {
+	switch {
+	case err == intr.ErrShortBuffer:
+		return &Error{Kind: ErrUnexpectedEOF, Detail: err.Error()}
+	case err == intr.ErrUnknownType, intr.IsInvalidType(err):
+		return &Error{Kind: ErrInvalidTypeID, Detail: err.Error()}
+	default:
+		return &Error{Kind: ErrLengthOverflow, Detail: err.Error()}
+	}
+}
+
+// appendLen appends the tagged-varint encoding of n.
+func appendLen(dst []byte, n int) []byte {
+	var tmp [4]byte
+	return append(dst, tmp[:intr.EncodeLen(tmp[:], n)]...)
+}
+
+// appendElem appends content as an element of type t: prefixed by its
+// length for varsize types and raw otherwise.
+func appendElem(dst []byte, t byte, content []byte) []byte {
+	if intr.IsVarSize(t) {
+		dst = appendLen(dst, len(content))
+	}
+	return append(dst, content...)
+}
+
+// appendValue appends a complete TLV of type t with the given content.
+func appendValue(dst []byte, t byte, content []byte) []byte {
+	return appendElem(append(dst, t), t, content)
+}
+
+// firstError returns the first of errs as an error, or nil.
+func firstError(errs []*Error) error {
+	if len(errs) == 0 {
+		return nil
+	}
+	return errs[0]
+}
@@ -0,0 +1,24 @@
+package relish
+
+import "testing"
+
+func TestSplitElem_ZeroSize(t *testing.T) {
+	// array<null> with a byte after the element type: nulls take no
+	// bytes, so the byte belongs to no element.
+	data := []byte{0x0F, 0x04, 0x00, 0x01}
+	_, c, _, err := splitValue(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := splitElem(c[0], c[1:]); err == nil || err.(*Error).Kind != ErrInvalidValue {
+		t.Fatalf("splitElem: got %v, want ErrInvalidValue", err)
+	}
+	if _, _, _, err := splitEntry(0x00, 0x00, []byte{0x01}); err == nil || err.(*Error).Kind != ErrInvalidValue {
+		t.Fatalf("splitEntry of null-to-null: got %v, want ErrInvalidValue", err)
+	}
+	// A null key is fine as long as the value takes bytes.
+	kc, vc, rest, err := splitEntry(0x00, 0x02, []byte{0x05})
+	if err != nil || len(kc) != 0 || string(vc) != "\x05" || len(rest) != 0 {
+		t.Fatalf("splitEntry of null-to-u8 = %x, %x, %x, %v", kc, vc, rest, err)
+	}
+}
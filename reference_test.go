@@ -3,6 +3,7 @@ package relish
 import (
 	"bytes"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -28,7 +29,11 @@ func assertRoundtrip(t *testing.T, expected any, b []byte) {
 		t.Fatalf("encode failed: %v", err)
 	}
 	if !bytes.Equal(enc, b) {
-		t.Fatalf("encoded bytes mismatch:\n got: %v\nwant: %v", enc, b)
+		var report strings.Builder
+		if changes, err := Diff(b, enc); err == nil {
+			_ = FormatDiff(&report, changes, reflect.TypeOf(expected))
+		}
+		t.Fatalf("encoded bytes mismatch:\n got: %v\nwant: %v\n%s", enc, b, report.String())
 	}
 }
 
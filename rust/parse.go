@@ -0,0 +1,689 @@
+package rust
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/dadrian/relish/idl"
+)
+
+// Parse reads the structs and enums deriving Relish from the Rust source
+// file src, including those in inline modules, and returns them as a
+// schema file. Other items are skipped. name is used in positions.
+//
+// Each field and variant needs a #[relish(field_id = N)] attribute.
+// Option<T> fields are optional; Box, Rc and Arc are looked through;
+// Vec, VecDeque and slices are arrays; HashMap and BTreeMap are maps;
+// SystemTime, DateTime and relish's Timestamp are timestamps; unit
+// variants hold null. Generic types, tuple structs and enum variants with
+// named or several fields have no Relish equivalent and are errors, as
+// are structs whose fields are all Options, which idl.Check rejects.
+//
+// The parser knows only enough Rust to find these items; it does not
+// check that the rest of the file is valid.
+func Parse(name string, src []byte) (*idl.File, error) {
+	p := &rsParser{lx: lexer{src: src, pos: idl.Pos{File: name, Line: 1, Col: 1}}}
+	p.next()
+	f := &idl.File{Name: name}
+	p.items(f, false)
+	return f, p.errs.Err()
+}
+
+type tokKind int
+
+const (
+	tEOF tokKind = iota
+	tIdent
+	tLifetime
+	tLiteral
+	tPunct // one character, or "::"
+)
+
+type token struct {
+	kind tokKind
+	lit  string
+	pos  idl.Pos
+}
+
+// lexer splits Rust source into tokens. Comments, including nested block
+// comments, are skipped.
+type lexer struct {
+	src []byte
+	off int
+	pos idl.Pos
+}
+
+func (lx *lexer) peekByte(i int) byte {
+	if lx.off+i < len(lx.src) {
+		return lx.src[lx.off+i]
+	}
+	return 0
+}
+
+// advance moves past n runes.
+func (lx *lexer) advance(n int) {
+	for ; n > 0 && lx.off < len(lx.src); n-- {
+		r, size := utf8.DecodeRune(lx.src[lx.off:])
+		lx.off += size
+		if r == '\n' {
+			lx.pos.Line++
+			lx.pos.Col = 1
+		} else {
+			lx.pos.Col++
+		}
+	}
+}
+
+func (lx *lexer) skipSpace() {
+	for lx.off < len(lx.src) {
+		c := lx.src[lx.off]
+		switch {
+		case c == ' ' || c == '\t' || c == '\r' || c == '\n':
+			lx.advance(1)
+		case c == '/' && lx.peekByte(1) == '/':
+			for lx.off < len(lx.src) && lx.src[lx.off] != '\n' {
+				lx.advance(1)
+			}
+		case c == '/' && lx.peekByte(1) == '*':
+			lx.advance(2)
+			for depth := 1; depth > 0 && lx.off < len(lx.src); {
+				switch {
+				case lx.src[lx.off] == '/' && lx.peekByte(1) == '*':
+					depth++
+					lx.advance(2)
+				case lx.src[lx.off] == '*' && lx.peekByte(1) == '/':
+					depth--
+					lx.advance(2)
+				default:
+					lx.advance(1)
+				}
+			}
+		default:
+			return
+		}
+	}
+}
+
+func isIdentRune(r rune) bool { return r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r) }
+
+func (lx *lexer) next() token {
+	lx.skipSpace()
+	t := token{pos: lx.pos}
+	if lx.off >= len(lx.src) {
+		return t
+	}
+	start := lx.off
+	r, _ := utf8.DecodeRune(lx.src[lx.off:])
+	c := lx.src[lx.off]
+	switch {
+	case c == 'r' && lx.peekByte(1) == '#' && (lx.peekByte(2) == '"' || lx.peekByte(2) == '#'),
+		c == 'r' && lx.peekByte(1) == '"',
+		c == 'b' && lx.peekByte(1) == 'r' && (lx.peekByte(2) == '"' || lx.peekByte(2) == '#'):
+		lx.rawString()
+		t.kind = tLiteral
+	case c == 'b' && (lx.peekByte(1) == '"' || lx.peekByte(1) == '\''):
+		lx.advance(1)
+		lx.quoted(lx.src[lx.off])
+		t.kind = tLiteral
+	case c == 'r' && lx.peekByte(1) == '#':
+		lx.advance(2)
+		lx.ident()
+		t.kind = tIdent
+		t.lit = string(lx.src[start+2 : lx.off])
+		return t
+	case r == '_' || unicode.IsLetter(r):
+		lx.ident()
+		t.kind = tIdent
+	case c >= '0' && c <= '9':
+		for lx.off < len(lx.src) && (isIdentRune(rune(lx.src[lx.off])) || lx.src[lx.off] == '.' && lx.peekByte(1) >= '0' && lx.peekByte(1) <= '9') {
+			lx.advance(1)
+		}
+		t.kind = tLiteral
+	case c == '"':
+		lx.quoted('"')
+		t.kind = tLiteral
+	case c == '\'':
+		// A char literal closes within a few bytes; a lifetime does not.
+		if lx.peekByte(1) == '\\' || lx.peekByte(2) == '\'' || r2(lx.src[lx.off+1:]) {
+			lx.quoted('\'')
+			t.kind = tLiteral
+		} else {
+			lx.advance(1)
+			lx.ident()
+			t.kind = tLifetime
+		}
+	case c == ':' && lx.peekByte(1) == ':':
+		lx.advance(2)
+		t.kind = tPunct
+	default:
+		lx.advance(1)
+		t.kind = tPunct
+	}
+	t.lit = string(lx.src[start:lx.off])
+	return t
+}
+
+// r2 reports whether b starts with a multi-byte rune followed by a quote,
+// as in the char literal 'é'.
+func r2(b []byte) bool {
+	r, n := utf8.DecodeRune(b)
+	return r >= utf8.RuneSelf && n < len(b) && b[n] == '\''
+}
+
+func (lx *lexer) ident() {
+	for lx.off < len(lx.src) {
+		r, _ := utf8.DecodeRune(lx.src[lx.off:])
+		if !isIdentRune(r) {
+			return
+		}
+		lx.advance(1)
+	}
+}
+
+// quoted skips a string or char literal delimited by q.
+func (lx *lexer) quoted(q byte) {
+	lx.advance(1)
+	for lx.off < len(lx.src) && lx.src[lx.off] != q {
+		if lx.src[lx.off] == '\\' {
+			lx.advance(1)
+		}
+		lx.advance(1)
+	}
+	lx.advance(1)
+}
+
+// rawString skips a raw string literal such as r#"..."#.
+func (lx *lexer) rawString() {
+	if lx.src[lx.off] == 'b' {
+		lx.advance(1)
+	}
+	lx.advance(1) // r
+	hashes := 0
+	for lx.peekByte(0) == '#' {
+		hashes++
+		lx.advance(1)
+	}
+	lx.advance(1) // opening quote
+	closing := "\"" + strings.Repeat("#", hashes)
+	for lx.off < len(lx.src) && !strings.HasPrefix(string(lx.src[lx.off:min(lx.off+len(closing), len(lx.src))]), closing) {
+		lx.advance(1)
+	}
+	lx.advance(len(closing))
+}
+
+type rsParser struct {
+	lx   lexer
+	tok  token
+	errs idl.ErrorList
+}
+
+func (p *rsParser) next() { p.tok = p.lx.next() }
+
+func (p *rsParser) errorf(pos idl.Pos, format string, args ...any) {
+	p.errs = append(p.errs, &idl.Error{Pos: pos, Msg: fmt.Sprintf(format, args...)})
+}
+
+func (p *rsParser) is(lit string) bool {
+	return (p.tok.kind == tPunct || p.tok.kind == tIdent) && p.tok.lit == lit
+}
+
+// got consumes the token lit if it is next.
+func (p *rsParser) got(lit string) bool {
+	if p.is(lit) {
+		p.next()
+		return true
+	}
+	return false
+}
+
+func (p *rsParser) expect(lit string) bool {
+	if p.got(lit) {
+		return true
+	}
+	p.errorf(p.tok.pos, "expected %q, found %s", lit, p.describe())
+	return false
+}
+
+func (p *rsParser) describe() string {
+	if p.tok.kind == tEOF {
+		return "end of file"
+	}
+	return strconv.Quote(p.tok.lit)
+}
+
+// attr is an outer attribute such as #[derive(Relish)].
+type attr struct {
+	toks []token
+}
+
+// attrs parses outer and inner attributes.
+func (p *rsParser) attrs() []attr {
+	var as []attr
+	for p.is("#") {
+		var a attr
+		p.next()
+		p.got("!")
+		if !p.is("[") {
+			p.errorf(p.tok.pos, "expected \"[\", found %s", p.describe())
+			return as
+		}
+		a.toks = p.balanced()
+		as = append(as, a)
+	}
+	return as
+}
+
+// balanced consumes a bracketed token group, returning the tokens inside.
+func (p *rsParser) balanced() []token {
+	var toks []token
+	depth := 0
+	for {
+		switch {
+		case p.tok.kind == tEOF:
+			p.errorf(p.tok.pos, "unexpected end of file")
+			return toks
+		case p.is("(") || p.is("[") || p.is("{"):
+			depth++
+		case p.is(")") || p.is("]") || p.is("}"):
+			depth--
+		}
+		if depth > 1 || depth == 1 && !(p.is("(") || p.is("[") || p.is("{")) {
+			toks = append(toks, p.tok)
+		}
+		p.next()
+		if depth == 0 {
+			return toks
+		}
+	}
+}
+
+// derivesRelish reports whether as includes a derive of Relish.
+func derivesRelish(as []attr) bool {
+	for _, a := range as {
+		if len(a.toks) > 0 && a.toks[0].lit == "derive" {
+			for _, t := range a.toks[1:] {
+				if t.kind == tIdent && t.lit == "Relish" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// fieldID returns the ID from a #[relish(field_id = N)] attribute.
+func (p *rsParser) fieldID(as []attr, pos idl.Pos, what string) (int, bool) {
+	for _, a := range as {
+		t := a.toks
+		if len(t) == 0 || t[0].lit != "relish" {
+			continue
+		}
+		for i := 1; i+2 < len(t); i++ {
+			if t[i].lit == "field_id" && t[i+1].lit == "=" {
+				id, err := strconv.ParseInt(intLiteral(t[i+2].lit), 0, 64)
+				if err != nil {
+					p.errorf(t[i+2].pos, "invalid field_id %s", t[i+2].lit)
+					return 0, false
+				}
+				return int(id), true
+			}
+		}
+	}
+	p.errorf(pos, "%s has no #[relish(field_id = N)] attribute", what)
+	return 0, false
+}
+
+// intLiteral strips the underscores and type suffix from a Rust integer
+// literal.
+func intLiteral(lit string) string {
+	lit = strings.ReplaceAll(lit, "_", "")
+	for _, suffix := range []string{"u8", "u16", "u32", "u64", "u128", "usize", "i8", "i16", "i32", "i64", "i128", "isize"} {
+		if strings.HasSuffix(lit, suffix) && !strings.HasPrefix(lit, "0x") {
+			return strings.TrimSuffix(lit, suffix)
+		}
+	}
+	return lit
+}
+
+// items parses items up to the end of the file, or to a closing brace if
+// inMod is set.
+func (p *rsParser) items(f *idl.File, inMod bool) {
+	for {
+		if p.tok.kind == tEOF {
+			if inMod {
+				p.errorf(p.tok.pos, "unexpected end of file in module")
+			}
+			return
+		}
+		if p.is("}") {
+			if inMod {
+				p.next()
+				return
+			}
+			p.errorf(p.tok.pos, "unexpected }")
+			p.next()
+			continue
+		}
+		as := p.attrs()
+		p.visibility()
+		pos := p.tok.pos
+		switch {
+		case p.got("struct"):
+			if d := p.structItem(pos, as); d != nil {
+				f.Decls = append(f.Decls, d)
+			}
+		case p.got("enum"):
+			if d := p.enumItem(pos, as); d != nil {
+				f.Decls = append(f.Decls, d)
+			}
+		case p.is("mod"):
+			p.next()
+			p.next() // name
+			if p.got("{") {
+				p.items(f, true)
+			} else {
+				p.got(";")
+			}
+		default:
+			p.skipItem()
+		}
+	}
+}
+
+// visibility skips pub, pub(crate) and the like.
+func (p *rsParser) visibility() {
+	if p.got("pub") && p.is("(") {
+		p.balanced()
+	}
+}
+
+// skipItem skips an item that is not of interest: up to a semicolon, or
+// through a braced body, at bracket depth zero. It stops before a stray
+// closing brace, which is for the caller to consume.
+func (p *rsParser) skipItem() {
+	for p.tok.kind != tEOF {
+		switch {
+		case p.got(";"):
+			return
+		case p.is("{"):
+			p.balanced()
+			p.got(";")
+			return
+		case p.is("(") || p.is("["):
+			p.balanced()
+		case p.is("}"):
+			// A stray closing brace belongs to an enclosing module.
+			return
+		default:
+			p.next()
+		}
+	}
+}
+
+// header parses an item's name and rejects generic parameters.
+func (p *rsParser) header(kind string) (string, bool) {
+	if p.tok.kind != tIdent {
+		p.errorf(p.tok.pos, "expected %s name, found %s", kind, p.describe())
+		return "", false
+	}
+	name := p.tok.lit
+	p.next()
+	if p.is("<") {
+		p.errorf(p.tok.pos, "generic %s %s has no Relish equivalent", kind, name)
+		return name, false
+	}
+	return name, true
+}
+
+func (p *rsParser) structItem(pos idl.Pos, as []attr) *idl.Decl {
+	relish := derivesRelish(as)
+	if !relish {
+		p.skipItem()
+		return nil
+	}
+	name, ok := p.header("struct")
+	if !ok {
+		p.skipItem()
+		return nil
+	}
+	if !p.is("{") {
+		p.errorf(p.tok.pos, "struct %s: tuple and unit structs have no Relish equivalent", name)
+		p.skipItem()
+		return nil
+	}
+	p.next()
+	d := &idl.Decl{Pos: pos, Name: name}
+	for !p.got("}") {
+		if p.tok.kind == tEOF {
+			p.errorf(p.tok.pos, "unexpected end of file in struct %s", name)
+			return nil
+		}
+		fas := p.attrs()
+		p.visibility()
+		m := &idl.Member{Pos: p.tok.pos, Name: p.tok.lit}
+		if p.tok.kind != tIdent {
+			p.errorf(p.tok.pos, "expected field name, found %s", p.describe())
+			p.balancedRest()
+			return nil
+		}
+		p.next()
+		if !p.expect(":") {
+			p.balancedRest()
+			return nil
+		}
+		m.Type, m.Optional = p.fieldType()
+		id, ok := p.fieldID(fas, m.Pos, name+"."+m.Name)
+		if !p.is("}") && !p.expect(",") {
+			p.balancedRest()
+			return nil
+		}
+		if m.Type != nil && ok {
+			m.ID = id
+			d.Members = append(d.Members, m)
+		}
+	}
+	optional := 0
+	for _, m := range d.Members {
+		if m.Optional {
+			optional++
+		}
+	}
+	if optional > 0 && optional == len(d.Members) {
+		p.errorf(pos, "struct %s: every field is an Option, which Go encodes as an enum when exactly one is set; make a field required", name)
+	}
+	return d
+}
+
+func (p *rsParser) enumItem(pos idl.Pos, as []attr) *idl.Decl {
+	relish := derivesRelish(as)
+	if !relish {
+		p.skipItem()
+		return nil
+	}
+	name, ok := p.header("enum")
+	if !ok || !p.expect("{") {
+		p.skipItem()
+		return nil
+	}
+	d := &idl.Decl{Pos: pos, Enum: true, Name: name}
+	for !p.got("}") {
+		if p.tok.kind == tEOF {
+			p.errorf(p.tok.pos, "unexpected end of file in enum %s", name)
+			return nil
+		}
+		vas := p.attrs()
+		m := &idl.Member{Pos: p.tok.pos, Name: p.tok.lit}
+		if p.tok.kind != tIdent {
+			p.errorf(p.tok.pos, "expected variant name, found %s", p.describe())
+			p.balancedRest()
+			return nil
+		}
+		p.next()
+		switch {
+		case p.got("("):
+			m.Type = p.typ()
+			if !p.is(")") {
+				p.errorf(p.tok.pos, "%s::%s: variants with several fields have no Relish equivalent", name, m.Name)
+				p.balancedRest()
+				m.Type = nil
+			} else {
+				p.next()
+			}
+		case p.is("{"):
+			p.errorf(p.tok.pos, "%s::%s: struct variants have no Relish equivalent", name, m.Name)
+			p.balanced()
+		default:
+			m.Type = &idl.Type{Pos: m.Pos, Name: "null"}
+		}
+		if p.got("=") {
+			p.errorf(m.Pos, "%s::%s: explicit discriminants have no Relish equivalent; use field_id", name, m.Name)
+			for !p.is(",") && !p.is("}") && p.tok.kind != tEOF {
+				p.next()
+			}
+		}
+		id, ok := p.fieldID(vas, m.Pos, name+"::"+m.Name)
+		if !p.is("}") && !p.expect(",") {
+			p.balancedRest()
+			return nil
+		}
+		if m.Type != nil && ok {
+			m.ID = id
+			d.Members = append(d.Members, m)
+		}
+	}
+	return d
+}
+
+// balancedRest skips to just past the bracket closing the current group.
+func (p *rsParser) balancedRest() {
+	for depth := 1; depth > 0 && p.tok.kind != tEOF; p.next() {
+		switch {
+		case p.is("(") || p.is("[") || p.is("{"):
+			depth++
+		case p.is(")") || p.is("]") || p.is("}"):
+			depth--
+		}
+	}
+}
+
+// fieldType parses a struct field's type, unwrapping a top-level Option.
+func (p *rsParser) fieldType() (*idl.Type, bool) {
+	t := p.typ()
+	if t != nil && t.Name == "Option" {
+		return t.Args[0], true
+	}
+	return t, false
+}
+
+// rustNames maps Rust type names to schema type names.
+var rustNames = map[string]string{
+	"bool": "bool", "u8": "u8", "u16": "u16", "u32": "u32", "u64": "u64", "u128": "u128",
+	"i8": "i8", "i16": "i16", "i32": "i32", "i64": "i64", "i128": "i128",
+	"f32": "f32", "f64": "f64", "String": "string", "str": "string",
+	"SystemTime": "timestamp", "Timestamp": "timestamp", "DateTime": "timestamp",
+	"Null": "null",
+}
+
+// typ parses a type. It returns nil after reporting an error.
+func (p *rsParser) typ() *idl.Type {
+	pos := p.tok.pos
+	switch {
+	case p.got("("):
+		if p.got(")") {
+			return &idl.Type{Pos: pos, Name: "null"}
+		}
+		p.errorf(pos, "tuple types have no Relish equivalent")
+		p.balancedRest()
+		return nil
+	case p.got("["):
+		elem := p.typ()
+		if p.got(";") {
+			for !p.is("]") && p.tok.kind != tEOF {
+				p.next()
+			}
+		}
+		if !p.expect("]") || elem == nil {
+			return nil
+		}
+		return &idl.Type{Pos: pos, Name: "array", Args: []*idl.Type{elem}}
+	case p.got("&"):
+		if p.tok.kind == tLifetime {
+			p.next()
+		}
+		p.got("mut")
+		return p.typ()
+	}
+	// A path, of which only the last segment matters.
+	p.got("::")
+	if p.tok.kind != tIdent {
+		p.errorf(pos, "expected type, found %s", p.describe())
+		return nil
+	}
+	name := p.tok.lit
+	p.next()
+	for p.got("::") {
+		if p.tok.kind != tIdent {
+			p.errorf(p.tok.pos, "expected type, found %s", p.describe())
+			return nil
+		}
+		name = p.tok.lit
+		p.next()
+	}
+	var args []*idl.Type
+	if p.got("<") {
+		for !p.got(">") {
+			if p.tok.kind == tLifetime {
+				p.next()
+			} else if a := p.typ(); a != nil {
+				args = append(args, a)
+			} else {
+				return nil
+			}
+			if !p.is(">") && !p.expect(",") {
+				return nil
+			}
+		}
+	}
+	want := 0
+	t := &idl.Type{Pos: pos, Args: args}
+	switch name {
+	case "Option":
+		want, t.Name = 1, "Option"
+	case "Box", "Rc", "Arc":
+		if len(args) != 1 {
+			break
+		}
+		return args[0]
+	case "Vec", "VecDeque":
+		want, t.Name = 1, "array"
+	case "HashMap", "BTreeMap":
+		want, t.Name = 2, "map"
+	case "Bytes", "BytesMut":
+		return &idl.Type{Pos: pos, Name: "array", Args: []*idl.Type{{Pos: pos, Name: "u8"}}}
+	case "DateTime":
+		return &idl.Type{Pos: pos, Name: "timestamp"}
+	case "usize", "isize":
+		p.errorf(pos, "%s has no Relish equivalent; use a sized integer type", name)
+		return nil
+	default:
+		if s, ok := rustNames[name]; ok {
+			t.Name = s
+		} else {
+			t.Name = name
+		}
+	}
+	if len(args) != want {
+		p.errorf(pos, "%s with %d type arguments has no Relish equivalent", name, len(args))
+		return nil
+	}
+	for _, a := range args {
+		if a.Name == "Option" {
+			p.errorf(a.Pos, "Option is only supported as a struct field's type")
+			return nil
+		}
+	}
+	return t
+}
@@ -0,0 +1,136 @@
+package rust
+
+import (
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/dadrian/relish/idl"
+)
+
+const rustSrc = `//! Order types.
+use relish::Relish;
+use std::collections::HashMap;
+
+/* A block comment /* nested */ with struct Fake {} inside. */
+#[derive(Debug, Clone, Relish)]
+pub struct Order {
+    #[relish(field_id = 0)]
+    pub order_id: u64,
+    /// Free text.
+    #[relish(field_id = 1)]
+    pub note: Option<String>,
+    #[relish(field_id = 2)]
+    pub(crate) lines: Vec<Line>,
+    #[relish(field_id = 3)]
+    counts: HashMap<String, u32>,
+    #[relish(field_id = 0x4)]
+    pub big: u128,
+    #[relish(field_id = 5)]
+    pub parent: Option<Box<Order>>,
+    #[relish(field_id = 6)]
+    pub at: std::time::SystemTime,
+    #[relish(field_id = 7)]
+    pub r#type: Shape,
+}
+
+impl Order {
+    pub fn new() -> Result<(), &'static str> {
+        let s = "}"; let c = '}'; let r = r#"{"#;
+        Ok(())
+    }
+}
+
+mod inner {
+    #[derive(relish::Relish)]
+    pub struct Line {
+        #[relish(field_id = 0)]
+        sku: String,
+        #[relish(field_id = 1)]
+        qty: [i32; 4],
+    }
+}
+
+#[derive(Relish)]
+pub enum Shape {
+    #[relish(field_id = 0)]
+    Circle(f64),
+    #[relish(field_id = 1)]
+    Empty,
+}
+
+#[derive(Debug)]
+pub struct NotRelish(u8);
+`
+
+func TestParse(t *testing.T) {
+	f, err := Parse("order.rs", []byte(rustSrc))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := idl.Check(f); err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range f.Decls {
+		for _, m := range d.Members {
+			opt := ""
+			if m.Optional {
+				opt = "optional "
+			}
+			got = append(got, d.Name+"."+m.Name+" "+strconv.Itoa(m.ID)+": "+opt+m.Type.String())
+		}
+	}
+	want := []string{
+		"Order.order_id 0: u64",
+		"Order.note 1: optional string",
+		"Order.lines 2: array<Line>",
+		"Order.counts 3: map<string, u32>",
+		"Order.big 4: u128",
+		"Order.parent 5: optional Order",
+		"Order.at 6: timestamp",
+		"Order.type 7: Shape",
+		"Line.sku 0: string",
+		"Line.qty 1: array<i32>",
+		"Shape.Circle 0: f64",
+		"Shape.Empty 1: null",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Parse =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+	src, err := idl.GenerateGo(f, "orders")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, line := range []string{
+		"OrderID uint64 ", "Note    *string ", "Big     relish.U128 ", "Parent  *Order ", "Type    Shape ",
+		"Circle *float64     `relish:\"0,optional\"`", "Empty  *relish.Null `relish:\"1,optional\"`",
+	} {
+		if !strings.Contains(string(src), line) {
+			t.Errorf("generated Go lacks %q:\n%s", line, src)
+		}
+	}
+}
+
+func TestParse_Errors(t *testing.T) {
+	for _, tc := range []struct{ src, want string }{
+		{"#[derive(Relish)]\nstruct A {\n    x: u8,\n}", "x.rs:3:5: A.x has no #[relish(field_id = N)] attribute"},
+		{"#[derive(Relish)]\nstruct A<T> { #[relish(field_id = 0)] x: T }", "x.rs:2:9: generic struct A has no Relish equivalent"},
+		{"#[derive(Relish)]\nstruct A(u8);", "x.rs:2:9: struct A: tuple and unit structs have no Relish equivalent"},
+		{"#[derive(Relish)]\nstruct A { #[relish(field_id = 0)] x: usize }", "x.rs:2:39: usize has no Relish equivalent; use a sized integer type"},
+		{"#[derive(Relish)]\nstruct A { #[relish(field_id = 0)] x: Vec<Option<u8>> }", "x.rs:2:43: Option is only supported as a struct field's type"},
+		{"#[derive(Relish)]\nenum E { #[relish(field_id = 0)] V { x: u8 } }", "x.rs:2:36: E::V: struct variants have no Relish equivalent"},
+		{"#[derive(Relish)]\nenum E { #[relish(field_id = 0)] V(u8, u8) }", "x.rs:2:38: E::V: variants with several fields have no Relish equivalent"},
+		{"#[derive(Relish)]\nstruct A { #[relish(field_id = 0)] x: (u8, u8) }", "x.rs:2:39: tuple types have no Relish equivalent"},
+		{"#[derive(Relish)]\nstruct Patch {\n    #[relish(field_id = 0)] name: Option<String>,\n    #[relish(field_id = 1)] age: Option<u32>,\n}",
+			"x.rs:2:1: struct Patch: every field is an Option, which Go encodes as an enum when exactly one is set; make a field required"},
+		{"}", "x.rs:1:1: unexpected }"},
+		{"#[derive(Relish)] struct A { #[relish(field_id = 0)] a u8 }", `x.rs:1:56: expected ":", found "u8"`},
+	} {
+		_, err := Parse("x.rs", []byte(tc.src))
+		if err == nil || err.Error() != tc.want {
+			t.Errorf("Parse(%q) = %v, want %s", tc.src, err, tc.want)
+		}
+	}
+}
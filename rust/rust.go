@@ -0,0 +1,265 @@
+// Package rust translates between Relish schemas and Rust type
+// definitions for the reference relish crate, whose derive macro reads
+// field and variant IDs from #[relish(field_id = N)] attributes.
+//
+// Relish types map to Rust types as follows:
+//
+//	null        ()
+//	bool        bool
+//	u8 … u128   u8 … u128
+//	i8 … i128   i8 … i128
+//	f32, f64    f32, f64
+//	string      String
+//	timestamp   std::time::SystemTime
+//	array<T>    Vec<T>
+//	map<K, V>   std::collections::HashMap<K, V>
+//
+// Optional struct fields are Option<T>. Structs are Rust structs with
+// named fields, and enums are Rust enums with one single-field tuple
+// variant per Relish variant.
+package rust
+
+import (
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/dadrian/relish"
+)
+
+// primitives maps primitive types to Rust types.
+var primitives = map[relish.TypeID]string{
+	relish.TypeNull:      "()",
+	relish.TypeBool:      "bool",
+	relish.TypeU8:        "u8",
+	relish.TypeU16:       "u16",
+	relish.TypeU32:       "u32",
+	relish.TypeU64:       "u64",
+	relish.TypeU128:      "u128",
+	relish.TypeI8:        "i8",
+	relish.TypeI16:       "i16",
+	relish.TypeI32:       "i32",
+	relish.TypeI64:       "i64",
+	relish.TypeI128:      "i128",
+	relish.TypeF32:       "f32",
+	relish.TypeF64:       "f64",
+	relish.TypeString:    "String",
+	relish.TypeTimestamp: "SystemTime",
+}
+
+// keywords are Rust's strict and reserved keywords, which field names
+// must be written as raw identifiers to use.
+var keywords = map[string]bool{
+	"as": true, "async": true, "await": true, "break": true, "const": true,
+	"continue": true, "crate": true, "dyn": true, "else": true, "enum": true,
+	"extern": true, "false": true, "fn": true, "for": true, "if": true,
+	"impl": true, "in": true, "let": true, "loop": true, "match": true,
+	"mod": true, "move": true, "mut": true, "pub": true, "ref": true,
+	"return": true, "self": true, "static": true, "struct": true,
+	"super": true, "trait": true, "true": true, "type": true,
+	"unsafe": true, "use": true, "where": true, "while": true,
+	"abstract": true, "become": true, "box": true, "do": true,
+	"final": true, "gen": true, "macro": true, "override": true,
+	"priv": true, "try": true, "typeof": true, "unsized": true,
+	"virtual": true, "yield": true,
+}
+
+// Generate returns Rust source declaring the struct and enum types of
+// schemas and every struct and enum they refer to, in the order they are
+// first reached. Field names are converted to snake_case. A field whose
+// type contains the field's own struct or enum without an array or map
+// in between is boxed, as Rust needs for recursive types.
+//
+// Struct and enum descriptors must be named, and distinct descriptors
+// must have distinct names.
+func Generate(schemas ...relish.Schema) ([]byte, error) {
+	g := &generator{byName: make(map[string]relish.Schema)}
+	for _, s := range schemas {
+		if err := g.collect(s); err != nil {
+			return nil, err
+		}
+	}
+	var body strings.Builder
+	for _, d := range g.decls {
+		body.WriteString("\n")
+		g.decl(&body, d)
+	}
+
+	var b strings.Builder
+	b.WriteString("// Code generated by go2rust. DO NOT EDIT.\n\n")
+	if g.usesMap {
+		b.WriteString("use std::collections::HashMap;\n")
+	}
+	if g.usesTime {
+		b.WriteString("use std::time::SystemTime;\n")
+	}
+	if g.usesMap || g.usesTime {
+		b.WriteString("\n")
+	}
+	b.WriteString("use relish::Relish;\n")
+	b.WriteString(body.String())
+	return []byte(b.String()), nil
+}
+
+type generator struct {
+	decls    []relish.Schema
+	byName   map[string]relish.Schema
+	usesMap  bool
+	usesTime bool
+}
+
+// collect adds the struct and enum types reachable from s to g.decls.
+func (g *generator) collect(s relish.Schema) error {
+	switch d := s.(type) {
+	case *relish.ArrayDesc:
+		return g.collect(d.Elem)
+	case *relish.MapDesc:
+		if err := g.collect(d.Key); err != nil {
+			return err
+		}
+		return g.collect(d.Value)
+	case *relish.StructDesc, *relish.EnumDesc:
+		name, fields := members(s)
+		if name == "" {
+			return fmt.Errorf("rust: cannot generate anonymous %v", s)
+		}
+		if prev, ok := g.byName[name]; ok {
+			if prev != s {
+				return fmt.Errorf("rust: two different types are named %s", name)
+			}
+			return nil
+		}
+		g.byName[name] = s
+		g.decls = append(g.decls, s)
+		for _, f := range fields {
+			if err := g.collect(f.Type); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (g *generator) decl(b *strings.Builder, s relish.Schema) {
+	name, fields := members(s)
+	b.WriteString("#[derive(Debug, Clone, PartialEq, Relish)]\n")
+	if _, ok := s.(*relish.EnumDesc); ok {
+		fmt.Fprintf(b, "pub enum %s {\n", name)
+		for _, f := range fields {
+			fmt.Fprintf(b, "    #[relish(field_id = %d)]\n", f.ID)
+			fmt.Fprintf(b, "    %s(%s),\n", variantName(f.Name), g.member(f.Type, s))
+		}
+	} else {
+		fmt.Fprintf(b, "pub struct %s {\n", name)
+		for _, f := range fields {
+			t := g.member(f.Type, s)
+			if f.Optional {
+				t = "Option<" + t + ">"
+			}
+			fmt.Fprintf(b, "    #[relish(field_id = %d)]\n", f.ID)
+			fmt.Fprintf(b, "    pub %s: %s,\n", FieldName(f.Name), t)
+		}
+	}
+	b.WriteString("}\n")
+}
+
+// member returns the Rust type of a member of type t in container,
+// boxed if it would otherwise make container infinitely large.
+func (g *generator) member(t, container relish.Schema) string {
+	rt := g.typ(t)
+	if reaches(t, container, make(map[relish.Schema]bool)) {
+		rt = "Box<" + rt + ">"
+	}
+	return rt
+}
+
+func (g *generator) typ(s relish.Schema) string {
+	switch d := s.(type) {
+	case relish.PrimitiveDesc:
+		g.usesTime = g.usesTime || d.Type == relish.TypeTimestamp
+		return primitives[d.Type]
+	case *relish.ArrayDesc:
+		return "Vec<" + g.typ(d.Elem) + ">"
+	case *relish.MapDesc:
+		g.usesMap = true
+		return "HashMap<" + g.typ(d.Key) + ", " + g.typ(d.Value) + ">"
+	}
+	name, _ := members(s)
+	return name
+}
+
+// reaches reports whether a value of type from contains a value of type
+// to directly, or through other struct fields and enum variants, without
+// an array or map in between.
+func reaches(from, to relish.Schema, seen map[relish.Schema]bool) bool {
+	if from == to {
+		return true
+	}
+	switch from.(type) {
+	case *relish.StructDesc, *relish.EnumDesc:
+	default:
+		return false
+	}
+	if seen[from] {
+		return false
+	}
+	seen[from] = true
+	_, fields := members(from)
+	for _, f := range fields {
+		if reaches(f.Type, to, seen) {
+			return true
+		}
+	}
+	return false
+}
+
+// members returns the name and fields or variants of a struct or enum.
+func members(s relish.Schema) (string, []relish.FieldDesc) {
+	switch d := s.(type) {
+	case *relish.StructDesc:
+		return d.Name, d.Fields
+	case *relish.EnumDesc:
+		return d.Name, d.Variants
+	}
+	return "", nil
+}
+
+// FieldName converts a Go field name to a Rust field name: "OrderID"
+// becomes "order_id". Keywords become raw identifiers, except those that
+// cannot be, which get a trailing underscore.
+func FieldName(name string) string {
+	r := []rune(name)
+	var b strings.Builder
+	for i, c := range r {
+		if unicode.IsUpper(c) && i > 0 {
+			prev := r[i-1]
+			nextLower := i+1 < len(r) && unicode.IsLower(r[i+1])
+			if unicode.IsLower(prev) || unicode.IsDigit(prev) || unicode.IsUpper(prev) && nextLower {
+				b.WriteByte('_')
+			}
+		}
+		b.WriteRune(unicode.ToLower(c))
+	}
+	s := b.String()
+	switch {
+	case s == "self" || s == "super" || s == "crate":
+		return s + "_"
+	case keywords[s]:
+		return "r#" + s
+	}
+	return s
+}
+
+// variantName converts a member name to a Rust variant name, which is
+// CamelCase.
+func variantName(name string) string {
+	parts := strings.Split(name, "_")
+	for i, p := range parts {
+		if p != "" {
+			r := []rune(p)
+			r[0] = unicode.ToUpper(r[0])
+			parts[i] = string(r)
+		}
+	}
+	return strings.Join(parts, "")
+}
@@ -0,0 +1,115 @@
+package rust
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/dadrian/relish"
+)
+
+type order struct {
+	OrderID uint64            `relish:"0"`
+	Note    *string           `relish:"1,optional"`
+	Lines   []line            `relish:"2"`
+	Shape   shape             `relish:"3"`
+	Parent  *order            `relish:"4,optional"`
+	Big     relish.I128       `relish:"5"`
+	Counts  map[string]uint32 `relish:"6"`
+	At      time.Time         `relish:"7"`
+	Type    uint8             `relish:"8"`
+}
+
+type line struct {
+	SKU   string  `relish:"0"`
+	Owner []order `relish:"1"`
+}
+
+type shape struct {
+	Circle *float64     `relish:"0,optional"`
+	None   *relish.Null `relish:"1,optional"`
+	Nested *shape       `relish:"2,optional"`
+}
+
+func TestGenerate(t *testing.T) {
+	s, err := relish.SchemaOf(reflect.TypeOf(order{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err := Generate(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const want = `// Code generated by go2rust. DO NOT EDIT.
+
+use std::collections::HashMap;
+use std::time::SystemTime;
+
+use relish::Relish;
+
+#[derive(Debug, Clone, PartialEq, Relish)]
+pub struct order {
+    #[relish(field_id = 0)]
+    pub order_id: u64,
+    #[relish(field_id = 1)]
+    pub note: Option<String>,
+    #[relish(field_id = 2)]
+    pub lines: Vec<line>,
+    #[relish(field_id = 3)]
+    pub shape: shape,
+    #[relish(field_id = 4)]
+    pub parent: Option<Box<order>>,
+    #[relish(field_id = 5)]
+    pub big: i128,
+    #[relish(field_id = 6)]
+    pub counts: HashMap<String, u32>,
+    #[relish(field_id = 7)]
+    pub at: SystemTime,
+    #[relish(field_id = 8)]
+    pub r#type: u8,
+}
+
+#[derive(Debug, Clone, PartialEq, Relish)]
+pub struct line {
+    #[relish(field_id = 0)]
+    pub sku: String,
+    #[relish(field_id = 1)]
+    pub owner: Vec<order>,
+}
+
+#[derive(Debug, Clone, PartialEq, Relish)]
+pub enum shape {
+    #[relish(field_id = 0)]
+    Circle(f64),
+    #[relish(field_id = 1)]
+    None(()),
+    #[relish(field_id = 2)]
+    Nested(Box<shape>),
+}
+`
+	if string(got) != want {
+		t.Errorf("Generate =\n%s\nwant\n%s", got, want)
+	}
+}
+
+func TestGenerate_Errors(t *testing.T) {
+	a := &relish.StructDesc{Name: "A"}
+	for _, s := range [][]relish.Schema{
+		{&relish.StructDesc{}},
+		{a, &relish.ArrayDesc{Elem: &relish.StructDesc{Name: "A"}}},
+	} {
+		if _, err := Generate(s...); err == nil {
+			t.Errorf("Generate(%v) succeeded", s)
+		}
+	}
+}
+
+func TestFieldName(t *testing.T) {
+	for in, want := range map[string]string{
+		"ID": "id", "OrderID": "order_id", "HTTPServer": "http_server", "Utf8Len": "utf8_len", "Match": "r#match", "Self": "self_",
+	} {
+		if got := FieldName(in); got != want {
+			t.Errorf("FieldName(%q) = %q, want %q", in, got, want)
+		}
+	}
+}
@@ -0,0 +1,367 @@
+package relish
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	intr "github.com/dadrian/relish/internal"
+)
+
+// Schema describes the type of an encoded value. It is one of
+// PrimitiveDesc, *ArrayDesc, *MapDesc, *StructDesc or *EnumDesc. Struct
+// and enum descriptors may refer to themselves, directly or indirectly,
+// to describe recursive types.
+type Schema interface {
+	// TypeID returns the type ID values of this type are encoded with.
+	TypeID() TypeID
+	// String returns a short description, such as "array<u32>" or
+	// "struct Order".
+	String() string
+	schema()
+}
+
+// PrimitiveDesc describes a value with no inner structure: null, bool,
+// the integer and float types, string and timestamp.
+type PrimitiveDesc struct {
+	Type TypeID
+}
+
+// ArrayDesc describes an array.
+type ArrayDesc struct {
+	Elem Schema
+}
+
+// MapDesc describes a map.
+type MapDesc struct {
+	Key, Value Schema
+}
+
+// StructDesc describes a struct. Fields are in increasing ID order.
+type StructDesc struct {
+	Name   string
+	Fields []FieldDesc
+}
+
+// EnumDesc describes an enum. Variants are in increasing ID order.
+type EnumDesc struct {
+	Name     string
+	Variants []FieldDesc
+}
+
+// FieldDesc describes a struct field or enum variant.
+type FieldDesc struct {
+	ID   byte
+	Name string
+	Type Schema
+	// Optional reports whether a struct field may be absent. It is
+	// unused for enum variants.
+	Optional bool
+}
+
+func (d PrimitiveDesc) TypeID() TypeID { return d.Type }
+func (d *ArrayDesc) TypeID() TypeID    { return TypeArray }
+func (d *MapDesc) TypeID() TypeID      { return TypeMap }
+func (d *StructDesc) TypeID() TypeID   { return TypeStruct }
+func (d *EnumDesc) TypeID() TypeID     { return TypeEnum }
+
+func (d PrimitiveDesc) String() string { return d.Type.String() }
+func (d *ArrayDesc) String() string    { return "array<" + d.Elem.String() + ">" }
+func (d *MapDesc) String() string      { return "map<" + d.Key.String() + "," + d.Value.String() + ">" }
+func (d *StructDesc) String() string   { return strings.TrimSpace("struct " + d.Name) }
+func (d *EnumDesc) String() string     { return strings.TrimSpace("enum " + d.Name) }
+
+func (PrimitiveDesc) schema() {}
+func (*ArrayDesc) schema()    {}
+func (*MapDesc) schema()      {}
+func (*StructDesc) schema()   {}
+func (*EnumDesc) schema()     {}
+
+// Field returns the field with the given ID.
+func (d *StructDesc) Field(id byte) (FieldDesc, bool) { return findField(d.Fields, id) }
+
+// Variant returns the variant with the given ID.
+func (d *EnumDesc) Variant(id byte) (FieldDesc, bool) { return findField(d.Variants, id) }
+
+func findField(fields []FieldDesc, id byte) (FieldDesc, bool) {
+	for _, f := range fields {
+		if f.ID == id {
+			return f, true
+		}
+	}
+	return FieldDesc{}, false
+}
+
+// SchemaOf derives the schema of values of Go type rt as the Encoder
+// writes them. Tagged fields of a struct type become struct fields, or
+// enum variants if every tagged field is optional; fields tagged
+// optional or omitempty are optional. Named struct types are described by
+// a single descriptor however often they occur, so recursive types yield
+// cyclic schemas. Recursion through array and map types alone, as in
+// type L []L, has no descriptor to refer back to and is an error.
+func SchemaOf(rt reflect.Type) (Schema, error) {
+	if rt == nil {
+		return nil, &Error{Kind: ErrNotImplementedKind, Detail: "no relish type for nil"}
+	}
+	return schemaOf(rt, make(map[reflect.Type]Schema), nil)
+}
+
+// schemaOf derives the schema of rt. seen holds the struct and enum
+// descriptors derived so far, and outer the array and map types whose
+// schemas enclose this one since the nearest struct or enum.
+func schemaOf(rt reflect.Type, seen map[reflect.Type]Schema, outer map[reflect.Type]bool) (Schema, error) {
+	for rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	if s, ok := seen[rt]; ok {
+		return s, nil
+	}
+	if outer[rt] {
+		return nil, &Error{Kind: ErrNotImplementedKind, Detail: fmt.Sprintf("%v: recursive type without a struct", rt)}
+	}
+	t, err := typeIDOf(rt)
+	if err != nil {
+		return nil, err
+	}
+	switch TypeID(t) {
+	case TypeArray, TypeMap:
+		if outer == nil {
+			outer = make(map[reflect.Type]bool)
+		}
+		outer[rt] = true
+		defer delete(outer, rt)
+	}
+	switch TypeID(t) {
+	case TypeArray:
+		elem, err := schemaOf(rt.Elem(), seen, outer)
+		if err != nil {
+			return nil, err
+		}
+		return &ArrayDesc{Elem: elem}, nil
+	case TypeMap:
+		key, err := schemaOf(rt.Key(), seen, outer)
+		if err != nil {
+			return nil, err
+		}
+		value, err := schemaOf(rt.Elem(), seen, outer)
+		if err != nil {
+			return nil, err
+		}
+		return &MapDesc{Key: key, Value: value}, nil
+	case TypeStruct, TypeEnum:
+		var fields *[]FieldDesc
+		if TypeID(t) == TypeEnum {
+			d := &EnumDesc{Name: rt.Name()}
+			seen[rt], fields = d, &d.Variants
+		} else {
+			d := &StructDesc{Name: rt.Name()}
+			seen[rt], fields = d, &d.Fields
+		}
+		for i := 0; i < rt.NumField(); i++ {
+			f := rt.Field(i)
+			id, optional, omitempty, ok := intr.ParseRelishTag(f)
+			if !ok {
+				continue
+			}
+			if _, dup := findField(*fields, byte(id)); dup {
+				return nil, &Error{Kind: ErrInvalidFieldID, Detail: fmt.Sprintf("%v.%s: duplicate field id %d", rt, f.Name, id)}
+			}
+			ft, err := schemaOf(f.Type, seen, nil)
+			if err != nil {
+				return nil, err
+			}
+			*fields = append(*fields, FieldDesc{ID: byte(id), Name: f.Name, Type: ft, Optional: optional || omitempty})
+		}
+		fs := *fields
+		sort.SliceStable(fs, func(i, j int) bool { return fs[i].ID < fs[j].ID })
+		return seen[rt], nil
+	}
+	return PrimitiveDesc{Type: TypeID(t)}, nil
+}
+
+// isPrimitive reports whether t is described by a PrimitiveDesc.
+func isPrimitive(t TypeID) bool {
+	_, fixed := intr.FixedSize(byte(t))
+	return fixed || t == TypeString
+}
+
+// A schema is serialized as a Relish struct holding the root type and a
+// table of the struct and enum types it uses, which type references name
+// by index. This lets recursive schemas be written without cycles.
+type schemaWire struct {
+	Root  typeRefWire   `relish:"0"`
+	Types []typeDefWire `relish:"1"`
+}
+
+type typeRefWire struct {
+	Primitive *uint8       `relish:"0,optional"`
+	Array     *typeRefWire `relish:"1,optional"`
+	Map       *mapRefWire  `relish:"2,optional"`
+	Named     *uint32      `relish:"3,optional"`
+}
+
+type mapRefWire struct {
+	Key   typeRefWire `relish:"0"`
+	Value typeRefWire `relish:"1"`
+}
+
+type typeDefWire struct {
+	Name   string      `relish:"0"`
+	Enum   bool        `relish:"1"`
+	Fields []fieldWire `relish:"2"`
+}
+
+type fieldWire struct {
+	ID       uint8       `relish:"0"`
+	Name     string      `relish:"1"`
+	Type     typeRefWire `relish:"2"`
+	Optional bool        `relish:"3"`
+}
+
+// MarshalSchema encodes s as a Relish value, so that it can be stored or
+// sent alongside the data it describes.
+func MarshalSchema(s Schema) ([]byte, error) { return marshalSchema(s, false) }
+
+// marshalSchema encodes s as MarshalSchema does, with every type, field
+// and variant name left empty if anonymous is set.
+func marshalSchema(s Schema, anonymous bool) ([]byte, error) {
+	w := schemaWriter{index: make(map[Schema]uint32), anonymous: anonymous}
+	root, err := w.ref(s)
+	if err != nil {
+		return nil, err
+	}
+	return Marshal(schemaWire{Root: root, Types: w.defs})
+}
+
+type schemaWriter struct {
+	index     map[Schema]uint32
+	defs      []typeDefWire
+	anonymous bool
+}
+
+func (w *schemaWriter) ref(s Schema) (typeRefWire, error) {
+	switch d := s.(type) {
+	case PrimitiveDesc:
+		if !isPrimitive(d.Type) {
+			return typeRefWire{}, &Error{Kind: ErrInvalidTypeID, Detail: fmt.Sprintf("%v is not a primitive type", d.Type)}
+		}
+		t := uint8(d.Type)
+		return typeRefWire{Primitive: &t}, nil
+	case *ArrayDesc:
+		elem, err := w.ref(d.Elem)
+		return typeRefWire{Array: &elem}, err
+	case *MapDesc:
+		key, err := w.ref(d.Key)
+		if err != nil {
+			return typeRefWire{}, err
+		}
+		value, err := w.ref(d.Value)
+		return typeRefWire{Map: &mapRefWire{Key: key, Value: value}}, err
+	case *StructDesc, *EnumDesc:
+		if i, ok := w.index[s]; ok {
+			return typeRefWire{Named: &i}, nil
+		}
+		i := uint32(len(w.defs))
+		w.index[s] = i
+		w.defs = append(w.defs, typeDefWire{})
+		def := typeDefWire{Fields: []fieldWire{}}
+		fields := []FieldDesc(nil)
+		if sd, ok := d.(*StructDesc); ok {
+			def.Name, fields = sd.Name, sd.Fields
+		} else {
+			ed := d.(*EnumDesc)
+			def.Name, def.Enum, fields = ed.Name, true, ed.Variants
+		}
+		if w.anonymous {
+			def.Name = ""
+		}
+		for _, f := range fields {
+			ft, err := w.ref(f.Type)
+			if err != nil {
+				return typeRefWire{}, err
+			}
+			fw := fieldWire{ID: f.ID, Name: f.Name, Type: ft, Optional: f.Optional}
+			if w.anonymous {
+				fw.Name = ""
+			}
+			def.Fields = append(def.Fields, fw)
+		}
+		w.defs[i] = def
+		return typeRefWire{Named: &i}, nil
+	}
+	return typeRefWire{}, &Error{Kind: ErrTypeMismatch, Detail: fmt.Sprintf("unknown schema type %T", s)}
+}
+
+// UnmarshalSchema decodes a schema written by MarshalSchema.
+func UnmarshalSchema(data []byte) (Schema, error) {
+	var sw schemaWire
+	if err := Unmarshal(data, &sw); err != nil {
+		return nil, err
+	}
+	named := make([]Schema, len(sw.Types))
+	for i, def := range sw.Types {
+		if def.Enum {
+			named[i] = &EnumDesc{Name: def.Name}
+		} else {
+			named[i] = &StructDesc{Name: def.Name}
+		}
+	}
+	for i, def := range sw.Types {
+		var fields []FieldDesc
+		for _, f := range def.Fields {
+			if f.ID > 0x7F {
+				return nil, &Error{Kind: ErrInvalidFieldID, Detail: fmt.Sprintf("type %d: field id %d out of range", i, f.ID)}
+			}
+			if n := len(fields); n > 0 && fields[n-1].ID >= f.ID {
+				return nil, &Error{Kind: ErrFieldOrder, Detail: fmt.Sprintf("type %d: field ids not strictly increasing", i)}
+			}
+			ft, err := schemaFromWire(f.Type, named)
+			if err != nil {
+				return nil, err
+			}
+			fields = append(fields, FieldDesc{ID: f.ID, Name: f.Name, Type: ft, Optional: f.Optional})
+		}
+		switch d := named[i].(type) {
+		case *EnumDesc:
+			d.Variants = fields
+		case *StructDesc:
+			d.Fields = fields
+		}
+	}
+	return schemaFromWire(sw.Root, named)
+}
+
+func schemaFromWire(r typeRefWire, named []Schema) (Schema, error) {
+	switch {
+	case r.Primitive != nil:
+		t := TypeID(*r.Primitive)
+		if !isPrimitive(t) {
+			return nil, &Error{Kind: ErrInvalidTypeID, Detail: fmt.Sprintf("%v is not a primitive type", t)}
+		}
+		return PrimitiveDesc{Type: t}, nil
+	case r.Array != nil:
+		elem, err := schemaFromWire(*r.Array, named)
+		if err != nil {
+			return nil, err
+		}
+		return &ArrayDesc{Elem: elem}, nil
+	case r.Map != nil:
+		key, err := schemaFromWire(r.Map.Key, named)
+		if err != nil {
+			return nil, err
+		}
+		value, err := schemaFromWire(r.Map.Value, named)
+		if err != nil {
+			return nil, err
+		}
+		return &MapDesc{Key: key, Value: value}, nil
+	case r.Named != nil:
+		if int(*r.Named) >= len(named) {
+			return nil, &Error{Kind: ErrInvalidValue, Detail: "type index " + strconv.Itoa(int(*r.Named)) + " out of range"}
+		}
+		return named[*r.Named], nil
+	}
+	return nil, &Error{Kind: ErrInvalidValue, Detail: "empty type reference"}
+}
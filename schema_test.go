@@ -0,0 +1,188 @@
+package relish
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type schemaNode struct {
+	Value    string            `relish:"0"`
+	Children []schemaNode      `relish:"1"`
+	Attrs    map[string]uint16 `relish:"2,omitempty"`
+	Parent   *schemaNode       `relish:"4,optional"`
+	At       time.Time         `relish:"3"`
+	ignored  int
+}
+
+type schemaShape struct {
+	Circle *float64    `relish:"1,optional"`
+	Square *uint32     `relish:"0,optional"`
+	Node   *schemaNode `relish:"2,optional"`
+}
+
+func TestSchemaOf(t *testing.T) {
+	s, err := SchemaOf(reflect.TypeOf(&schemaShape{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	e, ok := s.(*EnumDesc)
+	if !ok || e.Name != "schemaShape" || len(e.Variants) != 3 {
+		t.Fatalf("SchemaOf = %#v", s)
+	}
+	if e.Variants[0].Name != "Square" || e.Variants[1].Name != "Circle" {
+		t.Errorf("variants not in ID order: %+v", e.Variants)
+	}
+	if got := e.Variants[0].Type; got != (PrimitiveDesc{Type: TypeU32}) {
+		t.Errorf("Square type = %v", got)
+	}
+	n, ok := e.Variants[2].Type.(*StructDesc)
+	if !ok {
+		t.Fatalf("Node type = %v", e.Variants[2].Type)
+	}
+	var got []string
+	for _, f := range n.Fields {
+		got = append(got, f.Name+" "+f.Type.String())
+	}
+	want := []string{"Value string", "Children array<struct schemaNode>", "Attrs map<string,u16>", "At timestamp", "Parent struct schemaNode"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fields = %q, want %q", got, want)
+	}
+	if n.Fields[1].Type.(*ArrayDesc).Elem != n || n.Fields[4].Type != n {
+		t.Error("recursive references do not share the descriptor")
+	}
+	if f, _ := n.Field(2); !f.Optional {
+		t.Error("omitempty field not optional")
+	}
+	if f, _ := n.Field(0); f.Optional {
+		t.Error("plain field optional")
+	}
+}
+
+func TestSchemaOf_Errors(t *testing.T) {
+	type dup struct {
+		A uint8 `relish:"1"`
+		B uint8 `relish:"1"`
+	}
+	type unsupported struct {
+		C chan int `relish:"0"`
+	}
+	type list []list
+	type tree map[string][]tree
+	for _, v := range []any{dup{}, unsupported{}, func() {}, list{}, tree{}, nil} {
+		if _, err := SchemaOf(reflect.TypeOf(v)); err == nil {
+			t.Errorf("SchemaOf(%T) succeeded", v)
+		}
+	}
+}
+
+type schemaForest []schemaTree
+
+type schemaTree struct {
+	Children schemaForest `relish:"0"`
+}
+
+func TestSchemaOf_RecursiveArray(t *testing.T) {
+	s, err := SchemaOf(reflect.TypeOf(schemaForest{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	node := s.(*ArrayDesc).Elem.(*StructDesc)
+	if node.Fields[0].Type.(*ArrayDesc).Elem != node {
+		t.Fatalf("SchemaOf = %v, want a cycle through struct schemaTree", s)
+	}
+}
+
+func TestSchemaOf_Reserved(t *testing.T) {
+	type retired struct {
+		A uint8    `relish:"0"`
+		_ struct{} `relish:"1,reserved"`
+	}
+	s, err := SchemaOf(reflect.TypeOf(retired{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d := s.(*StructDesc); len(d.Fields) != 1 || d.Fields[0].Name != "A" {
+		t.Errorf("SchemaOf = %+v, want only field A", d.Fields)
+	}
+	b, err := Marshal(retired{A: 7})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []byte{0x11, 0x06, 0x00, 0x02, 0x07}; !reflect.DeepEqual(b, want) {
+		t.Errorf("Marshal = %x, want %x", b, want)
+	}
+}
+
+func TestSchema_RoundTrip(t *testing.T) {
+	s, err := SchemaOf(reflect.TypeOf(schemaShape{}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := MarshalSchema(s)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := firstError(Validate(data)); err != nil {
+		t.Fatalf("encoded schema invalid: %v", err)
+	}
+	back, err := UnmarshalSchema(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := back.(*EnumDesc)
+	n := e.Variants[2].Type.(*StructDesc)
+	if n.Fields[1].Type.(*ArrayDesc).Elem != n {
+		t.Error("recursion lost in round trip")
+	}
+	again, err := MarshalSchema(back)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(data, again) {
+		t.Errorf("re-encoded schema differs:\n% x\n% x", data, again)
+	}
+	for _, p := range []Schema{PrimitiveDesc{Type: TypeBool}, &MapDesc{Key: PrimitiveDesc{Type: TypeI64}, Value: &ArrayDesc{Elem: PrimitiveDesc{Type: TypeString}}}} {
+		data, err := MarshalSchema(p)
+		if err != nil {
+			t.Fatal(err)
+		}
+		back, err := UnmarshalSchema(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(back, p) {
+			t.Errorf("round trip of %v = %v", p, back)
+		}
+	}
+}
+
+func TestSchema_Invalid(t *testing.T) {
+	if _, err := MarshalSchema(PrimitiveDesc{Type: TypeArray}); err == nil {
+		t.Error("MarshalSchema accepted array as a primitive")
+	}
+	idx := uint32(3)
+	data, err := Marshal(schemaWire{Root: typeRefWire{Named: &idx}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var e *Error
+	if _, err := UnmarshalSchema(data); !errors.As(err, &e) || e.Kind != ErrInvalidValue {
+		t.Errorf("dangling type index: err = %v", err)
+	}
+	u8 := uint8(TypeU8)
+	data, err = Marshal(schemaWire{
+		Root: typeRefWire{Named: new(uint32)},
+		Types: []typeDefWire{{Fields: []fieldWire{
+			{ID: 2, Type: typeRefWire{Primitive: &u8}},
+			{ID: 1, Type: typeRefWire{Primitive: &u8}},
+		}}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := UnmarshalSchema(data); !errors.As(err, &e) || e.Kind != ErrFieldOrder {
+		t.Errorf("unordered fields: err = %v", err)
+	}
+}
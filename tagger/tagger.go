@@ -0,0 +1,250 @@
+// Package tagger adds relish tags to Go struct types that lack them, such
+// as types written for encoding/json, by rewriting their source.
+//
+// Each exported field without a relish tag gets one, in declaration
+// order, with IDs counting up from the highest ID the struct already
+// uses. Pointer fields are tagged optional. The new key is appended to the
+// field's existing tag, and comments are kept. A field declared with
+// others, as in A, B int, is left alone, since one tag cannot give them
+// different IDs, and so are fields tagged json:"-" and fields of function
+// or channel type. Struct types declared inline in a field are tagged
+// too. Generated files are left alone.
+//
+// Given a lockfile, tagger never assigns an ID the lockfile records for
+// the struct, except to the field it records under that name, which gets
+// its old ID back.
+package tagger
+
+import (
+	"bytes"
+	"fmt"
+	"go/ast"
+	"go/format"
+	"go/token"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/dadrian/relish/lockfile"
+)
+
+// Options control Tag.
+type Options struct {
+	// Types, if not empty, limits Tag to the struct types so named.
+	Types []string
+	// Lock, if not nil, holds the IDs the types have used before.
+	Lock *lockfile.File
+}
+
+// Warning is a remark about a struct Tag changed or left alone.
+type Warning struct {
+	Pos token.Position
+	Msg string
+}
+
+func (w Warning) String() string { return w.Pos.String() + ": " + w.Msg }
+
+// Tag adds relish tags to the struct types declared in f, which must have
+// been parsed with comments using fset, and returns the formatted source
+// of the result. It returns nil source if there was nothing to tag, or if
+// f is generated code, which the next run of its generator would undo.
+func Tag(fset *token.FileSet, f *ast.File, opts Options) ([]byte, []Warning, error) {
+	if ast.IsGenerated(f) {
+		return nil, nil, nil
+	}
+	t := &tagger{fset: fset, opts: opts}
+	for _, d := range f.Decls {
+		g, ok := d.(*ast.GenDecl)
+		if !ok || g.Tok != token.TYPE {
+			continue
+		}
+		for _, s := range g.Specs {
+			spec := s.(*ast.TypeSpec)
+			st, ok := spec.Type.(*ast.StructType)
+			if !ok || !t.wanted(spec.Name.Name) {
+				continue
+			}
+			if err := t.structType(spec.Name.Name, st); err != nil {
+				return nil, t.warnings, err
+			}
+		}
+	}
+	if !t.changed {
+		return nil, t.warnings, nil
+	}
+	var b bytes.Buffer
+	if err := format.Node(&b, fset, f); err != nil {
+		return nil, t.warnings, err
+	}
+	return b.Bytes(), t.warnings, nil
+}
+
+type tagger struct {
+	fset     *token.FileSet
+	opts     Options
+	changed  bool
+	warnings []Warning
+}
+
+func (t *tagger) wanted(name string) bool {
+	if len(t.opts.Types) == 0 {
+		return true
+	}
+	for _, n := range t.opts.Types {
+		if n == name {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *tagger) warnf(pos token.Pos, format string, args ...any) {
+	t.warnings = append(t.warnings, Warning{Pos: t.fset.Position(pos), Msg: fmt.Sprintf(format, args...)})
+}
+
+// fieldTag returns the unquoted tag of f, or "" if it is malformed.
+func fieldTag(f *ast.Field) reflect.StructTag {
+	if f.Tag == nil {
+		return ""
+	}
+	s, err := strconv.Unquote(f.Tag.Value)
+	if err != nil {
+		return ""
+	}
+	return reflect.StructTag(s)
+}
+
+func (t *tagger) structType(name string, st *ast.StructType) error {
+	// next is above every ID the struct or its lockfile entries use;
+	// used holds the IDs tagged in the source.
+	next := 0
+	used := make(map[int]bool)
+	locked := make(map[string]int)
+	take := func(id int) {
+		if id >= next {
+			next = id + 1
+		}
+	}
+	if t.opts.Lock != nil {
+		for _, e := range t.opts.Lock.Entries {
+			if e.Type == name {
+				take(e.ID)
+				if e.Name != "" {
+					locked[e.Name] = e.ID
+				}
+			}
+		}
+	}
+	var todo []*ast.Field
+	tagged, optional := 0, 0
+	for _, f := range st.Fields.List {
+		if inner, ok := f.Type.(*ast.StructType); ok && len(f.Names) == 1 {
+			if err := t.structType(name+"."+f.Names[0].Name, inner); err != nil {
+				return err
+			}
+		}
+		if f.Tag != nil {
+			if _, err := strconv.Unquote(f.Tag.Value); err != nil {
+				t.warnf(f.Tag.Pos(), "%s: malformed tag left alone", name)
+				continue
+			}
+		}
+		tag, ok := fieldTag(f).Lookup("relish")
+		if ok {
+			if tag == "-" {
+				continue
+			}
+			id, err := strconv.Atoi(strings.Split(tag, ",")[0])
+			if err == nil {
+				take(id)
+				used[id] = true
+			}
+			if strings.Contains(tag, ",reserved") {
+				continue // a retired ID, not a field
+			}
+			tagged++
+			if strings.Contains(tag, ",optional") {
+				optional++
+			}
+			continue
+		}
+		if len(f.Names) > 1 {
+			t.warnf(f.Pos(), "%s: fields declared together are not tagged; declare each on its own line", name)
+			continue
+		}
+		if !token.IsExported(fieldName(f)) || fieldTag(f).Get("json") == "-" {
+			continue
+		}
+		switch f.Type.(type) {
+		case *ast.FuncType, *ast.ChanType:
+			continue
+		}
+		todo = append(todo, f)
+	}
+	for _, f := range todo {
+		id, ok := locked[fieldName(f)]
+		if !ok || used[id] {
+			id = next
+		}
+		if id > 127 {
+			return fmt.Errorf("%v: %s: no field IDs left for %s; IDs must be 0 to 127", t.fset.Position(f.Pos()), name, fieldName(f))
+		}
+		take(id)
+		used[id] = true
+		tag := strconv.Itoa(id)
+		if _, ok := f.Type.(*ast.StarExpr); ok {
+			tag += ",optional"
+			optional++
+		}
+		setTag(f, `relish:"`+tag+`"`)
+		tagged++
+		t.changed = true
+	}
+	if len(todo) > 0 && tagged > 0 && optional == tagged {
+		t.warnf(st.Pos(), "%s: every tagged field is optional, so values with exactly one field set encode as enums", name)
+	}
+	return nil
+}
+
+// fieldName returns the name of f, which declares at most one field.
+func fieldName(f *ast.Field) string {
+	if len(f.Names) == 1 {
+		return f.Names[0].Name
+	}
+	e := f.Type
+	for {
+		switch x := e.(type) {
+		case *ast.StarExpr:
+			e = x.X
+		case *ast.SelectorExpr:
+			return x.Sel.Name
+		case *ast.IndexExpr:
+			e = x.X
+		case *ast.IndexListExpr:
+			e = x.X
+		case *ast.Ident:
+			return x.Name
+		default:
+			return ""
+		}
+	}
+}
+
+// setTag appends the key:"value" pair kv to the tag of f, keeping the
+// tag's quoting.
+func setTag(f *ast.Field, kv string) {
+	if f.Tag == nil {
+		f.Tag = &ast.BasicLit{ValuePos: f.Type.End(), Kind: token.STRING, Value: "`" + kv + "`"}
+		return
+	}
+	s, _ := strconv.Unquote(f.Tag.Value)
+	if s = strings.TrimSpace(s); s != "" {
+		s += " "
+	}
+	s += kv
+	if strings.HasPrefix(f.Tag.Value, "`") && !strings.Contains(s, "`") {
+		f.Tag.Value = "`" + s + "`"
+	} else {
+		f.Tag.Value = strconv.Quote(s)
+	}
+}
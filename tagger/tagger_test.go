@@ -0,0 +1,128 @@
+package tagger
+
+import (
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/dadrian/relish/lockfile"
+)
+
+const src = `package p
+
+// Order is an order.
+type Order struct {
+	ID    uint64            ` + "`json:\"id\"`" + ` // primary key
+	Note  *string           ` + "`json:\"note,omitempty\"`" + `
+	Lines []Line
+	Kept  int               ` + "`relish:\"4\"`" + `
+	Skip  string            ` + "`json:\"-\"`" + `
+	A, B  int
+	hidden int
+	Done  chan bool
+	Meta  struct {
+		Key string
+	}
+	_     struct{}          ` + "`relish:\"6,reserved\"`" + `
+	Count int               "json:\"count\""
+}
+
+type Line struct {
+	SKU string
+}
+
+type Choice struct {
+	X *int
+	Y *string
+}
+
+type Patch struct {
+	_    struct{} ` + "`relish:\"0,reserved\"`" + `
+	Name *string
+}
+`
+
+const want = `package p
+
+// Order is an order.
+type Order struct {
+	ID     uint64  ` + "`json:\"id\" relish:\"10\"`" + ` // primary key
+	Note   *string ` + "`json:\"note,omitempty\" relish:\"11,optional\"`" + `
+	Lines  []Line  ` + "`relish:\"2\"`" + `
+	Kept   int     ` + "`relish:\"4\"`" + `
+	Skip   string  ` + "`json:\"-\"`" + `
+	A, B   int
+	hidden int
+	Done   chan bool
+	Meta   struct {
+		Key string ` + "`relish:\"0\"`" + `
+	} ` + "`relish:\"12\"`" + `
+	_     struct{} ` + "`relish:\"6,reserved\"`" + `
+	Count int      "json:\"count\" relish:\"13\""
+}
+
+type Line struct {
+	SKU string ` + "`relish:\"0\"`" + `
+}
+
+type Choice struct {
+	X *int    ` + "`relish:\"0,optional\"`" + `
+	Y *string ` + "`relish:\"1,optional\"`" + `
+}
+
+type Patch struct {
+	_    struct{} ` + "`relish:\"0,reserved\"`" + `
+	Name *string  ` + "`relish:\"1,optional\"`" + `
+}
+`
+
+func TestTag(t *testing.T) {
+	lock, err := lockfile.Parse("relish.lock", []byte("Order 2 field Lines array<struct Line>\nOrder 9 retired Old u8\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	out, warnings, err := Tag(fset, f, Options{Lock: lock})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(out) != want {
+		t.Errorf("Tag =\n%s\nwant\n%s", out, want)
+	}
+	var got []string
+	for _, w := range warnings {
+		got = append(got, w.String())
+	}
+	wantWarnings := []string{
+		"p.go:10:2: Order: fields declared together are not tagged; declare each on its own line",
+		"p.go:24:13: Choice: every tagged field is optional, so values with exactly one field set encode as enums",
+		"p.go:29:12: Patch: every tagged field is optional, so values with exactly one field set encode as enums",
+	}
+	if !reflect.DeepEqual(got, wantWarnings) {
+		t.Errorf("warnings =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(wantWarnings, "\n"))
+	}
+
+	// Tagged source has nothing left to tag.
+	f, err = parser.ParseFile(fset, "p.go", out, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, _, err := Tag(fset, f, Options{Lock: lock, Types: []string{"Order", "Line"}}); out != nil || err != nil {
+		t.Errorf("Tag of tagged source = %s, %v", out, err)
+	}
+
+	// Generated code is left to its generator.
+	f, err = parser.ParseFile(fset, "gen.go", "// Code generated by stringer. DO NOT EDIT.\n\n"+src, parser.ParseComments)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out, warnings, err := Tag(fset, f, Options{}); out != nil || warnings != nil || err != nil {
+		t.Errorf("Tag of generated source = %s, %v, %v", out, warnings, err)
+	}
+}
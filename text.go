@@ -0,0 +1,707 @@
+package relish
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	intr "github.com/dadrian/relish/internal"
+)
+
+// The text format writes each value as its type followed by its content:
+//
+//	null
+//	true
+//	u32 42
+//	f64 -1.5
+//	"hi"
+//	timestamp 1700000000
+//	u128 0x0123456789abcdef0123456789abcdef
+//	array<u8>[1, 2]
+//	map<string,u64>{"a": 1}
+//	struct{0: u32 42, 1: "hi", 5: true}
+//	enum 3: null
+//
+// Strings and bools need no type name. Inside arrays and maps the element
+// types are already known, so numbers are written bare. Integers may be
+// written in any base Go accepts (0x1F, 0b101, 1_000); floats accept inf,
+// -inf, nan, and nan(0x...) for a NaN with a particular bit pattern. A
+// timestamp may also be given as an RFC 3339 string. Text from # or // to
+// the end of a line is a comment, and lists may end with a trailing comma.
+
+// FormatText renders data in the text format. If rt is not nil, struct
+// field IDs and enum variant IDs are written as the names of the matching
+// fields of rt.
+func FormatText(data []byte, rt reflect.Type) (string, error) {
+	if err := firstError(Validate(data)); err != nil {
+		return "", err
+	}
+	t, c, _, _ := splitValue(data)
+	var b strings.Builder
+	writeText(&b, t, c, rt, false)
+	return b.String(), nil
+}
+
+// writeText writes the value with type t and content c. If bare is set,
+// scalars other than strings and bools are written without their type.
+func writeText(b *strings.Builder, t byte, c []byte, rt reflect.Type, bare bool) {
+	for rt != nil && rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	le := binary.LittleEndian
+	if !bare {
+		switch TypeID(t) {
+		case TypeNull, TypeBool, TypeString, TypeArray, TypeMap, TypeStruct, TypeEnum:
+		default:
+			b.WriteString(TypeID(t).String())
+			b.WriteByte(' ')
+		}
+	}
+	switch TypeID(t) {
+	case TypeNull:
+		b.WriteString("null")
+	case TypeBool:
+		b.WriteString(strconv.FormatBool(c[0] == 0xFF))
+	case TypeU8, TypeU16, TypeU32, TypeU64, TypeI8, TypeI16, TypeI32, TypeI64:
+		lit, _ := keyLiteral(t, c)
+		b.WriteString(lit)
+	case TypeU128:
+		b.WriteString("0x" + int128(c, false).Text(16))
+	case TypeI128:
+		b.WriteString(int128(c, true).String())
+	case TypeF32:
+		bits := le.Uint32(c)
+		b.WriteString(formatFloat(float64(math.Float32frombits(bits)), uint64(bits), 32, 0x7FC00000))
+	case TypeF64:
+		bits := le.Uint64(c)
+		b.WriteString(formatFloat(math.Float64frombits(bits), bits, 64, 0x7FF8000000000000))
+	case TypeTimestamp:
+		b.WriteString(strconv.FormatUint(le.Uint64(c), 10))
+	case TypeString:
+		b.WriteString(strconv.Quote(string(c)))
+	case TypeArray:
+		et := c[0]
+		var ert reflect.Type
+		if rt != nil && (rt.Kind() == reflect.Slice || rt.Kind() == reflect.Array) {
+			ert = rt.Elem()
+		}
+		fmt.Fprintf(b, "array<%v>[", TypeID(et))
+		for i, ec := range splitElems(et, c[1:]) {
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeText(b, et, ec, ert, true)
+		}
+		b.WriteByte(']')
+	case TypeMap:
+		kt, vt := c[0], c[1]
+		var krt, vrt reflect.Type
+		if rt != nil && rt.Kind() == reflect.Map {
+			krt, vrt = rt.Key(), rt.Elem()
+		}
+		fmt.Fprintf(b, "map<%v,%v>{", TypeID(kt), TypeID(vt))
+		for i, p := 0, c[2:]; len(p) > 0; i++ {
+			kc, vc, next, _ := splitEntry(kt, vt, p)
+			if i > 0 {
+				b.WriteString(", ")
+			}
+			writeText(b, kt, kc, krt, true)
+			b.WriteString(": ")
+			writeText(b, vt, vc, vrt, true)
+			p = next
+		}
+		b.WriteByte('}')
+	case TypeStruct:
+		b.WriteString("struct{")
+		for p := c; len(p) > 0; {
+			if len(p) < len(c) {
+				b.WriteString(", ")
+			}
+			ft, fc, next, _ := splitValue(p[1:])
+			frt := writeFieldRef(b, rt, p[0])
+			b.WriteString(": ")
+			writeText(b, ft, fc, frt, false)
+			p = next
+		}
+		b.WriteByte('}')
+	case TypeEnum:
+		b.WriteString("enum ")
+		vt, vc, _, _ := splitValue(c[1:])
+		vrt := writeFieldRef(b, rt, c[0])
+		b.WriteString(": ")
+		writeText(b, vt, vc, vrt, false)
+	}
+}
+
+// writeFieldRef writes the name of field id of rt, or the ID if rt has
+// no such field, and returns the field's type.
+func writeFieldRef(b *strings.Builder, rt reflect.Type, id byte) reflect.Type {
+	name, ft := fieldByID(rt, id)
+	if name == "" {
+		name = strconv.Itoa(int(id))
+	}
+	b.WriteString(name)
+	return ft
+}
+
+func formatFloat(f float64, bits uint64, size int, quietNaN uint64) string {
+	switch {
+	case f != f && bits == quietNaN:
+		return "nan"
+	case f != f:
+		return fmt.Sprintf("nan(%#x)", bits)
+	case math.IsInf(f, 1):
+		return "inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, size)
+}
+
+// int128 converts little-endian 128-bit content to a big.Int.
+func int128(c []byte, signed bool) *big.Int {
+	var be [16]byte
+	for i := range be {
+		be[i] = c[15-i]
+	}
+	n := new(big.Int).SetBytes(be[:])
+	if signed && be[0]&0x80 != 0 {
+		n.Sub(n, new(big.Int).Lsh(big.NewInt(1), 128))
+	}
+	return n
+}
+
+// ParseText parses a value written in the text format and returns its
+// encoding. If rt is not nil, struct fields and enum variants may be given
+// by the names of the fields of rt, and numbers whose type follows from rt
+// may be written bare. Struct fields may appear in any order; they are
+// encoded in ID order. Errors are of kind ErrSyntax, or ErrTypeMismatch or
+// ErrDuplicateMapKey for well-formed text that describes an invalid value,
+// with Offset giving the byte offset in text.
+func ParseText(text string, rt reflect.Type) ([]byte, error) {
+	p := &textParser{s: text}
+	t, c, err := p.value(anyType, false, rt)
+	if err != nil {
+		return nil, err
+	}
+	p.space()
+	if p.i < len(p.s) {
+		return nil, p.errorf(ErrSyntax, "unexpected %s after value", p.near())
+	}
+	return appendValue(nil, t, c), nil
+}
+
+// anyType is the type hint for a value whose type is not known.
+const anyType = 0xFF
+
+type textParser struct {
+	s string
+	i int
+}
+
+func (p *textParser) errorf(kind ErrorKind, format string, args ...any) error {
+	return p.errorAt(p.i, kind, format, args...)
+}
+
+func (p *textParser) errorAt(pos int, kind ErrorKind, format string, args ...any) error {
+	line := 1 + strings.Count(p.s[:pos], "\n")
+	col := 1 + utf8.RuneCountInString(p.s[strings.LastIndexByte(p.s[:pos], '\n')+1:pos])
+	return &Error{Offset: int64(pos), Kind: kind, Detail: fmt.Sprintf("line %d, column %d: ", line, col) + fmt.Sprintf(format, args...)}
+}
+
+// near describes the text at the current position for error messages.
+func (p *textParser) near() string {
+	if p.i >= len(p.s) {
+		return "end of input"
+	}
+	if tok := p.peekToken(); tok != "" {
+		return strconv.Quote(tok)
+	}
+	r, _ := utf8.DecodeRuneInString(p.s[p.i:])
+	return strconv.QuoteRune(r)
+}
+
+// space skips whitespace and comments.
+func (p *textParser) space() {
+	for p.i < len(p.s) {
+		switch c := p.s[p.i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			p.i++
+		case c == '#' || c == '/' && strings.HasPrefix(p.s[p.i:], "//"):
+			for p.i < len(p.s) && p.s[p.i] != '\n' {
+				p.i++
+			}
+		default:
+			return
+		}
+	}
+}
+
+func (p *textParser) peek(c byte) bool {
+	p.space()
+	return p.i < len(p.s) && p.s[p.i] == c
+}
+
+func (p *textParser) expect(c byte) error {
+	if !p.peek(c) {
+		return p.errorf(ErrSyntax, "expected %q, found %s", c, p.near())
+	}
+	p.i++
+	return nil
+}
+
+func isTokenByte(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c) || strings.IndexByte("_.+-()", c) >= 0
+}
+
+func (p *textParser) peekToken() string {
+	j := p.i
+	for j < len(p.s) && isTokenByte(p.s[j]) {
+		j++
+	}
+	return p.s[p.i:j]
+}
+
+// token returns the next run of identifier and number characters.
+func (p *textParser) token() string {
+	p.space()
+	tok := p.peekToken()
+	p.i += len(tok)
+	return tok
+}
+
+func isIdent(s string) bool {
+	if s == "" || isDigit(s[0]) {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		if c := s[i]; !(c == '_' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || isDigit(c)) {
+			return false
+		}
+	}
+	return true
+}
+
+var typeByName = func() map[string]byte {
+	m := make(map[string]byte, len(typeNames))
+	for t, name := range typeNames {
+		m[name] = byte(t)
+	}
+	return m
+}()
+
+// value parses one value. want is the value's type if known, or anyType.
+// If strict is set the value must have type want, as for array elements
+// and map entries; otherwise want, which then comes from rt, only
+// supplies the type of bare numbers.
+func (p *textParser) value(want byte, strict bool, rt reflect.Type) (byte, []byte, error) {
+	for rt != nil && rt.Kind() == reflect.Pointer {
+		rt = rt.Elem()
+	}
+	p.space()
+	start := p.i
+	t, c, err := p.untypedValue(want, rt)
+	if err != nil {
+		return 0, nil, err
+	}
+	if strict && t != want {
+		return 0, nil, p.errorAt(start, ErrTypeMismatch, "expected %v, found %v", TypeID(want), TypeID(t))
+	}
+	return t, c, nil
+}
+
+func (p *textParser) untypedValue(want byte, rt reflect.Type) (byte, []byte, error) {
+	if p.i >= len(p.s) {
+		return 0, nil, p.errorf(ErrSyntax, "expected value, found end of input")
+	}
+	switch c := p.s[p.i]; {
+	case c == '"':
+		s, err := p.str()
+		if err != nil {
+			return 0, nil, err
+		}
+		if want == byte(TypeTimestamp) {
+			return p.timestamp(s)
+		}
+		return byte(TypeString), []byte(s), nil
+	case c == '{' && structLike(want):
+		c, err := p.structBody(rt)
+		return byte(TypeStruct), c, err
+	case !isTokenByte(c):
+		return 0, nil, p.errorf(ErrSyntax, "expected value, found %s", p.near())
+	}
+	start := p.i
+	tok := p.peekToken()
+	t, ok := typeByName[tok]
+	switch {
+	case tok == "null":
+		p.i += len(tok)
+		return byte(TypeNull), nil, nil
+	case tok == "true" || tok == "false":
+		p.i += len(tok)
+		return p.scalar(byte(TypeBool), tok, start)
+	case tok == "struct":
+		p.i += len(tok)
+		c, err := p.structBody(rt)
+		return byte(TypeStruct), c, err
+	case tok == "enum":
+		p.i += len(tok)
+		c, err := p.enumBody(rt)
+		return byte(TypeEnum), c, err
+	case tok == "array":
+		p.i += len(tok)
+		c, err := p.arrayBody(rt)
+		return byte(TypeArray), c, err
+	case tok == "map":
+		p.i += len(tok)
+		c, err := p.mapBody(rt)
+		return byte(TypeMap), c, err
+	case ok:
+		p.i += len(tok)
+		p.space()
+		if t == byte(TypeNull) {
+			return t, nil, nil
+		}
+		if p.peek('"') {
+			s, err := p.str()
+			if err != nil {
+				return 0, nil, err
+			}
+			switch TypeID(t) {
+			case TypeString:
+				return t, []byte(s), nil
+			case TypeTimestamp:
+				return p.timestamp(s)
+			}
+			return 0, nil, p.errorAt(start, ErrSyntax, "%v value cannot be a string", TypeID(t))
+		}
+		lit := p.token()
+		if lit == "" {
+			return 0, nil, p.errorf(ErrSyntax, "expected %v value, found %s", TypeID(t), p.near())
+		}
+		return p.scalar(t, lit, p.i-len(lit))
+	case want != anyType && !structLike(want) && TypeID(want) != TypeArray && TypeID(want) != TypeMap:
+		p.i += len(tok)
+		return p.scalar(want, tok, start)
+	case isDigit(tok[0]) || tok[0] == '-' || tok[0] == '+':
+		return 0, nil, p.errorf(ErrSyntax, "number %s needs a type, as in u32 %s", tok, tok)
+	}
+	return 0, nil, p.errorf(ErrSyntax, "unknown type %q", tok)
+}
+
+// str parses a double-quoted string with Go escapes.
+func (p *textParser) str() (string, error) {
+	q, err := strconv.QuotedPrefix(p.s[p.i:])
+	if err != nil || q[0] != '"' {
+		return "", p.errorf(ErrSyntax, "unterminated or invalid string literal")
+	}
+	s, _ := strconv.Unquote(q)
+	if !utf8.ValidString(s) {
+		return "", p.errorf(ErrInvalidUTF8, "string literal is not valid UTF-8")
+	}
+	p.i += len(q)
+	return s, nil
+}
+
+func (p *textParser) timestamp(s string) (byte, []byte, error) {
+	tm, err := time.Parse(time.RFC3339, s)
+	if err != nil || tm.Unix() < 0 {
+		return 0, nil, p.errorf(ErrSyntax, "invalid timestamp %q", s)
+	}
+	return byte(TypeTimestamp), binary.LittleEndian.AppendUint64(nil, uint64(tm.Unix())), nil
+}
+
+// scalar parses literal lit, found at offset at, as a value of type t.
+func (p *textParser) scalar(t byte, lit string, at int) (byte, []byte, error) {
+	c, ok := scalarContent(t, lit)
+	if ok {
+		return t, c, nil
+	}
+	if _, fixed := intr.FixedSize(t); fixed && TypeID(t) != TypeNull {
+		return 0, nil, p.errorAt(at, ErrSyntax, "invalid %v value %q", TypeID(t), lit)
+	}
+	return 0, nil, p.errorAt(at, ErrSyntax, "%v values cannot be written as %q", TypeID(t), lit)
+}
+
+// scalarContent parses literal lit as the content of a fixed-size value
+// of type t. Integers may be in any base Go accepts, and floats may be
+// inf, -inf, nan or nan(0x...) for an exact NaN bit pattern.
+func scalarContent(t byte, lit string) ([]byte, bool) {
+	le := binary.LittleEndian
+	switch TypeID(t) {
+	case TypeBool:
+		switch lit {
+		case "true":
+			return []byte{0xFF}, true
+		case "false":
+			return []byte{0x00}, true
+		}
+	case TypeU8, TypeU16, TypeU32, TypeU64, TypeTimestamp:
+		sz, _ := intr.FixedSize(t)
+		n, err := strconv.ParseUint(lit, 0, sz*8)
+		if err == nil {
+			return le.AppendUint64(nil, n)[:sz], true
+		}
+	case TypeI8, TypeI16, TypeI32, TypeI64:
+		sz, _ := intr.FixedSize(t)
+		n, err := strconv.ParseInt(lit, 0, sz*8)
+		if err == nil {
+			return le.AppendUint64(nil, uint64(n))[:sz], true
+		}
+	case TypeU128, TypeI128:
+		n, ok := new(big.Int).SetString(lit, 0)
+		if !ok {
+			return nil, false
+		}
+		min, max := big.NewInt(0), new(big.Int).Lsh(big.NewInt(1), 128)
+		if TypeID(t) == TypeI128 {
+			min = new(big.Int).Neg(new(big.Int).Rsh(max, 1))
+			max = new(big.Int).Rsh(max, 1)
+		}
+		if n.Cmp(min) < 0 || n.Cmp(max) >= 0 {
+			return nil, false
+		}
+		if n.Sign() < 0 {
+			n.Add(n, new(big.Int).Lsh(big.NewInt(1), 128))
+		}
+		var be [16]byte
+		n.FillBytes(be[:])
+		out := make([]byte, 16)
+		for i := range out {
+			out[i] = be[15-i]
+		}
+		return out, true
+	case TypeF32, TypeF64:
+		sz, _ := intr.FixedSize(t)
+		var bits uint64
+		if strings.HasPrefix(lit, "nan(") && strings.HasSuffix(lit, ")") {
+			n, err := strconv.ParseUint(lit[4:len(lit)-1], 0, sz*8)
+			if err != nil {
+				return nil, false
+			}
+			bits = n
+		} else {
+			f, err := strconv.ParseFloat(lit, sz*8)
+			if err != nil {
+				return nil, false
+			}
+			if sz == 4 {
+				bits = uint64(math.Float32bits(float32(f)))
+				if f != f {
+					bits = 0x7FC00000
+				}
+			} else {
+				bits = math.Float64bits(f)
+				if f != f {
+					bits = 0x7FF8000000000000
+				}
+			}
+		}
+		return le.AppendUint64(nil, bits)[:sz], true
+	}
+	return nil, false
+}
+
+// typeRef parses a type name inside array<...> or map<...>.
+func (p *textParser) typeRef() (byte, error) {
+	start := p.token()
+	t, ok := typeByName[start]
+	if !ok {
+		p.i -= len(start)
+		return 0, p.errorf(ErrSyntax, "expected type name, found %s", p.near())
+	}
+	return t, nil
+}
+
+// fieldRef parses a field or variant ID or, if rt is known, name, and
+// returns the ID and the field's type.
+func (p *textParser) fieldRef(rt reflect.Type) (byte, reflect.Type, error) {
+	tok := p.token()
+	at := p.i - len(tok)
+	if isIdent(tok) {
+		id, ft, ok := fieldByName(rt, tok)
+		if !ok {
+			return 0, nil, p.errorAt(at, ErrSyntax, "unknown field name %q", tok)
+		}
+		return id, ft, nil
+	}
+	n, err := strconv.ParseUint(tok, 10, 8)
+	if err != nil || n >= 0x80 {
+		p.i = at
+		return 0, nil, p.errorf(ErrSyntax, "expected field id or name, found %s", p.near())
+	}
+	_, ft := fieldByID(rt, byte(n))
+	return byte(n), ft, nil
+}
+
+// list parses comma-separated items up to close, calling item for each.
+func (p *textParser) list(close byte, item func() error) error {
+	for {
+		if p.peek(close) {
+			p.i++
+			return nil
+		}
+		if err := item(); err != nil {
+			return err
+		}
+		if p.peek(',') {
+			p.i++
+			continue
+		}
+		return p.expect(close)
+	}
+}
+
+func (p *textParser) structBody(rt reflect.Type) ([]byte, error) {
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	type field struct {
+		id  byte
+		tlv []byte
+	}
+	var fields []field
+	seen := make(map[byte]bool)
+	err := p.list('}', func() error {
+		p.space()
+		at := p.i
+		id, ft, err := p.fieldRef(rt)
+		if err != nil {
+			return err
+		}
+		if seen[id] {
+			return p.errorAt(at, ErrSyntax, "duplicate field %d", id)
+		}
+		seen[id] = true
+		if err := p.expect(':'); err != nil {
+			return err
+		}
+		t, c, err := p.value(hintType(ft), false, ft)
+		if err != nil {
+			return err
+		}
+		fields = append(fields, field{id, appendValue(nil, t, c)})
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(fields, func(i, j int) bool { return fields[i].id < fields[j].id })
+	var out []byte
+	for _, f := range fields {
+		out = append(append(out, f.id), f.tlv...)
+	}
+	return out, nil
+}
+
+// hintType returns the Relish type of Go type rt, or anyType.
+func hintType(rt reflect.Type) byte {
+	if rt == nil {
+		return anyType
+	}
+	t, err := typeIDOf(rt)
+	if err != nil {
+		return anyType
+	}
+	return t
+}
+
+func (p *textParser) enumBody(rt reflect.Type) ([]byte, error) {
+	id, vrt, err := p.fieldRef(rt)
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(':'); err != nil {
+		return nil, err
+	}
+	t, c, err := p.value(hintType(vrt), false, vrt)
+	if err != nil {
+		return nil, err
+	}
+	return appendValue([]byte{id}, t, c), nil
+}
+
+func (p *textParser) arrayBody(rt reflect.Type) ([]byte, error) {
+	if err := p.expect('<'); err != nil {
+		return nil, err
+	}
+	et, err := p.typeRef()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect('>'); err != nil {
+		return nil, err
+	}
+	if err := p.expect('['); err != nil {
+		return nil, err
+	}
+	var ert reflect.Type
+	if rt != nil && (rt.Kind() == reflect.Slice || rt.Kind() == reflect.Array) {
+		ert = rt.Elem()
+	}
+	out := []byte{et}
+	err = p.list(']', func() error {
+		_, c, err := p.value(et, true, ert)
+		out = appendElem(out, et, c)
+		return err
+	})
+	return out, err
+}
+
+func (p *textParser) mapBody(rt reflect.Type) ([]byte, error) {
+	if err := p.expect('<'); err != nil {
+		return nil, err
+	}
+	kt, err := p.typeRef()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect(','); err != nil {
+		return nil, err
+	}
+	vt, err := p.typeRef()
+	if err != nil {
+		return nil, err
+	}
+	if err := p.expect('>'); err != nil {
+		return nil, err
+	}
+	if err := p.expect('{'); err != nil {
+		return nil, err
+	}
+	var krt, vrt reflect.Type
+	if rt != nil && rt.Kind() == reflect.Map {
+		krt, vrt = rt.Key(), rt.Elem()
+	}
+	out := []byte{kt, vt}
+	seen := make(map[string]bool)
+	err = p.list('}', func() error {
+		p.space()
+		at := p.i
+		_, kc, err := p.value(kt, true, krt)
+		if err != nil {
+			return err
+		}
+		if seen[string(kc)] {
+			return p.errorAt(at, ErrDuplicateMapKey, "duplicate map key")
+		}
+		seen[string(kc)] = true
+		if err := p.expect(':'); err != nil {
+			return err
+		}
+		_, vc, err := p.value(vt, true, vrt)
+		if err != nil {
+			return err
+		}
+		out = appendElem(appendElem(out, kt, kc), vt, vc)
+		return nil
+	})
+	return out, err
+}
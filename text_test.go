@@ -0,0 +1,143 @@
+package relish
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestText_RoundTrip(t *testing.T) {
+	for _, text := range []string{
+		`null`,
+		`true`,
+		`u32 42`,
+		`i8 -128`,
+		`f32 1.5`,
+		`f64 -0`,
+		`f64 nan`,
+		`f64 nan(0x7ff8000000000001)`,
+		`f32 -inf`,
+		`"hi\n\"there\""`,
+		`timestamp 1700000000`,
+		`u128 0x123456789abcdef0123456789abcdef`,
+		`i128 -170141183460469231731687303715884105728`,
+		`array<u8>[1, 2]`,
+		`array<string>[]`,
+		`array<struct>[struct{0: u16 1}, struct{}]`,
+		`array<array>[array<u8>[1], array<bool>[true]]`,
+		`map<string,u64>{"a": 1, "b": 18446744073709551615}`,
+		`map<i16,enum>{-1: enum 2: "x"}`,
+		`struct{0: u32 42, 1: "hi", 5: true}`,
+		`enum 3: null`,
+	} {
+		data, err := ParseText(text, nil)
+		if err != nil {
+			t.Fatalf("ParseText(%q): %v", text, err)
+		}
+		if errs := Validate(data); len(errs) > 0 {
+			t.Fatalf("ParseText(%q) produced invalid encoding: %v", text, errs[0])
+		}
+		got, err := FormatText(data, nil)
+		if err != nil {
+			t.Fatalf("FormatText(%q): %v", text, err)
+		}
+		if got != text {
+			t.Fatalf("round trip of %q gave %q", text, got)
+		}
+	}
+}
+
+func TestText_MatchesEncoder(t *testing.T) {
+	type Shape struct {
+		Circle *float64 `relish:"0,optional"`
+		Label  *string  `relish:"1,optional"`
+	}
+	type Msg struct {
+		ID     uint32            `relish:"0"`
+		Name   string            `relish:"1"`
+		Shapes []Shape           `relish:"2"`
+		Counts map[string]uint64 `relish:"3"`
+		At     time.Time         `relish:"4"`
+		Big    U128              `relish:"5"`
+	}
+	v := Msg{
+		ID: 7, Name: "n", Shapes: []Shape{{Circle: ptr(2.5)}, {Label: ptr("sq")}},
+		Counts: map[string]uint64{"a": 1}, At: time.Unix(1700000000, 0).UTC(), Big: U128{0: 1},
+	}
+	want, err := Marshal(v)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rt := reflect.TypeOf(v)
+	text, err := FormatText(want, rt)
+	if err != nil {
+		t.Fatal(err)
+	}
+	const wantText = `struct{ID: u32 7, Name: "n", Shapes: array<enum>[enum Circle: f64 2.5, enum Label: "sq"], ` +
+		`Counts: map<string,u64>{"a": 1}, At: timestamp 1700000000, Big: u128 0x1}`
+	if text != wantText {
+		t.Fatalf("FormatText =\n%s\nwant\n%s", text, wantText)
+	}
+	for _, in := range []string{
+		wantText,
+		// Fields in any order, bare numbers from the Go type, comments.
+		`struct{
+			Big: 1, # low bit
+			Name: "n", ID: 7,
+			Shapes: array<enum>[enum Circle: 2.5, enum 1: "sq",],
+			Counts: map<string,u64>{"a": 1},
+			At: "2023-11-14T22:13:20Z", // RFC 3339
+		}`,
+	} {
+		got, err := ParseText(in, rt)
+		if err != nil {
+			t.Fatalf("ParseText(%q): %v", in, err)
+		}
+		if !bytes.Equal(got, want) {
+			t.Fatalf("ParseText(%q) =\n% x\nwant\n% x", in, got, want)
+		}
+	}
+}
+
+func TestText_Floats(t *testing.T) {
+	data, _ := Marshal(math.Float32frombits(0x7FC00001))
+	text, _ := FormatText(data, nil)
+	back, err := ParseText(text, nil)
+	if err != nil || !bytes.Equal(back, data) {
+		t.Fatalf("%s round trip = % x, %v; want % x", text, back, err, data)
+	}
+}
+
+func TestText_Errors(t *testing.T) {
+	for _, c := range []struct {
+		text   string
+		kind   ErrorKind
+		offset int64
+	}{
+		{`42`, ErrSyntax, 0},
+		{`u8 256`, ErrSyntax, 3},
+		{`struct{0: u32 1,`, ErrSyntax, 16},
+		{`struct{0: u32 1 1: true}`, ErrSyntax, 16},
+		{"struct{\n  0: true,\n  0: false}", ErrSyntax, 21},
+		{`struct{200: null}`, ErrSyntax, 7},
+		{`struct{Name: null}`, ErrSyntax, 7},
+		{`array<u8>[1, "x"]`, ErrTypeMismatch, 13},
+		{`array<nope>[]`, ErrSyntax, 6},
+		{`map<u8,u8>{1: 2, 1: 3}`, ErrDuplicateMapKey, 17},
+		{`"abc`, ErrSyntax, 0},
+		{`true false`, ErrSyntax, 5},
+		{`enum 1 null`, ErrSyntax, 7},
+	} {
+		_, err := ParseText(c.text, nil)
+		e, ok := err.(*Error)
+		if !ok || e.Kind != c.kind || e.Offset != c.offset {
+			t.Fatalf("ParseText(%q) error = %v, want %v at %d", c.text, err, c.kind, c.offset)
+		}
+	}
+	_, err := ParseText("struct{\n  0: true,\n  0: false}", nil)
+	if want := "relish: syntax error at 21: line 3, column 3: duplicate field 0"; err.Error() != want {
+		t.Fatalf("error = %q, want %q", err, want)
+	}
+}
@@ -1,5 +1,7 @@
 package relish
 
+import "fmt"
+
 // TypeID identifies a Relish type. Top bit must be 0 per spec.
 type TypeID byte
 
@@ -26,6 +28,36 @@ const (
 	TypeTimestamp TypeID = 0x13
 )
 
+var typeNames = map[TypeID]string{
+	TypeNull:      "null",
+	TypeBool:      "bool",
+	TypeU8:        "u8",
+	TypeU16:       "u16",
+	TypeU32:       "u32",
+	TypeU64:       "u64",
+	TypeU128:      "u128",
+	TypeI8:        "i8",
+	TypeI16:       "i16",
+	TypeI32:       "i32",
+	TypeI64:       "i64",
+	TypeI128:      "i128",
+	TypeF32:       "f32",
+	TypeF64:       "f64",
+	TypeString:    "string",
+	TypeArray:     "array",
+	TypeMap:       "map",
+	TypeStruct:    "struct",
+	TypeEnum:      "enum",
+	TypeTimestamp: "timestamp",
+}
+
+func (t TypeID) String() string {
+	if s, ok := typeNames[t]; ok {
+		return s
+	}
+	return fmt.Sprintf("TypeID(0x%02x)", byte(t))
+}
+
 // Null represents the Relish Null value.
 type Null struct{}
 
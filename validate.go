@@ -0,0 +1,271 @@
+package relish
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"unicode/utf8"
+
+	intr "github.com/dadrian/relish/internal"
+)
+
+// Validate checks that data holds exactly one value satisfying every
+// parsing requirement in SPEC.md, without decoding into a Go type.
+//
+// Unlike Unmarshal it does not stop at the first problem: each violation
+// is reported with its offset and path, and checking resumes at the next
+// value whose framing is still known. A nil result means data is valid.
+func Validate(data []byte) []*Error {
+	v := &validator{data: data}
+	if len(data) == 0 {
+		v.report(0, ErrUnexpectedEOF, "", "empty input")
+		return v.errs
+	}
+	next := v.value(0, len(data), "")
+	if next >= 0 && next < len(data) {
+		v.report(next, ErrTrailingData, "", "%d bytes after value", len(data)-next)
+	}
+	return v.errs
+}
+
+// ValidateReader reads a single value from r and validates it as Validate
+// does. It reads the type byte, the length prefix and as many content
+// bytes as those give the value, and nothing after, so it can be called
+// repeatedly on a stream of concatenated values. The error
+// result is reserved for read failures; it is io.EOF if r is already at
+// its end, while a value cut short by EOF is reported as ErrUnexpectedEOF.
+func ValidateReader(r io.Reader) ([]*Error, error) {
+	var buf bytes.Buffer
+	read := func(n int64) (bool, error) {
+		_, err := io.CopyN(&buf, r, n)
+		if err == io.EOF {
+			return false, nil
+		}
+		return err == nil, err
+	}
+	if _, err := io.CopyN(&buf, r, 1); err != nil {
+		return nil, err
+	}
+	t := buf.Bytes()[0]
+	if sz, ok := intr.FixedSize(t); ok && t&0x80 == 0 {
+		if _, err := read(int64(sz)); err != nil {
+			return nil, err
+		}
+	} else if intr.IsVarSize(t) {
+		ok, err := read(1)
+		if err != nil {
+			return nil, err
+		}
+		if ok && buf.Bytes()[1]&0x01 != 0 {
+			ok, err = read(3)
+			if err != nil {
+				return nil, err
+			}
+		}
+		if ok {
+			n, _, _ := intr.SplitLen(buf.Bytes()[1:])
+			if _, err := read(int64(n)); err != nil {
+				return nil, err
+			}
+		}
+	}
+	return Validate(buf.Bytes()), nil
+}
+
+// validator accumulates every spec violation found while walking data.
+type validator struct {
+	data []byte
+	errs []*Error
+	eof  bool
+}
+
+func (v *validator) report(off int, kind ErrorKind, path, format string, args ...any) {
+	if kind == ErrUnexpectedEOF {
+		// Everything after the first truncation is truncated too.
+		if v.eof {
+			return
+		}
+		v.eof = true
+	}
+	v.errs = append(v.errs, &Error{Offset: int64(off), Kind: kind, Path: path, Detail: fmt.Sprintf(format, args...)})
+}
+
+// overrun reports a value at off that extends past end, the end of its
+// enclosing container (or of the input).
+func (v *validator) overrun(off, end int, path, what string) {
+	if end == len(v.data) {
+		v.report(off, ErrUnexpectedEOF, path, "%s extends past end of input", what)
+		return
+	}
+	v.report(off, ErrLengthOverflow, path, "%s extends past end of enclosing value", what)
+}
+
+// value validates the TLV at off, which must lie before end. It returns
+// the offset just past the value, or -1 if the value's extent could not be
+// determined and the caller must stop walking its container.
+func (v *validator) value(off, end int, path string) int {
+	t := v.data[off]
+	if !v.typeID(off, t, path, "type") {
+		return -1
+	}
+	return v.elem(t, off+1, end, path)
+}
+
+// typeID checks a type ID byte found at off.
+func (v *validator) typeID(off int, t byte, path, what string) bool {
+	if t&0x80 != 0 {
+		v.report(off, ErrInvalidTypeID, path, "%s id 0x%02x has top bit set", what, t)
+		return false
+	}
+	if !intr.IsKnownType(t) {
+		v.report(off, ErrInvalidTypeID, path, "unknown %s id 0x%02x", what, t)
+		return false
+	}
+	return true
+}
+
+// elem validates a value of type t at off without a leading type byte, as
+// laid out inside arrays and maps. It returns the offset past the value or
+// -1 as for value.
+func (v *validator) elem(t byte, off, end int, path string) int {
+	hdr, n, err := intr.SplitElem(t, v.data[off:end])
+	if err != nil {
+		v.overrun(off, end, path, "length prefix")
+		return -1
+	}
+	start := off + hdr
+	if n > end-start {
+		v.overrun(off, end, path, fmt.Sprintf("%s of %d bytes", TypeID(t), n))
+		return end
+	}
+	v.content(t, start, start+n, path)
+	return start + n
+}
+
+// content validates the content bytes [off, end) of a value of type t.
+func (v *validator) content(t byte, off, end int, path string) {
+	switch TypeID(t) {
+	case TypeBool:
+		if b := v.data[off]; b != 0x00 && b != 0xFF {
+			v.report(off, ErrInvalidValue, path, "bool byte 0x%02x is neither 0x00 nor 0xFF", b)
+		}
+	case TypeString:
+		s := v.data[off:end]
+		if !utf8.Valid(s) {
+			i := 0
+			for i < len(s) {
+				r, size := utf8.DecodeRune(s[i:])
+				if r == utf8.RuneError && size <= 1 {
+					break
+				}
+				i += size
+			}
+			v.report(off+i, ErrInvalidUTF8, path, "invalid utf-8 in string")
+		}
+	case TypeArray:
+		v.array(off, end, path)
+	case TypeMap:
+		v.mapContent(off, end, path)
+	case TypeStruct:
+		v.structContent(off, end, path)
+	case TypeEnum:
+		v.enum(off, end, path)
+	}
+}
+
+func (v *validator) array(off, end int, path string) {
+	if off == end {
+		v.report(off, ErrInvalidValue, path, "array has no element type")
+		return
+	}
+	et := v.data[off]
+	if !v.typeID(off, et, path, "element type") {
+		return
+	}
+	if intr.IsZeroSize(et) && off+1 < end {
+		v.report(off+1, ErrInvalidValue, path, "%d bytes after the element type, but %v elements take none", end-off-1, TypeID(et))
+		return
+	}
+	for i, p := 0, off+1; p < end; i++ {
+		if p = v.elem(et, p, end, pathIndex(path, i)); p < 0 {
+			return
+		}
+	}
+}
+
+func (v *validator) mapContent(off, end int, path string) {
+	if end-off < 2 {
+		v.report(off, ErrInvalidValue, path, "map has no key/value types")
+		return
+	}
+	kt, vt := v.data[off], v.data[off+1]
+	okK := v.typeID(off, kt, path, "key type")
+	okV := v.typeID(off+1, vt, path, "value type")
+	if !okK || !okV {
+		return
+	}
+	if intr.IsZeroSize(kt) && intr.IsZeroSize(vt) && off+2 < end {
+		v.report(off+2, ErrInvalidValue, path, "%d bytes after the key and value types, but %v entries take none", end-off-2, TypeID(kt))
+		return
+	}
+	seen := make(map[string]int)
+	for i, p := 0, off+2; p < end; i++ {
+		k := p
+		if p = v.elem(kt, p, end, pathIndex(path, i)); p < 0 {
+			return
+		}
+		hdr, _, _ := intr.SplitElem(kt, v.data[k:p])
+		entry := pathKey(path, kt, v.data[k+hdr:p], i)
+		if first, dup := seen[string(v.data[k:p])]; dup {
+			v.report(k, ErrDuplicateMapKey, entry, "duplicate key, first seen at %d", first)
+		} else {
+			seen[string(v.data[k:p])] = k
+		}
+		if p = v.elem(vt, p, end, entry); p < 0 {
+			return
+		}
+	}
+}
+
+func (v *validator) structContent(off, end int, path string) {
+	prev := -1
+	for p := off; p < end; {
+		id := v.data[p]
+		fp := pathField(path, id&0x7F)
+		if id&0x80 != 0 {
+			v.report(p, ErrInvalidFieldID, fp, "field id 0x%02x has top bit set", id)
+		} else {
+			if int(id) <= prev {
+				v.report(p, ErrFieldOrder, fp, "field id %d follows %d", id, prev)
+			}
+			prev = int(id)
+		}
+		p++
+		if p == end {
+			v.overrun(p, end, fp, "field value")
+			return
+		}
+		if p = v.value(p, end, fp); p < 0 {
+			return
+		}
+	}
+}
+
+func (v *validator) enum(off, end int, path string) {
+	if off == end {
+		v.report(off, ErrEnumLengthMismatch, path, "enum has no variant id")
+		return
+	}
+	id := v.data[off]
+	vp := pathVariant(path, id&0x7F)
+	if id&0x80 != 0 {
+		v.report(off, ErrInvalidFieldID, vp, "variant id 0x%02x has top bit set", id)
+	}
+	if off+1 == end {
+		v.report(off+1, ErrEnumLengthMismatch, vp, "enum has no variant value")
+		return
+	}
+	if next := v.value(off+1, end, vp); next >= 0 && next < end {
+		v.report(next, ErrEnumLengthMismatch, vp, "%d bytes after variant value", end-next)
+	}
+}
@@ -0,0 +1,127 @@
+package relish
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+type wantErr struct {
+	kind   ErrorKind
+	offset int64
+	path   string
+}
+
+func checkErrors(t *testing.T, got []*Error, want []wantErr) {
+	t.Helper()
+	if len(got) != len(want) {
+		t.Fatalf("got %d errors, want %d: %v", len(got), len(want), got)
+	}
+	for i, w := range want {
+		g := got[i]
+		if g.Kind != w.kind || g.Offset != w.offset || g.Path != w.path {
+			t.Fatalf("error %d: got (%v, %d, %q) want (%v, %d, %q)", i, g.Kind, g.Offset, g.Path, w.kind, w.offset, w.path)
+		}
+	}
+}
+
+func TestValidate_Valid(t *testing.T) {
+	cases := [][]byte{
+		{0x00},
+		{0x04, 0x2A, 0x00, 0x00, 0x00},
+		{0x11, 0x22, 0x00, 0x04, 0x2A, 0x00, 0x00, 0x00, 0x01, 0x0E, 0x0A, 'h', 'e', 'l', 'l', 'o', 0x05, 0x01, 0xFF},
+		{0x0F, 0x0C, 0x0E, 0x02, 'a', 0x04, 'b', 'c'},
+		{0x10, 0x18, 0x0E, 0x0E, 0x02, 'a', 0x02, 'x', 0x04, 'b', 'b', 0x04, 'y', 'z'},
+		{0x12, 0x0C, 0x00, 0x04, 0x2A, 0x00, 0x00, 0x00},
+		{0x0F, 0x02, 0x00},
+	}
+	for _, c := range cases {
+		if errs := Validate(c); errs != nil {
+			t.Fatalf("Validate(%v) = %v", c, errs)
+		}
+	}
+}
+
+func TestValidate_ReportsEveryViolation(t *testing.T) {
+	data := []byte{
+		0x11, 0x34,
+		0x01, 0x01, 0x7F, // bad bool
+		0x00, 0x0E, 0x02, 0xFF, // out of order, bad utf-8
+		0x83, 0x00, // field id top bit
+		0x05, 0x10, 0x1C, 0x0E, 0x04, // map<string,u32>
+		0x02, 'a', 0x01, 0x00, 0x00, 0x00,
+		0x02, 'a', 0x02, 0x00, 0x00, 0x00, // duplicate key
+	}
+	checkErrors(t, Validate(data), []wantErr{
+		{ErrInvalidValue, 4, ".1"},
+		{ErrFieldOrder, 5, ".0"},
+		{ErrInvalidUTF8, 8, ".0"},
+		{ErrInvalidFieldID, 9, ".3"},
+		{ErrDuplicateMapKey, 22, `.5{"a"}`},
+	})
+}
+
+func TestValidate_Framing(t *testing.T) {
+	// Top-bit type ID inside an array element stops only that array.
+	checkErrors(t, Validate([]byte{0x11, 0x0E, 0x00, 0x0F, 0x02, 0x85, 0x01, 0x01, 0x01}), []wantErr{
+		{ErrInvalidTypeID, 5, ".0"},
+		{ErrInvalidValue, 8, ".1"},
+	})
+	// A nested length that runs past its container is an overflow, one
+	// that runs past the input is truncation.
+	checkErrors(t, Validate([]byte{0x11, 0x06, 0x00, 0x0E, 0x08, 'a', 0x00, 0x00}), []wantErr{
+		{ErrLengthOverflow, 4, ".0"},
+		{ErrTrailingData, 5, ""},
+	})
+	checkErrors(t, Validate([]byte{0x11, 0x0C, 0x00, 0x04, 0x2A}), []wantErr{
+		{ErrUnexpectedEOF, 1, ""},
+	})
+	checkErrors(t, Validate([]byte{0x12, 0x0E, 0x00, 0x04, 0x2A, 0x00, 0x00, 0x00, 0xFF}), []wantErr{
+		{ErrEnumLengthMismatch, 8, "<0>"},
+	})
+	checkErrors(t, Validate([]byte{0x14}), []wantErr{
+		{ErrInvalidTypeID, 0, ""},
+	})
+	// Null elements take no bytes, so nothing may follow their type.
+	checkErrors(t, Validate([]byte{0x0F, 0x04, 0x00, 0x01}), []wantErr{
+		{ErrInvalidValue, 3, ""},
+	})
+	checkErrors(t, Validate([]byte{0x10, 0x06, 0x00, 0x00, 0x01}), []wantErr{
+		{ErrInvalidValue, 4, ""},
+	})
+	if errs := Validate([]byte{0x10, 0x06, 0x00, 0x02, 0x01}); errs != nil {
+		t.Fatalf("map<null,u8> with one entry: %v", errs)
+	}
+}
+
+func TestValidateReader(t *testing.T) {
+	stream := []byte{
+		0x04, 0x01, 0x00, 0x00, 0x00,
+		0x0E, 0x02, 0xC0,
+		0x11, 0x00,
+	}
+	r := bytes.NewReader(stream)
+	var kinds [][]ErrorKind
+	for {
+		errs, err := ValidateReader(r)
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatalf("ValidateReader: %v", err)
+		}
+		var ks []ErrorKind
+		for _, e := range errs {
+			ks = append(ks, e.Kind)
+		}
+		kinds = append(kinds, ks)
+	}
+	if len(kinds) != 3 || kinds[0] != nil || len(kinds[1]) != 1 || kinds[1][0] != ErrInvalidUTF8 || kinds[2] != nil {
+		t.Fatalf("unexpected results %v", kinds)
+	}
+
+	errs, err := ValidateReader(bytes.NewReader([]byte{0x0E, 0x0A, 'h'}))
+	if err != nil || len(errs) != 1 || errs[0].Kind != ErrUnexpectedEOF {
+		t.Fatalf("truncated stream: errs=%v err=%v", errs, err)
+	}
+}
@@ -0,0 +1,300 @@
+// Package vet reports mistakes in relish struct tags that the Encoder and
+// Decoder accept without complaint but that make values encode other than
+// intended:
+//
+//   - a field ID that is not a number, or is outside 0 to 127, which makes
+//     the field untagged;
+//   - two fields of a struct with the same ID;
+//   - a tag option other than optional, omitempty and reserved, or a
+//     field using an ID reserved in its struct;
+//   - optional on a field that is not a pointer, which the Encoder writes
+//     regardless;
+//   - a tag on an unexported field, which the Decoder cannot set;
+//   - a struct type whose encoding never ends because it leads back to
+//     itself through fields the Encoder always writes. A nil pointer in a
+//     field that is neither optional nor omitempty encodes as the zero
+//     value it points to, so such a cycle of pointers recurses forever.
+package vet
+
+import (
+	"fmt"
+	"go/ast"
+	"go/importer"
+	"go/token"
+	"go/types"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/dadrian/relish/gosrc"
+	intr "github.com/dadrian/relish/internal"
+)
+
+// Diagnostic is a problem found at a position in the source.
+type Diagnostic struct {
+	Pos token.Position
+	Msg string
+}
+
+func (d Diagnostic) String() string { return d.Pos.String() + ": " + d.Msg }
+
+// Dir checks the package in dir, leaving out tests.
+func Dir(dir string) ([]Diagnostic, error) {
+	p, err := gosrc.ParseDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	return Check(p.Fset, p.Files)
+}
+
+// Check type-checks files as one package, importing dependencies from
+// source, and returns the problems in its relish tags in source order.
+func Check(fset *token.FileSet, files []*ast.File) ([]Diagnostic, error) {
+	info := &types.Info{
+		Types: make(map[ast.Expr]types.TypeAndValue),
+		Defs:  make(map[*ast.Ident]types.Object),
+	}
+	conf := types.Config{Importer: importer.ForCompiler(fset, "source", nil)}
+	pkg, err := conf.Check(files[0].Name.Name, fset, files, info)
+	if err != nil {
+		return nil, err
+	}
+	c := &checker{fset: fset, info: info, pkg: pkg}
+	for _, f := range files {
+		ast.Inspect(f, func(n ast.Node) bool {
+			if st, ok := n.(*ast.StructType); ok {
+				c.structType(st)
+			}
+			return true
+		})
+	}
+	c.cycles(files)
+	sort.SliceStable(c.diags, func(i, j int) bool {
+		a, b := c.diags[i].Pos, c.diags[j].Pos
+		if a.Filename != b.Filename {
+			return a.Filename < b.Filename
+		}
+		return a.Offset < b.Offset
+	})
+	return c.diags, nil
+}
+
+type checker struct {
+	fset  *token.FileSet
+	info  *types.Info
+	pkg   *types.Package
+	diags []Diagnostic
+}
+
+func (c *checker) reportf(pos token.Pos, format string, args ...any) {
+	c.diags = append(c.diags, Diagnostic{Pos: c.fset.Position(pos), Msg: fmt.Sprintf(format, args...)})
+}
+
+// reservedID stands for a field tagged reserved in the IDs seen in a
+// struct.
+const reservedID = "reserved"
+
+// structType checks the tags of the fields of st.
+func (c *checker) structType(st *ast.StructType) {
+	ids := make(map[int]string)
+	for _, f := range st.Fields.List {
+		if f.Tag == nil {
+			continue
+		}
+		raw, err := strconv.Unquote(f.Tag.Value)
+		if err != nil {
+			continue
+		}
+		tag, ok := reflect.StructTag(raw).Lookup("relish")
+		if !ok || tag == "-" {
+			continue
+		}
+		parts := strings.Split(tag, ",")
+		id, err := strconv.Atoi(parts[0])
+		switch {
+		case err != nil:
+			c.reportf(f.Tag.Pos(), "relish tag: invalid field id %q; the field is not encoded", parts[0])
+			continue
+		case id < 0 || id > 127:
+			c.reportf(f.Tag.Pos(), "relish tag: field id %d out of range 0 to 127; the field is not encoded", id)
+			continue
+		}
+		optional, reserved := false, false
+		for _, o := range parts[1:] {
+			switch strings.TrimSpace(o) {
+			case "optional":
+				optional = true
+			case "reserved":
+				reserved = true
+			case "omitempty":
+			default:
+				c.reportf(f.Tag.Pos(), "relish tag: unknown option %q", o)
+			}
+		}
+		names := fieldNames(f)
+		if reserved {
+			if prev, ok := ids[id]; ok {
+				c.reportf(f.Tag.Pos(), "relish tag: field id %d is reserved but used by %s", id, prev)
+			} else {
+				ids[id] = reservedID
+			}
+			continue
+		}
+		if optional {
+			if _, ok := c.info.TypeOf(f.Type).Underlying().(*types.Pointer); !ok && !isTypeParam(c.info.TypeOf(f.Type)) {
+				c.reportf(f.Tag.Pos(), "relish tag: optional has no effect on %s, which is not a pointer; it is always encoded", strings.Join(names, ", "))
+			}
+		}
+		for _, name := range names {
+			if !token.IsExported(name) {
+				c.reportf(f.Tag.Pos(), "relish tag on unexported field %s, which the Decoder cannot set", name)
+			}
+			if prev, ok := ids[id]; ok && prev == reservedID {
+				c.reportf(f.Tag.Pos(), "relish tag: field id %d of %s is reserved", id, name)
+			} else if ok {
+				c.reportf(f.Tag.Pos(), "relish tag: field id %d of %s already used by %s", id, name, prev)
+			} else {
+				ids[id] = name
+			}
+		}
+	}
+}
+
+// fieldNames returns the names of the fields f declares.
+func fieldNames(f *ast.Field) []string {
+	if len(f.Names) > 0 {
+		names := make([]string, len(f.Names))
+		for i, n := range f.Names {
+			names[i] = n.Name
+		}
+		return names
+	}
+	t := f.Type
+	for {
+		switch x := t.(type) {
+		case *ast.StarExpr:
+			t = x.X
+		case *ast.SelectorExpr:
+			return []string{x.Sel.Name}
+		case *ast.IndexExpr:
+			t = x.X
+		case *ast.IndexListExpr:
+			t = x.X
+		case *ast.Ident:
+			return []string{x.Name}
+		default:
+			return []string{"?"}
+		}
+	}
+}
+
+func isTypeParam(t types.Type) bool {
+	_, ok := t.(*types.TypeParam)
+	return ok
+}
+
+// cycles reports the named struct types declared in files whose encoding
+// never ends, once for each cycle.
+func (c *checker) cycles(files []*ast.File) {
+	reported := make(map[*types.TypeName]bool)
+	for _, f := range files {
+		for _, d := range f.Decls {
+			g, ok := d.(*ast.GenDecl)
+			if !ok || g.Tok != token.TYPE {
+				continue
+			}
+			for _, s := range g.Specs {
+				obj, ok := c.info.Defs[s.(*ast.TypeSpec).Name].(*types.TypeName)
+				if !ok || reported[obj] {
+					continue
+				}
+				named, ok := obj.Type().(*types.Named)
+				if !ok || named.TypeParams().Len() > 0 {
+					continue
+				}
+				if _, ok := named.Underlying().(*types.Struct); !ok {
+					continue
+				}
+				path, via := c.cycle(named)
+				if path == nil {
+					continue
+				}
+				for _, n := range via {
+					reported[n] = true
+				}
+				c.reportf(obj.Pos(), "encoding %s never ends: %s -> %s; make a pointer field on the way optional or omitempty",
+					obj.Name(), strings.Join(path, " -> "), obj.Name())
+			}
+		}
+	}
+}
+
+// cycle returns the fields through which the Encoder, writing a value of
+// type start, always comes to write another, and the named types on the
+// way. It returns nil if there are none.
+func (c *checker) cycle(start *types.Named) (path []string, via []*types.TypeName) {
+	seen := make(map[*types.TypeName]bool)
+	var typ func(t types.Type, name string) bool
+	fields := func(st *types.Struct, name string) bool {
+		for i := 0; i < st.NumFields(); i++ {
+			f := st.Field(i)
+			_, optional, omitempty, ok := intr.ParseRelishTag(reflect.StructField{Tag: reflect.StructTag(st.Tag(i))})
+			if !ok || omitempty {
+				continue
+			}
+			if _, ptr := f.Type().Underlying().(*types.Pointer); optional && ptr {
+				continue
+			}
+			path = append(path, name+"."+f.Name())
+			if typ(f.Type(), name+"."+f.Name()) {
+				return true
+			}
+			path = path[:len(path)-1]
+		}
+		return false
+	}
+	typ = func(t types.Type, name string) bool {
+		for {
+			switch u := types.Unalias(t).(type) {
+			case *types.Named:
+				obj := u.Origin().Obj()
+				if obj == start.Obj() {
+					return true
+				}
+				st, ok := u.Underlying().(*types.Struct)
+				if !ok {
+					t = u.Underlying()
+					continue
+				}
+				if obj.Pkg() != c.pkg || seen[obj] {
+					return false
+				}
+				seen[obj] = true
+				via = append(via, obj)
+				if fields(st, obj.Name()) {
+					return true
+				}
+				via = via[:len(via)-1]
+				return false
+			case *types.Pointer:
+				t = u.Elem()
+			case *types.Array:
+				if u.Len() == 0 {
+					return false
+				}
+				t = u.Elem()
+			case *types.Struct:
+				return fields(u, name)
+			default:
+				return false
+			}
+		}
+	}
+	seen[start.Obj()] = true
+	via = append(via, start.Obj())
+	if !fields(start.Underlying().(*types.Struct), start.Obj().Name()) {
+		return nil, nil
+	}
+	return path, via
+}
@@ -0,0 +1,92 @@
+package vet
+
+import (
+	"go/ast"
+	"go/parser"
+	"go/token"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+const src = `package p
+
+type Good struct {
+	A    int          ` + "`relish:\"0\"`" + `
+	B    *string      ` + "`relish:\"1,optional\"`" + `
+	Self *Good        ` + "`relish:\"2,optional\"`" + `
+	Kids []Good       ` + "`relish:\"3\"`" + `
+	Skip string       ` + "`relish:\"-\"`" + `
+	Tree map[int]Good ` + "`relish:\"4,omitempty\"`" + `
+	note string
+}
+
+type Bad struct {
+	A, B  int    ` + "`relish:\"1\"`" + `
+	C     int    ` + "`relish:\"128\"`" + `
+	D     int    ` + "`relish:\"x\"`" + `
+	E     int    ` + "`relish:\"2,omitemtpy\"`" + `
+	F     string ` + "`relish:\"3,optional\"`" + `
+	g     int    ` + "`relish:\"4\"`" + `
+	Inner struct {
+		X int ` + "`relish:\"0\"`" + `
+		Y int ` + "`relish:\"0\"`" + `
+	} ` + "`relish:\"5\"`" + `
+}
+
+type List struct {
+	Next *List ` + "`relish:\"0\"`" + `
+}
+
+type Tree struct {
+	Root  *Node   ` + "`relish:\"0\"`" + `
+}
+
+type Node struct {
+	Leaves [2]*Tree ` + "`relish:\"0\"`" + `
+}
+
+type Gen[T any] struct {
+	V T ` + "`relish:\"0,optional\"`" + `
+}
+
+type Retired struct {
+	_ struct{} ` + "`relish:\"0,reserved\"`" + `
+	A int      ` + "`relish:\"0\"`" + `
+	B int      ` + "`relish:\"1\"`" + `
+	_ struct{} ` + "`relish:\"1,reserved\"`" + `
+	_ struct{} ` + "`relish:\"2,reserved\"`" + `
+}
+`
+
+func TestCheck(t *testing.T) {
+	fset := token.NewFileSet()
+	f, err := parser.ParseFile(fset, "p.go", src, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	diags, err := Check(fset, []*ast.File{f})
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, d := range diags {
+		got = append(got, d.String())
+	}
+	want := []string{
+		"p.go:14:15: relish tag: field id 1 of B already used by A",
+		"p.go:15:15: relish tag: field id 128 out of range 0 to 127; the field is not encoded",
+		`p.go:16:15: relish tag: invalid field id "x"; the field is not encoded`,
+		`p.go:17:15: relish tag: unknown option "omitemtpy"`,
+		"p.go:18:15: relish tag: optional has no effect on F, which is not a pointer; it is always encoded",
+		"p.go:19:15: relish tag on unexported field g, which the Decoder cannot set",
+		"p.go:22:9: relish tag: field id 0 of Y already used by X",
+		"p.go:26:6: encoding List never ends: List.Next -> List; make a pointer field on the way optional or omitempty",
+		"p.go:30:6: encoding Tree never ends: Tree.Root -> Node.Leaves -> Tree; make a pointer field on the way optional or omitempty",
+		"p.go:44:13: relish tag: field id 0 of A is reserved",
+		"p.go:46:13: relish tag: field id 1 is reserved but used by B",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("Check =\n%s\nwant\n%s", strings.Join(got, "\n"), strings.Join(want, "\n"))
+	}
+}
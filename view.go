@@ -0,0 +1,394 @@
+package relish
+
+import (
+	"bytes"
+	"encoding/binary"
+	"math"
+	"time"
+
+	intr "github.com/dadrian/relish/internal"
+)
+
+// View is a read-only accessor over one encoded value. It holds the
+// value's type and a slice of its content in the original buffer, so
+// navigating into fields, elements and map entries never copies the
+// buffer. Apart from MapLookup, whose key may allocate, the accessors do
+// not allocate. The zero View is invalid and reports false from Valid.
+//
+// Views only check framing as they go; malformed input makes accessors
+// report absence or an error rather than panic. Run Validate first if all
+// of SPEC.md's parsing requirements must hold.
+type View struct {
+	t     TypeID
+	c     []byte
+	valid bool
+}
+
+// NewView returns a View of the single value encoded in data.
+func NewView(data []byte) (View, error) {
+	t, c, rest, err := splitValue(data)
+	if err != nil {
+		return View{}, err
+	}
+	if len(rest) != 0 {
+		return View{}, &Error{Offset: int64(len(data) - len(rest)), Kind: ErrTrailingData, Detail: "data after value"}
+	}
+	return View{t: TypeID(t), c: c, valid: true}, nil
+}
+
+// Valid reports whether v refers to a value.
+func (v View) Valid() bool { return v.valid }
+
+// Type returns the value's type ID.
+func (v View) Type() TypeID { return v.t }
+
+// Content returns the value's content bytes, excluding its type ID and
+// length prefix. The slice aliases the underlying buffer.
+func (v View) Content() []byte { return v.c }
+
+// AppendTLV appends the complete encoding of the value to dst.
+func (v View) AppendTLV(dst []byte) []byte { return appendValue(dst, byte(v.t), v.c) }
+
+// Field returns the struct field with the given ID.
+func (v View) Field(id byte) (View, bool) {
+	if v.t != TypeStruct {
+		return View{}, false
+	}
+	for p := v.c; len(p) > 0 && p[0] <= id; {
+		t, c, rest, err := splitValue(p[1:])
+		if err != nil {
+			return View{}, false
+		}
+		if p[0] == id {
+			return View{t: TypeID(t), c: c, valid: true}, true
+		}
+		p = rest
+	}
+	return View{}, false
+}
+
+// Variant returns an enum's variant ID and value. It returns an invalid
+// View if v is not an enum.
+func (v View) Variant() (byte, View) {
+	if v.t != TypeEnum || len(v.c) == 0 {
+		return 0, View{}
+	}
+	t, c, _, err := splitValue(v.c[1:])
+	if err != nil {
+		return v.c[0], View{}
+	}
+	return v.c[0], View{t: TypeID(t), c: c, valid: true}
+}
+
+// ElemType returns an array's element type, or a map's value type.
+func (v View) ElemType() TypeID {
+	switch {
+	case v.t == TypeArray && len(v.c) >= 1:
+		return TypeID(v.c[0])
+	case v.t == TypeMap && len(v.c) >= 2:
+		return TypeID(v.c[1])
+	}
+	return 0
+}
+
+// KeyType returns a map's key type.
+func (v View) KeyType() TypeID {
+	if v.t == TypeMap && len(v.c) >= 2 {
+		return TypeID(v.c[0])
+	}
+	return 0
+}
+
+// Index returns array element i. Arrays of fixed-size elements are
+// indexed in constant time; others are scanned from the start.
+func (v View) Index(i int) (View, bool) {
+	if v.t != TypeArray || len(v.c) == 0 || i < 0 {
+		return View{}, false
+	}
+	et := v.c[0]
+	elems := v.c[1:]
+	if sz, ok := intr.FixedSize(et); ok {
+		if sz == 0 || i >= len(elems)/sz {
+			return View{}, false
+		}
+		return View{t: TypeID(et), c: elems[i*sz : (i+1)*sz], valid: true}, true
+	}
+	for n := 0; len(elems) > 0; n++ {
+		c, rest, err := splitElem(et, elems)
+		if err != nil {
+			break
+		}
+		if n == i {
+			return View{t: TypeID(et), c: c, valid: true}, true
+		}
+		elems = rest
+	}
+	return View{}, false
+}
+
+// MapLookup returns the value stored under key in a map. The key may be
+// a View or a Go value; Go strings, bools and sized integers are compared
+// in place, and other values are marshaled first. Boxing a non-constant
+// key in an interface may allocate, and marshaling does, so MapLookup is
+// the one accessor that may allocate.
+func (v View) MapLookup(key any) (View, bool) {
+	if v.t != TypeMap || len(v.c) < 2 {
+		return View{}, false
+	}
+	kt, vt := v.c[0], v.c[1]
+	str, isStr := key.(string)
+	var buf [8]byte
+	var want []byte
+	if isStr {
+		if TypeID(kt) != TypeString {
+			return View{}, false
+		}
+	} else {
+		var ok bool
+		if want, ok = appendKeyContent(buf[:0], kt, key); !ok {
+			return View{}, false
+		}
+	}
+	for p := v.c[2:]; len(p) > 0; {
+		kc, vc, rest, err := splitEntry(kt, vt, p)
+		if err != nil {
+			break
+		}
+		if isStr && string(kc) == str || !isStr && bytes.Equal(kc, want) {
+			return View{t: TypeID(vt), c: vc, valid: true}, true
+		}
+		p = rest
+	}
+	return View{}, false
+}
+
+// appendKeyContent appends the content encoding of key, as a map key of
+// type kt, to dst. It reports false if key cannot be a key of that type.
+func appendKeyContent(dst []byte, kt byte, key any) ([]byte, bool) {
+	le := binary.LittleEndian
+	switch k := key.(type) {
+	case View:
+		return append(dst, k.c...), byte(k.t) == kt
+	case string:
+		return append(dst, k...), TypeID(kt) == TypeString
+	case bool:
+		if k {
+			return append(dst, 0xFF), TypeID(kt) == TypeBool
+		}
+		return append(dst, 0x00), TypeID(kt) == TypeBool
+	case uint8:
+		return append(dst, k), TypeID(kt) == TypeU8
+	case int8:
+		return append(dst, byte(k)), TypeID(kt) == TypeI8
+	case uint16:
+		return le.AppendUint16(dst, k), TypeID(kt) == TypeU16
+	case int16:
+		return le.AppendUint16(dst, uint16(k)), TypeID(kt) == TypeI16
+	case uint32:
+		return le.AppendUint32(dst, k), TypeID(kt) == TypeU32
+	case int32:
+		return le.AppendUint32(dst, uint32(k)), TypeID(kt) == TypeI32
+	case uint64:
+		return le.AppendUint64(dst, k), TypeID(kt) == TypeU64
+	case int64:
+		return le.AppendUint64(dst, uint64(k)), TypeID(kt) == TypeI64
+	}
+	b, err := Marshal(key)
+	if err != nil {
+		return nil, false
+	}
+	t, c, _, err := splitValue(b)
+	return append(dst, c...), err == nil && t == kt
+}
+
+// Len returns the number of elements of an array, entries of a map,
+// fields of a struct or bytes of a string. It returns 0 for other types.
+func (v View) Len() int {
+	switch v.t {
+	case TypeString:
+		return len(v.c)
+	case TypeArray:
+		if len(v.c) == 0 {
+			return 0
+		}
+		if sz, ok := intr.FixedSize(v.c[0]); ok {
+			if sz == 0 {
+				return 0
+			}
+			return (len(v.c) - 1) / sz
+		}
+		return len(splitElems(v.c[0], v.c[1:]))
+	case TypeMap:
+		if len(v.c) < 2 {
+			return 0
+		}
+		return countPairs(v.c[0], v.c[1], v.c[2:])
+	case TypeStruct:
+		n := 0
+		for p := v.c; len(p) > 0; n++ {
+			_, _, rest, err := splitValue(p[1:])
+			if err != nil {
+				break
+			}
+			p = rest
+		}
+		return n
+	}
+	return 0
+}
+
+// fixed returns the content of a fixed-size value of type t.
+func (v View) fixed(t TypeID) ([]byte, error) {
+	if v.t != t {
+		return nil, &Error{Kind: ErrTypeMismatch, Detail: "value is " + v.t.String() + ", not " + t.String()}
+	}
+	if sz, _ := intr.FixedSize(byte(t)); len(v.c) != sz {
+		return nil, &Error{Kind: ErrUnexpectedEOF, Detail: "short " + t.String()}
+	}
+	return v.c, nil
+}
+
+// Bool returns the value of a bool.
+func (v View) Bool() (bool, error) {
+	c, err := v.fixed(TypeBool)
+	if err != nil {
+		return false, err
+	}
+	switch c[0] {
+	case 0x00:
+		return false, nil
+	case 0xFF:
+		return true, nil
+	}
+	return false, &Error{Kind: ErrInvalidValue, Detail: "invalid bool value"}
+}
+
+// U8 returns the value of a u8.
+func (v View) U8() (uint8, error) {
+	c, err := v.fixed(TypeU8)
+	if err != nil {
+		return 0, err
+	}
+	return c[0], nil
+}
+
+// U16 returns the value of a u16.
+func (v View) U16() (uint16, error) {
+	c, err := v.fixed(TypeU16)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint16(c), nil
+}
+
+// U32 returns the value of a u32.
+func (v View) U32() (uint32, error) {
+	c, err := v.fixed(TypeU32)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint32(c), nil
+}
+
+// U64 returns the value of a u64.
+func (v View) U64() (uint64, error) {
+	c, err := v.fixed(TypeU64)
+	if err != nil {
+		return 0, err
+	}
+	return binary.LittleEndian.Uint64(c), nil
+}
+
+// U128 returns the value of a u128.
+func (v View) U128() (U128, error) {
+	c, err := v.fixed(TypeU128)
+	if err != nil {
+		return U128{}, err
+	}
+	return U128(c), nil
+}
+
+// I8 returns the value of an i8.
+func (v View) I8() (int8, error) {
+	c, err := v.fixed(TypeI8)
+	if err != nil {
+		return 0, err
+	}
+	return int8(c[0]), nil
+}
+
+// I16 returns the value of an i16.
+func (v View) I16() (int16, error) {
+	c, err := v.fixed(TypeI16)
+	if err != nil {
+		return 0, err
+	}
+	return int16(binary.LittleEndian.Uint16(c)), nil
+}
+
+// I32 returns the value of an i32.
+func (v View) I32() (int32, error) {
+	c, err := v.fixed(TypeI32)
+	if err != nil {
+		return 0, err
+	}
+	return int32(binary.LittleEndian.Uint32(c)), nil
+}
+
+// I64 returns the value of an i64.
+func (v View) I64() (int64, error) {
+	c, err := v.fixed(TypeI64)
+	if err != nil {
+		return 0, err
+	}
+	return int64(binary.LittleEndian.Uint64(c)), nil
+}
+
+// I128 returns the value of an i128.
+func (v View) I128() (I128, error) {
+	c, err := v.fixed(TypeI128)
+	if err != nil {
+		return I128{}, err
+	}
+	return I128(c), nil
+}
+
+// F32 returns the value of an f32.
+func (v View) F32() (float32, error) {
+	c, err := v.fixed(TypeF32)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float32frombits(binary.LittleEndian.Uint32(c)), nil
+}
+
+// F64 returns the value of an f64.
+func (v View) F64() (float64, error) {
+	c, err := v.fixed(TypeF64)
+	if err != nil {
+		return 0, err
+	}
+	return math.Float64frombits(binary.LittleEndian.Uint64(c)), nil
+}
+
+// Time returns the value of a timestamp, in UTC.
+func (v View) Time() (time.Time, error) {
+	c, err := v.fixed(TypeTimestamp)
+	if err != nil {
+		return time.Time{}, err
+	}
+	sec := binary.LittleEndian.Uint64(c)
+	if sec > math.MaxInt64 {
+		return time.Time{}, &Error{Kind: ErrInvalidValue, Detail: "timestamp out of range"}
+	}
+	return time.Unix(int64(sec), 0).UTC(), nil
+}
+
+// Str returns the value of a string. It allocates the returned string;
+// use Content to read the bytes in place.
+func (v View) Str() (string, error) {
+	if v.t != TypeString {
+		return "", &Error{Kind: ErrTypeMismatch, Detail: "value is " + v.t.String() + ", not string"}
+	}
+	return string(v.c), nil
+}
@@ -0,0 +1,107 @@
+package relish
+
+import (
+	"testing"
+	"time"
+)
+
+func TestView(t *testing.T) {
+	type Item struct {
+		Sku string `relish:"0"`
+		Qty uint32 `relish:"1"`
+	}
+	type Shape struct {
+		Circle *uint32 `relish:"0,optional"`
+		Rect   *string `relish:"1,optional"`
+	}
+	type Msg struct {
+		ID     uint64           `relish:"0"`
+		Scores []uint16         `relish:"1"`
+		Items  []Item           `relish:"2"`
+		Attrs  map[string]int32 `relish:"3"`
+		Shape  Shape            `relish:"4"`
+		At     time.Time        `relish:"5"`
+	}
+	at := time.Unix(1700000000, 0).UTC()
+	data, err := Marshal(Msg{
+		ID:     7,
+		Scores: []uint16{10, 20, 30},
+		Items:  []Item{{"a", 1}, {"b", 2}},
+		Attrs:  map[string]int32{"x": -1},
+		Shape:  Shape{Rect: ptr("wide")},
+		At:     at,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	v, err := NewView(data)
+	if err != nil {
+		t.Fatalf("NewView: %v", err)
+	}
+	if v.Type() != TypeStruct || v.Len() != 6 {
+		t.Fatalf("root: type %v len %d", v.Type(), v.Len())
+	}
+	id, _ := v.Field(0)
+	if n, err := id.U64(); err != nil || n != 7 {
+		t.Fatalf("ID = %d, %v", n, err)
+	}
+	scores, _ := v.Field(1)
+	if s, ok := scores.Index(2); !ok {
+		t.Fatalf("Scores[2] missing")
+	} else if n, _ := s.U16(); n != 30 {
+		t.Fatalf("Scores[2] = %d", n)
+	}
+	if _, ok := scores.Index(3); ok {
+		t.Fatalf("Scores[3] should be out of range")
+	}
+	items, _ := v.Field(2)
+	item, _ := items.Index(1)
+	sku, _ := item.Field(0)
+	if s, err := sku.Str(); err != nil || s != "b" {
+		t.Fatalf("Items[1].Sku = %q, %v", s, err)
+	}
+	attrs, _ := v.Field(3)
+	if x, ok := attrs.MapLookup("x"); !ok {
+		t.Fatalf("Attrs[x] missing")
+	} else if n, _ := x.I32(); n != -1 {
+		t.Fatalf("Attrs[x] = %d", n)
+	}
+	if _, ok := attrs.MapLookup("y"); ok {
+		t.Fatalf("Attrs[y] should be missing")
+	}
+	shape, _ := v.Field(4)
+	vid, rect := shape.Variant()
+	if s, _ := rect.Str(); vid != 1 || s != "wide" {
+		t.Fatalf("Shape = %d %q", vid, s)
+	}
+	ts, _ := v.Field(5)
+	if got, err := ts.Time(); err != nil || !got.Equal(at) {
+		t.Fatalf("At = %v, %v", got, err)
+	}
+	if _, err := id.U32(); err == nil {
+		t.Fatalf("expected type mismatch reading u64 as u32")
+	}
+	if _, ok := v.Field(9); ok {
+		t.Fatalf("field 9 should be missing")
+	}
+
+	allocs := testing.AllocsPerRun(100, func() {
+		f, _ := v.Field(1)
+		e, _ := f.Index(1)
+		_, _ = e.U16()
+		m, _ := v.Field(3)
+		_, _ = m.MapLookup("x")
+	})
+	if allocs != 0 {
+		t.Fatalf("View accessors allocated %v times", allocs)
+	}
+}
+
+func TestNewView_Errors(t *testing.T) {
+	if _, err := NewView([]byte{0x0E, 0x0A, 'h'}); err == nil {
+		t.Fatalf("expected error for truncated value")
+	}
+	if _, err := NewView([]byte{0x00, 0x00}); err == nil {
+		t.Fatalf("expected error for trailing data")
+	}
+}